@@ -0,0 +1,14 @@
+-- Finished orchestrator jobs evicted from memory by the retention policy
+-- data: the full job as served by GET /api/v1/jobs/:id
+
+CREATE TABLE orchestrator_job_archive (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    data JSONB NOT NULL
+);
+
+-- Index for purging by completion time
+CREATE INDEX idx_orchestrator_job_archive_completed_at ON orchestrator_job_archive(completed_at);
@@ -0,0 +1,20 @@
+-- Daily per-project aggregates of finished orchestrator jobs, written after
+-- each day ends (UTC) so reports need not scan the job archive. Sums rather
+-- than averages are kept so days can be combined into weeks and months.
+
+CREATE TABLE orchestrator_job_rollups (
+    project_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    total INTEGER NOT NULL,
+    completed INTEGER NOT NULL,
+    failed INTEGER NOT NULL,
+    cancelled INTEGER NOT NULL,
+    attempts INTEGER NOT NULL,
+    duration_seconds DOUBLE PRECISION NOT NULL,
+    max_duration_seconds DOUBLE PRECISION NOT NULL,
+    run_seconds DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (day, project_id)
+);
+
+-- Index for a project's reports
+CREATE INDEX idx_orchestrator_job_rollups_project_day ON orchestrator_job_rollups(project_id, day);
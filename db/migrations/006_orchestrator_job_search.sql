@@ -0,0 +1,15 @@
+-- Full-text search over archived orchestrator jobs, for
+-- GET /api/v1/jobs/search: their prompts, ticket titles and descriptions
+-- and error messages
+
+ALTER TABLE orchestrator_job_archive ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    to_tsvector('english'::regconfig,
+        coalesce(data->>'prompt', '') || ' ' ||
+        coalesce(data->>'ticket_title', '') || ' ' ||
+        coalesce(data->>'ticket_description', '') || ' ' ||
+        coalesce(data->>'error_message', '') || ' ' ||
+        coalesce(data->'result'->>'error', ''))
+) STORED;
+
+-- Index for matching search queries
+CREATE INDEX idx_orchestrator_job_archive_search ON orchestrator_job_archive USING GIN (search);
@@ -0,0 +1,19 @@
+-- Job search matches the words of a query anywhere in an archived job's
+-- text, in any case, as it does for jobs still held in memory, rather than
+-- by English word stems. Trigram indexes serve the LIKE patterns.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE orchestrator_job_archive DROP COLUMN search;
+
+ALTER TABLE orchestrator_job_archive ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+    lower(
+        coalesce(data->>'prompt', '') || E'\n' ||
+        coalesce(data->>'ticket_title', '') || E'\n' ||
+        coalesce(data->>'ticket_description', '') || E'\n' ||
+        coalesce(data->>'error_message', '') || E'\n' ||
+        coalesce(data->'result'->>'error', ''))
+) STORED;
+
+-- Index for matching search queries
+CREATE INDEX idx_orchestrator_job_archive_search_text ON orchestrator_job_archive USING GIN (search_text gin_trgm_ops);
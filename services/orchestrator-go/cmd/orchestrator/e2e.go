@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/e2e"
+)
+
+// runE2E runs the end-to-end scenarios, each against this binary serving
+// a fake GitHub, and reports which failed
+func runE2E(args []string) int {
+	fs := flag.NewFlagSet("e2e", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: orchestrator e2e [flags]
+
+Runs end-to-end scenarios: for each, starts this binary against a fake GitHub
+API and temporary git repositories, submits jobs through the API and checks
+their dispatch, callbacks and pull requests. Needs git, but no GitHub
+credentials, database or network access.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	run := fs.String("run", "", "run only the scenarios whose name matches this regular expression")
+	timeout := fs.Duration("timeout", 2*time.Minute, "bound on each scenario")
+	verbose := fs.Bool("v", false, "print the orchestrator's logs of every scenario, not only failed ones")
+	keep := fs.Bool("keep", false, "keep each scenario's temporary directory")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "e2e: invalid -run:", err)
+		return 2
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "e2e:", err)
+		return 1
+	}
+
+	failed := 0
+	for _, scenario := range e2e.Scenarios {
+		if !filter.MatchString(scenario.Name) {
+			continue
+		}
+		var logs bytes.Buffer
+		var output io.Writer = &logs
+		if *verbose {
+			output = os.Stderr
+		}
+
+		start := time.Now()
+		err := runScenario(scenario, e2e.Options{Binary: binary, Env: scenario.Env, Output: output, KeepDir: *keep}, *timeout)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			failed++
+			fmt.Printf("--- FAIL: %s (%s)\n    %v\n", scenario.Name, elapsed, err)
+			if !*verbose {
+				os.Stderr.Write(logs.Bytes())
+			}
+			continue
+		}
+		fmt.Printf("--- PASS: %s (%s)\n", scenario.Name, elapsed)
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d scenarios failed\n", failed)
+		return 1
+	}
+	fmt.Println("PASS")
+	return 0
+}
+
+func runScenario(scenario e2e.Scenario, opts e2e.Options, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	h, err := e2e.Start(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	if opts.KeepDir {
+		fmt.Printf("    %s: %s\n", scenario.Name, h.Dir)
+	}
+	return scenario.Run(ctx, h)
+}
@@ -2,24 +2,107 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/api"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/archive"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/awsauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/bitbucket"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/delivery"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/egress"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/executor"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/federation"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitlab"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/health"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/jira"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/jobtoken"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/leader"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/linear"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/localexec"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/memory"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/worktree"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// The processes the binary runs as. serve does everything in one process;
+// a deployment may instead split it into api processes serving the API and
+// worker processes dispatching the jobs submitted through them.
+const (
+	modeServe  = "serve"
+	modeAPI    = "api"
+	modeWorker = "worker"
+)
+
+const usage = `Usage: orchestrator [command] [flags]
+
+serve, api and worker take -config <file> to read settings from a YAML
+config file (CONFIG_FILE), under those of the environment.
+
+Commands:
+  serve      serve the API and dispatch jobs (default)
+  api        serve the API, leaving dispatching to workers
+  worker     dispatch jobs, serving only health, metrics, callbacks and webhooks
+             -executors local,docker  run only these executors' jobs
+             -no-http                 serve nothing; runs only local and docker jobs
+  migrate    create the database tables and exit
+  simulate   replay job arrivals against other worker counts and strategies
+  e2e        run end-to-end scenarios against a fake GitHub
+`
+
 func main() {
-	// Load .env file if it exists
+	mode := modeServe
+	var runOnly []string
+	var noHTTP bool
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			os.Exit(runSimulate(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "e2e":
+			os.Exit(runE2E(os.Args[2:]))
+		case modeWorker:
+			mode = modeWorker
+			runOnly, noHTTP = parseWorkerFlags(os.Args[2:])
+		case modeServe, modeAPI:
+			mode = os.Args[1]
+			fs := flag.NewFlagSet(mode, flag.ExitOnError)
+			configFlag(fs)
+			fs.Parse(os.Args[2:])
+		case "-h", "-help", "--help", "help":
+			fmt.Print(usage)
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+			os.Exit(2)
+		}
+	}
+
+	// Load .env file if it exists. Variables set when the process started
+	// take precedence over it, on reloads too.
+	launchEnv := envNames()
 	godotenv.Load()
 
 	// Setup logging
@@ -33,8 +116,21 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
+	setLogLevel(cfg.LogLevel)
+	if cfg.File != "" {
+		log.Info().Str("file", cfg.File).Int("projects", len(cfg.Projects)).Msg("Read config file")
+	}
+	if len(cfg.Secrets.Referenced) > 0 {
+		log.Info().Strs("settings", cfg.Secrets.Referenced).Msg("Read settings from secrets backend")
+	}
+
+	// API and worker processes find each other's jobs in the shared queue
+	if mode != modeServe && cfg.Queue.Backend == "memory" {
+		log.Fatal().Str("mode", mode).Msg("The api and worker commands require a shared QUEUE_BACKEND such as redis")
+	}
 
 	log.Info().
+		Str("mode", mode).
 		Str("env", cfg.Env).
 		Int("port", cfg.Server.Port).
 		Int("max_parallel", cfg.Queue.MaxParallelJobs).
@@ -44,38 +140,278 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+
 	// Initialize worktree manager
 	worktreeManager := worktree.NewManager(cfg.Worktree)
 	defer worktreeManager.Cleanup()
 
 	// Initialize queue manager
-	queueManager := queue.NewManager(cfg.Queue, worktreeManager)
+	queueBackend, err := queue.NewBackend(cfg.Queue, cfg.Redis)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize queue backend")
+	}
+	githubClient, err := github.NewClient(cfg.GitHub)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize GitHub client")
+	}
+	if !githubClient.Configured() && cfg.Executor.Type == "github_actions" {
+		log.Warn().Msg("GitHub App credentials not configured, jobs cannot be dispatched")
+	}
+	deliverer := delivery.NewDeliverer(cfg.Delivery)
+	projects := project.NewRegistry()
+	applyProjects(projects, cfg.Projects)
+	// Projects are hosted on GitHub unless their settings select GitLab or
+	// Bitbucket
+	gitlabClient := gitlab.NewClient(cfg.GitLab, cfg.GitHub.CallbackURL)
+	bitbucketClient := bitbucket.NewClient(cfg.Bitbucket, cfg.GitHub.CallbackURL)
+	providers := scm.NewRegistry(projects, githubClient, gitlabClient, bitbucketClient)
+	queueManager := queue.NewManager(cfg.Queue, queueBackend, worktreeManager, githubClient, deliverer, projects)
+	worktreeManager.SetQuotaHandler(queueManager.HandleWorktreeOverQuota)
+	worktreeManager.SetProviders(providers)
+	queueManager.SetProviders(providers)
+	worktreeManager.SetProjects(projects)
+	go worktreeManager.Start(ctx)
+
+	// User-facing messages are rendered in each project's locale
+	catalog, err := messages.Load(cfg.Messages.Dir, cfg.Messages.DefaultLocale)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load message catalog")
+	}
+	queueManager.SetMessages(catalog)
+
+	// Besides GitHub Actions, agents can run in GitLab or Bitbucket
+	// pipelines, on this host or in Kubernetes; projects may select any
+	// executor that is available
+	executors := []executor.Executor{}
+	if gitlabClient.CanTrigger() {
+		executors = append(executors, executor.NewGitLabCI(gitlabClient))
+	}
+	if bitbucketClient.Configured() {
+		executors = append(executors, executor.NewBitbucketPipelines(bitbucketClient, queueManager.RecordRun))
+	}
+	var egressProxy *egress.Proxy
+	if cfg.Executor.DockerEgressProxyListen != "" {
+		egressProxy, err = egress.NewProxy(cfg.Executor.DockerEgressProxyURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid DOCKER_EGRESS_PROXY_URL")
+		}
+		go func() {
+			log.Info().Msgf("Egress proxy listening on %s", cfg.Executor.DockerEgressProxyListen)
+			if err := http.ListenAndServe(cfg.Executor.DockerEgressProxyListen, egressProxy); err != nil {
+				log.Fatal().Err(err).Msg("Egress proxy failed")
+			}
+		}()
+	}
+	for _, kind := range []string{models.ExecutorLocal, models.ExecutorDocker} {
+		execCfg := cfg.Executor
+		execCfg.Type = kind
+		runner := localexec.NewRunner(execCfg, providers, projects)
+		runner.SetEgressProxy(egressProxy)
+		runner.SetMessages(catalog)
+		executors = append(executors, executor.NewLocal(runner))
+	}
+	if k8s, err := executor.NewKubernetes(cfg.Executor, cfg.GitHub, projects); err != nil {
+		if cfg.Executor.Type == models.ExecutorKubernetes {
+			log.Fatal().Err(err).Msg("Failed to set up the kubernetes executor")
+		}
+		log.Debug().Err(err).Msg("Kubernetes executor unavailable")
+	} else {
+		executors = append(executors, k8s)
+	}
+	if err := queueManager.SetExecutors(cfg.Executor.Type, executors...); err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up executors")
+	}
+	if runOnly != nil {
+		if err := queueManager.RunOnly(runOnly...); err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up executors")
+		}
+		log.Info().Strs("executors", runOnly).Msg("Running only the jobs of these executors")
+	}
+	log.Info().Str("executor", cfg.Executor.Type).Msg("Default executor selected")
+
+	signingKey := []byte(cfg.GitHub.CallbackSigningKey)
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate callback signing key")
+		}
+		log.Warn().Msg("GITHUB_CALLBACK_SIGNING_KEY not set, callbacks from runs dispatched before a restart or by another instance will be rejected")
+	}
+	callbackTokens := jobtoken.NewIssuer(signingKey, cfg.GitHub.CallbackTokenTTL)
+	queueManager.SetCallbackTokens(callbackTokens)
+	if cfg.GitHub.JobCredentials {
+		queueManager.SetRepoTokens()
+		log.Info().Msg("Minting repository-scoped installation tokens per run")
+	}
+	if cfg.MemoryService.Enabled {
+		queueManager.SetMemory(memory.NewClient(cfg.MemoryService))
+		log.Info().Str("url", cfg.MemoryService.URL).Msg("Memory service enabled")
+	}
+
+	// Projects that select an issue tracker have their tickets follow their
+	// jobs
+	var trackers []queue.Tracker
+	jiraClient := jira.NewClient(cfg.Jira)
+	if jiraClient.Configured() {
+		trackers = append(trackers, jiraClient)
+		log.Info().Str("url", cfg.Jira.URL).Msg("Jira issue updates enabled")
+	}
+	linearClient := linear.NewClient(cfg.Linear)
+	if linearClient.Configured() {
+		trackers = append(trackers, linearClient)
+		log.Info().Msg("Linear issue updates enabled")
+	}
+	queueManager.SetTrackers(trackers...)
+
+	var pool *pgxpool.Pool
+	var databaseCreds *rotatingCredentials
+	if cfg.Leader.Enabled || cfg.Queue.ArchiveJobs || cfg.Queue.RollupsEnabled {
+		pool, databaseCreds, err = newPool(ctx, cfg.Database.URL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create database pool")
+		}
+		defer pool.Close()
+	}
+
+	// Finished jobs evicted from memory are kept in Postgres
+	if cfg.Queue.ArchiveJobs {
+		queueManager.SetArchiver(archive.NewPostgresArchive(pool))
+	}
+	// Finished days are rolled up per project for reports
+	if cfg.Queue.RollupsEnabled {
+		queueManager.SetRollupStore(archive.NewPostgresRollups(pool))
+	}
+
+	// Job logs are kept on disk or in S3 so they outlive the workflow run
+	logStore, err := joblog.New(cfg.JobLog, awsauth.Credentials{
+		AccessKeyID:     cfg.Delivery.AWSAccessKeyID,
+		SecretAccessKey: cfg.Delivery.AWSSecretAccessKey,
+		SessionToken:    cfg.Delivery.AWSSessionToken,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize job log store")
+	}
+	if logStore != nil {
+		queueManager.SetLogStore(logStore, cfg.JobLog)
+	}
+
+	// Only the elected leader dispatches when several instances share a
+	// queue, and API processes never do
+	if mode == modeAPI {
+		queueManager.SetLeader(neverLeader{})
+	} else if cfg.Leader.Enabled {
+		if mode == modeWorker {
+			log.Warn().Msg("LEADER_ELECTION_ENABLED lets only one worker dispatch; workers claim jobs from the shared queue without it")
+		}
+		elector := leader.NewElector(cfg.Leader, pool)
+		queueManager.SetLeader(elector)
+		go elector.Run(ctx)
+	}
+
 	go queueManager.Start(ctx)
 
-	// Initialize HTTP server
-	router := api.NewRouter(cfg, queueManager, worktreeManager)
+	// Initialize federation with downstream orchestrators
+	fed, err := federation.NewRouter(cfg.Federation)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize federation")
+	}
+
+	// The health check probes the dependencies this process uses; it is not
+	// ready to take traffic without its queue and database
+	checks := health.NewChecker(cfg.Server.HealthCheckTimeout, cfg.Server.HealthCheckCacheTTL)
+	checks.AddReadiness("queue", queueManager.CheckBackend)
+	if pool != nil {
+		checks.AddReadiness("database", pool.Ping)
+	}
+	if githubClient.Configured() {
+		checks.Add("github", githubClient.Ping)
+	}
+	checks.Add("worktrees", func(ctx context.Context) error {
+		return worktreeManager.CheckBasePath(cfg.Server.HealthMinFreeDiskBytes)
+	})
+
+	// SIGHUP and the admin API reload the settings that can change without
+	// losing the in-memory queue
+	reloader := config.NewReloader(cfg, func() (*config.Config, error) {
+		reloadDotEnv(launchEnv)
+		return config.Load()
+	})
+	reloader.OnReload(func(c *config.Config) { setLogLevel(c.LogLevel) })
+	reloader.OnReload(func(c *config.Config) { queueManager.Reload(c.Queue) })
+	reloader.OnReload(func(c *config.Config) { worktreeManager.Reload(c.Worktree) })
+	reloader.OnReload(func(c *config.Config) { deliverer.SetProjectDestinations(c.Delivery.ProjectDestinations) })
+	reloader.OnReload(func(c *config.Config) { applyProjects(projects, c.Projects) })
+	reloader.OnReload(func(c *config.Config) { jiraClient.SetConfig(c.Jira) })
+	reloader.OnReload(func(c *config.Config) { linearClient.SetConfig(c.Linear) })
+	reloader.OnReload(func(c *config.Config) {
+		if err := githubClient.SetPrivateKey(c.GitHub); err != nil {
+			log.Error().Err(err).Msg("Failed to reload GitHub private key, keeping the current one")
+		}
+	})
+	reloader.OnReload(func(c *config.Config) {
+		if c.GitHub.CallbackSigningKey != "" {
+			callbackTokens.Rotate([]byte(c.GitHub.CallbackSigningKey))
+		}
+	})
+	if databaseCreds != nil {
+		reloader.OnReload(func(c *config.Config) { databaseCreds.set(c.Database.URL) })
+	}
+	go reloadOnHangup(ctx, reloader)
+	if cfg.Secrets.RefreshInterval > 0 {
+		go refreshSecrets(ctx, reloader, cfg.Secrets.RefreshInterval)
+	}
+
+	// Initialize HTTP server. Workers serve what runs and probes need, and
+	// leave the API to the api processes.
+	router := api.NewRouter(cfg, queueManager, worktreeManager, fed, projects, checks, reloader)
+	if mode == modeWorker {
+		router = api.NewWorkerRouter(cfg, queueManager, worktreeManager, fed, projects, checks, reloader)
+	}
 
 	server := &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:        fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler:     router,
+		ReadTimeout: cfg.Server.ReadTimeout,
+		IdleTimeout: cfg.Server.IdleTimeout,
+		// Write deadlines are set per route group so streams can stay open
+		WriteTimeout: 0,
 	}
 
 	// Start server in goroutine
-	go func() {
-		log.Info().Msgf("Server listening on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal().Err(err).Msg("Server failed")
-		}
-	}()
+	if !noHTTP {
+		go func() {
+			log.Info().Msgf("Server listening on %s", server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Msg("Server failed")
+			}
+		}()
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Let dispatched jobs report back before this instance goes away
+	if cfg.Server.DrainTimeout > 0 {
+		log.Info().Dur("timeout", cfg.Server.DrainTimeout).Msg("Draining before shutdown...")
+		queueManager.Drain()
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+		status := queueManager.WaitDrained(drainCtx)
+		drainCancel()
+		if !status.Drained {
+			log.Warn().
+				Int("running_jobs", status.RunningJobs).
+				Int("pending_results", status.PendingResults).
+				Int("pending_deliveries", status.PendingDeliveries).
+				Msg("Drain timed out, shutting down with work in flight")
+		}
+	}
+
 	log.Info().Msg("Shutting down server...")
 
 	// Give outstanding requests 30 seconds to complete
@@ -85,6 +421,174 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
 
 	log.Info().Msg("Server exited")
 }
+
+// configFlag adds the -config flag, which sets CONFIG_FILE
+func configFlag(fs *flag.FlagSet) {
+	fs.Func("config", "read settings from this YAML file, under the environment's (CONFIG_FILE)", func(path string) error {
+		return os.Setenv("CONFIG_FILE", path)
+	})
+}
+
+// applyProjects sets the projects of the config file, keeping whether each
+// is archived. Projects set through the API and not in the file are left.
+func applyProjects(registry *project.Registry, projects []models.ProjectSettings) {
+	for _, settings := range projects {
+		current, _ := registry.Get(settings.ProjectID)
+		settings.ArchivedAt = current.ArchivedAt
+		registry.Put(settings)
+	}
+}
+
+// envNames returns the names of the variables in the environment
+func envNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		names[name] = true
+	}
+	return names
+}
+
+// reloadDotEnv reads the .env file again, leaving the variables set when
+// the process started. Variables removed from the file keep their value.
+func reloadDotEnv(launchEnv map[string]bool) {
+	values, err := godotenv.Read()
+	if err != nil {
+		return
+	}
+	for name, value := range values {
+		if !launchEnv[name] {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// setLogLevel sets the least severe level logged; the level was validated
+// with the configuration
+func setLogLevel(level string) {
+	if parsed, err := zerolog.ParseLevel(level); err == nil {
+		zerolog.SetGlobalLevel(parsed)
+	}
+}
+
+// reloadOnHangup reloads the configuration on every SIGHUP until ctx is
+// cancelled
+func reloadOnHangup(ctx context.Context, reloader *config.Reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			changed, err := reloader.Reload()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to reload configuration, keeping the current one")
+				continue
+			}
+			log.Info().Strs("changed", changed).Msg("Configuration reloaded")
+		}
+	}
+}
+
+// refreshSecrets reloads the configuration every interval, so secrets
+// rotated in a secrets backend take effect, until ctx is cancelled
+func refreshSecrets(ctx context.Context, reloader *config.Reloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := reloader.Reload()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to refresh secrets, keeping the current configuration")
+				continue
+			}
+			if len(changed) > 0 {
+				log.Info().Strs("changed", changed).Msg("Configuration reloaded with refreshed secrets")
+			}
+		}
+	}
+}
+
+// rotatingCredentials are the database credentials new connections log in
+// with, replaced when DATABASE_URL changes on a reload. Open connections
+// keep theirs until the pool recycles them.
+type rotatingCredentials struct {
+	current atomic.Pointer[pgx.ConnConfig]
+}
+
+// set takes the credentials of url; a URL that does not parse is ignored
+func (r *rotatingCredentials) set(url string) {
+	connCfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse reloaded DATABASE_URL, keeping the current credentials")
+		return
+	}
+	r.current.Store(connCfg)
+}
+
+// newPool creates a database pool whose new connections use the latest
+// credentials given to the returned rotatingCredentials
+func newPool(ctx context.Context, url string) (*pgxpool.Pool, *rotatingCredentials, error) {
+	poolCfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	creds := &rotatingCredentials{}
+	creds.current.Store(poolCfg.ConnConfig)
+	poolCfg.BeforeConnect = func(ctx context.Context, connCfg *pgx.ConnConfig) error {
+		latest := creds.current.Load()
+		connCfg.User, connCfg.Password = latest.User, latest.Password
+		return nil
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool, creds, nil
+}
+
+// neverLeader keeps API processes from dispatching, as followers of workers
+type neverLeader struct{}
+
+func (neverLeader) IsLeader() bool { return false }
+
+// parseWorkerFlags reads the flags of the worker command: the executors
+// whose jobs it runs, and whether it serves nothing. Without HTTP, results
+// can only come from executors that run the agent in this process.
+func parseWorkerFlags(args []string) (runOnly []string, noHTTP bool) {
+	fs := flag.NewFlagSet(modeWorker, flag.ExitOnError)
+	configFlag(fs)
+	executors := fs.String("executors", "", "comma-separated executors whose jobs this worker runs (default all)")
+	fs.BoolVar(&noHTTP, "no-http", false, "serve nothing; only local and docker jobs are run, as they need no callbacks or webhooks")
+	fs.Parse(args)
+
+	if *executors != "" {
+		runOnly = strings.Split(*executors, ",")
+	}
+	if !noHTTP {
+		return runOnly, false
+	}
+	if runOnly == nil {
+		return []string{models.ExecutorLocal, models.ExecutorDocker}, true
+	}
+	for _, name := range runOnly {
+		if name != models.ExecutorLocal && name != models.ExecutorDocker {
+			fmt.Fprintf(os.Stderr, "worker: -no-http runs only local and docker jobs, not %s\n", name)
+			os.Exit(2)
+		}
+	}
+	return runOnly, true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/archive"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+// runMigrate creates the orchestrator's tables and exits, so it can run as
+// an init container ahead of the API and worker processes
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: orchestrator migrate [flags]
+
+Creates the tables the orchestrator keeps in the database at DATABASE_URL.
+Safe to run on every deploy.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up when the database is not reachable within this time")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	godotenv.Load()
+	url, err := config.ResolveSecret("DATABASE_URL")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	if url == "" {
+		fmt.Fprintln(os.Stderr, "migrate: DATABASE_URL is required")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	// The database may still be starting alongside the init container
+	for {
+		err := pool.Ping(ctx)
+		if err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "migrate: database unreachable:", err)
+			return 1
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	if err := archive.Migrate(ctx, pool); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	fmt.Println("Migrations applied")
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/simulate"
+)
+
+// runSimulate replays recorded job arrivals against each combination of
+// worker count and strategy and prints the predicted waits
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: orchestrator simulate [flags] [jobs.ndjson]
+
+Replays job arrivals, one JSON job per line as returned by the API or stored
+in the job archive, and prints predicted waits from submission to dispatch.
+Reads standard input when no file is given.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	workers := fs.String("workers", "12", "comma-separated worker counts to compare")
+	strategies := fs.String("strategies", simulate.StrategyPriority, "comma-separated strategies to compare: "+strings.Join(simulate.Strategies, ", ")+" or all")
+	projectMax := fs.Int("project-max-parallel", 3, "running jobs allowed per project (0 for unlimited)")
+	defaultDuration := fs.Duration("default-duration", 10*time.Minute, "run time of jobs that never finished")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	counts, err := parseCounts(*workers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "simulate:", err)
+		return 2
+	}
+	names := strings.Split(*strategies, ",")
+	if *strategies == "all" {
+		names = simulate.Strategies
+	}
+
+	var in io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "simulate:", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	arrivals, err := simulate.Load(in, *defaultDuration)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "simulate: failed to read jobs:", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "workers\tstrategy\tjobs\tmean\tp50\tp90\tp95\tp99\tmax\tutilization\t")
+	for _, n := range counts {
+		for _, name := range names {
+			r, err := simulate.Run(simulate.Config{
+				Workers:            n,
+				Strategy:           strings.TrimSpace(name),
+				ProjectMaxParallel: *projectMax,
+			}, arrivals)
+			if err != nil {
+				w.Flush()
+				fmt.Fprintln(os.Stderr, "simulate:", err)
+				return 1
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%%\t\n",
+				r.Workers, r.Strategy, r.Jobs, round(r.Mean), round(r.P50), round(r.P90),
+				round(r.P95), round(r.P99), round(r.Max), r.Utilization*100)
+		}
+	}
+	w.Flush()
+	return 0
+}
+
+// parseCounts parses a comma-separated list of worker counts
+func parseCounts(list string) ([]int, error) {
+	var counts []int
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid worker count %q", s)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Second)
+}
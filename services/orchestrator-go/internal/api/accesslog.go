@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// accessEntry collects fields for a request's access log record that are
+// only known deeper in the handler chain
+type accessEntry struct {
+	keyID string
+}
+
+type accessEntryKey struct{}
+
+// noteCaller records the API key a request authenticated with in its
+// access log record
+func noteCaller(r *http.Request, principal *auth.Principal) {
+	if entry, ok := r.Context().Value(accessEntryKey{}).(*accessEntry); ok && principal != nil {
+		entry.keyID = principal.Name
+	}
+}
+
+// accessLog writes one structured record per request, correlated with the
+// job or worktree the path refers to
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = log.Error()
+		case status >= http.StatusBadRequest:
+			event = log.Warn()
+		default:
+			event = log.Info()
+		}
+
+		event = event.
+			Str("request_id", middleware.GetReqID(r.Context())).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("remote_addr", r.RemoteAddr).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Float64("latency_ms", float64(time.Since(start).Microseconds())/1000)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				event = event.Str("route", pattern)
+			}
+			if jobID := rctx.URLParam("jobID"); jobID != "" {
+				event = event.Str("job_id", jobID)
+			}
+			if worktreeID := rctx.URLParam("worktreeID"); worktreeID != "" {
+				event = event.Str("worktree_id", worktreeID)
+			}
+		}
+		// Log uploads from workflows name their job in the query string
+		if jobID := r.URL.Query().Get("job_id"); jobID != "" && chi.URLParam(r, "jobID") == "" {
+			event = event.Str("job_id", jobID)
+		}
+		if entry.keyID != "" {
+			event = event.Str("api_key_id", entry.keyID)
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			event = event.Str("trace_id", sc.TraceID().String())
+		}
+
+		event.Msg("HTTP request")
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Reconcile diffs GitHub state against job state, optionally fixing orphans
+func (h *Handlers) Reconcile(w http.ResponseWriter, r *http.Request) {
+	// The body is optional; an empty one reports on every known repository
+	var req models.ReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	report, err := h.queueManager.Reconcile(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, github.ErrNotConfigured) {
+			writeError(w, http.StatusServiceUnavailable, "GitHub App credentials not configured")
+			return
+		}
+		log.Error().Err(err).Msg("Failed to reconcile")
+		writeError(w, http.StatusInternalServerError, "Failed to reconcile")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// PurgeJobs evicts finished jobs older than the given age from memory and
+// deletes them from the archive
+func (h *Handlers) PurgeJobs(w http.ResponseWriter, r *http.Request) {
+	var req models.PurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	olderThan, err := time.ParseDuration(req.OlderThan)
+	if err != nil || olderThan < 0 {
+		writeError(w, http.StatusBadRequest, "older_than must be a duration such as 720h")
+		return
+	}
+
+	result, err := h.queueManager.PurgeJobs(r.Context(), time.Now().Add(-olderThan))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge jobs")
+		writeError(w, http.StatusInternalServerError, "Failed to purge jobs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// AdminDump returns a snapshot of queue and worktree state for bug reports
+func (h *Handlers) AdminDump(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.queueManager.DebugDump(r.Context()))
+}
+
+// ReloadConfig reloads the configuration, as SIGHUP does, applying the
+// settings that can change without a restart
+func (h *Handlers) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	changed, err := h.reloader.Reload()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload configuration")
+		writeError(w, http.StatusInternalServerError, "Failed to reload configuration: "+err.Error())
+		return
+	}
+	log.Info().Strs("changed", changed).Msg("Configuration reloaded")
+	writeJSON(w, http.StatusOK, models.ReloadResult{ReloadedAt: time.Now(), Changed: changed})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+)
+
+// authenticate identifies the caller by API token and limits them to their
+// token's projects. Without configured API tokens every caller is let through
+// unscoped.
+func (h *Handlers) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.auth.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, ok := h.authorize(w, r)
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// requireAdmin restricts privileged endpoints to callers presenting the
+// admin token. They are refused outright when no admin token is configured.
+func (h *Handlers) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.Auth.AdminToken == "" {
+			writeError(w, http.StatusForbidden, "Admin API is disabled")
+			return
+		}
+
+		principal, ok := h.authorize(w, r)
+		if !ok {
+			return
+		}
+		if !principal.Admin {
+			writeError(w, http.StatusForbidden, "Admin token required")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// authorize resolves the request's bearer token, writing an error response
+// if it is missing or unknown
+func (h *Handlers) authorize(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		writeError(w, http.StatusUnauthorized, "Missing authorization header")
+		return nil, false
+	}
+
+	principal, ok := h.auth.Authenticate(authHeader)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid authorization header")
+		return nil, false
+	}
+	noteCaller(r, principal)
+	return principal, true
+}
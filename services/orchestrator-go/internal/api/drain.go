@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+)
+
+// StartDrain stops dispatching so running jobs and callbacks can settle
+// before a deploy. Poll GetDrainStatus until drained is true.
+func (h *Handlers) StartDrain(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusAccepted, h.queueManager.Drain())
+}
+
+// GetDrainStatus reports the progress of a drain
+func (h *Handlers) GetDrainStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.queueManager.DrainStatus())
+}
+
+// CancelDrain resumes dispatching after a drain
+func (h *Handlers) CancelDrain(w http.ResponseWriter, r *http.Request) {
+	message := "Drain cancelled"
+	if !h.queueManager.CancelDrain() {
+		message = "Not draining"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": message})
+}
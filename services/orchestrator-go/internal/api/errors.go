@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// statusCodes are the error codes of errors without a code of their own
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            models.ErrorCodeBadRequest,
+	http.StatusUnauthorized:          models.ErrorCodeUnauthorized,
+	http.StatusForbidden:             models.ErrorCodeForbidden,
+	http.StatusNotFound:              models.ErrorCodeNotFound,
+	http.StatusConflict:              models.ErrorCodeConflict,
+	http.StatusRequestEntityTooLarge: models.ErrorCodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   models.ErrorCodeValidationFailed,
+	http.StatusTooManyRequests:       models.ErrorCodeRateLimited,
+	http.StatusInternalServerError:   models.ErrorCodeInternal,
+	http.StatusBadGateway:            models.ErrorCodeBadGateway,
+	http.StatusServiceUnavailable:    models.ErrorCodeUnavailable,
+}
+
+// writeError writes an error with the code of its status
+func writeError(w http.ResponseWriter, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = models.ErrorCodeInternal
+	}
+	writeErrorCode(w, status, code, message, nil)
+}
+
+// writeErrorCode writes an error with its own code, and details clients
+// can act on without parsing the message
+func writeErrorCode(w http.ResponseWriter, status int, code, message string, details map[string]interface{}) {
+	writeJSON(w, status, models.ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: w.Header().Get(middleware.RequestIDHeader),
+		Details:   details,
+	})
+}
+
+// echoRequestID returns each request's ID in the X-Request-Id header, where
+// error responses also pick it up
+func echoRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// jobExpansions are the heavy parts of a job ?include names. Attempts and
+// events are embedded unless ?include leaves them out; artifacts only when
+// asked for.
+var jobExpansions = map[string]bool{
+	"attempts":  true,
+	"events":    true,
+	"artifacts": false,
+}
+
+// jobFields are the JSON names of a job's fields, for checking ?fields
+var jobFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(models.Job{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// jobView is the shape a request asks jobs to be rendered in: the sparse
+// fieldset of ?fields and the expansions of ?include
+type jobView struct {
+	fields  map[string]bool // nil renders every field
+	include map[string]bool
+}
+
+// parseJobView reads ?fields=id,status,pr_url and ?include=attempts,artifacts
+func parseJobView(query url.Values) (jobView, error) {
+	view := jobView{include: make(map[string]bool)}
+	for name, embedded := range jobExpansions {
+		view.include[name] = embedded
+	}
+
+	if query.Has("include") {
+		for name := range view.include {
+			view.include[name] = false
+		}
+		for _, name := range splitList(query.Get("include")) {
+			if _, ok := jobExpansions[name]; !ok {
+				return jobView{}, fmt.Errorf("unknown include %q", name)
+			}
+			view.include[name] = true
+		}
+	}
+
+	if query.Has("fields") {
+		view.fields = map[string]bool{"id": true}
+		for _, name := range splitList(query.Get("fields")) {
+			if !jobFields[name] {
+				return jobView{}, fmt.Errorf("unknown field %q", name)
+			}
+			view.fields[name] = true
+		}
+	}
+	return view, nil
+}
+
+// splitList splits a comma separated query value, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// full reports whether the view renders jobs as they are
+func (v jobView) full() bool {
+	return v.fields == nil && v.include["attempts"] && v.include["events"] && !v.include["artifacts"]
+}
+
+// render shapes a job for the view. Expansions always follow ?include,
+// whatever ?fields says.
+func (v jobView) render(job *models.Job, artifacts []models.JobArtifact) (interface{}, error) {
+	if v.full() {
+		return job, nil
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if v.include["artifacts"] {
+		out["artifacts"], _ = json.Marshal(artifacts)
+	}
+
+	for name := range out {
+		embedded, expansion := v.include[name]
+		switch {
+		case expansion && !embedded:
+			delete(out, name)
+		case !expansion && v.fields != nil && !v.fields[name]:
+			delete(out, name)
+		}
+	}
+	return out, nil
+}
+
+// renderJobs shapes jobs for the view, looking up their artifacts only when
+// they are included
+func (h *Handlers) renderJobs(r *http.Request, view jobView, jobs []*models.Job) ([]interface{}, error) {
+	var artifacts map[string][]models.JobArtifact
+	if view.include["artifacts"] {
+		var err error
+		if artifacts, err = h.queueManager.JobArtifacts(r.Context(), jobs); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		rendered, err := view.render(job, artifacts[job.ID])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rendered)
+	}
+	return out, nil
+}
@@ -1,14 +1,32 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/bitbucket"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/federation"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitlab"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/health"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/version"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/worktree"
 	"github.com/rs/zerolog/log"
 )
@@ -18,25 +36,45 @@ type Handlers struct {
 	cfg             *config.Config
 	queueManager    *queue.Manager
 	worktreeManager *worktree.Manager
+	federation      *federation.Router
+	projects        *project.Registry
+	checks          *health.Checker
+	reloader        *config.Reloader
+	auth            *auth.Authenticator
+	statusz         statuszCache
+	submitLimits    submitLimits
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(cfg *config.Config, qm *queue.Manager, wm *worktree.Manager) *Handlers {
+func NewHandlers(cfg *config.Config, qm *queue.Manager, wm *worktree.Manager, fed *federation.Router, projects *project.Registry, checks *health.Checker, reloader *config.Reloader) *Handlers {
 	return &Handlers{
 		cfg:             cfg,
 		queueManager:    qm,
 		worktreeManager: wm,
+		federation:      fed,
+		projects:        projects,
+		checks:          checks,
+		reloader:        reloader,
+		auth:            auth.NewAuthenticator(cfg.Auth),
+		submitLimits:    newSubmitLimits(cfg.RateLimit),
 	}
 }
 
-// Health returns the health status of the service
+// Health returns the health status of the service and of the dependencies
+// it probes. Failing probes degrade the status without failing the request,
+// so the response keeps its detail. Callers are not authenticated, so the
+// queue is described by its totals only.
 func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	response := models.HealthResponse{
 		Status:    "healthy",
-		Version:   "0.1.0",
+		Version:   version.Version,
 		Uptime:    time.Since(startTime).String(),
-		Queue:     *h.queueManager.GetStats(),
+		Queue:     h.queueManager.GetStats(nil).Totals(),
 		Worktrees: *h.worktreeManager.GetStats(),
+		Checks:    h.checks.Run(r.Context()),
+	}
+	if !health.Healthy(response.Checks) {
+		response.Status = "degraded"
 	}
 
 	writeJSON(w, http.StatusOK, response)
@@ -44,9 +82,14 @@ func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 
 // Metrics returns Prometheus-compatible metrics
 func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
-	stats := h.queueManager.GetStats()
+	stats := h.queueManager.GetStats(nil)
 	wtStats := h.worktreeManager.GetStats()
 
+	paused := 0
+	if stats.Paused {
+		paused = 1
+	}
+
 	// Simple text format for now
 	metrics := `# HELP autobuild_jobs_total Total number of jobs
 # TYPE autobuild_jobs_total gauge
@@ -63,20 +106,70 @@ autobuild_workers_max %d
 # HELP autobuild_worktrees_active Number of active worktrees
 # TYPE autobuild_worktrees_active gauge
 autobuild_worktrees_active %d
+# HELP autobuild_worktree_disk_usage_bytes Disk usage of all worktrees when last measured
+# TYPE autobuild_worktree_disk_usage_bytes gauge
+autobuild_worktree_disk_usage_bytes %d
+# HELP autobuild_worktrees_over_quota Number of worktrees over their disk quota
+# TYPE autobuild_worktrees_over_quota gauge
+autobuild_worktrees_over_quota %d
+# HELP autobuild_worktrees_pooled Number of cleaned worktrees waiting to be reused
+# TYPE autobuild_worktrees_pooled gauge
+autobuild_worktrees_pooled %d
+# HELP autobuild_queue_paused Whether dispatching is paused (1) or not (0)
+# TYPE autobuild_queue_paused gauge
+autobuild_queue_paused %d
 `
-	w.Header().Set("Content-Type", "text/plain")
+	metrics = formatMetrics(metrics,
+		stats.PendingJobs,
+		stats.RunningJobs,
+		stats.CompletedJobs,
+		stats.FailedJobs,
+		stats.ActiveWorkers,
+		stats.MaxWorkers,
+		wtStats.Active,
+		int(wtStats.DiskUsageBytes),
+		wtStats.OverQuota,
+		wtStats.Pooled,
+		paused,
+	)
+
+	metrics += "# HELP autobuild_pull_requests Number of jobs' pull requests by state\n"
+	metrics += "# TYPE autobuild_pull_requests gauge\n"
+	for _, state := range []models.PRState{models.PRStateOpen, models.PRStateMerged, models.PRStateClosed} {
+		metrics += "autobuild_pull_requests{state=\"" + string(state) + "\"} " + intToString(stats.PullRequests[string(state)]) + "\n"
+	}
+
+	metrics += "# HELP autobuild_jobs_deadline_at_risk Number of queued jobs expected to miss their deadlines\n"
+	metrics += "# TYPE autobuild_jobs_deadline_at_risk gauge\n"
+	metrics += "autobuild_jobs_deadline_at_risk " + intToString(stats.DeadlinesAtRisk) + "\n"
+
+	sources := make([]string, 0, len(stats.JobsBySource))
+	for source := range stats.JobsBySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	metrics += "# HELP autobuild_jobs_by_source Number of jobs per submission source\n"
+	metrics += "# TYPE autobuild_jobs_by_source gauge\n"
+	for _, source := range sources {
+		metrics += "autobuild_jobs_by_source{source=\"" + labelValue(source) + "\"} " + intToString(stats.JobsBySource[source]) + "\n"
+	}
+
+	// Exemplars are only valid in the OpenMetrics format, which Prometheus
+	// asks for when exemplar storage is enabled
+	openMetrics := acceptsOpenMetrics(r)
+	metrics += jobLatencyMetrics(h.queueManager.JobLatencyStats(), openMetrics)
+	metrics += schedulerMetrics(h.queueManager.SchedulerStats())
+	metrics += artifactMetrics(h.queueManager.ArtifactRetentionStats())
+	metrics += worktreeMetrics(wtStats, h.worktreeManager.Snapshot(), time.Now())
+
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+		metrics = toOpenMetrics(metrics)
+	} else {
+		w.Header().Set("Content-Type", "text/plain")
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(
-		formatMetrics(metrics,
-			stats.PendingJobs,
-			stats.RunningJobs,
-			stats.CompletedJobs,
-			stats.FailedJobs,
-			stats.ActiveWorkers,
-			stats.MaxWorkers,
-			wtStats.Active,
-		),
-	))
+	w.Write([]byte(metrics))
 }
 
 // CreateJob creates a new agent job
@@ -87,86 +180,595 @@ func (h *Handlers) CreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate required fields
-	if req.TicketID == "" || req.ProjectID == "" || req.Prompt == "" {
-		writeError(w, http.StatusBadRequest, "ticket_id, project_id, and prompt are required")
+	// A template fills in what the submission leaves out, so it applies
+	// before the submission is validated
+	if req.TemplateID != "" {
+		settings, _ := h.projects.Get(req.ProjectID)
+		if tmpl, ok := settings.Templates[req.TemplateID]; ok {
+			project.ApplyTemplate(tmpl, &req)
+		}
+	}
+	if v := h.validateCreateJob(&req); len(v) > 0 {
+		writeViolations(w, v)
+		return
+	}
+	principal := auth.FromContext(r.Context())
+	if !principal.Allows(req.ProjectID) {
+		writeError(w, http.StatusForbidden, "Token is not scoped to this project")
+		return
+	}
+
+	// Authenticated integrations are identified by their token
+	if principal != nil {
+		req.Source = principal.Name
+	} else if req.Source == "" {
+		req.Source = defaultSource
+	} else if v := h.validateSource(req.Source); len(v) > 0 {
+		writeViolations(w, v)
+		return
+	}
+	if ok, wait := h.submitLimits.allowSource(req.Source); !ok {
+		log.Warn().Str("source", req.Source).Msg("Job submission rate limit exceeded")
+		tooManyRequests(w, wait)
+		return
+	}
+
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		req.Force = true
+	}
+
+	// Projects owned by a downstream orchestrator are forwarded there
+	if ds, ok := h.federation.ForProject(req.ProjectID); ok {
+		response, err := h.federation.Submit(r.Context(), ds, &req)
+		if err != nil {
+			log.Error().Err(err).Str("downstream", ds.Name()).Msg("Failed to forward job")
+			writeError(w, http.StatusBadGateway, "Failed to forward job to downstream orchestrator")
+			return
+		}
+		writeJSON(w, http.StatusCreated, response)
 		return
 	}
 
 	response, err := h.queueManager.Submit(r.Context(), &req)
 	if err != nil {
+		var active *queue.TicketActiveError
+		if errors.As(err, &active) {
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeTicketActive,
+				"Ticket "+req.TicketID+" already has unfinished job "+active.Job.ID+"; submit with force=true to run another",
+				map[string]interface{}{"ticket_id": req.TicketID, "job": active.Job})
+			return
+		}
+		if errors.Is(err, queue.ErrSourceQuotaExceeded) {
+			writeErrorCode(w, http.StatusTooManyRequests, models.ErrorCodeQueueFull, "Too many unfinished jobs from source "+req.Source,
+				map[string]interface{}{"source": req.Source})
+			return
+		}
+		var full *queue.QueueFullError
+		if errors.As(err, &full) {
+			h.writeQueueFull(w, r, full)
+			return
+		}
+		if errors.Is(err, queue.ErrJobIDExists) {
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeJobIDExists, "A job with id "+req.ID+" already exists", map[string]interface{}{"job_id": req.ID})
+			return
+		}
+		if errors.Is(err, queue.ErrBaseBranchNotFound) {
+			writeErrorCode(w, http.StatusUnprocessableEntity, models.ErrorCodeBaseBranchNotFound, err.Error(), nil)
+			return
+		}
+		if errors.Is(err, queue.ErrProjectArchived) {
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeProjectArchived, "Project "+req.ProjectID+" is archived", map[string]interface{}{"project_id": req.ProjectID})
+			return
+		}
 		log.Error().Err(err).Msg("Failed to submit job")
 		writeError(w, http.StatusInternalServerError, "Failed to submit job")
 		return
 	}
 
+	// A reused job was created by an earlier submission
+	if response.Reused {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
 	writeJSON(w, http.StatusCreated, response)
 }
 
-// ListJobs returns all jobs
+// ListJobs returns all jobs, including those forwarded to downstream
+// orchestrators
 func (h *Handlers) ListJobs(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement pagination and filtering
-	stats := h.queueManager.GetStats()
+	query := r.URL.Query()
+	filter := models.JobFilter{
+		ProjectID:   query.Get("project_id"),
+		Source:      query.Get("source"),
+		Status:      models.JobStatus(query.Get("status")),
+		GroupID:     query.Get("group_id"),
+		FailureKind: query.Get("failure_kind"),
+		Label:       query.Get("label"),
+	}
+	view, err := parseJobView(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	scope := auth.FromContext(r.Context())
+	jobs := h.queueManager.ListJobs(scope, filter)
+	if forwarded := h.federation.Jobs(r.Context(), "/api/v1/jobs", query, scope); len(forwarded) > 0 {
+		jobs = append(jobs, forwarded...)
+		sortNewestFirst(jobs)
+	}
+	rendered, err := h.renderJobs(r, view, jobs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to render jobs")
+		writeError(w, http.StatusInternalServerError, "Failed to render jobs")
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"jobs":  []interface{}{}, // TODO: Get actual jobs
-		"stats": stats,
+		"jobs":  rendered,
+		"total": len(jobs),
+	})
+}
+
+// sortNewestFirst orders jobs merged from several orchestrators as each
+// lists its own
+func sortNewestFirst(jobs []*models.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+}
+
+// proxyFederatedJob hands requests for forwarded jobs to the downstream
+// orchestrator that owns them
+func (h *Handlers) proxyFederatedJob(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID := chi.URLParam(r, "jobID")
+		ds, projectID, ok := h.federation.ForJob(jobID)
+		if _, local := h.queueManager.GetJob(jobID, nil); !ok && !local {
+			// Forwarded before a restart, or forgotten since
+			ds, projectID, ok = h.federation.Locate(r.Context(), jobID)
+		}
+		if ok {
+			if !auth.FromContext(r.Context()).Allows(projectID) {
+				writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+				return
+			}
+			ds.Proxy(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
 // GetJob returns a specific job
 func (h *Handlers) GetJob(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
+	view, err := parseJobView(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	job, ok := h.queueManager.GetJob(jobID)
+	scope := auth.FromContext(r.Context())
+	job, ok := h.queueManager.GetJob(jobID, scope)
 	if !ok {
-		writeError(w, http.StatusNotFound, "Job not found")
+		// Finished jobs evicted from memory may still be archived
+		archived, found, err := h.queueManager.GetArchivedJob(r.Context(), jobID, scope)
+		if err != nil {
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to look up archived job")
+		}
+		if !found {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+			return
+		}
+		job = archived
+	}
+
+	rendered, err := h.renderJobs(r, view, []*models.Job{job})
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to render job")
+		writeError(w, http.StatusInternalServerError, "Failed to render job")
 		return
 	}
+	writeJSON(w, http.StatusOK, rendered[0])
+}
+
+// GetJobReport returns the markdown report of a finished analysis job
+func (h *Handlers) GetJobReport(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
 
-	writeJSON(w, http.StatusOK, job)
+	scope := auth.FromContext(r.Context())
+	job, ok := h.queueManager.GetJob(jobID, scope)
+	if !ok {
+		archived, found, err := h.queueManager.GetArchivedJob(r.Context(), jobID, scope)
+		if err != nil {
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to look up archived job")
+		}
+		if !found {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+			return
+		}
+		job = archived
+	}
+	if job.Result == nil || job.Result.Report == "" {
+		writeError(w, http.StatusNotFound, "No report recorded for job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, job.Result.Report)
 }
 
 // CancelJob cancels a job
 func (h *Handlers) CancelJob(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 
-	err := h.queueManager.CancelJob(jobID)
+	var (
+		err       error
+		cancelled bool
+		pending   = "Cancel requested from the worker running the job"
+	)
+	switch models.CancelMode(r.URL.Query().Get("mode")) {
+	case "", models.CancelModeHard:
+		cancelled, err = h.queueManager.CancelJob(jobID, auth.FromContext(r.Context()))
+	case models.CancelModeSoft:
+		cancelled, err = h.queueManager.StopJob(jobID, auth.FromContext(r.Context()))
+		pending = "Stop requested, the agent will push its partial work"
+	default:
+		writeError(w, http.StatusBadRequest, "mode must be hard or soft")
+		return
+	}
 	if err != nil {
-		if err == queue.ErrJobNotFound {
-			writeError(w, http.StatusNotFound, "Job not found")
+		if errors.Is(err, queue.ErrJobNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
 			return
 		}
-		if err == queue.ErrJobAlreadyCompleted {
-			writeError(w, http.StatusConflict, "Job already completed")
+		if errors.Is(err, queue.ErrJobAlreadyCompleted) {
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeJobAlreadyCompleted, "Job already completed", map[string]interface{}{"job_id": jobID})
 			return
 		}
 		writeError(w, http.StatusInternalServerError, "Failed to cancel job")
 		return
 	}
 
+	if !cancelled {
+		writeJSON(w, http.StatusAccepted, map[string]string{"message": pending})
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Job cancelled"})
 }
 
-// GetJobLogs returns the logs for a job
+// UpdateJob changes the priority, prompt or base branch of a queued job
+func (h *Handlers) UpdateJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	var req models.UpdateJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Priority == nil && req.Prompt == nil && req.BaseBranch == nil {
+		writeError(w, http.StatusBadRequest, "One of priority, prompt, or base_branch is required")
+		return
+	}
+	if (req.Prompt != nil && *req.Prompt == "") || (req.BaseBranch != nil && *req.BaseBranch == "") {
+		writeError(w, http.StatusBadRequest, "prompt and base_branch may not be empty")
+		return
+	}
+	if v := h.validateUpdateJob(&req); len(v) > 0 {
+		writeViolations(w, v)
+		return
+	}
+
+	resp, err := h.queueManager.UpdateJob(r.Context(), jobID, &req, auth.FromContext(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, queue.ErrJobNotFound):
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		case errors.Is(err, queue.ErrJobNotPending):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeJobNotPending, err.Error(), nil)
+		case errors.Is(err, queue.ErrUndefinedVariables):
+			writeViolations(w, violations{{Field: "prompt", Message: err.Error()}})
+		case errors.Is(err, queue.ErrBaseBranchNotFound):
+			writeErrorCode(w, http.StatusUnprocessableEntity, models.ErrorCodeBaseBranchNotFound, err.Error(), nil)
+		default:
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to update job")
+			writeError(w, http.StatusInternalServerError, "Failed to update job")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetJobRun asks the job's executor where its run is
+func (h *Handlers) GetJobRun(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	status, err := h.queueManager.RunStatus(r.Context(), jobID, auth.FromContext(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, queue.ErrJobNotFound):
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		case errors.Is(err, queue.ErrJobNotStarted):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeJobNotStarted, err.Error(), nil)
+		default:
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to get run status")
+			writeError(w, http.StatusBadGateway, "Failed to get run status from the executor")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// maxRetentionDays caps how far a single request extends a job's retention
+const maxRetentionDays = 3650
+
+// ExtendJobRetention keeps a job's logs for more days than its project's
+// retention policy would
+func (h *Handlers) ExtendJobRetention(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	var req models.ExtendRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Days < 1 || req.Days > maxRetentionDays {
+		writeError(w, http.StatusBadRequest, "days must be between 1 and "+intToString(maxRetentionDays))
+		return
+	}
+
+	until, err := h.queueManager.ExtendRetention(r.Context(), jobID, req.Days, auth.FromContext(r.Context()))
+	if err != nil {
+		switch {
+		case errors.Is(err, queue.ErrJobNotFound):
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		case errors.Is(err, queue.ErrLogsNotKept):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeLogsNotKept, err.Error(), nil)
+		default:
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to extend job retention")
+			writeError(w, http.StatusInternalServerError, "Failed to extend job retention")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, models.ExtendRetentionResponse{JobID: jobID, RetainUntil: *until})
+}
+
+// GetGroup returns the jobs of a group with their rolled-up status
+func (h *Handlers) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.queueManager.GetGroup(chi.URLParam(r, "groupID"), auth.FromContext(r.Context()))
+	if err != nil {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeGroupNotFound, "Group not found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+// RequeueJob queues a copy of a failed or cancelled job and returns it
+func (h *Handlers) RequeueJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	// The body is optional; an empty one keeps the branch and worktree
+	var req models.RequeueJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.queueManager.Requeue(r.Context(), jobID, &req, auth.FromContext(r.Context()))
+	if err != nil {
+		var full *queue.QueueFullError
+		switch {
+		case errors.Is(err, queue.ErrJobNotFound):
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		case errors.Is(err, queue.ErrJobNotRetryable):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeJobNotRetryable, err.Error(), nil)
+		case errors.Is(err, queue.ErrSourceQuotaExceeded):
+			writeErrorCode(w, http.StatusTooManyRequests, models.ErrorCodeQueueFull, err.Error(), nil)
+		case errors.As(err, &full):
+			h.writeQueueFull(w, r, full)
+		case errors.Is(err, queue.ErrProjectArchived):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeProjectArchived, err.Error(), nil)
+		default:
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to requeue job")
+			writeError(w, http.StatusInternalServerError, "Failed to requeue job")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// writeQueueFull refuses a job while the queue is full, with how long to
+// wait before trying again. The queue counts are those the caller may see.
+func (h *Handlers) writeQueueFull(w http.ResponseWriter, r *http.Request, full *queue.QueueFullError) {
+	seconds := max(int(math.Ceil(full.RetryAfter.Seconds())), 1)
+	message := fmt.Sprintf("Queue is full (%d of %d jobs waiting)", full.Depth, full.Limit)
+	if full.ProjectID != "" {
+		message = fmt.Sprintf("Project %s has %d of %d jobs waiting", full.ProjectID, full.Depth, full.Limit)
+	}
+	stats := h.queueManager.GetStats(auth.FromContext(r.Context()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorCode(w, http.StatusTooManyRequests, models.ErrorCodeQueueFull, message,
+		map[string]interface{}{
+			"project_id":          full.ProjectID,
+			"depth":               full.Depth,
+			"max_depth":           full.Limit,
+			"retry_after_seconds": seconds,
+			"pending_jobs":        stats.PendingJobs,
+			"running_jobs":        stats.RunningJobs,
+			"active_workers":      stats.ActiveWorkers,
+			"max_workers":         stats.MaxWorkers,
+		})
+}
+
+// GetJobEvents returns the state changes of a job, oldest first
+func (h *Handlers) GetJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	events, err := h.queueManager.JobEvents(r.Context(), jobID, auth.FromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+			return
+		}
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to load job events")
+		writeError(w, http.StatusInternalServerError, "Failed to load job events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id": jobID,
+		"events": events,
+	})
+}
+
+// CompareJobAttempts diffs the prompts and changes of two attempts of a job
+func (h *Handlers) CompareJobAttempts(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	from, err := attemptParam(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := attemptParam(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cmp, err := h.queueManager.CompareAttempts(r.Context(), jobID, from, to, auth.FromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+			return
+		}
+		if errors.Is(err, queue.ErrAttemptNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeAttemptNotFound, "Attempt not found", nil)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to compare attempts")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, cmp)
+}
+
+// attemptParam reads an optional attempt number from the query string
+func attemptParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s attempt number", name)
+	}
+	return n, nil
+}
+
+// defaultLogTail is how many log lines GetJobLogs returns by default
+const defaultLogTail = 500
+
+// GetJobLogs returns the last lines of a job's log
 func (h *Handlers) GetJobLogs(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 
-	job, ok := h.queueManager.GetJob(jobID)
+	tail := defaultLogTail
+	if value := r.URL.Query().Get("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid tail")
+			return
+		}
+		tail = n
+	}
+
+	logs, ok := h.openJobLog(w, r, jobID)
 	if !ok {
-		writeError(w, http.StatusNotFound, "Job not found")
 		return
 	}
+	defer logs.Close()
+
+	// Keep a ring of the last tail lines; lines can be long (agent output
+	// is uploaded as single-line JSON), so read them without a size cap
+	ring := make([]string, 0, tail)
+	start := 0
+	reader := bufio.NewReader(logs)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\n"); line != "" || err == nil {
+			if len(ring) < tail {
+				ring = append(ring, line)
+			} else {
+				ring[start] = line
+				start = (start + 1) % tail
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error().Err(err).Str("job_id", jobID).Msg("Failed to read job log")
+			writeError(w, http.StatusInternalServerError, "Failed to read job log")
+			return
+		}
+	}
 
-	// TODO: Implement log streaming
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"job_id": job.ID,
-		"logs":   []string{},
+		"job_id": jobID,
+		"logs":   append(ring[start:], ring[:start]...),
 	})
 }
 
+// DownloadJobLogs sends a job's full log as a text file
+func (h *Handlers) DownloadJobLogs(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	logs, ok := h.openJobLog(w, r, jobID)
+	if !ok {
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=job-%s.log", jobID))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, logs); err != nil {
+		log.Warn().Err(err).Str("job_id", jobID).Msg("Job log download interrupted")
+	}
+}
+
+// openJobLog opens a job's log, writing the error response when it cannot
+func (h *Handlers) openJobLog(w http.ResponseWriter, r *http.Request, jobID string) (io.ReadCloser, bool) {
+	logs, err := h.queueManager.OpenJobLog(r.Context(), jobID, auth.FromContext(r.Context()))
+	switch {
+	case err == nil:
+		return logs, true
+	case errors.Is(err, queue.ErrJobNotFound):
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+	case errors.Is(err, joblog.ErrNotFound):
+		writeError(w, http.StatusNotFound, "No logs recorded for job")
+	default:
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to open job log")
+		writeError(w, http.StatusInternalServerError, "Failed to open job log")
+	}
+	return nil, false
+}
+
 // ListWorktrees returns all worktrees
 func (h *Handlers) ListWorktrees(w http.ResponseWriter, r *http.Request) {
-	worktrees := h.worktreeManager.List()
+	principal := auth.FromContext(r.Context())
+	worktrees := make([]*models.Worktree, 0)
+	for _, wt := range h.worktreeManager.List() {
+		if principal.Allows(wt.ProjectID) {
+			worktrees = append(worktrees, wt)
+		}
+	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"worktrees": worktrees,
 		"stats":     h.worktreeManager.GetStats(),
@@ -176,20 +778,26 @@ func (h *Handlers) ListWorktrees(w http.ResponseWriter, r *http.Request) {
 // CreateWorktree creates a new worktree
 func (h *Handlers) CreateWorktree(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ProjectID  string `json:"project_id"`
-		TicketID   string `json:"ticket_id"`
-		BranchName string `json:"branch_name"`
+		ProjectID    string `json:"project_id"`
+		RepoFullName string `json:"repo_full_name"`
+		BaseBranch   string `json:"base_branch"`
+		TicketID     string `json:"ticket_id"`
+		BranchName   string `json:"branch_name"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if !auth.FromContext(r.Context()).Allows(req.ProjectID) {
+		writeError(w, http.StatusForbidden, "Token is not scoped to this project")
+		return
+	}
 
-	wt, err := h.worktreeManager.Create(req.ProjectID, req.TicketID, req.BranchName)
+	wt, err := h.worktreeManager.Create(r.Context(), req.ProjectID, req.RepoFullName, req.BaseBranch, req.TicketID, req.BranchName)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create worktree")
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeWorktreeError(w, err)
 		return
 	}
 
@@ -200,35 +808,101 @@ func (h *Handlers) CreateWorktree(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) DeleteWorktree(w http.ResponseWriter, r *http.Request) {
 	worktreeID := chi.URLParam(r, "worktreeID")
 
+	if wt, ok := h.worktreeManager.Get(worktreeID); ok && !auth.FromContext(r.Context()).Allows(wt.ProjectID) {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeWorktreeNotFound, "worktree not found: "+worktreeID, nil)
+		return
+	}
+
 	err := h.worktreeManager.Delete(worktreeID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, err.Error())
+		writeWorktreeError(w, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Worktree deleted"})
 }
 
+// MarkWorktreeMerging keeps a worktree until the pull request opened from
+// its branch is merged or closed
+func (h *Handlers) MarkWorktreeMerging(w http.ResponseWriter, r *http.Request) {
+	worktreeID := chi.URLParam(r, "worktreeID")
+
+	wt, ok := h.worktreeManager.Get(worktreeID)
+	if !ok || !auth.FromContext(r.Context()).Allows(wt.ProjectID) {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeWorktreeNotFound, "worktree not found: "+worktreeID, nil)
+		return
+	}
+
+	var req models.WorktreeMergingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.RepoFullName == "" || req.PRNumber <= 0 {
+		writeError(w, http.StatusBadRequest, "repo_full_name and pr_number are required")
+		return
+	}
+
+	if err := h.worktreeManager.MarkMerging(worktreeID, req.RepoFullName, req.PRNumber, req.PRUrl); err != nil {
+		writeWorktreeError(w, err)
+		return
+	}
+	wt, _ = h.worktreeManager.Get(worktreeID)
+	writeJSON(w, http.StatusOK, wt)
+}
+
+// MarkWorktreeCleanup schedules a worktree for removal, such as once its
+// pull request was resolved without a webhook saying so
+func (h *Handlers) MarkWorktreeCleanup(w http.ResponseWriter, r *http.Request) {
+	worktreeID := chi.URLParam(r, "worktreeID")
+
+	wt, ok := h.worktreeManager.Get(worktreeID)
+	if !ok || !auth.FromContext(r.Context()).Allows(wt.ProjectID) {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeWorktreeNotFound, "worktree not found: "+worktreeID, nil)
+		return
+	}
+
+	if err := h.worktreeManager.MarkCleanup(worktreeID); err != nil {
+		writeWorktreeError(w, err)
+		return
+	}
+	wt, _ = h.worktreeManager.Get(worktreeID)
+	writeJSON(w, http.StatusOK, wt)
+}
+
+// writeWorktreeError writes a worktree manager error with its status and code
+func writeWorktreeError(w http.ResponseWriter, err error) {
+	status, code := http.StatusInternalServerError, models.ErrorCodeInternal
+	switch {
+	case errors.Is(err, worktree.ErrNotFound):
+		status, code = http.StatusNotFound, models.ErrorCodeWorktreeNotFound
+	case errors.Is(err, worktree.ErrBranchExists), errors.Is(err, worktree.ErrMerging),
+		errors.Is(err, worktree.ErrInvalidTransition):
+		status, code = http.StatusConflict, models.ErrorCodeWorktreeConflict
+	case errors.Is(err, worktree.ErrCapacityReached):
+		status, code = http.StatusServiceUnavailable, models.ErrorCodeWorktreeLimit
+	case errors.Is(err, worktree.ErrRepoUnavailable), gitauth.IsAuth(err):
+		status, code = http.StatusBadGateway, models.ErrorCodeRepoUnavailable
+	}
+	writeErrorCode(w, status, code, err.Error(), nil)
+}
+
 // GetQueueStatus returns the queue status
 func (h *Handlers) GetQueueStatus(w http.ResponseWriter, r *http.Request) {
-	stats := h.queueManager.GetStats()
+	stats := h.queueManager.GetStats(auth.FromContext(r.Context()))
 	writeJSON(w, http.StatusOK, stats)
 }
 
 // HandleCallback handles callbacks from GitHub Actions
 func (h *Handlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
-	// Verify authorization
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		writeError(w, http.StatusUnauthorized, "Missing authorization header")
-		return
-	}
-
 	var result models.JobResult
 	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if !h.verifyCallback(w, r, result.JobID) {
+		return
+	}
 
 	result.ReceivedAt = time.Now()
 
@@ -237,6 +911,292 @@ func (h *Handlers) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Callback received"})
 }
 
+// maxLogUploadSize caps one upload of workflow output
+const maxLogUploadSize = 10 << 20
+
+// HandleLogCallback appends output uploaded by a job's workflow to the job's log
+func (h *Handlers) HandleLogCallback(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job_id")
+	if !h.verifyCallback(w, r, jobID) {
+		return
+	}
+	if jobID == "" {
+		writeError(w, http.StatusBadRequest, "job_id is required")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogUploadSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "Log upload too large")
+		return
+	}
+
+	if err := h.queueManager.AppendJobLog(r.Context(), jobID, body); err != nil {
+		if errors.Is(err, queue.ErrJobNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+			return
+		}
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to store job log upload")
+		writeError(w, http.StatusInternalServerError, "Failed to store job log")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Logs received"})
+}
+
+// GetJobControl tells a running job's workflow whether to stop early
+func (h *Handlers) GetJobControl(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job_id")
+	if !h.verifyCallback(w, r, jobID) {
+		return
+	}
+
+	control, err := h.queueManager.JobControl(jobID)
+	if err != nil {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		return
+	}
+	writeJSON(w, http.StatusOK, control)
+}
+
+// verifyCallback checks the callback token a run sends for jobID, writing
+// the error response when it is not valid for that job's current attempt
+func (h *Handlers) verifyCallback(w http.ResponseWriter, r *http.Request, jobID string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, "Missing callback token")
+		return false
+	}
+
+	switch err := h.queueManager.VerifyCallbackToken(token, jobID); {
+	case err == nil:
+		return true
+	case errors.Is(err, queue.ErrJobNotFound):
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+	case errors.Is(err, queue.ErrTokenOtherJob), errors.Is(err, queue.ErrTokenPastAttempt), errors.Is(err, queue.ErrJobAlreadyCompleted):
+		writeErrorCode(w, http.StatusForbidden, models.ErrorCodeInvalidCallbackToken, err.Error(), nil)
+	default:
+		writeErrorCode(w, http.StatusUnauthorized, models.ErrorCodeInvalidCallbackToken, err.Error(), nil)
+	}
+	return false
+}
+
+// maxWebhookBodySize caps webhook payloads read into memory
+const maxWebhookBodySize = 5 << 20
+
+// HandleGitHubWebhook ingests workflow_run and workflow_job events so job
+// status tracks the Actions run even when the workflow never calls back,
+// push events so QA can be re-run when a PR's base branch moves, and
+// pull_request events so jobs track their PR's state and worktrees are
+// cleaned up once it is closed
+func (h *Handlers) HandleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	// Secrets are verified as last reloaded, so they can be rotated
+	secret := h.reloader.Current().GitHub.WebhookSecret
+	if secret == "" {
+		writeError(w, http.StatusServiceUnavailable, "Webhook secret not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	if !github.VerifySignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		writeJSON(w, http.StatusOK, map[string]string{"message": "pong"})
+		return
+
+	case "workflow_run":
+		var payload github.WorkflowRunEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid workflow_run payload")
+			return
+		}
+		h.queueManager.HandleWorkflowRun(payload.Update())
+
+	case "workflow_job":
+		var payload github.WorkflowJobEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid workflow_job payload")
+			return
+		}
+		h.queueManager.HandleWorkflowRun(payload.Update())
+
+	case "push":
+		var payload github.PushEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid push payload")
+			return
+		}
+		if branch := payload.Branch(); branch != "" {
+			h.queueManager.HandleBaseBranchPush(payload.Repository.FullName, branch, payload.After)
+		}
+
+	case "pull_request":
+		var payload github.PullRequestEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid pull_request payload")
+			return
+		}
+		if state := payload.State(); state != "" {
+			h.pullRequestChanged(payload.Repository.FullName, payload.Number, state)
+		}
+
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"message": "Event ignored"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook processed"})
+}
+
+// HandleGitLabWebhook ingests pipeline events so the status of jobs of
+// GitLab projects tracks their pipeline, push events so QA can be re-run
+// when a merge request's base branch moves, and merge request events so
+// jobs track their merge request's state and worktrees are cleaned up once
+// it is merged or closed
+func (h *Handlers) HandleGitLabWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := h.reloader.Current().GitLab.WebhookSecret
+	if secret == "" {
+		writeError(w, http.StatusServiceUnavailable, "Webhook secret not configured")
+		return
+	}
+	if !gitlab.VerifyToken(secret, r.Header.Get("X-Gitlab-Token")) {
+		writeError(w, http.StatusUnauthorized, "Invalid webhook token")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	switch event := r.Header.Get("X-Gitlab-Event"); event {
+	case "Pipeline Hook":
+		var payload gitlab.PipelineEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid pipeline payload")
+			return
+		}
+		h.queueManager.HandleWorkflowRun(payload.Update())
+
+	case "Push Hook":
+		var payload gitlab.PushEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid push payload")
+			return
+		}
+		if branch := payload.Branch(); branch != "" {
+			h.queueManager.HandleBaseBranchPush(payload.Project.PathWithNamespace, branch, payload.After)
+		}
+
+	case "Merge Request Hook":
+		var payload gitlab.MergeRequestEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid merge request payload")
+			return
+		}
+		if state := payload.State(); state != "" {
+			h.pullRequestChanged(payload.Project.PathWithNamespace, payload.ObjectAttributes.IID, state)
+		}
+
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"message": "Event ignored"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook processed"})
+}
+
+// HandleBitbucketWebhook ingests the commit statuses Bitbucket Pipelines
+// reports so the status of jobs of Bitbucket projects tracks their
+// pipeline, pushes so QA can be re-run when a pull request's base branch
+// moves, and merged or declined pull requests so their worktrees are
+// cleaned up
+func (h *Handlers) HandleBitbucketWebhook(w http.ResponseWriter, r *http.Request) {
+	secret := h.reloader.Current().Bitbucket.WebhookSecret
+	if secret == "" {
+		writeError(w, http.StatusServiceUnavailable, "Webhook secret not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	if !bitbucket.VerifySignature(secret, body, r.Header.Get("X-Hub-Signature")) {
+		writeError(w, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	switch event := r.Header.Get("X-Event-Key"); event {
+	case "repo:commit_status_created", "repo:commit_status_updated":
+		var payload bitbucket.CommitStatusEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid commit status payload")
+			return
+		}
+		if update := payload.Update(); update != nil {
+			h.queueManager.HandleWorkflowRun(update)
+		}
+
+	case "repo:push":
+		var payload bitbucket.PushEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid push payload")
+			return
+		}
+		for branch, head := range payload.BranchHeads() {
+			h.queueManager.HandleBaseBranchPush(payload.Repository.FullName, branch, head)
+		}
+
+	case "pullrequest:fulfilled", "pullrequest:rejected":
+		var payload bitbucket.PullRequestEvent
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid pull request payload")
+			return
+		}
+		state := models.PRStateMerged
+		if event == "pullrequest:rejected" {
+			state = models.PRStateClosed
+		}
+		h.pullRequestChanged(payload.Repository.FullName, payload.PullRequest.ID, state)
+
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"message": "Event ignored"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Webhook processed"})
+}
+
+// pullRequestChanged records a pull request's new state on the jobs that
+// opened it and, once it is merged or closed, schedules the cleanup of the
+// worktrees kept for it
+func (h *Handlers) pullRequestChanged(repo string, number int, state models.PRState) {
+	h.queueManager.HandlePullRequest(repo, number, state)
+	if state == models.PRStateOpen {
+		return
+	}
+	for _, id := range h.worktreeManager.ResolvePullRequest(repo, number) {
+		log.Info().
+			Str("worktree_id", id).
+			Str("repo", repo).
+			Int("pr_number", number).
+			Msg("Pull request resolved, cleaning up worktree")
+	}
+}
+
 // Helper functions
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -245,8 +1205,160 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+// jobLatencyMetrics renders how long jobs wait for dispatch and run. With
+// exemplars, each bucket links to the trace of a job that fell in it.
+func jobLatencyMetrics(stats *models.JobLatencyStats, exemplars bool) string {
+	metrics := "# HELP autobuild_job_dispatch_latency_seconds How long jobs wait from submission to dispatch\n"
+	metrics += "# TYPE autobuild_job_dispatch_latency_seconds histogram\n"
+	metrics += histogramMetric("autobuild_job_dispatch_latency_seconds", "", stats.DispatchLatency, exemplars)
+
+	statuses := make([]string, 0, len(stats.Duration))
+	for status := range stats.Duration {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	metrics += "# HELP autobuild_job_duration_seconds How long runs take from dispatch to their result\n"
+	metrics += "# TYPE autobuild_job_duration_seconds histogram\n"
+	for _, status := range statuses {
+		metrics += histogramMetric("autobuild_job_duration_seconds", "status=\""+status+"\"", stats.Duration[status], exemplars)
+	}
+	return metrics
+}
+
+// artifactMetrics renders what the job log retention sweeper has reclaimed
+func artifactMetrics(stats models.ArtifactRetentionStats) string {
+	metrics := "# HELP autobuild_artifact_sweeps_total Job log retention sweeps\n"
+	metrics += "# TYPE autobuild_artifact_sweeps_total counter\n"
+	metrics += "autobuild_artifact_sweeps_total " + strconv.FormatUint(stats.Sweeps, 10) + "\n"
+	metrics += "# HELP autobuild_artifact_deleted_total Job logs deleted by retention\n"
+	metrics += "# TYPE autobuild_artifact_deleted_total counter\n"
+	metrics += "autobuild_artifact_deleted_total " + strconv.FormatUint(stats.DeletedLogs, 10) + "\n"
+	metrics += "# HELP autobuild_artifact_reclaimed_bytes_total Bytes of job logs deleted by retention\n"
+	metrics += "# TYPE autobuild_artifact_reclaimed_bytes_total counter\n"
+	metrics += "autobuild_artifact_reclaimed_bytes_total " + strconv.FormatUint(stats.ReclaimedBytes, 10) + "\n"
+	metrics += "# HELP autobuild_artifact_stored_bytes Bytes of job logs stored after the latest sweep\n"
+	metrics += "# TYPE autobuild_artifact_stored_bytes gauge\n"
+	metrics += "autobuild_artifact_stored_bytes " + strconv.FormatInt(stats.StoredBytes, 10) + "\n"
+	return metrics
+}
+
+// worktreeMetrics renders worktree counts by status, churn, and the age and
+// last measured disk usage of each worktree, so leaks show before the disk
+// fills
+func worktreeMetrics(stats *models.WorktreeStats, worktrees []models.Worktree, now time.Time) string {
+	metrics := "# HELP autobuild_worktrees Number of worktrees by status\n"
+	metrics += "# TYPE autobuild_worktrees gauge\n"
+	for _, status := range []struct {
+		name  models.WorktreeStatus
+		count int
+	}{
+		{models.WorktreeStatusActive, stats.Active},
+		{models.WorktreeStatusPooled, stats.Pooled},
+		{models.WorktreeStatusMerging, stats.Merging},
+		{models.WorktreeStatusCleanup, stats.Cleanup},
+	} {
+		metrics += "autobuild_worktrees{status=\"" + string(status.name) + "\"} " + intToString(status.count) + "\n"
+	}
+	metrics += "# HELP autobuild_worktrees_created_total Worktrees checked out since startup\n"
+	metrics += "# TYPE autobuild_worktrees_created_total counter\n"
+	metrics += "autobuild_worktrees_created_total " + strconv.FormatUint(stats.CreatedTotal, 10) + "\n"
+	metrics += "# HELP autobuild_worktrees_removed_total Worktrees removed from disk since startup\n"
+	metrics += "# TYPE autobuild_worktrees_removed_total counter\n"
+	metrics += "autobuild_worktrees_removed_total " + strconv.FormatUint(stats.RemovedTotal, 10) + "\n"
+
+	sort.Slice(worktrees, func(i, j int) bool { return worktrees[i].ID < worktrees[j].ID })
+	var ages, usage string
+	for _, wt := range worktrees {
+		labels := "{worktree_id=\"" + labelValue(wt.ID) + "\",project_id=\"" + labelValue(wt.ProjectID) + "\",status=\"" + string(wt.Status) + "\"} "
+		ages += "autobuild_worktree_age_seconds" + labels + strconv.FormatFloat(now.Sub(wt.CreatedAt).Seconds(), 'f', 0, 64) + "\n"
+		usage += "autobuild_worktree_disk_bytes" + labels + strconv.FormatInt(wt.DiskUsageBytes, 10) + "\n"
+	}
+	metrics += "# HELP autobuild_worktree_age_seconds Time since each worktree was checked out\n"
+	metrics += "# TYPE autobuild_worktree_age_seconds gauge\n" + ages
+	metrics += "# HELP autobuild_worktree_disk_bytes Disk usage of each worktree when last measured\n"
+	metrics += "# TYPE autobuild_worktree_disk_bytes gauge\n" + usage
+	return metrics
+}
+
+// schedulerMetrics renders the dispatch loop timings and scan lengths
+func schedulerMetrics(sched *models.SchedulerStats) string {
+	metrics := "# HELP autobuild_scheduler_ticks_total Dispatch loop passes that scanned the queue\n"
+	metrics += "# TYPE autobuild_scheduler_ticks_total counter\n"
+	metrics += "autobuild_scheduler_ticks_total " + strconv.FormatUint(sched.Ticks, 10) + "\n"
+	metrics += "# HELP autobuild_scheduler_tick_duration_seconds How long each dispatch loop pass holds the queue lock\n"
+	metrics += "# TYPE autobuild_scheduler_tick_duration_seconds histogram\n"
+	metrics += histogramMetric("autobuild_scheduler_tick_duration_seconds", "", sched.TickDuration, false)
+
+	ops := make([]string, 0, len(sched.LockWait))
+	for op := range sched.LockWait {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	metrics += "# HELP autobuild_scheduler_lock_wait_seconds How long operations wait for the queue lock\n"
+	metrics += "# TYPE autobuild_scheduler_lock_wait_seconds histogram\n"
+	for _, op := range ops {
+		metrics += histogramMetric("autobuild_scheduler_lock_wait_seconds", "op=\""+op+"\"", sched.LockWait[op], false)
+	}
+
+	metrics += "# HELP autobuild_scheduler_queue_length Queued jobs listed by the latest dispatch loop pass\n"
+	metrics += "# TYPE autobuild_scheduler_queue_length gauge\n"
+	metrics += "autobuild_scheduler_queue_length " + intToString(sched.QueueLength) + "\n"
+	metrics += "# HELP autobuild_scheduler_scan_length Queued jobs examined by the latest dispatch loop pass\n"
+	metrics += "# TYPE autobuild_scheduler_scan_length gauge\n"
+	metrics += "autobuild_scheduler_scan_length " + intToString(sched.ScanLength) + "\n"
+	metrics += "# HELP autobuild_scheduler_scanned_jobs_total Queued jobs examined by all dispatch loop passes\n"
+	metrics += "# TYPE autobuild_scheduler_scanned_jobs_total counter\n"
+	metrics += "autobuild_scheduler_scanned_jobs_total " + strconv.FormatUint(sched.ScannedTotal, 10) + "\n"
+	metrics += "# HELP autobuild_scheduler_dispatched_total Jobs handed to workers by the dispatch loop\n"
+	metrics += "# TYPE autobuild_scheduler_dispatched_total counter\n"
+	metrics += "autobuild_scheduler_dispatched_total " + strconv.FormatUint(sched.Dispatched, 10) + "\n"
+
+	// Every resource is listed so the series exist before the first deferral
+	metrics += "# HELP autobuild_dispatch_deferrals_total Dispatch loop passes held back by a short host resource\n"
+	metrics += "# TYPE autobuild_dispatch_deferrals_total counter\n"
+	for _, resource := range []string{"disk", "load", "memory"} {
+		metrics += "autobuild_dispatch_deferrals_total{resource=\"" + resource + "\"} " + strconv.FormatUint(sched.Deferrals[resource], 10) + "\n"
+	}
+	metrics += "# HELP autobuild_dispatch_deferred Whether a short host resource holds dispatching back (1) or not (0)\n"
+	metrics += "# TYPE autobuild_dispatch_deferred gauge\n"
+	for _, resource := range []string{"disk", "load", "memory"} {
+		deferred := 0
+		if sched.DeferredFor == resource {
+			deferred = 1
+		}
+		metrics += "autobuild_dispatch_deferred{resource=\"" + resource + "\"} " + intToString(deferred) + "\n"
+	}
+	return metrics
+}
+
+// histogramMetric renders the bucket, sum and count series of a histogram.
+// labels, if any, are added to every series, and bucket exemplars are
+// rendered when exemplars is set.
+func histogramMetric(name, labels string, h models.Histogram, exemplars bool) string {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var metrics string
+	for _, b := range h.Buckets {
+		le := strconv.FormatFloat(b.UpperBound, 'g', -1, 64)
+		metrics += name + "_bucket{" + labels + sep + "le=\"" + le + "\"} " + strconv.FormatUint(b.Count, 10)
+		if exemplars {
+			metrics += exemplarSuffix(b.Exemplar)
+		}
+		metrics += "\n"
+	}
+	metrics += name + "_bucket{" + labels + sep + "le=\"+Inf\"} " + strconv.FormatUint(h.Count, 10)
+	if exemplars {
+		metrics += exemplarSuffix(h.InfExemplar)
+	}
+	metrics += "\n"
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	metrics += name + "_sum" + labels + " " + strconv.FormatFloat(h.Sum, 'g', -1, 64) + "\n"
+	metrics += name + "_count" + labels + " " + strconv.FormatUint(h.Count, 10) + "\n"
+	return metrics
 }
 
 func formatMetrics(format string, args ...interface{}) string {
@@ -282,6 +1394,16 @@ func formatArg(arg interface{}) string {
 	}
 }
 
+// labelEscaper escapes what the exposition format does not allow unescaped
+// in a label value
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue escapes a value from outside the orchestrator, such as a
+// source or project ID, for use as a metric label value
+func labelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
 func intToString(n int) string {
 	if n == 0 {
 		return "0"
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/openapi"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/version"
+)
+
+// route describes one /api/v1 endpoint for the OpenAPI document. Request and
+// response are zero values of the Go types the handler decodes and encodes.
+type route struct {
+	method      string
+	path        string
+	tag         string
+	summary     string
+	query       []string // integer parameters unless written "name:type"
+	request     interface{}
+	status      string
+	response    interface{}
+	contentType string // response content type when not JSON
+	auth        bool
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// apiRoutes lists the documented endpoints. Keep it in step with NewRouter.
+var apiRoutes = []route{
+	{method: "get", path: "/health", tag: "system", summary: "Health check", status: "200", response: models.HealthResponse{}},
+	{method: "get", path: "/metrics", tag: "system", summary: "Prometheus metrics; OpenMetrics with trace exemplars when the Accept header asks for it", status: "200", contentType: "text/plain"},
+
+	{method: "post", path: "/jobs", tag: "jobs", summary: "Submit a job; force=true runs it even while another job of the ticket is unfinished", query: []string{"force:boolean"}, request: models.CreateJobRequest{}, status: "201", response: models.CreateJobResponse{}, auth: true},
+	{method: "get", path: "/jobs", tag: "jobs", summary: "List jobs; fields picks a sparse fieldset and include the attempts, events and artifacts to embed", query: []string{"project_id:string", "source:string", "status:string", "group_id:string", "failure_kind:string", "label:string", "fields:string", "include:string"}, status: "200", response: struct {
+		Jobs  []models.Job `json:"jobs"`
+		Total int          `json:"total"`
+	}{}, auth: true},
+	{method: "get", path: "/jobs/search", tag: "jobs", summary: "Search jobs, in memory and archived, whose prompt, ticket title or description, or error message contain every word of q, newest first; from and to bound their creation", query: []string{"q:string", "project_id:string", "status:string", "from:string", "to:string", "limit", "fields:string", "include:string"}, status: "200", response: struct {
+		Jobs  []models.Job `json:"jobs"`
+		Total int          `json:"total"`
+	}{}, auth: true},
+	{method: "get", path: "/jobs/{jobID}", tag: "jobs", summary: "Get a job; fields picks a sparse fieldset and include the attempts, events and artifacts to embed", query: []string{"fields:string", "include:string"}, status: "200", response: models.Job{}, auth: true},
+	{method: "patch", path: "/jobs/{jobID}", tag: "jobs", summary: "Change a queued job", request: models.UpdateJobRequest{}, status: "200", response: models.CreateJobResponse{}, auth: true},
+	{method: "delete", path: "/jobs/{jobID}", tag: "jobs", summary: "Cancel a job; mode=soft lets the agent push its partial work first", query: []string{"mode:string"}, status: "200", response: messageResponse{}, auth: true},
+	{method: "post", path: "/jobs/{jobID}/retry", tag: "jobs", summary: "Requeue a failed or cancelled job", request: models.RequeueJobRequest{}, status: "201", response: models.CreateJobResponse{}, auth: true},
+	{method: "get", path: "/jobs/{jobID}/logs", tag: "jobs", summary: "Get the last lines of a job's log", query: []string{"tail"}, status: "200", response: struct {
+		JobID string   `json:"job_id"`
+		Logs  []string `json:"logs"`
+	}{}, auth: true},
+	{method: "get", path: "/jobs/{jobID}/events", tag: "jobs", summary: "Get the state changes of a job", status: "200", response: struct {
+		JobID  string            `json:"job_id"`
+		Events []models.JobEvent `json:"events"`
+	}{}, auth: true},
+	{method: "get", path: "/jobs/{jobID}/report", tag: "jobs", summary: "Get the markdown report of an analysis job", status: "200", contentType: "text/markdown", auth: true},
+	{method: "get", path: "/jobs/{jobID}/logs/download", tag: "jobs", summary: "Download a job's full log", status: "200", contentType: "text/plain", auth: true},
+	{method: "get", path: "/jobs/{jobID}/logs/stream", tag: "jobs", summary: "Stream job status changes", status: "200", contentType: "text/event-stream", auth: true},
+	{method: "get", path: "/jobs/{jobID}/run", tag: "jobs", summary: "Ask a job's executor where its run is", status: "200", response: models.RunStatus{}, auth: true},
+	{method: "post", path: "/jobs/{jobID}/retention", tag: "jobs", summary: "Keep a job's logs for more days than its project's retention", request: models.ExtendRetentionRequest{}, status: "200", response: models.ExtendRetentionResponse{}, auth: true},
+	{method: "get", path: "/jobs/{jobID}/attempts/compare", tag: "jobs", summary: "Compare two attempts of a job", query: []string{"from", "to"}, status: "200", response: models.AttemptComparison{}, auth: true},
+
+	{method: "get", path: "/groups/{groupID}", tag: "jobs", summary: "Get a job group and its rolled-up status", status: "200", response: models.JobGroup{}, auth: true},
+
+	{method: "get", path: "/worktrees", tag: "worktrees", summary: "List worktrees", status: "200", response: struct {
+		Worktrees []models.Worktree    `json:"worktrees"`
+		Stats     models.WorktreeStats `json:"stats"`
+	}{}, auth: true},
+	{method: "post", path: "/worktrees", tag: "worktrees", summary: "Create a worktree", request: struct {
+		ProjectID    string `json:"project_id"`
+		RepoFullName string `json:"repo_full_name"`
+		BaseBranch   string `json:"base_branch"`
+		TicketID     string `json:"ticket_id"`
+		BranchName   string `json:"branch_name"`
+	}{}, status: "201", response: models.Worktree{}, auth: true},
+	{method: "delete", path: "/worktrees/{worktreeID}", tag: "worktrees", summary: "Delete a worktree", status: "200", response: messageResponse{}, auth: true},
+	{method: "post", path: "/worktrees/{worktreeID}/merging", tag: "worktrees", summary: "Keep a worktree until its pull request is resolved", request: models.WorktreeMergingRequest{}, status: "200", response: models.Worktree{}, auth: true},
+	{method: "post", path: "/worktrees/{worktreeID}/cleanup", tag: "worktrees", summary: "Schedule a worktree for cleanup once its pull request is resolved", status: "200", response: models.Worktree{}, auth: true},
+
+	{method: "get", path: "/projects", tag: "projects", summary: "List project settings", status: "200", response: struct {
+		Projects []models.ProjectSettings `json:"projects"`
+		Total    int                      `json:"total"`
+	}{}, auth: true},
+	{method: "get", path: "/projects/stale", tag: "projects", summary: "List projects without recent jobs (admin)", status: "200", response: models.StaleProjectsReport{}, auth: true},
+	{method: "get", path: "/projects/{projectID}", tag: "projects", summary: "Get project settings", status: "200", response: models.ProjectSettings{}, auth: true},
+	{method: "put", path: "/projects/{projectID}", tag: "projects", summary: "Set project settings (admin)", request: models.ProjectSettings{}, status: "200", response: models.ProjectSettings{}, auth: true},
+	{method: "delete", path: "/projects/{projectID}", tag: "projects", summary: "Reset project settings (admin)", status: "200", response: messageResponse{}, auth: true},
+	{method: "post", path: "/projects/{projectID}/archive", tag: "projects", summary: "Archive a project and evict its repository cache (admin)", status: "200", response: models.ProjectSettings{}, auth: true},
+	{method: "delete", path: "/projects/{projectID}/archive", tag: "projects", summary: "Unarchive a project (admin)", status: "200", response: models.ProjectSettings{}, auth: true},
+
+	{method: "get", path: "/queue", tag: "queue", summary: "Queue status", status: "200", response: models.QueueStats{}, auth: true},
+	{method: "post", path: "/queue/pause", tag: "queue", summary: "Pause dispatching (admin)", request: pauseRequest{}, status: "200", response: models.QueuePause{}, auth: true},
+	{method: "post", path: "/queue/resume", tag: "queue", summary: "Resume dispatching (admin)", status: "200", response: messageResponse{}, auth: true},
+	{method: "get", path: "/queue/drain", tag: "queue", summary: "Drain progress", status: "200", response: models.DrainStatus{}, auth: true},
+	{method: "post", path: "/queue/drain", tag: "queue", summary: "Stop dispatching and let in-flight work settle (admin)", status: "202", response: models.DrainStatus{}, auth: true},
+	{method: "delete", path: "/queue/drain", tag: "queue", summary: "Cancel a drain (admin)", status: "200", response: messageResponse{}, auth: true},
+	{method: "get", path: "/reservations", tag: "queue", summary: "List worker slot reservations", status: "200", response: struct {
+		Reservations []models.Reservation `json:"reservations"`
+		Total        int                  `json:"total"`
+	}{}, auth: true},
+	{method: "post", path: "/reservations", tag: "queue", summary: "Reserve worker slots (admin)", request: models.CreateReservationRequest{}, status: "201", response: models.Reservation{}, auth: true},
+	{method: "delete", path: "/reservations/{reservationID}", tag: "queue", summary: "Cancel a reservation (admin)", status: "200", response: messageResponse{}, auth: true},
+
+	{method: "get", path: "/stats", tag: "reports", summary: "Throughput, failure rate, average duration and queue wait of recent jobs per time bucket; range and bucket are durations such as 24h and 1h", query: []string{"range:string", "bucket:string", "project_id:string"}, status: "200", response: models.JobStats{}, auth: true},
+	{method: "get", path: "/reports/jobs", tag: "reports", summary: "Daily, weekly or monthly rollups of finished jobs per project", query: []string{"project_id:string", "from:string", "to:string", "interval:string"}, status: "200", response: models.JobReport{}, auth: true},
+
+	{method: "post", path: "/admin/reconcile", tag: "admin", summary: "Reconcile GitHub state with job state (admin)", request: models.ReconcileRequest{}, status: "200", response: models.ReconcileReport{}, auth: true},
+	{method: "post", path: "/admin/purge", tag: "admin", summary: "Evict and purge finished jobs (admin)", request: models.PurgeRequest{}, status: "200", response: models.PurgeResult{}, auth: true},
+	{method: "post", path: "/admin/rollups", tag: "admin", summary: "Recompute the job rollups of a range of days (admin)", request: models.RollupRequest{}, status: "200", response: models.RollupResult{}, auth: true},
+	{method: "get", path: "/admin/dump", tag: "admin", summary: "Snapshot queue and worktree state for bug reports (admin)", status: "200", response: models.DebugDump{}, auth: true},
+	{method: "post", path: "/admin/reload", tag: "admin", summary: "Reload the configuration's runtime-tunable settings, as SIGHUP does (admin)", status: "200", response: models.ReloadResult{}, auth: true},
+
+	{method: "post", path: "/callback", tag: "callbacks", summary: "Report a job result from GitHub Actions", request: models.JobResult{}, status: "200", response: messageResponse{}, auth: true},
+	{method: "post", path: "/callback/logs", tag: "callbacks", summary: "Upload workflow output to a job's log", query: []string{"job_id:string"}, status: "200", response: messageResponse{}, auth: true},
+	{method: "get", path: "/callback/control", tag: "callbacks", summary: "Tell a running workflow whether to stop early", query: []string{"job_id:string"}, status: "200", response: models.JobControl{}, auth: true},
+	{method: "post", path: "/webhooks/github", tag: "callbacks", summary: "Receive GitHub webhooks", status: "200", response: messageResponse{}},
+	{method: "post", path: "/webhooks/gitlab", tag: "callbacks", summary: "Receive GitLab pipeline and push webhooks", status: "200", response: messageResponse{}},
+	{method: "post", path: "/webhooks/bitbucket", tag: "callbacks", summary: "Receive Bitbucket commit status and push webhooks", status: "200", response: messageResponse{}},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *openapi.Document
+)
+
+// buildOpenAPI generates the OpenAPI document from apiRoutes and the model types
+func buildOpenAPI() *openapi.Document {
+	gen := openapi.NewGenerator()
+	errSchema := gen.SchemaOf(models.ErrorResponse{})
+
+	doc := &openapi.Document{
+		OpenAPI: "3.0.3",
+		Info:    openapi.Info{Title: "AutoBuild Orchestrator API", Version: version.Version},
+		Servers: []openapi.Server{{URL: "/api/v1"}},
+		Paths:   make(map[string]map[string]openapi.Operation),
+		Components: openapi.Components{
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+
+	for _, rt := range apiRoutes {
+		op := openapi.Operation{
+			Summary:   rt.summary,
+			Tags:      []string{rt.tag},
+			Responses: make(map[string]openapi.Response),
+		}
+
+		for _, segment := range strings.Split(rt.path, "/") {
+			if strings.HasPrefix(segment, "{") {
+				op.Parameters = append(op.Parameters, openapi.Parameter{
+					Name:     strings.Trim(segment, "{}"),
+					In:       "path",
+					Required: true,
+					Schema:   &openapi.Schema{Type: "string"},
+				})
+			}
+		}
+		for _, name := range rt.query {
+			typ := "integer"
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name, typ = name[:i], name[i+1:]
+			}
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name:   name,
+				In:     "query",
+				Schema: &openapi.Schema{Type: typ},
+			})
+		}
+
+		if rt.request != nil {
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"application/json": {Schema: gen.SchemaOf(rt.request)}},
+			}
+		}
+
+		switch {
+		case rt.contentType != "":
+			op.Responses[rt.status] = openapi.Response{
+				Description: "OK",
+				Content:     map[string]openapi.MediaType{rt.contentType: {Schema: &openapi.Schema{Type: "string"}}},
+			}
+		case rt.response != nil:
+			op.Responses[rt.status] = openapi.Response{
+				Description: "OK",
+				Content:     map[string]openapi.MediaType{"application/json": {Schema: gen.SchemaOf(rt.response)}},
+			}
+		}
+		op.Responses["default"] = openapi.Response{
+			Description: "Error",
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: errSchema}},
+		}
+
+		if rt.auth {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+
+		if doc.Paths[rt.path] == nil {
+			doc.Paths[rt.path] = make(map[string]openapi.Operation)
+		}
+		doc.Paths[rt.path][rt.method] = op
+	}
+
+	doc.Components.Schemas = gen.Schemas()
+	return doc
+}
+
+// OpenAPI serves the generated OpenAPI document for the /api/v1 surface
+func (h *Handlers) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = buildOpenAPI()
+	})
+	writeJSON(w, http.StatusOK, openAPIDoc)
+}
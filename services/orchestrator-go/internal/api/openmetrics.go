@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// acceptsOpenMetrics reports whether a scrape asks for the OpenMetrics format
+func acceptsOpenMetrics(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+}
+
+// exemplarSuffix renders an exemplar to follow a bucket sample, or "" for nil
+func exemplarSuffix(e *models.Exemplar) string {
+	if e == nil {
+		return ""
+	}
+	ts := float64(e.Timestamp.UnixNano()) / 1e9
+	return " # {trace_id=\"" + e.TraceID + "\"} " +
+		strconv.FormatFloat(e.Value, 'g', -1, 64) + " " +
+		strconv.FormatFloat(ts, 'f', 3, 64)
+}
+
+// toOpenMetrics converts the text exposition to OpenMetrics: counter
+// families are named without their _total suffix, which only their samples
+// carry, and the exposition ends with # EOF
+func toOpenMetrics(metrics string) string {
+	lines := strings.Split(strings.TrimSuffix(metrics, "\n"), "\n")
+
+	counters := make(map[string]bool)
+	for _, line := range lines {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok && strings.HasSuffix(name, " counter") {
+			counters[strings.TrimSuffix(name, " counter")] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		for _, prefix := range []string{"# HELP ", "# TYPE "} {
+			rest, ok := strings.CutPrefix(line, prefix)
+			if !ok {
+				continue
+			}
+			name, desc, _ := strings.Cut(rest, " ")
+			if counters[name] {
+				line = prefix + strings.TrimSuffix(name, "_total") + " " + desc
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("# EOF\n")
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+)
+
+type pauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PauseQueue stops dispatching jobs while continuing to accept submissions
+func (h *Handlers) PauseQueue(w http.ResponseWriter, r *http.Request) {
+	// The body is optional
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	pause := h.queueManager.Pause(req.Reason, auth.FromContext(r.Context()).Name)
+	writeJSON(w, http.StatusOK, pause)
+}
+
+// ResumeQueue restarts dispatching after a pause
+func (h *Handlers) ResumeQueue(w http.ResponseWriter, r *http.Request) {
+	message := "Queue resumed"
+	if !h.queueManager.Resume(auth.FromContext(r.Context()).Name) {
+		message = "Queue was not paused"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": message})
+}
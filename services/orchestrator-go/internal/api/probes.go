@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Livez answers liveness probes. It only fails when the dispatch loop has
+// stalled, so a restart is what it takes; dependencies being down do not
+// make a restart help.
+func (h *Handlers) Livez(w http.ResponseWriter, r *http.Request) {
+	if stalled := h.queueManager.LoopStalledFor(); stalled > h.cfg.Server.LivenessStallTimeout {
+		writeJSON(w, http.StatusServiceUnavailable, models.ProbeResponse{
+			Status:  "unavailable",
+			Reasons: []string{"dispatch loop stalled for " + stalled.Round(time.Second).String()},
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ProbeResponse{Status: "ok"})
+}
+
+// Readyz answers readiness probes. It fails until the queue has been loaded
+// at startup, while draining and while the queue backend or database is
+// unreachable, so traffic goes to other instances meanwhile.
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	var reasons []string
+	if !h.queueManager.Started() {
+		reasons = append(reasons, "starting: queue not loaded yet")
+	}
+	if h.queueManager.DrainStatus().Draining {
+		reasons = append(reasons, "draining")
+	}
+	for _, check := range h.checks.Unready(h.checks.Run(r.Context())) {
+		reasons = append(reasons, check.Name+": "+check.Error)
+	}
+
+	if len(reasons) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, models.ProbeResponse{Status: "unavailable", Reasons: reasons})
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ProbeResponse{Status: "ok"})
+}
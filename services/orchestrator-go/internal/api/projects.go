@@ -0,0 +1,251 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/egress"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/worktree"
+)
+
+// ciExecutorSCM names the host whose CI each CI executor runs in; it can
+// only run projects hosted there
+var ciExecutorSCM = map[string]string{
+	models.ExecutorGitHubActions:      models.SCMGitHub,
+	models.ExecutorGitLabCI:           models.SCMGitLab,
+	models.ExecutorBitbucketPipelines: models.SCMBitbucket,
+}
+
+// ListProjects returns the settings of every project visible to the caller
+func (h *Handlers) ListProjects(w http.ResponseWriter, r *http.Request) {
+	principal := auth.FromContext(r.Context())
+	projects := make([]models.ProjectSettings, 0)
+	for _, settings := range h.projects.List() {
+		if principal.Allows(settings.ProjectID) {
+			projects = append(projects, settings)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"projects": projects,
+		"total":    len(projects),
+	})
+}
+
+// GetProject returns a project's settings
+func (h *Handlers) GetProject(w http.ResponseWriter, r *http.Request) {
+	projectID := chi.URLParam(r, "projectID")
+
+	settings, ok := h.projects.Get(projectID)
+	if !ok || !auth.FromContext(r.Context()).Allows(projectID) {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeProjectNotFound, "Project not found", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// PutProject creates or replaces a project's settings
+func (h *Handlers) PutProject(w http.ResponseWriter, r *http.Request) {
+	var settings models.ProjectSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	settings.ProjectID = chi.URLParam(r, "projectID")
+	if !ids.Valid(settings.ProjectID) {
+		writeError(w, http.StatusBadRequest, "Project IDs must be 1-"+intToString(ids.MaxLength)+" letters, digits, '-' or '_'")
+		return
+	}
+
+	if !validPriority(settings.DefaultPriority) || !validPriority(settings.MaxPriority) {
+		writeError(w, http.StatusBadRequest, "Priorities must be between 0 (low) and 3 (critical)")
+		return
+	}
+	if settings.DefaultPriority != nil && settings.MaxPriority != nil && *settings.DefaultPriority > *settings.MaxPriority {
+		writeError(w, http.StatusBadRequest, "default_priority may not exceed max_priority")
+		return
+	}
+	if settings.MaxParallel < 0 {
+		writeError(w, http.StatusBadRequest, "max_parallel may not be negative")
+		return
+	}
+	if settings.SchedulingWeight < 0 {
+		writeError(w, http.StatusBadRequest, "scheduling_weight may not be negative")
+		return
+	}
+	if settings.MaxQueueDepth < 0 {
+		writeError(w, http.StatusBadRequest, "max_queue_depth may not be negative")
+		return
+	}
+	if ret := settings.ArtifactRetention; ret != nil && (ret.Days < 0 || ret.MaxBytes < 0) {
+		writeError(w, http.StatusBadRequest, "artifact_retention days and max_bytes may not be negative")
+		return
+	}
+	if limit := settings.DiffLimit; limit != nil {
+		if limit.MaxLines < 0 || limit.MaxFiles < 0 {
+			writeError(w, http.StatusBadRequest, "diff_limit max_lines and max_files may not be negative")
+			return
+		}
+		switch limit.Action {
+		case "", models.DiffLimitFail, models.DiffLimitFlag:
+		default:
+			writeError(w, http.StatusBadRequest, "diff_limit action must be one of: fail, flag")
+			return
+		}
+	}
+	if settings.Executor != "" && !slices.Contains(h.queueManager.Executors(), settings.Executor) {
+		writeError(w, http.StatusBadRequest, "executor must be one of: "+strings.Join(h.queueManager.Executors(), ", "))
+		return
+	}
+	switch settings.SCM {
+	case "", models.SCMGitHub, models.SCMGitLab, models.SCMBitbucket:
+	default:
+		writeError(w, http.StatusBadRequest, "scm must be one of: github, gitlab, bitbucket")
+		return
+	}
+	executorName := settings.Executor
+	if executorName == "" {
+		executorName = h.queueManager.DefaultExecutor()
+	}
+	if host, ok := ciExecutorSCM[executorName]; ok && host != cmp.Or(settings.SCM, models.SCMGitHub) {
+		writeError(w, http.StatusBadRequest, "the "+executorName+" executor cannot run projects hosted on "+cmp.Or(settings.SCM, models.SCMGitHub))
+		return
+	}
+	if settings.DeployKey != "" {
+		if err := gitauth.ValidateDeployKey(settings.DeployKey); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := worktree.ValidateSparsePaths(settings.SparsePaths); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch settings.LFS {
+	case "", models.LFSModeAuto, models.LFSModeAlways, models.LFSModeSkip:
+	default:
+		writeError(w, http.StatusBadRequest, "lfs must be one of: auto, always, skip")
+		return
+	}
+	if settings.Egress != nil {
+		if err := egress.Validate(settings.Egress.AllowedHosts); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !queue.EnforcesEgress(executorName) {
+			writeError(w, http.StatusBadRequest, "egress needs the docker or kubernetes executor, not "+executorName)
+			return
+		}
+	}
+	if err := github.ValidatePayloadTemplate(settings.DispatchTemplate); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if settings.Locale != "" && !h.queueManager.HasLocale(settings.Locale) {
+		writeError(w, http.StatusBadRequest, "no messages for locale "+settings.Locale)
+		return
+	}
+	if err := messages.Validate(settings.Messages); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if tracker := settings.Tracker; tracker != nil {
+		if !slices.Contains(h.queueManager.Trackers(), tracker.Type) {
+			if len(h.queueManager.Trackers()) == 0 {
+				writeError(w, http.StatusBadRequest, "no issue trackers are configured")
+			} else {
+				writeError(w, http.StatusBadRequest, "tracker type must be one of: "+strings.Join(h.queueManager.Trackers(), ", "))
+			}
+			return
+		}
+		for event := range tracker.Transitions {
+			if !slices.Contains(models.TicketEvents, event) {
+				writeError(w, http.StatusBadRequest, "tracker transitions must be for: "+strings.Join(models.TicketEvents, ", "))
+				return
+			}
+		}
+	}
+	if len(settings.QAChecks) > 0 && cmp.Or(settings.SCM, models.SCMGitHub) != models.SCMGitHub {
+		writeError(w, http.StatusBadRequest, "qa_checks run GitHub Actions workflows, so they need scm github")
+		return
+	}
+	names := make(map[string]bool, len(settings.QAChecks))
+	workflows := make(map[string]bool, len(settings.QAChecks))
+	for _, check := range settings.QAChecks {
+		if check.Name == "" || check.Workflow == "" {
+			writeError(w, http.StatusBadRequest, "qa_checks need a name and a workflow")
+			return
+		}
+		if names[check.Name] || workflows[check.Workflow] {
+			writeError(w, http.StatusBadRequest, "qa_checks names and workflows must be unique")
+			return
+		}
+		names[check.Name], workflows[check.Workflow] = true, true
+	}
+	if err := project.ValidateBranchTemplate(settings.BranchTemplate); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := project.ValidateTemplates(settings, h.queueManager.Executors()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := project.ValidateDispatchRates(settings); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Archiving has its own endpoint
+	existing, _ := h.projects.Get(settings.ProjectID)
+	settings.ArchivedAt = existing.ArchivedAt
+
+	writeJSON(w, http.StatusOK, h.projects.Put(settings))
+}
+
+// ArchiveProject archives a project: it accepts no new jobs and its
+// repository cache is evicted
+func (h *Handlers) ArchiveProject(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.queueManager.ArchiveProject(chi.URLParam(r, "projectID"))
+	if errors.Is(err, queue.ErrProjectBusy) {
+		writeErrorCode(w, http.StatusConflict, models.ErrorCodeProjectBusy, "Project has unfinished jobs", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// UnarchiveProject lets an archived project accept jobs again
+func (h *Handlers) UnarchiveProject(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.queueManager.UnarchiveProject(chi.URLParam(r, "projectID")))
+}
+
+// ListStaleProjects reports the projects without new jobs for longer than
+// PROJECT_STALE_AFTER, the candidates for archiving
+func (h *Handlers) ListStaleProjects(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.queueManager.StaleProjects())
+}
+
+// DeleteProject removes a project's settings, reverting it to the defaults
+func (h *Handlers) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	if !h.projects.Delete(chi.URLParam(r, "projectID")) {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeProjectNotFound, "Project not found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Project settings deleted"})
+}
+
+func validPriority(p *models.JobPriority) bool {
+	return p == nil || (*p >= models.PriorityLow && *p <= models.PriorityCritical)
+}
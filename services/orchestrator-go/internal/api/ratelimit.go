@@ -0,0 +1,82 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ratelimit"
+	"github.com/rs/zerolog/log"
+)
+
+// submitLimits holds the job submission limiters; a nil limiter is disabled
+type submitLimits struct {
+	perToken  *ratelimit.Limiter
+	perIP     *ratelimit.Limiter
+	perSource map[string]*ratelimit.Limiter
+}
+
+func newSubmitLimits(cfg config.RateLimitConfig) submitLimits {
+	var l submitLimits
+	if cfg.SubmitPerToken > 0 {
+		l.perToken = ratelimit.NewLimiter(cfg.SubmitPerToken, cfg.SubmitBurstPerToken)
+	}
+	if cfg.SubmitPerIP > 0 {
+		l.perIP = ratelimit.NewLimiter(cfg.SubmitPerIP, cfg.SubmitBurstPerIP)
+	}
+	l.perSource = make(map[string]*ratelimit.Limiter)
+	for source, perMinute := range cfg.SubmitPerSource {
+		if perMinute > 0 {
+			l.perSource[source] = ratelimit.NewLimiter(perMinute, cfg.SubmitBurstPerToken)
+		}
+	}
+	return l
+}
+
+// allowSource applies the rate limit of a submission source, if it has one.
+// All of a source's submissions share one bucket.
+func (l submitLimits) allowSource(source string) (bool, time.Duration) {
+	limiter, ok := l.perSource[source]
+	if !ok {
+		return true, 0
+	}
+	return limiter.Allow(source)
+}
+
+// limitSubmissions rejects job submissions beyond the caller's token and IP
+// rate limits with 429 and a Retry-After header
+func (h *Handlers) limitSubmissions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal := auth.FromContext(r.Context()); principal != nil && h.submitLimits.perToken != nil {
+			if ok, wait := h.submitLimits.perToken.Allow(principal.Name); !ok {
+				log.Warn().Str("token", principal.Name).Msg("Job submission rate limit exceeded")
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+
+		if h.submitLimits.perIP != nil {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if ok, wait := h.submitLimits.perIP.Allow(ip); !ok {
+				log.Warn().Str("ip", ip).Msg("Job submission rate limit exceeded")
+				tooManyRequests(w, wait)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+}
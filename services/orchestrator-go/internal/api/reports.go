@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultReportDays is how far back a report without from reaches
+	defaultReportDays = 30
+	// maxRollupDays bounds the days a single rollup request recomputes
+	maxRollupDays = 366
+	// maxStatsBuckets bounds the buckets of a stats request
+	maxStatsBuckets = 1440
+)
+
+// GetJobsReport returns the rolled-up history of finished jobs, per project
+// and day, week or month
+func (h *Handlers) GetJobsReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -defaultReportDays)
+	var err error
+	if v := query.Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, http.StatusBadRequest, "to must be a date such as 2006-01-02")
+			return
+		}
+	}
+	if v := query.Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, http.StatusBadRequest, "from must be a date such as 2006-01-02")
+			return
+		}
+	}
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	interval := query.Get("interval")
+	switch interval {
+	case "":
+		interval = models.ReportIntervalDay
+	case models.ReportIntervalDay, models.ReportIntervalWeek, models.ReportIntervalMonth:
+	default:
+		writeError(w, http.StatusBadRequest, "interval must be one of: day, week, month")
+		return
+	}
+
+	report, err := h.queueManager.JobReport(r.Context(), auth.FromContext(r.Context()), query.Get("project_id"), from, to, interval)
+	if err != nil {
+		if errors.Is(err, queue.ErrRollupsDisabled) {
+			writeErrorCode(w, http.StatusServiceUnavailable, models.ErrorCodeRollupsDisabled, "Job rollups are not enabled", nil)
+			return
+		}
+		log.Error().Err(err).Msg("Failed to build jobs report")
+		writeError(w, http.StatusInternalServerError, "Failed to build jobs report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// GetJobStats returns recent throughput, failure rate, durations and queue
+// waits per time bucket, e.g. ?range=24h&bucket=1h
+func (h *Handlers) GetJobStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	span, bucket := 24*time.Hour, time.Hour
+	var err error
+	if v := query.Get("range"); v != "" {
+		if span, err = time.ParseDuration(v); err != nil || span <= 0 {
+			writeError(w, http.StatusBadRequest, "range must be a positive duration such as 24h")
+			return
+		}
+	}
+	if v := query.Get("bucket"); v != "" {
+		if bucket, err = time.ParseDuration(v); err != nil || bucket < time.Minute {
+			writeError(w, http.StatusBadRequest, "bucket must be a duration of at least 1m, such as 1h")
+			return
+		}
+	}
+	if span/bucket > maxStatsBuckets {
+		writeError(w, http.StatusBadRequest, "range may span at most "+intToString(maxStatsBuckets)+" buckets")
+		return
+	}
+
+	stats, err := h.queueManager.JobStats(r.Context(), auth.FromContext(r.Context()), query.Get("project_id"), span, bucket)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to compute job stats")
+		writeError(w, http.StatusInternalServerError, "Failed to compute job stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// RollUpJobs recomputes the rollups of a range of days
+func (h *Handlers) RollUpJobs(w http.ResponseWriter, r *http.Request) {
+	var req models.RollupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	from, err := time.Parse(time.DateOnly, req.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "from must be a date such as 2006-01-02")
+		return
+	}
+	to, err := time.Parse(time.DateOnly, req.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "to must be a date such as 2006-01-02")
+		return
+	}
+	if from.After(to) || to.Sub(from) >= maxRollupDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "from must not be after to, nor more than 366 days before it")
+		return
+	}
+
+	result, err := h.queueManager.RollUp(r.Context(), from, to)
+	if err != nil {
+		if errors.Is(err, queue.ErrRollupsDisabled) {
+			writeErrorCode(w, http.StatusServiceUnavailable, models.ErrorCodeRollupsDisabled, "Job rollups are not enabled", nil)
+			return
+		}
+		log.Error().Err(err).Msg("Failed to roll up jobs")
+		writeError(w, http.StatusInternalServerError, "Failed to roll up jobs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+)
+
+// ListReservations returns the active and upcoming worker slot reservations
+// of the caller's projects
+func (h *Handlers) ListReservations(w http.ResponseWriter, r *http.Request) {
+	reservations := h.queueManager.ListReservations(auth.FromContext(r.Context()))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"reservations": reservations,
+		"total":        len(reservations),
+	})
+}
+
+// CreateReservation reserves worker slots for a project over a time window
+func (h *Handlers) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	res, err := h.queueManager.Reserve(&req)
+	if err != nil {
+		switch {
+		case errors.Is(err, queue.ErrInvalidReservation):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, queue.ErrReservationConflict):
+			writeErrorCode(w, http.StatusConflict, models.ErrorCodeReservationConflict, err.Error(), nil)
+		default:
+			writeError(w, http.StatusInternalServerError, "Failed to create reservation")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// DeleteReservation releases a reservation
+func (h *Handlers) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := chi.URLParam(r, "reservationID")
+
+	if err := h.queueManager.CancelReservation(reservationID); err != nil {
+		if errors.Is(err, queue.ErrReservationNotFound) {
+			writeErrorCode(w, http.StatusNotFound, models.ErrorCodeReservationNotFound, "Reservation not found", nil)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to cancel reservation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Reservation cancelled"})
+}
@@ -8,64 +8,191 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/federation"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/health"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/worktree"
 )
 
 var startTime = time.Now()
 
 // NewRouter creates the HTTP router with all routes
-func NewRouter(cfg *config.Config, qm *queue.Manager, wm *worktree.Manager) http.Handler {
-	r := chi.NewRouter()
-
-	// Middleware
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+func NewRouter(cfg *config.Config, qm *queue.Manager, wm *worktree.Manager, fed *federation.Router, projects *project.Registry, checks *health.Checker, reloader *config.Reloader) http.Handler {
+	r := newBaseRouter(cfg)
 
 	// CORS
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "traceparent", "tracestate"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Create handlers
-	h := NewHandlers(cfg, qm, wm)
+	h := NewHandlers(cfg, qm, wm, fed, projects, checks, reloader)
+
+	// Public status summary for status pages
+	r.With(middleware.Timeout(cfg.Server.RequestTimeout)).Get("/statusz", h.Statusz)
+	probeRoutes(r, cfg, h)
 
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
-		// Health & metrics
-		r.Get("/health", h.Health)
-		r.Get("/metrics", h.Metrics)
+		// Regular request/response endpoints get short deadlines
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(cfg.Server.RequestTimeout))
+			r.Use(writeDeadline(cfg.Server.WriteTimeout))
+
+			// Health & metrics
+			r.Get("/health", h.Health)
+			r.Get("/metrics", h.Metrics)
+			r.Get("/openapi.json", h.OpenAPI)
+
+			// Jobs
+			r.Route("/jobs", func(r chi.Router) {
+				r.Use(h.authenticate)
+				r.With(h.limitSubmissions).Post("/", h.CreateJob)
+				r.Get("/", h.ListJobs)
+				r.Get("/search", h.SearchJobs)
+
+				r.Group(func(r chi.Router) {
+					r.Use(h.proxyFederatedJob)
+					r.Get("/{jobID}", h.GetJob)
+					r.Patch("/{jobID}", h.UpdateJob)
+					r.Delete("/{jobID}", h.CancelJob)
+					r.Post("/{jobID}/retry", h.RequeueJob)
+					r.Get("/{jobID}/logs", h.GetJobLogs)
+					r.Get("/{jobID}/report", h.GetJobReport)
+					r.Get("/{jobID}/events", h.GetJobEvents)
+					r.Post("/{jobID}/retention", h.ExtendJobRetention)
+					r.Get("/{jobID}/run", h.GetJobRun)
+					r.Get("/{jobID}/attempts/compare", h.CompareJobAttempts)
+				})
+			})
+
+			// Job groups
+			r.With(h.authenticate).Get("/groups/{groupID}", h.GetGroup)
+
+			// Worktrees
+			r.Route("/worktrees", func(r chi.Router) {
+				r.Use(h.authenticate)
+				r.Get("/", h.ListWorktrees)
+				r.Post("/", h.CreateWorktree)
+				r.Delete("/{worktreeID}", h.DeleteWorktree)
+				r.Post("/{worktreeID}/merging", h.MarkWorktreeMerging)
+				r.Post("/{worktreeID}/cleanup", h.MarkWorktreeCleanup)
+			})
+
+			// Project settings
+			r.Route("/projects", func(r chi.Router) {
+				r.Use(h.authenticate)
+				r.Get("/", h.ListProjects)
+				r.With(h.requireAdmin).Get("/stale", h.ListStaleProjects)
+				r.Get("/{projectID}", h.GetProject)
+				r.With(h.requireAdmin).Put("/{projectID}", h.PutProject)
+				r.With(h.requireAdmin).Delete("/{projectID}", h.DeleteProject)
+				r.With(h.requireAdmin).Post("/{projectID}/archive", h.ArchiveProject)
+				r.With(h.requireAdmin).Delete("/{projectID}/archive", h.UnarchiveProject)
+			})
+
+			// Queue
+			r.With(h.authenticate).Get("/queue", h.GetQueueStatus)
+			r.With(h.requireAdmin).Post("/queue/pause", h.PauseQueue)
+			r.With(h.requireAdmin).Post("/queue/resume", h.ResumeQueue)
+			r.With(h.authenticate).Get("/queue/drain", h.GetDrainStatus)
+			r.With(h.requireAdmin).Post("/queue/drain", h.StartDrain)
+			r.With(h.requireAdmin).Delete("/queue/drain", h.CancelDrain)
+
+			// Job history: recent buckets and rolled-up days
+			r.With(h.authenticate).Get("/stats", h.GetJobStats)
+			r.With(h.authenticate).Get("/reports/jobs", h.GetJobsReport)
+
+			// Administration
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(h.requireAdmin)
+				r.Post("/reconcile", h.Reconcile)
+				r.Post("/purge", h.PurgeJobs)
+				r.Post("/rollups", h.RollUpJobs)
+				r.Get("/dump", h.AdminDump)
+				r.Post("/reload", h.ReloadConfig)
+			})
+
+			// Worker slot reservations
+			r.Route("/reservations", func(r chi.Router) {
+				r.With(h.authenticate).Get("/", h.ListReservations)
+				r.With(h.requireAdmin).Post("/", h.CreateReservation)
+				r.With(h.requireAdmin).Delete("/{reservationID}", h.DeleteReservation)
+			})
+
+			// Callbacks (from GitHub Actions)
+			r.Post("/callback", h.HandleCallback)
+			r.Post("/callback/logs", h.HandleLogCallback)
+			r.Get("/callback/control", h.GetJobControl)
 
-		// Jobs
-		r.Route("/jobs", func(r chi.Router) {
-			r.Post("/", h.CreateJob)
-			r.Get("/", h.ListJobs)
-			r.Get("/{jobID}", h.GetJob)
-			r.Delete("/{jobID}", h.CancelJob)
-			r.Get("/{jobID}/logs", h.GetJobLogs)
+			// Webhooks (from GitHub, GitLab and Bitbucket)
+			r.Post("/webhooks/github", h.HandleGitHubWebhook)
+			r.Post("/webhooks/gitlab", h.HandleGitLabWebhook)
+			r.Post("/webhooks/bitbucket", h.HandleBitbucketWebhook)
 		})
 
-		// Worktrees
-		r.Route("/worktrees", func(r chi.Router) {
-			r.Get("/", h.ListWorktrees)
-			r.Post("/", h.CreateWorktree)
-			r.Delete("/{worktreeID}", h.DeleteWorktree)
+		// Streaming endpoints have no overall deadline; they send heartbeats
+		// and close themselves when idle
+		r.Group(func(r chi.Router) {
+			r.Use(h.authenticate)
+			r.Use(h.proxyFederatedJob)
+			r.Get("/jobs/{jobID}/logs/stream", h.StreamJobLogs)
+			r.Get("/jobs/{jobID}/logs/download", h.DownloadJobLogs)
 		})
+	})
+
+	return r
+}
+
+// NewWorkerRouter creates the router of worker processes, which dispatch
+// jobs but leave the API to other processes. It serves health and metrics
+// for probes, and the callbacks and webhooks runs report back through.
+func NewWorkerRouter(cfg *config.Config, qm *queue.Manager, wm *worktree.Manager, fed *federation.Router, projects *project.Registry, checks *health.Checker, reloader *config.Reloader) http.Handler {
+	r := newBaseRouter(cfg)
+	h := NewHandlers(cfg, qm, wm, fed, projects, checks, reloader)
+	probeRoutes(r, cfg, h)
 
-		// Queue
-		r.Get("/queue", h.GetQueueStatus)
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(middleware.Timeout(cfg.Server.RequestTimeout))
+		r.Use(writeDeadline(cfg.Server.WriteTimeout))
+
+		r.Get("/health", h.Health)
+		r.Get("/metrics", h.Metrics)
 
-		// Callbacks (from GitHub Actions)
 		r.Post("/callback", h.HandleCallback)
+		r.Post("/callback/logs", h.HandleLogCallback)
+		r.Get("/callback/control", h.GetJobControl)
+
+		r.Post("/webhooks/github", h.HandleGitHubWebhook)
+		r.Post("/webhooks/gitlab", h.HandleGitLabWebhook)
+		r.Post("/webhooks/bitbucket", h.HandleBitbucketWebhook)
 	})
 
 	return r
 }
+
+// probeRoutes adds the liveness and readiness probes of orchestration
+// platforms
+func probeRoutes(r chi.Router, cfg *config.Config, h *Handlers) {
+	r.With(middleware.Timeout(cfg.Server.RequestTimeout)).Get("/livez", h.Livez)
+	r.With(middleware.Timeout(cfg.Server.RequestTimeout)).Get("/readyz", h.Readyz)
+}
+
+// newBaseRouter creates a router with the middleware every route shares
+func newBaseRouter(cfg *config.Config) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(echoRequestID)
+	r.Use(realIP(parseTrustedProxies(cfg.Server.TrustedProxies)))
+	r.Use(tracing.Middleware)
+	r.Use(accessLog)
+	r.Use(middleware.Recoverer)
+	return r
+}
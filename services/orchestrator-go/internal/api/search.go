@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Bounds of the matches a job search returns
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// SearchJobs finds jobs, in memory, archived or on downstream
+// orchestrators, whose prompt, ticket title or description, or error
+// message contain every word of q
+func (h *Handlers) SearchJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := models.JobSearch{
+		Query:     query.Get("q"),
+		ProjectID: query.Get("project_id"),
+		Status:    models.JobStatus(query.Get("status")),
+		Limit:     defaultSearchLimit,
+	}
+	if strings.IndexFunc(search.Query, isWordRune) < 0 {
+		writeError(w, http.StatusBadRequest, "q must contain at least one word")
+		return
+	}
+	var err error
+	if search.From, err = parseSearchTime(query, "from", false); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if search.To, err = parseSearchTime(query, "to", true); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		search.Limit = n
+	}
+	view, err := parseJobView(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	scope := auth.FromContext(r.Context())
+	jobs, err := h.queueManager.SearchJobs(r.Context(), scope, search)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to search jobs")
+		writeError(w, http.StatusInternalServerError, "Failed to search jobs")
+		return
+	}
+	if forwarded := h.federation.Jobs(r.Context(), "/api/v1/jobs/search", query, scope); len(forwarded) > 0 {
+		jobs = append(jobs, forwarded...)
+		sortNewestFirst(jobs)
+		if len(jobs) > search.Limit {
+			jobs = jobs[:search.Limit]
+		}
+	}
+	rendered, err := h.renderJobs(r, view, jobs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to render jobs")
+		writeError(w, http.StatusInternalServerError, "Failed to render jobs")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":  rendered,
+		"total": len(jobs),
+	})
+}
+
+// isWordRune reports whether r is part of the words searches match
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parseSearchTime reads a search bound given as an RFC 3339 time or a date.
+// A date ending a range includes that whole day.
+func parseSearchTime(query url.Values, name string, end bool) (*time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date such as 2006-01-02 or an RFC 3339 time", name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
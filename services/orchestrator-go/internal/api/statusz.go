@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// statuszTTL is how long a status snapshot is served before it is rebuilt,
+// and how long clients and proxies may cache it
+const statuszTTL = 30 * time.Second
+
+// statuszWaitWindow is the period the average queue wait is taken over
+const statuszWaitWindow = time.Hour
+
+// statuszCache holds the last status snapshot so frequent polling by status
+// pages does not hit the queue backend
+type statuszCache struct {
+	mu      sync.Mutex
+	summary *models.StatusSummary
+}
+
+// Statusz serves a minimal, unauthenticated status summary for embedding in
+// status pages
+func (h *Handlers) Statusz(w http.ResponseWriter, r *http.Request) {
+	h.statusz.mu.Lock()
+	summary := h.statusz.summary
+	if summary == nil || time.Since(summary.GeneratedAt) >= statuszTTL {
+		summary = h.buildStatusSummary(r.Context())
+		h.statusz.summary = summary
+	}
+	h.statusz.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func (h *Handlers) buildStatusSummary(ctx context.Context) *models.StatusSummary {
+	summary := &models.StatusSummary{
+		Status:               "ok",
+		AcceptingSubmissions: true,
+		AverageWaitSeconds:   h.queueManager.AverageWait(statuszWaitWindow).Seconds(),
+		DegradedComponents:   []string{},
+		GeneratedAt:          time.Now(),
+	}
+
+	if err := h.queueManager.CheckBackend(ctx); err != nil {
+		log.Warn().Err(err).Msg("Queue backend unavailable")
+		summary.AcceptingSubmissions = false
+		summary.DegradedComponents = append(summary.DegradedComponents, "queue")
+	}
+	if !h.queueManager.CanDispatch() {
+		summary.DegradedComponents = append(summary.DegradedComponents, "dispatch")
+	}
+	if wt := h.worktreeManager.GetStats(); wt.Active >= wt.MaxActive {
+		summary.DegradedComponents = append(summary.DegradedComponents, "worktrees")
+	}
+
+	if len(summary.DegradedComponents) > 0 {
+		summary.Status = "degraded"
+	}
+	return summary
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/auth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// streamPollInterval is how often a stream checks for new events
+const streamPollInterval = time.Second
+
+// writeDeadline bounds how long a handler may spend writing its response
+func writeDeadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sseStream writes server-sent events, refreshing the write deadline on every
+// write so a live stream is never cut off while a dead client is detected
+// within one heartbeat
+type sseStream struct {
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	heartbeat time.Duration
+	lastEvent time.Time
+	lastWrite time.Time
+}
+
+func newSSEStream(w http.ResponseWriter, heartbeat time.Duration) *sseStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	now := time.Now()
+	return &sseStream{
+		w:         w,
+		rc:        http.NewResponseController(w),
+		heartbeat: heartbeat,
+		lastEvent: now,
+		lastWrite: now,
+	}
+}
+
+// Send writes a named event with a JSON payload
+func (s *sseStream) Send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.lastEvent = time.Now()
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+// Heartbeat sends a comment line if nothing has been written recently
+func (s *sseStream) Heartbeat() error {
+	if time.Since(s.lastWrite) < s.heartbeat {
+		return nil
+	}
+	return s.write(": heartbeat\n\n")
+}
+
+// IdleFor returns how long it has been since the last real event
+func (s *sseStream) IdleFor() time.Duration {
+	return time.Since(s.lastEvent)
+}
+
+func (s *sseStream) write(msg string) error {
+	// Leave room for the next heartbeat to be written before the deadline
+	s.rc.SetWriteDeadline(time.Now().Add(2 * s.heartbeat))
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.lastWrite = time.Now()
+	return s.rc.Flush()
+}
+
+// StreamJobLogs streams job status changes as server-sent events until the
+// job finishes, the client disconnects, or the stream goes idle
+func (h *Handlers) StreamJobLogs(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	job, ok := h.queueManager.GetJob(jobID, auth.FromContext(r.Context()))
+	if !ok {
+		writeErrorCode(w, http.StatusNotFound, models.ErrorCodeJobNotFound, "Job not found", map[string]interface{}{"job_id": jobID})
+		return
+	}
+
+	stream := newSSEStream(w, h.cfg.Server.StreamHeartbeat)
+
+	lastStatus := job.Status
+	if err := stream.Send("status", map[string]string{"job_id": jobID, "status": string(lastStatus)}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for !lastStatus.IsTerminal() {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		job, ok = h.queueManager.GetJob(jobID, auth.FromContext(r.Context()))
+		if !ok {
+			return
+		}
+
+		if job.Status != lastStatus {
+			lastStatus = job.Status
+			if err := stream.Send("status", map[string]string{"job_id": jobID, "status": string(lastStatus)}); err != nil {
+				return
+			}
+			continue
+		}
+
+		if stream.IdleFor() > h.cfg.Server.StreamIdleTimeout {
+			log.Debug().Str("job_id", jobID).Msg("Closing idle log stream")
+			stream.Send("idle", map[string]string{"job_id": jobID})
+			return
+		}
+
+		if err := stream.Heartbeat(); err != nil {
+			return
+		}
+	}
+
+	stream.Send("end", map[string]string{"job_id": jobID, "status": string(lastStatus)})
+}
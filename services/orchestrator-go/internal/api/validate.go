@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/prompt"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/queue"
+)
+
+// repoFullName matches owner/name, and the group/subgroup/name paths of
+// GitLab projects
+var repoFullName = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)+$`)
+
+// sourceName matches what a submission source may be called
+var sourceName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// defaultSource is the source of unauthenticated submissions that name none
+const defaultSource = "api"
+
+// violations collects what is wrong with the fields of a request
+type violations []models.FieldViolation
+
+func (v *violations) add(field, format string, args ...interface{}) {
+	*v = append(*v, models.FieldViolation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateCreateJob checks every field of a job submission, so clients
+// learn all that is wrong with it at once
+func (h *Handlers) validateCreateJob(req *models.CreateJobRequest) violations {
+	var v violations
+	if req.ID != "" && !ids.Valid(req.ID) {
+		v.add("id", "must be 1-%d letters, digits, '-' or '_'", ids.MaxLength)
+	}
+	if req.TicketID == "" {
+		v.add("ticket_id", "is required")
+	}
+	if req.ProjectID == "" {
+		v.add("project_id", "is required")
+	} else if !ids.Valid(req.ProjectID) {
+		v.add("project_id", "must be 1-%d letters, digits, '-' or '_'", ids.MaxLength)
+	}
+	if req.TemplateID != "" {
+		settings, _ := h.projects.Get(req.ProjectID)
+		if _, ok := settings.Templates[req.TemplateID]; !ok {
+			v.add("template_id", "is not a template of project %s", req.ProjectID)
+		}
+	}
+	if req.Priority != nil {
+		validatePriority(&v, *req.Priority)
+	}
+	h.validatePrompt(&v, req.Prompt)
+	validatePromptVars(&v, req.Prompt, req.Vars)
+	if req.RepoFullName != "" && !validRepoFullName(req.RepoFullName) {
+		v.add("repo_full_name", "must be owner/name")
+	}
+	if req.CallbackURL != "" {
+		if err := h.queueManager.ValidateDestination(req.CallbackURL); err != nil {
+			v.add("callback_url", "%s", err.Error())
+		}
+	}
+	if req.Deadline != nil && !req.Deadline.After(time.Now()) {
+		v.add("deadline", "must be in the future")
+	}
+	if req.Executor != "" && !slices.Contains(h.queueManager.Executors(), req.Executor) {
+		v.add("executor", "must be one of: %s", strings.Join(h.queueManager.Executors(), ", "))
+	}
+	if slices.Contains(req.Labels, "") {
+		v.add("labels", "may not be empty")
+	}
+	switch req.Kind {
+	case "", models.JobKindImplementation, models.JobKindAnalysis:
+		if err := queue.ValidateMatrix(req.Kind, req.Matrix); err != nil {
+			v.add("matrix", "%s", err.Error())
+		}
+	default:
+		v.add("kind", "must be implementation or analysis")
+	}
+	return v
+}
+
+// validateUpdateJob checks the fields a queued job is changed with
+func (h *Handlers) validateUpdateJob(req *models.UpdateJobRequest) violations {
+	var v violations
+	if req.Priority != nil {
+		validatePriority(&v, *req.Priority)
+	}
+	if req.Prompt != nil {
+		h.validatePrompt(&v, *req.Prompt)
+	}
+	return v
+}
+
+// validatePriority checks a priority is one of the defined levels
+func validatePriority(v *violations, priority models.JobPriority) {
+	if priority < models.PriorityLow || priority > models.PriorityCritical {
+		v.add("priority", "must be between %d (low) and %d (critical)", models.PriorityLow, models.PriorityCritical)
+	}
+}
+
+// validatePrompt checks a prompt is given and within the length limit
+func (h *Handlers) validatePrompt(v *violations, prompt string) {
+	if prompt == "" {
+		v.add("prompt", "is required")
+		return
+	}
+	if limit := h.cfg.Queue.MaxPromptLength; limit > 0 {
+		if n := utf8.RuneCountInString(prompt); n > limit {
+			v.add("prompt", "must be at most %d characters, not %d", limit, n)
+		}
+	}
+}
+
+// validatePromptVars checks a submission defines the variables its prompt
+// uses, without redefining the builtins
+func validatePromptVars(v *violations, src string, vars map[string]string) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case !prompt.ValidName(name):
+			v.add("vars."+name, "must be letters, digits or '_', not starting with a digit")
+		case slices.Contains(prompt.Builtins, name):
+			v.add("vars."+name, "is a builtin variable")
+		}
+	}
+	if missing := prompt.Missing(src, vars); len(missing) > 0 {
+		v.add("prompt", "uses undefined variables: %s", strings.Join(missing, ", "))
+	}
+}
+
+// validateSource checks the source an unauthenticated submission names.
+// Nothing vouches for it, so only the default and the sources the operator
+// has set limits for are taken; a caller cannot escape those limits, or
+// add metric series, by naming a new source each time.
+func (h *Handlers) validateSource(source string) violations {
+	var v violations
+	switch {
+	case !sourceName.MatchString(source):
+		v.add("source", "must be 1-64 letters, digits, '.', '-' or '_'")
+	case source == defaultSource, h.submitLimits.perSource[source] != nil, h.queueManager.LimitsSource(source):
+	default:
+		v.add("source", "must be %s or a source with limits in SOURCE_MAX_ACTIVE or SUBMIT_RATE_LIMIT_PER_SOURCE", defaultSource)
+	}
+	return v
+}
+
+// validRepoFullName reports whether name is a repository path, without
+// empty or relative segments
+func validRepoFullName(name string) bool {
+	if !repoFullName.MatchString(name) {
+		return false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// writeViolations rejects a request with 422, listing its violations
+func writeViolations(w http.ResponseWriter, v violations) {
+	messages := make([]string, len(v))
+	for i, violation := range v {
+		messages[i] = violation.Field + " " + violation.Message
+	}
+	writeErrorCode(w, http.StatusUnprocessableEntity, models.ErrorCodeValidationFailed,
+		"Invalid request: "+strings.Join(messages, "; "), map[string]interface{}{"violations": v})
+}
@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schema is db/migrations/004_orchestrator_job_archive.sql,
+// 005_orchestrator_job_rollups.sql, 006_orchestrator_job_search.sql and
+// 007_orchestrator_job_search_text.sql, written to be applied any number of
+// times
+const schema = `
+CREATE TABLE IF NOT EXISTS orchestrator_job_archive (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    data JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orchestrator_job_archive_completed_at ON orchestrator_job_archive(completed_at);
+
+CREATE TABLE IF NOT EXISTS orchestrator_job_rollups (
+    project_id TEXT NOT NULL,
+    day DATE NOT NULL,
+    total INTEGER NOT NULL,
+    completed INTEGER NOT NULL,
+    failed INTEGER NOT NULL,
+    cancelled INTEGER NOT NULL,
+    attempts INTEGER NOT NULL,
+    duration_seconds DOUBLE PRECISION NOT NULL,
+    max_duration_seconds DOUBLE PRECISION NOT NULL,
+    run_seconds DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (day, project_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orchestrator_job_rollups_project_day ON orchestrator_job_rollups(project_id, day);
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE orchestrator_job_archive DROP COLUMN IF EXISTS search;
+
+ALTER TABLE orchestrator_job_archive ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+    lower(
+        coalesce(data->>'prompt', '') || E'\n' ||
+        coalesce(data->>'ticket_title', '') || E'\n' ||
+        coalesce(data->>'ticket_description', '') || E'\n' ||
+        coalesce(data->>'error_message', '') || E'\n' ||
+        coalesce(data->'result'->>'error', ''))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_orchestrator_job_archive_search_text ON orchestrator_job_archive USING GIN (search_text gin_trgm_ops);
+`
+
+// Migrate creates the tables the orchestrator keeps in Postgres. It is safe
+// to run on every deploy, and concurrently.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Init containers of several replicas may start together
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext('orchestrator_migrate'))"); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext('orchestrator_migrate'))")
+
+	if _, err := conn.Exec(ctx, schema); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return nil
+}
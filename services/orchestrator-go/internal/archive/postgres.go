@@ -0,0 +1,150 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// PostgresArchive stores finished jobs in the orchestrator_job_archive table
+// (db/migrations/004_orchestrator_job_archive.sql)
+type PostgresArchive struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresArchive creates a job archive backed by Postgres
+func NewPostgresArchive(pool *pgxpool.Pool) *PostgresArchive {
+	return &PostgresArchive{pool: pool}
+}
+
+// Archive upserts jobs in a single transaction
+func (a *PostgresArchive) Archive(ctx context.Context, jobs []*models.Job) error {
+	batch := &pgx.Batch{}
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+		}
+		batch.Queue(`
+			INSERT INTO orchestrator_job_archive (id, project_id, status, completed_at, data)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (id) DO UPDATE
+			SET status = EXCLUDED.status, completed_at = EXCLUDED.completed_at,
+			    data = EXCLUDED.data, archived_at = NOW()`,
+			job.ID, job.ProjectID, string(job.Status), job.CompletedAt, data)
+	}
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Get returns an archived job, or nil if there is none with that ID
+func (a *PostgresArchive) Get(ctx context.Context, jobID string) (*models.Job, error) {
+	var data []byte
+	err := a.pool.QueryRow(ctx, `SELECT data FROM orchestrator_job_archive WHERE id = $1`, jobID).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode archived job %s: %w", jobID, err)
+	}
+	return &job, nil
+}
+
+// Purge deletes archived jobs that completed before the cutoff
+func (a *PostgresArchive) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := a.pool.Exec(ctx, `DELETE FROM orchestrator_job_archive WHERE completed_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Completed returns the archived jobs that completed in [from, to)
+func (a *PostgresArchive) Completed(ctx context.Context, from, to time.Time) ([]*models.Job, error) {
+	rows, err := a.pool.Query(ctx, `
+		SELECT data FROM orchestrator_job_archive
+		WHERE completed_at >= $1 AND completed_at < $2`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var job models.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode archived job: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
+
+// Search returns up to search.Limit archived jobs whose text contains every
+// word of the query, newest first. Words match anywhere in the text, in any
+// case, exactly as they do for jobs still in memory.
+func (a *PostgresArchive) Search(ctx context.Context, search models.JobSearch) ([]*models.Job, error) {
+	limit := search.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	// Terms are only letters and digits, so hold no LIKE wildcards
+	terms := search.Terms()
+	patterns := make([]string, len(terms))
+	for i, term := range terms {
+		patterns[i] = "%" + term + "%"
+	}
+	rows, err := a.pool.Query(ctx, `
+		SELECT data FROM orchestrator_job_archive
+		WHERE search_text LIKE ALL($1::text[])
+		  AND ($2 = '' OR project_id = $2)
+		  AND ($3::text[] IS NULL OR project_id = ANY($3))
+		  AND ($4 = '' OR status = $4)
+		  AND ($5::timestamptz IS NULL OR (data->>'created_at')::timestamptz >= $5)
+		  AND ($6::timestamptz IS NULL OR (data->>'created_at')::timestamptz < $6)
+		ORDER BY (data->>'created_at')::timestamptz DESC
+		LIMIT $7`,
+		patterns, search.ProjectID, search.ProjectIDs, string(search.Status), search.From, search.To, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var job models.Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode archived job: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// PostgresRollups stores daily job rollups in the orchestrator_job_rollups
+// table (db/migrations/005_orchestrator_job_rollups.sql)
+type PostgresRollups struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRollups creates a rollup store backed by Postgres
+func NewPostgresRollups(pool *pgxpool.Pool) *PostgresRollups {
+	return &PostgresRollups{pool: pool}
+}
+
+// SaveRollups replaces the rollups of a day in a single transaction, so a
+// day rolled up again never keeps projects that no longer have jobs on it
+func (s *PostgresRollups) SaveRollups(ctx context.Context, day time.Time, rollups []models.JobRollup) error {
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM orchestrator_job_rollups WHERE day = $1`, day)
+	for _, r := range rollups {
+		batch.Queue(`
+			INSERT INTO orchestrator_job_rollups (project_id, day, total, completed, failed, cancelled,
+			    attempts, duration_seconds, max_duration_seconds, run_seconds)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			r.ProjectID, day, r.Total, r.Completed, r.Failed, r.Cancelled,
+			r.Attempts, r.DurationSeconds, r.MaxDurationSeconds, r.RunSeconds)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListRollups returns the rollups of the days in [from, to], of one project
+// or of all when projectID is empty, by day then project
+func (s *PostgresRollups) ListRollups(ctx context.Context, from, to time.Time, projectID string) ([]models.JobRollup, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT project_id, day, total, completed, failed, cancelled,
+		       attempts, duration_seconds, max_duration_seconds, run_seconds
+		FROM orchestrator_job_rollups
+		WHERE day >= $1 AND day <= $2 AND ($3 = '' OR project_id = $3)
+		ORDER BY day, project_id`, from, to, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []models.JobRollup
+	for rows.Next() {
+		var r models.JobRollup
+		var day time.Time
+		if err := rows.Scan(&r.ProjectID, &day, &r.Total, &r.Completed, &r.Failed, &r.Cancelled,
+			&r.Attempts, &r.DurationSeconds, &r.MaxDurationSeconds, &r.RunSeconds); err != nil {
+			return nil, err
+		}
+		r.Day = day.Format(time.DateOnly)
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// LastRolledUp returns the latest day with rollups, or nil before the
+// first rollup
+func (s *PostgresRollups) LastRolledUp(ctx context.Context) (*time.Time, error) {
+	var day *time.Time
+	if err := s.pool.QueryRow(ctx, `SELECT MAX(day) FROM orchestrator_job_rollups`).Scan(&day); err != nil {
+		return nil, err
+	}
+	return day, nil
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+// AllProjects in a token's project list grants access to every project
+const AllProjects = "*"
+
+// Principal is the caller identified by an API token
+type Principal struct {
+	Name     string
+	Projects []string
+	Admin    bool
+}
+
+// Allows reports whether the principal may act on a project. A nil principal
+// means authentication is disabled and allows everything.
+func (p *Principal) Allows(projectID string) bool {
+	if p == nil || p.Admin {
+		return true
+	}
+	for _, id := range p.Projects {
+		if id == AllProjects || id == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopedProjects lists the projects the principal may act on, nil when it
+// may act on every project
+func (p *Principal) ScopedProjects() []string {
+	if p == nil || p.Admin || slices.Contains(p.Projects, AllProjects) {
+		return nil
+	}
+	// Never nil, so a principal without projects matches none
+	return append([]string{}, p.Projects...)
+}
+
+// String names the principal in audit records. A nil principal is an
+// unauthenticated API caller.
+func (p *Principal) String() string {
+	if p == nil {
+		return "api"
+	}
+	return p.Name
+}
+
+// Authenticator resolves bearer tokens to principals
+type Authenticator struct {
+	tokens  []token
+	enabled bool
+}
+
+type token struct {
+	secret    []byte
+	principal *Principal
+}
+
+// NewAuthenticator creates an authenticator from the configured API tokens
+// and admin token. Authentication is only required once API tokens exist;
+// the admin token alone protects just the admin endpoints.
+func NewAuthenticator(cfg config.AuthConfig) *Authenticator {
+	a := &Authenticator{enabled: len(cfg.Tokens) > 0}
+	for _, t := range cfg.Tokens {
+		a.tokens = append(a.tokens, token{
+			secret:    []byte(t.Token),
+			principal: &Principal{Name: t.Name, Projects: t.ProjectIDs},
+		})
+	}
+	if cfg.AdminToken != "" {
+		a.tokens = append(a.tokens, token{
+			secret:    []byte(cfg.AdminToken),
+			principal: &Principal{Name: "admin", Admin: true},
+		})
+	}
+	return a
+}
+
+// Enabled reports whether API calls must present a token
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Authenticate returns the principal for an Authorization header value
+func (a *Authenticator) Authenticate(header string) (*Principal, bool) {
+	secret, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || secret == "" {
+		return nil, false
+	}
+
+	// Compare against every token so timing does not reveal which matched
+	var match *Principal
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(secret), t.secret) == 1 {
+			match = t.principal
+		}
+	}
+	return match, match != nil
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the authenticated principal, or nil if authentication
+// is disabled
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
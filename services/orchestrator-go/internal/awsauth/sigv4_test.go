@@ -0,0 +1,115 @@
+package awsauth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The credentials and cases of the AWS Signature Version 4 test suite
+var (
+	testCreds = Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	testTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "get-vanilla",
+			url:  "https://example.amazonaws.com/",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name: "get-vanilla-query-order-key-case",
+			url:  "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			Sign(req, nil, testCreds, "us-east-1", "service", testTime)
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %s\nwant %s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s, want 20150830T123600Z", got)
+			}
+		})
+	}
+}
+
+// signedPost signs a JSON POST the way queue and bucket clients send them
+// and returns the signed request
+func signedPost(t *testing.T, creds Credentials, service string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://example.amazonaws.com/queue", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	Sign(req, []byte(`{}`), creds, "us-east-1", service, testTime)
+	return req
+}
+
+func TestSignSkipsUnsignedHeaders(t *testing.T) {
+	req := signedPost(t, testCreds, "sqs")
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=content-type;host;x-amz-date,") {
+		t.Errorf("Authorization = %s, want only content-type, host and x-amz-date signed", got)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "" {
+		t.Errorf("X-Amz-Content-Sha256 = %s outside S3", got)
+	}
+}
+
+func TestSignS3PayloadHash(t *testing.T) {
+	req := signedPost(t, testCreds, "s3")
+	// sha256 of {}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("X-Amz-Content-Sha256 = %s, want the body's hash", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date,") {
+		t.Errorf("Authorization = %s, want the payload hash signed", got)
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+	req := signedPost(t, creds, "sqs")
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %q, want token", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, ";x-amz-security-token,") {
+		t.Errorf("Authorization = %s, want the session token signed", got)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		query map[string][]string
+		want  string
+	}{
+		{nil, ""},
+		{map[string][]string{"b": {"2"}, "a": {"1"}}, "a=1&b=2"},
+		{map[string][]string{"a": {"z", "y"}}, "a=y&a=z"},
+		{map[string][]string{"q": {"a b"}}, "q=a%20b"},
+		{map[string][]string{"k": {"a/b~c"}}, "k=a%2Fb~c"},
+	}
+	for _, tt := range tests {
+		if got := canonicalQuery(tt.query); got != tt.want {
+			t.Errorf("canonicalQuery(%v) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package bitbucket is the Bitbucket Cloud SCM provider: it triggers custom
+// pipelines for the bitbucket_pipelines executor, opens pull requests,
+// authenticates git over HTTPS and parses commit status and push webhooks.
+package bitbucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	apiURL = "https://api.bitbucket.org/2.0"
+	webURL = "https://bitbucket.org"
+)
+
+// ErrNotConfigured is returned for API calls without Bitbucket credentials
+var ErrNotConfigured = errors.New("bitbucket credentials not configured")
+
+// Client talks to the Bitbucket Cloud API
+type Client struct {
+	cfg         config.BitbucketConfig
+	callbackURL string
+	apiURL      string
+	httpClient  *http.Client
+}
+
+// NewClient creates a Bitbucket client. Runs it triggers report to
+// callbackURL.
+func NewClient(cfg config.BitbucketConfig, callbackURL string) *Client {
+	return &Client{
+		cfg:         cfg,
+		callbackURL: callbackURL,
+		apiURL:      apiURL,
+		httpClient:  &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// Name returns bitbucket, the SCM provider name projects select Bitbucket by
+func (c *Client) Name() string {
+	return models.SCMBitbucket
+}
+
+// Configured reports whether API calls can be made
+func (c *Client) Configured() bool {
+	return c.cfg.AccessToken != "" || c.cfg.Username != "" && c.cfg.AppPassword != ""
+}
+
+// Pipeline is the subset of a pipeline the orchestrator uses
+type Pipeline struct {
+	UUID        string `json:"uuid"`
+	BuildNumber int64  `json:"build_number"`
+	State       struct {
+		Name   string `json:"name"`
+		Result struct {
+			Name string `json:"name"`
+		} `json:"result"`
+	} `json:"state"`
+}
+
+// RunID is the build number runs are known by, which the API accepts in
+// place of the pipeline's UUID
+func (p *Pipeline) RunID() string {
+	return strconv.FormatInt(p.BuildNumber, 10)
+}
+
+// PipelineURL links to a pipeline's results
+func PipelineURL(repo, runID string) string {
+	return webURL + "/" + repo + "/pipelines/results/" + runID
+}
+
+// TriggerPipeline starts the custom pipeline running the agent for job. Its
+// variables mirror the environment local runs give the agent.
+func (c *Client) TriggerPipeline(ctx context.Context, job *models.Job) (_ *Pipeline, err error) {
+	if !c.Configured() {
+		return nil, ErrNotConfigured
+	}
+
+	ctx, span := tracing.Start(ctx, "bitbucket.trigger",
+		attribute.String("job.id", job.ID),
+		attribute.String("bitbucket.repo", job.RepoFullName),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// QA runs verify the job's branch; the others start from the base
+	ref := job.BaseBranch
+	if job.Kind == models.JobKindQARerun {
+		ref = job.BranchName
+	}
+
+	var callbackSecret string
+	if job.Credentials != nil {
+		callbackSecret = job.Credentials.CallbackToken
+	}
+	type variable struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Secured bool   `json:"secured,omitempty"`
+	}
+	var variables []variable
+	for _, v := range []variable{
+		{Key: "AUTOBUILD_JOB_ID", Value: job.ID},
+		{Key: "AUTOBUILD_JOB_KIND", Value: string(job.Kind)},
+		{Key: "AUTOBUILD_TICKET_ID", Value: job.TicketID},
+		{Key: "AUTOBUILD_TICKET_TITLE", Value: job.TicketTitle},
+		{Key: "AUTOBUILD_TICKET_DESCRIPTION", Value: job.TicketDesc},
+		{Key: "AUTOBUILD_PROMPT", Value: job.DispatchPrompt()},
+		{Key: "AUTOBUILD_BRANCH_NAME", Value: job.BranchName},
+		{Key: "AUTOBUILD_BASE_BRANCH", Value: job.BaseBranch},
+		{Key: "AUTOBUILD_CALLBACK_URL", Value: c.callbackURL},
+		{Key: "AUTOBUILD_CALLBACK_SECRET", Value: callbackSecret, Secured: true},
+		{Key: "AUTOBUILD_TRACEPARENT", Value: tracing.Inject(ctx)},
+		{Key: "AUTOBUILD_RUNS_ON", Value: job.RunsOn},
+	} {
+		if v.Value != "" {
+			variables = append(variables, v)
+		}
+	}
+
+	req := map[string]interface{}{
+		"target": map[string]interface{}{
+			"type":     "pipeline_ref_target",
+			"ref_type": "branch",
+			"ref_name": ref,
+			"selector": map[string]string{"type": "custom", "pattern": c.cfg.Pipeline},
+		},
+		"variables": variables,
+	}
+	var pipeline Pipeline
+	if err := c.doJSON(ctx, http.MethodPost, repoPath(job.RepoFullName)+"/pipelines/", req, &pipeline); err != nil {
+		return nil, fmt.Errorf("failed to trigger pipeline: %w", err)
+	}
+	return &pipeline, nil
+}
+
+// GetPipeline returns a pipeline by build number
+func (c *Client) GetPipeline(ctx context.Context, repo, runID string) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := c.doJSON(ctx, http.MethodGet, repoPath(repo)+"/pipelines/"+runID, nil, &pipeline); err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// StopPipeline stops a pipeline's running steps
+func (c *Client) StopPipeline(ctx context.Context, repo, runID string) error {
+	pipeline, err := c.GetPipeline(ctx, repo, runID)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(ctx, http.MethodPost, repoPath(repo)+"/pipelines/"+pipeline.UUID+"/stopPipeline", nil, nil)
+}
+
+// OpenChangeRequest opens a pull request from head into base
+func (c *Client) OpenChangeRequest(ctx context.Context, repo, head, base, title, body string) (*scm.ChangeRequest, error) {
+	req := map[string]interface{}{
+		"title":               title,
+		"description":         body,
+		"source":              map[string]interface{}{"branch": map[string]string{"name": head}},
+		"destination":         map[string]interface{}{"branch": map[string]string{"name": base}},
+		"close_source_branch": true,
+	}
+	var pr struct {
+		ID    int `json:"id"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, repoPath(repo)+"/pullrequests", req, &pr); err != nil {
+		return nil, err
+	}
+	return &scm.ChangeRequest{Number: pr.ID, URL: pr.Links.HTML.Href}, nil
+}
+
+// repoPath is the API path of a repository ("workspace/slug")
+func repoPath(repo string) string {
+	return "/repositories/" + repo
+}
+
+// doJSON performs an authenticated API request with a JSON body, decoding
+// the JSON response into out
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.AccessToken)
+	} else {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.AppPassword)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// APIError is a non-2xx response from the Bitbucket API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bitbucket api error %d: %s", e.StatusCode, e.Message)
+}
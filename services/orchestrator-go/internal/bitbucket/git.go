@@ -0,0 +1,62 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+)
+
+// CloneURL returns the HTTPS URL git clones a repository ("workspace/slug")
+// from
+func (c *Client) CloneURL(repo string) string {
+	return webURL + "/" + repo + ".git"
+}
+
+// SSHCloneURL returns the SSH URL git clones a repository from with an
+// access key
+func (c *Client) SSHCloneURL(repo string) string {
+	return "git@bitbucket.org:" + repo + ".git"
+}
+
+// GitCredentials returns credentials authenticating git over HTTPS with the
+// access token or app password, or nil when neither is configured
+func (c *Client) GitCredentials() gitauth.Credentials {
+	if !c.Configured() {
+		return nil
+	}
+	return gitCredentials{c}
+}
+
+type gitCredentials struct {
+	c *Client
+}
+
+// Env sends the access token or app password as the basic auth header git
+// uses for bitbucket.org, and keeps git from prompting when it is rejected
+func (g gitCredentials) Env(ctx context.Context) ([]string, error) {
+	user, password := g.c.cfg.Username, g.c.cfg.AppPassword
+	if g.c.cfg.AccessToken != "" {
+		user, password = "x-token-auth", g.c.cfg.AccessToken
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + webURL + "/.extraheader",
+		"GIT_CONFIG_VALUE_0=AUTHORIZATION: basic " + auth,
+	}, nil
+}
+
+// Refresh does nothing: tokens and app passwords are rotated by replacing
+// them in the configuration
+func (g gitCredentials) Refresh(ctx context.Context) error {
+	return nil
+}
+
+func (g gitCredentials) Installation() string {
+	if g.c.cfg.AccessToken != "" {
+		return "BITBUCKET_ACCESS_TOKEN"
+	}
+	return "BITBUCKET_APP_PASSWORD of " + g.c.cfg.Username
+}
@@ -0,0 +1,139 @@
+package bitbucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// VerifySignature checks an X-Hub-Signature header ("sha256=<hex>") against
+// the HMAC of the payload with the webhook secret
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Repository is the repository block common to webhook payloads
+type Repository struct {
+	FullName string `json:"full_name"`
+}
+
+// pipelineResult finds a pipeline's build number in the link of its commit
+// status, e.g. .../addon/pipelines/home#!/results/42
+var pipelineResult = regexp.MustCompile(`/pipelines/.*results/(\d+)`)
+
+// CommitStatusEvent is the payload of a commit status webhook, which
+// Bitbucket Pipelines sends as pipelines start and finish
+type CommitStatusEvent struct {
+	CommitStatus struct {
+		State   string `json:"state"`
+		URL     string `json:"url"`
+		Refname string `json:"refname"`
+	} `json:"commit_status"`
+	Repository Repository `json:"repository"`
+}
+
+// Update converts the event into a run update for the queue, in the
+// statuses and conclusions of GitHub workflow runs, or returns nil for
+// statuses that no pipeline reported. The run is the pipeline's build
+// number, which the executor recorded when it triggered the pipeline.
+func (e *CommitStatusEvent) Update() *models.WorkflowRunUpdate {
+	status := e.CommitStatus
+	m := pipelineResult.FindStringSubmatch(status.URL)
+	if m == nil {
+		return nil
+	}
+	update := &models.WorkflowRunUpdate{
+		RepoFullName: e.Repository.FullName,
+		Branch:       status.Refname,
+		RunID:        m[1],
+		URL:          PipelineURL(e.Repository.FullName, m[1]),
+		SCM:          models.SCMBitbucket,
+	}
+	update.Status, update.Conclusion = runStatus(status.State, status.State)
+	return update
+}
+
+// runStatus maps a pipeline or commit status state, and the result of a
+// completed pipeline, to a workflow run's status and conclusion
+func runStatus(state, result string) (string, string) {
+	switch state {
+	case "INPROGRESS", "IN_PROGRESS":
+		return "in_progress", ""
+	case "COMPLETED", "SUCCESSFUL", "FAILED", "STOPPED":
+		switch result {
+		case "SUCCESSFUL":
+			return "completed", "success"
+		case "STOPPED":
+			return "completed", "cancelled"
+		default:
+			// FAILED, ERROR, EXPIRED
+			return "completed", "failure"
+		}
+	default:
+		// PENDING, PAUSED
+		return "queued", ""
+	}
+}
+
+// RunState maps a pipeline's state to the state of a job's run
+func RunState(p *Pipeline) string {
+	switch s, _ := runStatus(p.State.Name, p.State.Result.Name); s {
+	case "completed":
+		return models.RunStateCompleted
+	case "in_progress":
+		return models.RunStateRunning
+	default:
+		return models.RunStateQueued
+	}
+}
+
+// PushEvent is the payload of a repo:push webhook
+type PushEvent struct {
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Type   string `json:"type"`
+				Name   string `json:"name"`
+				Target struct {
+					Hash string `json:"hash"`
+				} `json:"target"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	Repository Repository `json:"repository"`
+}
+
+// BranchHeads returns the new head of each pushed branch; deleted branches
+// and tags are left out
+func (e *PushEvent) BranchHeads() map[string]string {
+	heads := make(map[string]string)
+	for _, change := range e.Push.Changes {
+		if change.New != nil && change.New.Type == "branch" {
+			heads[change.New.Name] = change.New.Target.Hash
+		}
+	}
+	return heads
+}
+
+// PullRequestEvent is the payload of a pullrequest:fulfilled or
+// pullrequest:rejected webhook, sent when a pull request is merged or
+// declined
+type PullRequestEvent struct {
+	PullRequest struct {
+		ID int `json:"id"`
+	} `json:"pullrequest"`
+	Repository Repository `json:"repository"`
+}
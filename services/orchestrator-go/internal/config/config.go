@@ -2,30 +2,184 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
 )
 
 type Config struct {
-	Env    string
-	Server ServerConfig
-	Queue  QueueConfig
-	Worktree WorktreeConfig
-	GitHub GitHubConfig
-	Database DatabaseConfig
+	Env           string
+	Server        ServerConfig
+	Queue         QueueConfig
+	Delivery      DeliveryConfig
+	Worktree      WorktreeConfig
+	GitHub        GitHubConfig
+	GitLab        GitLabConfig
+	Bitbucket     BitbucketConfig
+	Jira          JiraConfig
+	Linear        LinearConfig
+	Database      DatabaseConfig
+	Redis         RedisConfig
+	Leader        LeaderConfig
+	Federation    FederationConfig
+	Auth          AuthConfig
+	RateLimit     RateLimitConfig
 	MemoryService MemoryServiceConfig
+	Tracing       TracingConfig
+	JobLog        JobLogConfig
+	Executor      ExecutorConfig
+	Messages      MessagesConfig
+	Secrets       SecretsConfig
+	// LogLevel is the least severe level logged: debug, info, warn or error
+	LogLevel string
+	// File is the config file settings were read from under the
+	// environment, and Projects the project settings it holds
+	File     string
+	Projects []models.ProjectSettings
 }
 
 type ServerConfig struct {
 	Host string
 	Port int
+	// ReadTimeout and IdleTimeout apply to every connection
+	ReadTimeout time.Duration
+	IdleTimeout time.Duration
+	// RequestTimeout and WriteTimeout bound regular (non-streaming) requests
+	RequestTimeout time.Duration
+	WriteTimeout   time.Duration
+	// StreamHeartbeat is how often idle streams send a keep-alive, and
+	// StreamIdleTimeout closes streams that have had no events for that long
+	StreamHeartbeat   time.Duration
+	StreamIdleTimeout time.Duration
+	// DrainTimeout is how long shutdown waits for in-flight jobs to settle
+	DrainTimeout time.Duration
+	// HealthCheckTimeout bounds each dependency probe of the health check,
+	// whose results are reused for HealthCheckCacheTTL
+	HealthCheckTimeout  time.Duration
+	HealthCheckCacheTTL time.Duration
+	// HealthMinFreeDiskBytes is the free space below which the worktree
+	// check fails, zero to only check that the base path is writable
+	HealthMinFreeDiskBytes int64
+	// LivenessStallTimeout is how long the dispatch loop may go without a
+	// pass before /livez reports the process wedged
+	LivenessStallTimeout time.Duration
+	// TrustedProxies are the addresses and CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For and X-Real-IP headers name the client;
+	// without any, clients are identified by their connection
+	TrustedProxies []string
 }
 
 type QueueConfig struct {
+	// Backend selects where pending jobs are stored: "memory" or "redis"
+	Backend         string
 	MaxParallelJobs int
 	JobTimeout      time.Duration
 	RetryAttempts   int
+	// Scheduling orders the queue for dispatch: "priority" takes jobs by
+	// priority then age across all projects, "fair" takes them from each
+	// project in turn, fewest running first, by priority within a project,
+	// and "deadline" takes them by priority then earliest deadline
+	Scheduling string
+	// Preemption lets a critical job that finds no capacity cancel the
+	// lowest-priority running job in its way, which is queued again
+	Preemption bool
+	// MinFreeDiskBytes (in the worktree base path), MaxLoadPerCPU (one-minute
+	// load average per CPU) and MinFreeMemoryBytes defer dispatching while
+	// the host is short of them; zero disables each check
+	MinFreeDiskBytes   int64
+	MaxLoadPerCPU      float64
+	MinFreeMemoryBytes int64
+	// DedupWindow is how far back Submit looks for an identical prompt on the
+	// same project. Zero disables duplicate detection.
+	DedupWindow time.Duration
+	// DedupMode is what happens to a probable duplicate: "flag" queues it
+	// marked as one, "link" makes it wait for the earlier job's result
+	// instead of running a second agent, and "reuse" returns the earlier
+	// job without creating another.
+	DedupMode string
+	// QARerunOnBaseChange re-runs QA for completed jobs with open PRs when
+	// their base branch moves, marking the earlier QA result stale
+	QARerunOnBaseChange bool
+	// SourceMaxActive caps the queued and running jobs of each submission
+	// source, so one integration cannot monopolize the queue
+	SourceMaxActive map[string]int
+	// MaxQueueDepth caps the jobs waiting in the queue, and
+	// ProjectMaxQueueDepth those of each project that sets no
+	// max_queue_depth; submissions beyond either are refused. Zero leaves
+	// the queue unbounded.
+	MaxQueueDepth        int
+	ProjectMaxQueueDepth int
+	// ResultWorkers is how many job results are handled concurrently
+	ResultWorkers int
+	// RetentionTTL evicts finished jobs from memory this long after they
+	// complete, and RetentionMaxJobs evicts the oldest finished jobs once more
+	// jobs than that are held. Zero disables either limit.
+	RetentionTTL      time.Duration
+	RetentionMaxJobs  int
+	RetentionInterval time.Duration
+	// ArchiveJobs writes evicted jobs to Postgres so they can still be fetched
+	ArchiveJobs bool
+	// RollupsEnabled aggregates each day's finished jobs per project into
+	// Postgres after the day ends (UTC), catching up on at most
+	// RollupBackfillDays missed days. ArchiveMaxAge then deletes archived
+	// jobs older than that whose days are rolled up; zero keeps them.
+	RollupsEnabled     bool
+	RollupBackfillDays int
+	ArchiveMaxAge      time.Duration
+	// IDFormat selects how job IDs are generated: "uuid", "uuidv7" or "ulid"
+	IDFormat string
+	// StopGracePeriod is how long a soft-cancelled run may take to push its
+	// partial work before it is cancelled outright
+	StopGracePeriod time.Duration
+	// QACheckTimeout is how long a project's QA checks may take to report
+	// before the job waiting on them fails
+	QACheckTimeout time.Duration
+	// ProjectStaleAfter is how long a project may go without new jobs
+	// before it is stale: its repository cache and pooled worktrees are
+	// evicted and, with ProjectAutoArchive, it is archived. Zero disables
+	// stale detection.
+	ProjectStaleAfter  time.Duration
+	ProjectAutoArchive bool
+	// DiffMaxLines and DiffMaxFiles bound the changes of jobs of projects
+	// that set no diff limit; zero leaves either unbounded. DiffLimitAction
+	// is "fail" or "flag", and DiffSuggestSplit lists the areas an
+	// oversized diff touched.
+	DiffMaxLines     int
+	DiffMaxFiles     int
+	DiffLimitAction  string
+	DiffSuggestSplit bool
+	// CheckBaseBranch rejects submissions whose base branch the
+	// repository's remote does not have
+	CheckBaseBranch bool
+	// MaxPromptLength is the most characters a submitted prompt may have,
+	// zero for no limit
+	MaxPromptLength int
+}
+
+// DeliveryConfig controls how job results reach submitters. Destinations are
+// URLs: http(s)://..., sqs://<region>/<account>/<queue>,
+// pubsub://<project>/<topic>, or nats://[user:pass@]host[:port]/<subject>.
+type DeliveryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// ProjectDestinations receives results for a project's jobs submitted
+	// without their own callback_url
+	ProjectDestinations map[string]string
+	// CallbackAllowedDestinations are the queue and topic destinations a
+	// job's own callback_url may name; otherwise only http(s) is accepted
+	CallbackAllowedDestinations []string
+	// Credentials for queue destinations
+	AWSAccessKeyID        string
+	AWSSecretAccessKey    string
+	AWSSessionToken       string
+	PubSubCredentialsFile string
 }
 
 type WorktreeConfig struct {
@@ -33,13 +187,167 @@ type WorktreeConfig struct {
 	MaxActive       int
 	CleanupInterval time.Duration
 	MaxAge          time.Duration
+	// CopyOnWrite controls reflink clones of a prepared per-project template:
+	// "auto" detects filesystem support, "always" requires it, "never" disables it
+	CopyOnWrite string
+	// TemplatePrepareCmd runs once in each new template, e.g. to install dependencies
+	TemplatePrepareCmd string
+	// WatchActivity refreshes LastUsedAt from file activity inside worktrees
+	WatchActivity bool
+	// DiskQuotaBytes caps each worktree's disk usage, failing the job using
+	// a worktree that grows past it; zero is unlimited. Usage is measured
+	// every DiskCheckInterval, or never when it is zero.
+	DiskQuotaBytes    int64
+	DiskCheckInterval time.Duration
+	// FetchInterval is how often cached repository clones are fetched in
+	// the background, besides before each worktree is added; zero disables
+	// the background fetch
+	FetchInterval time.Duration
+	// GitTimeout bounds the clone, fetch and checkout of a new worktree,
+	// and each background fetch; zero leaves them unbounded
+	GitTimeout time.Duration
+	// PoolSize is how many released worktrees each project keeps, cleaned,
+	// for new jobs to reuse instead of adding worktrees; zero disables pooling
+	PoolSize int
+	// CleanupDelay is how long a worktree whose pull request was resolved
+	// is kept before it is removed
+	CleanupDelay time.Duration
+	// MergingMaxAge bounds how long a worktree waits on a pull request that
+	// is never resolved; zero keeps it until the pull request is resolved
+	MergingMaxAge time.Duration
+}
+
+// defaultLocalAgentCommand runs Claude Code the way the agent workflow does
+const defaultLocalAgentCommand = `claude -p "$AUTOBUILD_PROMPT" --allowedTools "Edit,Write,Read,Glob,Grep,Bash" --output-format json --max-turns 50`
+
+// defaultLocalAnalysisCommand runs Claude Code with read-only tools and
+// keeps its answer as the report
+const defaultLocalAnalysisCommand = `claude -p "$AUTOBUILD_PROMPT" --allowedTools "Read,Glob,Grep" --output-format text --max-turns 50 > "$AUTOBUILD_REPORT_PATH"`
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ExecutorConfig selects where agents run. Type is the default executor:
+// "github_actions" to dispatch workflow runs, "gitlab_ci" to trigger GitLab
+// pipelines, "bitbucket_pipelines" to trigger Bitbucket pipelines, "local" to run LocalCommand with sh inside each job's worktree, "docker" to run it in a container with
+// the worktree mounted at /workspace, or "kubernetes" to start a Kubernetes
+// Job whose image does what the workflow does. The prompt is in
+// $AUTOBUILD_PROMPT. Projects may select another executor.
+type ExecutorConfig struct {
+	Type         string
+	LocalCommand string
+	// LocalPush pushes the agent's branch and opens a pull request
+	LocalPush bool
+	// LocalAnalysisCommand runs analysis jobs in place of LocalCommand. It
+	// writes its markdown report to $AUTOBUILD_REPORT_PATH; docker mounts
+	// the worktree read-only for it.
+	LocalAnalysisCommand string
+	// Timeout bounds a local agent run; zero leaves it unbounded
+	Timeout time.Duration
+	// DockerImage is the default container image; projects may set their own
+	DockerImage string
+	// DockerCPUs and DockerMemory limit each container ("2", "4g"); empty
+	// leaves it unlimited
+	DockerCPUs   string
+	DockerMemory string
+	// DockerEnv names host environment variables passed into containers
+	DockerEnv []string
+	// DockerEgressNetwork is an internal Docker network, with no route out,
+	// that containers of projects restricting egress run on. The egress
+	// proxy listens on DockerEgressProxyListen and containers reach it at
+	// DockerEgressProxyURL, an address on that network.
+	DockerEgressNetwork     string
+	DockerEgressProxyListen string
+	DockerEgressProxyURL    string
+	// Kubernetes is where the kubernetes executor starts Jobs
+	Kubernetes KubernetesConfig
+}
+
+// KubernetesConfig is where the kubernetes executor starts Jobs. The API
+// server, token and CA default to the pod's in-cluster service account.
+type KubernetesConfig struct {
+	APIURL    string
+	TokenFile string
+	CAFile    string
+	Namespace string
+	// Image is the default agent image; projects may set their own
+	Image string
+	// EnvSecret names a Secret whose keys are added to the agent's environment
+	EnvSecret string
+	// CPU and Memory are the agent container's limits ("2", "4Gi")
+	CPU    string
+	Memory string
+	// ServiceAccount runs agent pods under another service account
+	ServiceAccount string
 }
 
 type GitHubConfig struct {
+	// APIURL is where the REST API is served and URL where repositories
+	// are cloned from, github.com by default. Both may point at a GitHub
+	// Enterprise Server, or at the fake GitHub of integration tests.
+	APIURL         string
+	URL            string
 	AppID          string
 	InstallationID string
+	// PrivateKey is the app's PEM encoded key, read from PrivateKeyPath
+	// when not set
+	PrivateKey     string
 	PrivateKeyPath string
 	WebhookSecret  string
+	// CallbackURL is where dispatched runs report results. Each run sends
+	// a token for its own job signed with CallbackSigningKey, valid until
+	// the job finishes or CallbackTokenTTL passes.
+	CallbackURL        string
+	CallbackSigningKey string
+	CallbackTokenTTL   time.Duration
+	// JobCredentials also dispatches each run with an installation token
+	// scoped to the job's repository, revoked once the run ends
+	JobCredentials bool
+}
+
+// GitLabConfig lets projects host their repositories on GitLab. Their runs
+// are triggered as pipelines and report back to GitHub.CallbackURL.
+type GitLabConfig struct {
+	// URL is the GitLab instance, https://gitlab.com by default
+	URL string
+	// Token is a project, group or personal access token with api and
+	// write_repository scopes, used for API calls and git over HTTPS
+	Token string
+	// TriggerToken is the pipeline trigger token runs are started with
+	TriggerToken  string
+	WebhookSecret string
+}
+
+// BitbucketConfig lets projects host their repositories on Bitbucket
+// Cloud. Their runs are triggered as a custom pipeline and report back to
+// GitHub.CallbackURL.
+type BitbucketConfig struct {
+	// Username and AppPassword authenticate with an app password with
+	// repository write, pull request write and pipeline write permissions
+	Username    string
+	AppPassword string
+	// AccessToken is a repository, project or workspace access token used
+	// instead of an app password
+	AccessToken string
+	// Pipeline is the custom pipeline runs are triggered as
+	Pipeline      string
+	WebhookSecret string
+}
+
+// JiraConfig lets projects keep their tickets' Jira issues up to date.
+// Email and APIToken authenticate with a Jira Cloud API token; without an
+// email, APIToken is sent as a personal access token (Jira Data Center).
+type JiraConfig struct {
+	URL      string
+	Email    string
+	APIToken string
+}
+
+// LinearConfig lets projects keep their tickets' Linear issues up to date.
+// APIKey is a personal API key, or "Bearer <token>" for an OAuth token.
+type LinearConfig struct {
+	APIURL string
+	APIKey string
 }
 
 type DatabaseConfig struct {
@@ -47,45 +355,347 @@ type DatabaseConfig struct {
 	MaxConnections int
 }
 
+type RedisConfig struct {
+	URL       string
+	KeyPrefix string
+}
+
+type LeaderConfig struct {
+	Enabled       bool
+	LockID        int
+	RetryInterval time.Duration
+}
+
+// FederationConfig lists downstream orchestrators that own some projects
+type FederationConfig struct {
+	Downstreams []DownstreamConfig
+}
+
+// DownstreamConfig is an orchestrator that jobs for ProjectIDs are forwarded
+// to. Token replaces the caller's credentials on forwarded requests.
+type DownstreamConfig struct {
+	Name       string
+	URL        string
+	Token      string
+	ProjectIDs []string
+}
+
+// AuthConfig holds API credentials. Job endpoints require a token once any
+// API tokens are configured; admin endpoints are disabled while AdminToken
+// is empty.
+type AuthConfig struct {
+	AdminToken string
+	Tokens     []APITokenConfig
+}
+
+// APITokenConfig is an API token limited to ProjectIDs ("*" for all projects)
+type APITokenConfig struct {
+	Name       string
+	Token      string
+	ProjectIDs []string
+}
+
+// RateLimitConfig bounds job submissions per API token and per client IP.
+// Rates are requests per minute; zero disables that limit.
+type RateLimitConfig struct {
+	SubmitPerToken      int
+	SubmitBurstPerToken int
+	SubmitPerIP         int
+	SubmitBurstPerIP    int
+	// SubmitPerSource limits individual submission sources, sharing the
+	// per-token burst
+	SubmitPerSource map[string]int
+}
+
 type MemoryServiceConfig struct {
 	URL     string
 	Timeout time.Duration
 	Token   string
+	// Enabled fetches project context for jobs before dispatch and records
+	// their outcomes afterwards
+	Enabled bool
+	// ContextMaxTokens bounds the project context attached to a dispatch
+	ContextMaxTokens int
 }
 
+// TracingConfig controls OpenTelemetry tracing. Spans are exported over
+// OTLP/HTTP to the endpoint in the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Enabled     bool
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded; traces continued
+	// from a caller follow the caller's sampling decision
+	SampleRatio float64
+}
+
+// MessagesConfig selects the catalog of user-facing messages: Dir holds a
+// <locale>.json file per locale, and DefaultLocale is used by projects that
+// pick none
+type MessagesConfig struct {
+	Dir           string
+	DefaultLocale string
+}
+
+// SecretsConfig addresses the secrets backends settings may be read from,
+// Vault and AWS Secrets Manager (with the AWS credentials of the
+// environment). Fetched secrets are reused for CacheTTL; every
+// RefreshInterval, when set, the configuration is loaded again so rotated
+// secrets take effect.
+type SecretsConfig struct {
+	VaultAddr       string
+	VaultToken      string
+	VaultNamespace  string
+	AWSRegion       string
+	AWSEndpoint     string
+	CacheTTL        time.Duration
+	RefreshInterval time.Duration
+	// Referenced names the settings that were read from a backend
+	Referenced []string
+}
+
+// JobLogConfig controls where job logs are kept. Store is "disk", "s3" or
+// "none". The S3 store spools to Dir and uploads finished segments, using
+// the AWS credentials from the environment; S3Endpoint selects an
+// S3-compatible service instead of AWS.
+type JobLogConfig struct {
+	Store       string
+	Dir         string
+	SegmentSize int64
+	MaxSegments int
+	S3Bucket    string
+	S3Region    string
+	S3Endpoint  string
+	S3Prefix    string
+	// RetentionDays and RetentionMaxBytes are the default retention for
+	// projects without their own; zero disables either limit. The sweeper
+	// runs every RetentionInterval.
+	RetentionDays     int
+	RetentionMaxBytes int64
+	RetentionInterval time.Duration
+}
+
+// Load reads the configuration from the environment, over the config file
+// at CONFIG_FILE if one is set
 func Load() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	file := os.Getenv("CONFIG_FILE")
+	values, projects, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	fileValues = values
+	defer func() { fileValues = nil }()
+
 	cfg := &Config{
-		Env: getEnv("ENV", "development"),
+		File:     file,
+		Projects: projects,
+		Env:      getEnv("ENV", "development"),
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 		Server: ServerConfig{
-			Host: getEnv("HOST", "0.0.0.0"),
-			Port: getEnvInt("PORT", 8080),
+			Host:                   getEnv("HOST", "0.0.0.0"),
+			Port:                   getEnvInt("PORT", 8080),
+			ReadTimeout:            getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+			IdleTimeout:            getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			RequestTimeout:         getEnvDuration("SERVER_REQUEST_TIMEOUT", 60*time.Second),
+			WriteTimeout:           getEnvDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			StreamHeartbeat:        getEnvDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+			StreamIdleTimeout:      getEnvDuration("STREAM_IDLE_TIMEOUT", 10*time.Minute),
+			DrainTimeout:           getEnvDuration("SHUTDOWN_DRAIN_TIMEOUT", 0),
+			HealthCheckTimeout:     getEnvDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+			HealthCheckCacheTTL:    getEnvDuration("HEALTH_CHECK_CACHE_TTL", 10*time.Second),
+			HealthMinFreeDiskBytes: int64(getEnvInt("HEALTH_MIN_FREE_DISK_BYTES", 1<<30)),
+			LivenessStallTimeout:   getEnvDuration("LIVENESS_STALL_TIMEOUT", 2*time.Minute),
+			TrustedProxies:         getEnvList("TRUSTED_PROXIES"),
 		},
 		Queue: QueueConfig{
-			MaxParallelJobs: getEnvInt("MAX_PARALLEL_JOBS", 12),
-			JobTimeout:      getEnvDuration("JOB_TIMEOUT", 30*time.Minute),
-			RetryAttempts:   getEnvInt("RETRY_ATTEMPTS", 3),
+			Backend:              getEnv("QUEUE_BACKEND", "memory"),
+			MaxParallelJobs:      getEnvInt("MAX_PARALLEL_JOBS", 12),
+			Scheduling:           getEnv("QUEUE_SCHEDULING", "priority"),
+			Preemption:           getEnvBool("QUEUE_PREEMPTION", false),
+			MinFreeDiskBytes:     int64(getEnvInt("DISPATCH_MIN_FREE_DISK_BYTES", 0)),
+			MaxLoadPerCPU:        getEnvFloat("DISPATCH_MAX_LOAD_PER_CPU", 0),
+			MinFreeMemoryBytes:   int64(getEnvInt("DISPATCH_MIN_FREE_MEMORY_BYTES", 0)),
+			JobTimeout:           getEnvDuration("JOB_TIMEOUT", 30*time.Minute),
+			RetryAttempts:        getEnvInt("RETRY_ATTEMPTS", 3),
+			ResultWorkers:        getEnvInt("RESULT_WORKERS", 8),
+			RetentionTTL:         getEnvDuration("JOB_RETENTION_TTL", 24*time.Hour),
+			RetentionMaxJobs:     getEnvInt("JOB_RETENTION_MAX_JOBS", 10000),
+			RetentionInterval:    getEnvDuration("JOB_RETENTION_INTERVAL", 5*time.Minute),
+			ProjectStaleAfter:    getEnvDuration("PROJECT_STALE_AFTER", 30*24*time.Hour),
+			ProjectAutoArchive:   getEnvBool("PROJECT_AUTO_ARCHIVE", false),
+			ArchiveJobs:          getEnvBool("JOB_ARCHIVE_ENABLED", false),
+			RollupsEnabled:       getEnvBool("JOB_ROLLUPS_ENABLED", false),
+			RollupBackfillDays:   getEnvInt("JOB_ROLLUP_BACKFILL_DAYS", 30),
+			ArchiveMaxAge:        getEnvDuration("JOB_ARCHIVE_MAX_AGE", 0),
+			IDFormat:             getEnv("JOB_ID_FORMAT", ids.FormatUUID),
+			StopGracePeriod:      getEnvDuration("JOB_STOP_GRACE_PERIOD", 10*time.Minute),
+			QACheckTimeout:       getEnvDuration("QA_CHECK_TIMEOUT", time.Hour),
+			DedupWindow:          getEnvDuration("DEDUP_WINDOW", time.Hour),
+			DedupMode:            getEnv("DEDUP_MODE", dedupModeDefault()),
+			QARerunOnBaseChange:  getEnvBool("QA_RERUN_ON_BASE_CHANGE", false),
+			SourceMaxActive:      getEnvIntMap("SOURCE_MAX_ACTIVE"),
+			MaxQueueDepth:        getEnvInt("QUEUE_MAX_DEPTH", 0),
+			ProjectMaxQueueDepth: getEnvInt("PROJECT_QUEUE_MAX_DEPTH", 0),
+			DiffMaxLines:         getEnvInt("DIFF_MAX_LINES", 0),
+			DiffMaxFiles:         getEnvInt("DIFF_MAX_FILES", 0),
+			DiffLimitAction:      getEnv("DIFF_LIMIT_ACTION", "fail"),
+			DiffSuggestSplit:     getEnvBool("DIFF_SUGGEST_SPLIT", true),
+			CheckBaseBranch:      getEnvBool("BASE_BRANCH_CHECK", true),
+			MaxPromptLength:      getEnvInt("JOB_PROMPT_MAX_LENGTH", 100000),
+		},
+		Delivery: DeliveryConfig{
+			MaxAttempts:                 getEnvInt("CALLBACK_MAX_ATTEMPTS", 5),
+			InitialBackoff:              getEnvDuration("CALLBACK_INITIAL_BACKOFF", 2*time.Second),
+			MaxBackoff:                  getEnvDuration("CALLBACK_MAX_BACKOFF", 5*time.Minute),
+			Timeout:                     getEnvDuration("CALLBACK_TIMEOUT", 10*time.Second),
+			ProjectDestinations:         getEnvMap("RESULT_DESTINATIONS"),
+			CallbackAllowedDestinations: getEnvList("CALLBACK_ALLOWED_DESTINATIONS"),
+			AWSAccessKeyID:              getEnv("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey:          getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			AWSSessionToken:             getEnv("AWS_SESSION_TOKEN", ""),
+			PubSubCredentialsFile:       getEnv("PUBSUB_CREDENTIALS_FILE", lookupEnv("GOOGLE_APPLICATION_CREDENTIALS")),
 		},
 		Worktree: WorktreeConfig{
-			BasePath:        getEnv("WORKTREE_BASE_PATH", "/tmp/autobuild-worktrees"),
-			MaxActive:       getEnvInt("WORKTREE_MAX_ACTIVE", 20),
-			CleanupInterval: getEnvDuration("WORKTREE_CLEANUP_INTERVAL", 5*time.Minute),
-			MaxAge:          getEnvDuration("WORKTREE_MAX_AGE", 2*time.Hour),
+			BasePath:           getEnv("WORKTREE_BASE_PATH", "/tmp/autobuild-worktrees"),
+			MaxActive:          getEnvInt("WORKTREE_MAX_ACTIVE", 20),
+			CleanupInterval:    getEnvDuration("WORKTREE_CLEANUP_INTERVAL", 5*time.Minute),
+			MaxAge:             getEnvDuration("WORKTREE_MAX_AGE", 2*time.Hour),
+			CopyOnWrite:        getEnv("WORKTREE_COPY_ON_WRITE", "auto"),
+			TemplatePrepareCmd: getEnv("WORKTREE_TEMPLATE_PREPARE_CMD", ""),
+			WatchActivity:      getEnvBool("WORKTREE_WATCH_ACTIVITY", false),
+			DiskQuotaBytes:     int64(getEnvInt("WORKTREE_DISK_QUOTA_BYTES", 0)),
+			DiskCheckInterval:  getEnvDuration("WORKTREE_DISK_CHECK_INTERVAL", time.Minute),
+			FetchInterval:      getEnvDuration("WORKTREE_FETCH_INTERVAL", 5*time.Minute),
+			GitTimeout:         getEnvDuration("WORKTREE_GIT_TIMEOUT", 10*time.Minute),
+			PoolSize:           getEnvInt("WORKTREE_POOL_SIZE", 0),
+			CleanupDelay:       getEnvDuration("WORKTREE_CLEANUP_DELAY", 0),
+			MergingMaxAge:      getEnvDuration("WORKTREE_MERGING_MAX_AGE", 30*24*time.Hour),
 		},
 		GitHub: GitHubConfig{
+			APIURL:         strings.TrimSuffix(getEnv("GITHUB_API_URL", "https://api.github.com"), "/"),
+			URL:            strings.TrimSuffix(getEnv("GITHUB_URL", "https://github.com"), "/"),
 			AppID:          getEnv("GITHUB_APP_ID", ""),
 			InstallationID: getEnv("GITHUB_INSTALLATION_ID", ""),
+			PrivateKey:     getEnv("GITHUB_PRIVATE_KEY", ""),
 			PrivateKeyPath: getEnv("GITHUB_PRIVATE_KEY_PATH", ""),
 			WebhookSecret:  getEnv("GITHUB_WEBHOOK_SECRET", ""),
+			CallbackURL:    getEnv("GITHUB_CALLBACK_URL", "http://localhost:8080/api/v1/callback"),
+			// The key used to be sent to runs as a shared bearer token
+			CallbackSigningKey: getEnv("GITHUB_CALLBACK_SIGNING_KEY", lookupEnv("GITHUB_CALLBACK_TOKEN")),
+			CallbackTokenTTL:   getEnvDuration("GITHUB_CALLBACK_TOKEN_TTL", 2*time.Hour),
+			JobCredentials:     getEnvBool("GITHUB_JOB_CREDENTIALS", false),
+		},
+		GitLab: GitLabConfig{
+			URL:           strings.TrimSuffix(getEnv("GITLAB_URL", "https://gitlab.com"), "/"),
+			Token:         getEnv("GITLAB_TOKEN", ""),
+			TriggerToken:  getEnv("GITLAB_TRIGGER_TOKEN", ""),
+			WebhookSecret: getEnv("GITLAB_WEBHOOK_SECRET", ""),
+		},
+		Bitbucket: BitbucketConfig{
+			Username:      getEnv("BITBUCKET_USERNAME", ""),
+			AppPassword:   getEnv("BITBUCKET_APP_PASSWORD", ""),
+			AccessToken:   getEnv("BITBUCKET_ACCESS_TOKEN", ""),
+			Pipeline:      getEnv("BITBUCKET_PIPELINE", "autobuild"),
+			WebhookSecret: getEnv("BITBUCKET_WEBHOOK_SECRET", ""),
+		},
+		Jira: JiraConfig{
+			URL:      strings.TrimSuffix(getEnv("JIRA_URL", ""), "/"),
+			Email:    getEnv("JIRA_EMAIL", ""),
+			APIToken: getEnv("JIRA_API_TOKEN", ""),
+		},
+		Linear: LinearConfig{
+			APIURL: getEnv("LINEAR_API_URL", "https://api.linear.app/graphql"),
+			APIKey: getEnv("LINEAR_API_KEY", ""),
 		},
 		Database: DatabaseConfig{
 			URL:            getEnv("DATABASE_URL", ""),
 			MaxConnections: getEnvInt("DATABASE_MAX_CONNECTIONS", 25),
 		},
+		Redis: RedisConfig{
+			URL:       getEnv("REDIS_URL", ""),
+			KeyPrefix: getEnv("REDIS_KEY_PREFIX", "autobuild:"),
+		},
+		Leader: LeaderConfig{
+			Enabled:       getEnvBool("LEADER_ELECTION_ENABLED", false),
+			LockID:        getEnvInt("LEADER_ELECTION_LOCK_ID", 424242),
+			RetryInterval: getEnvDuration("LEADER_ELECTION_RETRY_INTERVAL", 5*time.Second),
+		},
+		Auth: AuthConfig{
+			AdminToken: getEnv("ADMIN_TOKEN", ""),
+			Tokens:     loadAPITokens(),
+		},
+		RateLimit: RateLimitConfig{
+			SubmitPerToken:      getEnvInt("SUBMIT_RATE_LIMIT_PER_TOKEN", 120),
+			SubmitBurstPerToken: getEnvInt("SUBMIT_RATE_BURST_PER_TOKEN", 20),
+			SubmitPerIP:         getEnvInt("SUBMIT_RATE_LIMIT_PER_IP", 60),
+			SubmitBurstPerIP:    getEnvInt("SUBMIT_RATE_BURST_PER_IP", 10),
+			SubmitPerSource:     getEnvIntMap("SUBMIT_RATE_LIMIT_PER_SOURCE"),
+		},
 		MemoryService: MemoryServiceConfig{
 			URL:     getEnv("MEMORY_SERVICE_URL", "http://localhost:8000"),
 			Timeout: getEnvDuration("MEMORY_SERVICE_TIMEOUT", 30*time.Second),
 			Token:   getEnv("MEMORY_SERVICE_TOKEN", ""),
+
+			Enabled:          getEnvBool("MEMORY_SERVICE_ENABLED", false),
+			ContextMaxTokens: getEnvInt("MEMORY_CONTEXT_MAX_TOKENS", 2000),
+		},
+		Tracing: TracingConfig{
+			Enabled:     getEnvBool("TRACING_ENABLED", false),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "autobuild-orchestrator"),
+			SampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		JobLog: JobLogConfig{
+			Store:       getEnv("JOB_LOG_STORE", "disk"),
+			Dir:         getEnv("JOB_LOG_DIR", "/tmp/autobuild-job-logs"),
+			SegmentSize: int64(getEnvInt("JOB_LOG_SEGMENT_BYTES", 1<<20)),
+			MaxSegments: getEnvInt("JOB_LOG_MAX_SEGMENTS", 10),
+			S3Bucket:    getEnv("JOB_LOG_S3_BUCKET", ""),
+			S3Region:    getEnv("JOB_LOG_S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+			S3Endpoint:  getEnv("JOB_LOG_S3_ENDPOINT", ""),
+			S3Prefix:    getEnv("JOB_LOG_S3_PREFIX", "job-logs/"),
+
+			RetentionDays:     getEnvInt("JOB_LOG_RETENTION_DAYS", 30),
+			RetentionMaxBytes: int64(getEnvInt("JOB_LOG_RETENTION_MAX_BYTES", 0)),
+			RetentionInterval: getEnvDuration("JOB_LOG_RETENTION_INTERVAL", time.Hour),
+		},
+		Executor: ExecutorConfig{
+			Type:                    getEnv("EXECUTOR", "github_actions"),
+			LocalCommand:            getEnv("LOCAL_AGENT_COMMAND", defaultLocalAgentCommand),
+			LocalPush:               getEnvBool("LOCAL_AGENT_PUSH", true),
+			LocalAnalysisCommand:    getEnv("LOCAL_ANALYSIS_COMMAND", defaultLocalAnalysisCommand),
+			Timeout:                 getEnvDuration("LOCAL_AGENT_TIMEOUT", 30*time.Minute),
+			DockerImage:             getEnv("DOCKER_IMAGE", ""),
+			DockerCPUs:              getEnv("DOCKER_CPUS", ""),
+			DockerMemory:            getEnv("DOCKER_MEMORY", ""),
+			DockerEnv:               getEnvList("DOCKER_ENV"),
+			DockerEgressNetwork:     getEnv("DOCKER_EGRESS_NETWORK", ""),
+			DockerEgressProxyListen: getEnv("DOCKER_EGRESS_PROXY_LISTEN", ""),
+			DockerEgressProxyURL:    getEnv("DOCKER_EGRESS_PROXY_URL", ""),
+			Kubernetes: KubernetesConfig{
+				APIURL:         getEnv("KUBERNETES_API_URL", "https://kubernetes.default.svc"),
+				TokenFile:      getEnv("KUBERNETES_TOKEN_FILE", serviceAccountDir+"/token"),
+				CAFile:         getEnv("KUBERNETES_CA_FILE", serviceAccountDir+"/ca.crt"),
+				Namespace:      getEnv("KUBERNETES_NAMESPACE", ""),
+				Image:          getEnv("KUBERNETES_IMAGE", ""),
+				EnvSecret:      getEnv("KUBERNETES_ENV_SECRET", ""),
+				CPU:            getEnv("KUBERNETES_CPU", ""),
+				Memory:         getEnv("KUBERNETES_MEMORY", ""),
+				ServiceAccount: getEnv("KUBERNETES_SERVICE_ACCOUNT", ""),
+			},
 		},
+		Messages: MessagesConfig{
+			Dir:           getEnv("MESSAGES_DIR", ""),
+			DefaultLocale: getEnv("MESSAGES_DEFAULT_LOCALE", "en"),
+		},
+		Secrets: loadSecrets(),
+	}
+
+	cfg.Federation = loadFederation()
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -99,18 +709,196 @@ func (c *Config) Validate() error {
 	if c.Database.URL == "" {
 		return fmt.Errorf("DATABASE_URL is required")
 	}
+	switch c.Queue.Backend {
+	case "memory":
+	case "redis":
+		if c.Redis.URL == "" {
+			return fmt.Errorf("REDIS_URL is required when QUEUE_BACKEND is redis")
+		}
+	default:
+		return fmt.Errorf("unknown QUEUE_BACKEND: %s", c.Queue.Backend)
+	}
+	if c.Queue.RollupsEnabled && c.Queue.RollupBackfillDays < 1 {
+		return fmt.Errorf("JOB_ROLLUP_BACKFILL_DAYS must be at least 1")
+	}
+	if c.Queue.ArchiveMaxAge > 0 && !c.Queue.RollupsEnabled {
+		return fmt.Errorf("JOB_ARCHIVE_MAX_AGE requires JOB_ROLLUPS_ENABLED, so purged jobs are rolled up first")
+	}
+	switch c.Queue.Scheduling {
+	case "priority", "fair", "deadline":
+	default:
+		return fmt.Errorf("QUEUE_SCHEDULING must be priority, fair or deadline")
+	}
+	if c.Queue.MinFreeDiskBytes < 0 || c.Queue.MaxLoadPerCPU < 0 || c.Queue.MinFreeMemoryBytes < 0 {
+		return fmt.Errorf("DISPATCH_MIN_FREE_DISK_BYTES, DISPATCH_MAX_LOAD_PER_CPU and DISPATCH_MIN_FREE_MEMORY_BYTES may not be negative")
+	}
+	if c.Queue.MaxQueueDepth < 0 || c.Queue.ProjectMaxQueueDepth < 0 {
+		return fmt.Errorf("QUEUE_MAX_DEPTH and PROJECT_QUEUE_MAX_DEPTH may not be negative")
+	}
+	if c.Queue.MaxPromptLength < 0 {
+		return fmt.Errorf("JOB_PROMPT_MAX_LENGTH may not be negative")
+	}
+	// With no attempts, results would count as delivered without being sent
+	if c.Delivery.MaxAttempts < 1 {
+		return fmt.Errorf("CALLBACK_MAX_ATTEMPTS must be at least 1")
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+	seen := make(map[string]bool, len(c.Projects))
+	for _, project := range c.Projects {
+		if project.ProjectID == "" {
+			return fmt.Errorf("projects in %s need a project_id", c.File)
+		}
+		if !ids.Valid(project.ProjectID) {
+			return fmt.Errorf("project ID %q in %s must be 1-%d letters, digits, '-' or '_'", project.ProjectID, c.File, ids.MaxLength)
+		}
+		if seen[project.ProjectID] {
+			return fmt.Errorf("project %s is listed twice in %s", project.ProjectID, c.File)
+		}
+		seen[project.ProjectID] = true
+		if project.MaxParallel < 0 || project.SchedulingWeight < 0 || project.MaxQueueDepth < 0 {
+			return fmt.Errorf("project %s: max_parallel, scheduling_weight and max_queue_depth may not be negative", project.ProjectID)
+		}
+	}
+	if c.Server.HealthCheckTimeout <= 0 || c.Server.LivenessStallTimeout <= 0 {
+		return fmt.Errorf("HEALTH_CHECK_TIMEOUT and LIVENESS_STALL_TIMEOUT must be positive")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("TRUSTED_PROXIES entry %q is not an address or CIDR range", proxy)
+		}
+	}
+	if c.Server.HealthMinFreeDiskBytes < 0 {
+		return fmt.Errorf("HEALTH_MIN_FREE_DISK_BYTES may not be negative")
+	}
+	switch c.Queue.DedupMode {
+	case "flag", "link", "reuse":
+	default:
+		return fmt.Errorf("DEDUP_MODE must be flag, link or reuse")
+	}
+	switch c.Queue.DiffLimitAction {
+	case "fail", "flag":
+	default:
+		return fmt.Errorf("DIFF_LIMIT_ACTION must be fail or flag")
+	}
+	if c.Leader.Enabled && c.Queue.Backend == "memory" {
+		return fmt.Errorf("LEADER_ELECTION_ENABLED requires a shared QUEUE_BACKEND such as redis")
+	}
+	for _, ds := range c.Federation.Downstreams {
+		if ds.URL == "" {
+			return fmt.Errorf("FEDERATION_%s_URL is required", strings.ToUpper(ds.Name))
+		}
+	}
+	for _, t := range c.Auth.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("API_TOKEN_%s is required", strings.ToUpper(t.Name))
+		}
+		if len(t.ProjectIDs) == 0 {
+			return fmt.Errorf("API_TOKEN_%s_PROJECTS is required (use * for all projects)", strings.ToUpper(t.Name))
+		}
+	}
+	if _, err := ids.New(c.Queue.IDFormat); err != nil {
+		return fmt.Errorf("invalid JOB_ID_FORMAT: %w", err)
+	}
+	switch c.JobLog.Store {
+	case "none", "disk":
+	case "s3":
+		if c.JobLog.S3Bucket == "" {
+			return fmt.Errorf("JOB_LOG_S3_BUCKET is required when JOB_LOG_STORE is s3")
+		}
+	default:
+		return fmt.Errorf("unknown JOB_LOG_STORE: %s", c.JobLog.Store)
+	}
+	switch c.Executor.Type {
+	case "github_actions":
+	case "gitlab_ci":
+		if c.GitLab.Token == "" || c.GitLab.TriggerToken == "" {
+			return fmt.Errorf("GITLAB_TOKEN and GITLAB_TRIGGER_TOKEN are required when EXECUTOR is gitlab_ci")
+		}
+	case "bitbucket_pipelines":
+		if c.Bitbucket.AccessToken == "" && (c.Bitbucket.Username == "" || c.Bitbucket.AppPassword == "") {
+			return fmt.Errorf("BITBUCKET_ACCESS_TOKEN, or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD, are required when EXECUTOR is bitbucket_pipelines")
+		}
+	case "local", "docker":
+		if c.Executor.LocalCommand == "" {
+			return fmt.Errorf("LOCAL_AGENT_COMMAND is required when EXECUTOR is %s", c.Executor.Type)
+		}
+		if c.Executor.LocalAnalysisCommand == "" {
+			return fmt.Errorf("LOCAL_ANALYSIS_COMMAND is required when EXECUTOR is %s", c.Executor.Type)
+		}
+	case "kubernetes":
+		if c.Executor.Kubernetes.Image == "" {
+			return fmt.Errorf("KUBERNETES_IMAGE is required when EXECUTOR is kubernetes")
+		}
+	default:
+		return fmt.Errorf("unknown EXECUTOR: %s", c.Executor.Type)
+	}
+	if c.Executor.DockerEgressProxyListen != "" && (c.Executor.DockerEgressNetwork == "" || c.Executor.DockerEgressProxyURL == "") {
+		return fmt.Errorf("DOCKER_EGRESS_NETWORK and DOCKER_EGRESS_PROXY_URL are required when DOCKER_EGRESS_PROXY_LISTEN is set")
+	}
+	if c.MemoryService.Enabled && c.MemoryService.URL == "" {
+		return fmt.Errorf("MEMORY_SERVICE_URL is required when MEMORY_SERVICE_ENABLED is true")
+	}
+	switch c.Worktree.CopyOnWrite {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("unknown WORKTREE_COPY_ON_WRITE mode: %s", c.Worktree.CopyOnWrite)
+	}
 	return nil
 }
 
+// dedupModeDefault keeps DEDUP_LINK_RESULTS=true, which DEDUP_MODE=link
+// replaced, linking duplicates
+func dedupModeDefault() string {
+	if getEnvBool("DEDUP_LINK_RESULTS", false) {
+		return "link"
+	}
+	return "flag"
+}
+
+// loadFederation reads FEDERATION_DOWNSTREAMS (comma-separated names) and,
+// for each name, FEDERATION_<NAME>_URL, _TOKEN, and _PROJECTS
+func loadFederation() FederationConfig {
+	var fed FederationConfig
+	for _, name := range getEnvList("FEDERATION_DOWNSTREAMS") {
+		prefix := "FEDERATION_" + strings.ToUpper(name) + "_"
+		fed.Downstreams = append(fed.Downstreams, DownstreamConfig{
+			Name:       name,
+			URL:        strings.TrimSuffix(getEnv(prefix+"URL", ""), "/"),
+			Token:      getEnv(prefix+"TOKEN", ""),
+			ProjectIDs: getEnvList(prefix + "PROJECTS"),
+		})
+	}
+	return fed
+}
+
+// loadAPITokens reads API_TOKENS (comma-separated names) and, for each name,
+// API_TOKEN_<NAME> and API_TOKEN_<NAME>_PROJECTS
+func loadAPITokens() []APITokenConfig {
+	var tokens []APITokenConfig
+	for _, name := range getEnvList("API_TOKENS") {
+		key := "API_TOKEN_" + strings.ToUpper(name)
+		tokens = append(tokens, APITokenConfig{
+			Name:       name,
+			Token:      getEnv(key, ""),
+			ProjectIDs: getEnvList(key + "_PROJECTS"),
+		})
+	}
+	return tokens
+}
+
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -118,11 +906,62 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := lookupEnv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
 	}
 	return defaultValue
 }
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(lookupEnv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvMap parses a comma-separated list of key=value pairs
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvList(key) {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+// getEnvIntMap parses a comma-separated list of key=integer pairs, skipping
+// pairs whose value is not an integer
+func getEnvIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for k, v := range getEnvMap(key) {
+		if n, err := strconv.Atoi(v); err == nil {
+			values[k] = n
+		}
+	}
+	return values
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := lookupEnv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// The config file holds settings under their environment variable names, in
+// any case, either flat (max_parallel_jobs: 12) or grouped by the leading
+// words of the name (worktree: {max_age: 3h}). Lists are joined with commas.
+// Its projects section holds per-project settings, as the projects API takes
+// them. Environment variables override the file.
+
+var (
+	// loadMu serializes loads, which read fileValues
+	loadMu     sync.Mutex
+	fileValues map[string]string
+)
+
+// lookupEnv returns a setting from the environment, or else the config file
+func lookupEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileValues[key]
+}
+
+// readFile reads a YAML (or JSON) config file into settings by variable
+// name and the settings of its projects. An empty path reads nothing.
+func readFile(path string) (map[string]string, []models.ProjectSettings, error) {
+	values := make(map[string]string)
+	if path == "" {
+		return values, nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	var projects []models.ProjectSettings
+	for key, value := range doc {
+		if strings.EqualFold(key, "projects") {
+			if projects, err = readProjects(value); err != nil {
+				return nil, nil, fmt.Errorf("invalid projects in config file %s: %w", path, err)
+			}
+			continue
+		}
+		if err := flatten(values, strings.ToUpper(key), value); err != nil {
+			return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	return values, projects, nil
+}
+
+// flatten adds a setting, or the settings grouped under it, to values
+func flatten(values map[string]string, name string, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := flatten(values, name+"_"+strings.ToUpper(key), v[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s: list items must be plain values", name)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[name] = strings.Join(items, ",")
+	case nil:
+	default:
+		values[name] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// readProjects decodes the projects section, a list of project settings
+func readProjects(value interface{}) ([]models.ProjectSettings, error) {
+	// Project settings are read by their JSON names, as in the API
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var projects []models.ProjectSettings
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+)
+
+// tunables are the settings a reload changes without a restart; the others
+// keep the value they had at startup
+var tunables = []struct {
+	name string
+	get  func(*Config) interface{}
+}{
+	{"LOG_LEVEL", func(c *Config) interface{} { return c.LogLevel }},
+	{"MAX_PARALLEL_JOBS", func(c *Config) interface{} { return c.Queue.MaxParallelJobs }},
+	{"SOURCE_MAX_ACTIVE", func(c *Config) interface{} { return c.Queue.SourceMaxActive }},
+	{"WORKTREE_MAX_ACTIVE", func(c *Config) interface{} { return c.Worktree.MaxActive }},
+	{"WORKTREE_MAX_AGE", func(c *Config) interface{} { return c.Worktree.MaxAge }},
+	{"WORKTREE_CLEANUP_INTERVAL", func(c *Config) interface{} { return c.Worktree.CleanupInterval }},
+	{"RESULT_DESTINATIONS", func(c *Config) interface{} { return c.Delivery.ProjectDestinations }},
+	{"projects", func(c *Config) interface{} { return c.Projects }},
+	// Credentials rotate, in a secrets backend or otherwise
+	{"DATABASE_URL", func(c *Config) interface{} { return c.Database.URL }},
+	{"GITHUB_PRIVATE_KEY", func(c *Config) interface{} { return [2]string{c.GitHub.PrivateKey, c.GitHub.PrivateKeyPath} }},
+	{"GITHUB_WEBHOOK_SECRET", func(c *Config) interface{} { return c.GitHub.WebhookSecret }},
+	{"GITHUB_CALLBACK_SIGNING_KEY", func(c *Config) interface{} { return c.GitHub.CallbackSigningKey }},
+	{"GITLAB_WEBHOOK_SECRET", func(c *Config) interface{} { return c.GitLab.WebhookSecret }},
+	{"BITBUCKET_WEBHOOK_SECRET", func(c *Config) interface{} { return c.Bitbucket.WebhookSecret }},
+	{"JIRA_API_TOKEN", func(c *Config) interface{} { return c.Jira.APIToken }},
+	{"LINEAR_API_KEY", func(c *Config) interface{} { return c.Linear.APIKey }},
+}
+
+// Reloader loads the configuration again on demand and hands it to the
+// components that apply its runtime-tunable settings
+type Reloader struct {
+	mu       sync.Mutex
+	load     func() (*Config, error)
+	current  *Config
+	appliers []func(*Config)
+}
+
+// NewReloader creates a reloader of the configuration current was loaded
+// as, reading it again with load
+func NewReloader(current *Config, load func() (*Config, error)) *Reloader {
+	return &Reloader{load: load, current: current}
+}
+
+// Current returns the configuration last loaded
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnReload registers what applies a reloaded configuration. Appliers are
+// registered before the first reload and run in order.
+func (r *Reloader) OnReload(apply func(*Config)) {
+	r.appliers = append(r.appliers, apply)
+}
+
+// Reload loads the configuration and applies it, returning the names of
+// the tunable settings that changed. A configuration that fails to load or
+// validate is not applied at all.
+func (r *Reloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, t := range tunables {
+		if !reflect.DeepEqual(t.get(r.current), t.get(cfg)) {
+			changed = append(changed, t.name)
+		}
+	}
+	for _, apply := range r.appliers {
+		apply(cfg)
+	}
+	r.current = cfg
+	return changed, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/secrets"
+)
+
+// Credentials may be kept in a secrets backend instead of the environment,
+// their setting naming the secret, as in
+// GITHUB_WEBHOOK_SECRET=vault:secret/data/autobuild#webhook_secret or
+// DATABASE_URL=awssm:autobuild/db#url.
+
+// resolver is kept across loads so reloads reuse its cache. It is only
+// used under loadMu.
+var resolver *secrets.Resolver
+
+// loadSecrets reads where secrets are fetched from and how long they are kept
+func loadSecrets() SecretsConfig {
+	return SecretsConfig{
+		VaultAddr:       getEnv("VAULT_ADDR", ""),
+		VaultToken:      getEnv("VAULT_TOKEN", ""),
+		VaultNamespace:  getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:       getEnv("SECRETS_AWS_REGION", getEnv("AWS_REGION", "us-east-1")),
+		AWSEndpoint:     getEnv("SECRETS_AWS_ENDPOINT", ""),
+		CacheTTL:        getEnvDuration("SECRETS_CACHE_TTL", 5*time.Minute),
+		RefreshInterval: getEnvDuration("SECRETS_REFRESH_INTERVAL", 0),
+	}
+}
+
+// secretSettings returns the settings that may name a secret
+func (c *Config) secretSettings() []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{"DATABASE_URL", &c.Database.URL},
+		{"GITHUB_PRIVATE_KEY", &c.GitHub.PrivateKey},
+		{"GITHUB_WEBHOOK_SECRET", &c.GitHub.WebhookSecret},
+		{"GITHUB_CALLBACK_SIGNING_KEY", &c.GitHub.CallbackSigningKey},
+		{"GITLAB_WEBHOOK_SECRET", &c.GitLab.WebhookSecret},
+		{"BITBUCKET_WEBHOOK_SECRET", &c.Bitbucket.WebhookSecret},
+		{"JIRA_API_TOKEN", &c.Jira.APIToken},
+		{"LINEAR_API_KEY", &c.Linear.APIKey},
+	}
+}
+
+// resolveSecrets replaces the settings that name a secret with the secret
+func (c *Config) resolveSecrets() error {
+	r := secretsResolver(c.Secrets)
+	for _, setting := range c.secretSettings() {
+		if !secrets.IsReference(*setting.value) {
+			continue
+		}
+		value, err := r.Resolve(*setting.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", setting.name, err)
+		}
+		*setting.value = value
+		c.Secrets.Referenced = append(c.Secrets.Referenced, setting.name)
+	}
+	return nil
+}
+
+// ResolveSecret returns the setting key from the environment, read from the
+// secrets backend when it names a secret, for commands that need it without
+// the rest of the configuration
+func ResolveSecret(key string) (string, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	value, err := secretsResolver(loadSecrets()).Resolve(lookupEnv(key))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return value, nil
+}
+
+// secretsResolver returns the resolver for the backends cfg configures,
+// replacing the current one when they changed. The caller must hold loadMu.
+func secretsResolver(cfg SecretsConfig) *secrets.Resolver {
+	opts := secrets.Options{
+		VaultAddr:          cfg.VaultAddr,
+		VaultToken:         cfg.VaultToken,
+		VaultNamespace:     cfg.VaultNamespace,
+		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		AWSRegion:          cfg.AWSRegion,
+		AWSEndpoint:        cfg.AWSEndpoint,
+		CacheTTL:           cfg.CacheTTL,
+	}
+	if resolver == nil || resolver.Options() != opts {
+		resolver = secrets.NewResolver(opts)
+	}
+	return resolver
+}
@@ -0,0 +1,186 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Message is a job result on its way to a destination
+type Message struct {
+	ID    string
+	Event string
+	Body  []byte
+	// Signature is the HMAC of Body under the job's callback secret, if any
+	Signature string
+}
+
+// adapter sends messages to one kind of destination
+type adapter interface {
+	Send(ctx context.Context, dest *url.URL, msg *Message) error
+}
+
+// Deliverer sends job results to submitters' destinations, retrying
+// transient failures with exponential backoff
+type Deliverer struct {
+	cfg      config.DeliveryConfig
+	adapters map[string]adapter // URL scheme -> adapter
+
+	// destMu guards the project destinations, which reloads replace
+	destMu sync.RWMutex
+}
+
+// NewDeliverer creates a new result deliverer
+func NewDeliverer(cfg config.DeliveryConfig) *Deliverer {
+	httpAdapter := newHTTPAdapter(cfg)
+	return &Deliverer{
+		cfg: cfg,
+		adapters: map[string]adapter{
+			"http":   httpAdapter,
+			"https":  httpAdapter,
+			"sqs":    newSQSAdapter(cfg),
+			"pubsub": newPubSubAdapter(cfg),
+			"nats":   newNATSAdapter(cfg),
+		},
+	}
+}
+
+// Destination returns where results for a job go: the job's own callback
+// URL, or else its project's configured destination
+func (d *Deliverer) Destination(projectID, callbackURL string) string {
+	if callbackURL != "" {
+		return callbackURL
+	}
+	d.destMu.RLock()
+	defer d.destMu.RUnlock()
+	return d.cfg.ProjectDestinations[projectID]
+}
+
+// SetProjectDestinations replaces where each project's results go when
+// their jobs have no callback URL
+func (d *Deliverer) SetProjectDestinations(destinations map[string]string) {
+	d.destMu.Lock()
+	defer d.destMu.Unlock()
+	d.cfg.ProjectDestinations = destinations
+}
+
+// Validate checks that a destination is a URL this deliverer can send to
+func (d *Deliverer) Validate(dest string) error {
+	_, _, err := d.resolve(dest)
+	return err
+}
+
+// ValidateCallback checks that a job may have its results sent to dest.
+// Queue and topic destinations are published to with the orchestrator's
+// own credentials, so a job may only name those the operator allows; the
+// rest are for projects' configured destinations.
+func (d *Deliverer) ValidateCallback(dest string) error {
+	_, u, err := d.resolve(dest)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "http" || u.Scheme == "https" || slices.Contains(d.cfg.CallbackAllowedDestinations, dest) {
+		return nil
+	}
+	return fmt.Errorf("%s destinations must be configured for the project or listed in CALLBACK_ALLOWED_DESTINATIONS", u.Scheme)
+}
+
+func (d *Deliverer) resolve(dest string) (adapter, *url.URL, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	a, ok := d.adapters[u.Scheme]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported destination scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, nil, fmt.Errorf("destination %q has no host", dest)
+	}
+	return a, u, nil
+}
+
+// Deliver sends payload to dest until it is accepted, a permanent error
+// occurs, or attempts run out. It returns the number of attempts made.
+func (d *Deliverer) Deliver(ctx context.Context, dest, secret, event string, payload interface{}) (int, error) {
+	a, u, err := d.resolve(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	msg := &Message{ID: uuid.New().String(), Event: event, Body: body}
+	if secret != "" {
+		msg.Signature = Sign(secret, body)
+	}
+
+	backoff := d.cfg.InitialBackoff
+
+	var lastErr error
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+		err := a.Send(sendCtx, u, msg)
+		cancel()
+		if err == nil {
+			return attempt, nil
+		}
+		lastErr = err
+
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt == d.cfg.MaxAttempts {
+			return attempt, lastErr
+		}
+
+		log.Warn().
+			Err(err).
+			Str("delivery_id", msg.ID).
+			Str("scheme", u.Scheme).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("Result delivery failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > d.cfg.MaxBackoff {
+			backoff = d.cfg.MaxBackoff
+		}
+	}
+
+	return d.cfg.MaxAttempts, lastErr
+}
+
+// permanentError marks a failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryableStatus reports whether an HTTP status from a destination is worth
+// retrying: server errors, timeouts and rate limits
+func retryableStatus(code int) bool {
+	return code >= 500 || code == 408 || code == 429
+}
@@ -0,0 +1,70 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+// Headers sent with every HTTP delivery. Queue destinations carry the same
+// values as message attributes.
+const (
+	HeaderSignature = "X-AutoBuild-Signature-256"
+	HeaderDelivery  = "X-AutoBuild-Delivery"
+	HeaderEvent     = "X-AutoBuild-Event"
+)
+
+// httpAdapter POSTs results to webhook URLs
+type httpAdapter struct {
+	client *http.Client
+}
+
+func newHTTPAdapter(cfg config.DeliveryConfig) *httpAdapter {
+	return &httpAdapter{client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (a *httpAdapter) Send(ctx context.Context, dest *url.URL, msg *Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dest.String(), bytes.NewReader(msg.Body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, msg.ID)
+	req.Header.Set(HeaderEvent, msg.Event)
+	if msg.Signature != "" {
+		req.Header.Set(HeaderSignature, msg.Signature)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("callback returned status %d", resp.StatusCode)
+	if !retryableStatus(resp.StatusCode) {
+		return permanent(err)
+	}
+	return err
+}
+
+// Sign returns the signature header value for a payload, in the same
+// "sha256=<hex hmac>" form GitHub uses for webhooks
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+const natsDefaultPort = "4222"
+
+// natsAdapter publishes results to a NATS subject, addressed as
+// nats://[user:pass@|token@]host[:port]/<subject>. Each delivery opens a
+// short-lived connection and waits for the server to acknowledge it.
+type natsAdapter struct {
+	cfg config.DeliveryConfig
+}
+
+func newNATSAdapter(cfg config.DeliveryConfig) *natsAdapter {
+	return &natsAdapter{cfg: cfg}
+}
+
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+func (a *natsAdapter) Send(ctx context.Context, dest *url.URL, msg *Message) error {
+	subject := strings.Trim(dest.Path, "/")
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n/") {
+		return permanent(fmt.Errorf("nats destination must be nats://host[:port]/<subject>"))
+	}
+
+	host := dest.Host
+	if dest.Port() == "" {
+		host = net.JoinHostPort(dest.Hostname(), natsDefaultPort)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(a.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// The server opens with INFO describing what it requires
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected nats greeting: %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		return fmt.Errorf("invalid nats info: %w", err)
+	}
+	if !info.Headers {
+		return permanent(fmt.Errorf("nats server does not support message headers"))
+	}
+	if info.MaxPayload > 0 && len(msg.Body) > info.MaxPayload {
+		return permanent(fmt.Errorf("result of %d bytes exceeds nats max payload of %d", len(msg.Body), info.MaxPayload))
+	}
+
+	if info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: dest.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"headers":  true,
+		"name":     "autobuild-orchestrator",
+		"lang":     "go",
+	}
+	if user := dest.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			connect["user"] = user.Username()
+			connect["pass"] = pass
+		} else {
+			connect["auth_token"] = user.Username()
+		}
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		return permanent(err)
+	}
+
+	var headers strings.Builder
+	headers.WriteString("NATS/1.0\r\n")
+	headers.WriteString(HeaderEvent + ": " + msg.Event + "\r\n")
+	headers.WriteString(HeaderDelivery + ": " + msg.ID + "\r\n")
+	if msg.Signature != "" {
+		headers.WriteString(HeaderSignature + ": " + msg.Signature + "\r\n")
+	}
+	headers.WriteString("\r\n")
+
+	// PING after the publish so the PONG confirms the server processed it
+	var out strings.Builder
+	fmt.Fprintf(&out, "CONNECT %s\r\n", connectJSON)
+	fmt.Fprintf(&out, "HPUB %s %d %d\r\n", subject, headers.Len(), headers.Len()+len(msg.Body))
+	out.WriteString(headers.String())
+	out.Write(msg.Body)
+	out.WriteString("\r\nPING\r\n")
+
+	if _, err := conn.Write([]byte(out.String())); err != nil {
+		return err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			err := fmt.Errorf("nats error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+			if strings.Contains(strings.ToLower(line), "authorization") || strings.Contains(strings.ToLower(line), "permissions") {
+				return permanent(err)
+			}
+			return err
+		}
+	}
+}
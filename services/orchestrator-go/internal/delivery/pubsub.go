@@ -0,0 +1,230 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+const (
+	pubsubBaseURL = "https://pubsub.googleapis.com/v1"
+	pubsubScope   = "https://www.googleapis.com/auth/pubsub"
+)
+
+// pubsubAdapter publishes results to a Google Cloud Pub/Sub topic, addressed
+// as pubsub://<project>/<topic>, authenticating as a service account
+type pubsubAdapter struct {
+	cfg    config.DeliveryConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	account     *serviceAccount
+	token       string
+	tokenExpiry time.Time
+}
+
+// serviceAccount is the subset of a service account key file used to mint tokens
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	key         *rsa.PrivateKey
+}
+
+func newPubSubAdapter(cfg config.DeliveryConfig) *pubsubAdapter {
+	return &pubsubAdapter{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (a *pubsubAdapter) Send(ctx context.Context, dest *url.URL, msg *Message) error {
+	project, topic := dest.Host, strings.Trim(dest.Path, "/")
+	if topic == "" || strings.Contains(topic, "/") {
+		return permanent(fmt.Errorf("pubsub destination must be pubsub://<project>/<topic>"))
+	}
+
+	token, err := a.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]string{
+		HeaderEvent:    msg.Event,
+		HeaderDelivery: msg.ID,
+	}
+	if msg.Signature != "" {
+		attrs[HeaderSignature] = msg.Signature
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"messages": []map[string]interface{}{{
+			"data":       base64.StdEncoding.EncodeToString(msg.Body),
+			"attributes": attrs,
+		}},
+	})
+	if err != nil {
+		return permanent(err)
+	}
+
+	endpoint := fmt.Sprintf("%s/projects/%s/topics/%s:publish", pubsubBaseURL, url.PathEscape(project), url.PathEscape(topic))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msgBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	err = fmt.Errorf("pubsub returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msgBody))
+	if retryableStatus(resp.StatusCode) {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+		return err
+	}
+	return permanent(err)
+}
+
+// accessToken returns a cached OAuth token, exchanging a freshly signed
+// service account assertion shortly before the current one expires
+func (a *pubsubAdapter) accessToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Until(a.tokenExpiry) > time.Minute {
+		return a.token, nil
+	}
+
+	if a.account == nil {
+		account, err := loadServiceAccount(a.cfg.PubSubCredentialsFile)
+		if err != nil {
+			return "", permanent(err)
+		}
+		a.account = account
+	}
+
+	assertion, err := a.account.assertion(time.Now())
+	if err != nil {
+		return "", permanent(err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("pubsub token exchange returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+
+	a.token = tok.AccessToken
+	a.tokenExpiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return a.token, nil
+}
+
+func loadServiceAccount(path string) (*serviceAccount, error) {
+	if path == "" {
+		return nil, errors.New("pubsub delivery requires PUBSUB_CREDENTIALS_FILE")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pubsub credentials: %w", err)
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid pubsub credentials: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("pubsub credentials contain no PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubsub private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("pubsub private key is not an RSA key")
+	}
+	account.key = rsaKey
+
+	return &account, nil
+}
+
+// assertion builds the RS256-signed JWT exchanged for an access token
+func (s *serviceAccount) assertion(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.ClientEmail,
+		"scope": pubsubScope,
+		"aud":   s.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
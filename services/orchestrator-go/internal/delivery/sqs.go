@@ -0,0 +1,93 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/awsauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+// sqsAdapter sends results to an SQS queue, addressed as
+// sqs://<region>/<account>/<queue>
+type sqsAdapter struct {
+	cfg    config.DeliveryConfig
+	client *http.Client
+}
+
+func newSQSAdapter(cfg config.DeliveryConfig) *sqsAdapter {
+	return &sqsAdapter{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+type sqsAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue"`
+}
+
+func (a *sqsAdapter) Send(ctx context.Context, dest *url.URL, msg *Message) error {
+	if a.cfg.AWSAccessKeyID == "" || a.cfg.AWSSecretAccessKey == "" {
+		return permanent(errors.New("sqs delivery requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"))
+	}
+
+	region := dest.Host
+	queuePath := strings.Trim(dest.Path, "/")
+	if strings.Count(queuePath, "/") != 1 {
+		return permanent(fmt.Errorf("sqs destination must be sqs://<region>/<account>/<queue>"))
+	}
+	endpoint := "sqs." + region + ".amazonaws.com"
+
+	attrs := map[string]sqsAttribute{
+		HeaderEvent:    {DataType: "String", StringValue: msg.Event},
+		HeaderDelivery: {DataType: "String", StringValue: msg.ID},
+	}
+	if msg.Signature != "" {
+		attrs[HeaderSignature] = sqsAttribute{DataType: "String", StringValue: msg.Signature}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"QueueUrl":          "https://" + endpoint + "/" + queuePath,
+		"MessageBody":       string(msg.Body),
+		"MessageAttributes": attrs,
+	})
+	if err != nil {
+		return permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	awsauth.Sign(req, body, awsauth.Credentials{
+		AccessKeyID:     a.cfg.AWSAccessKeyID,
+		SecretAccessKey: a.cfg.AWSSecretAccessKey,
+		SessionToken:    a.cfg.AWSSessionToken,
+	}, region, "sqs", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msgBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	err = fmt.Errorf("sqs returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msgBody))
+	if retryableStatus(resp.StatusCode) || bytes.Contains(msgBody, []byte("Throttl")) {
+		return err
+	}
+	return permanent(err)
+}
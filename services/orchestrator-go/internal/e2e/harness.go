@@ -0,0 +1,314 @@
+// Package e2e runs the orchestrator end to end against a fake GitHub and
+// temporary git repositories: jobs are submitted through the API, dispatched
+// to the fake, which plays the workflow, calls back and opens pull requests,
+// all without GitHub credentials.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/githubfake"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+const (
+	// Repo is the repository every harness creates, with a main branch
+	Repo = "acme/widgets"
+	// adminToken authenticates the harness's API calls
+	adminToken = "e2e-admin-token"
+	// webhookSecret signs the fake's webhooks
+	webhookSecret = "e2e-webhook-secret"
+	// startTimeout bounds how long the orchestrator takes to serve
+	startTimeout = 30 * time.Second
+)
+
+// Options configure a harness
+type Options struct {
+	// Binary is the orchestrator executable to run
+	Binary string
+	// Env adds to or overrides the orchestrator's environment
+	Env []string
+	// Output receives the orchestrator's logs; they are discarded when nil
+	Output io.Writer
+	// KeepDir leaves the harness's temporary directory behind on Close
+	KeepDir bool
+}
+
+// Harness is an orchestrator process wired to a fake GitHub
+type Harness struct {
+	// GitHub is the fake the orchestrator dispatches to
+	GitHub *githubfake.Server
+	// URL is the orchestrator's base URL
+	URL string
+	// Dir holds the repositories, worktrees and key of the harness
+	Dir string
+
+	opts Options
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// Start creates a temporary directory with the fake's repositories and a
+// GitHub App key, starts the fake, then the orchestrator configured to use
+// it, and waits until the orchestrator is healthy
+func Start(ctx context.Context, opts Options) (*Harness, error) {
+	dir, err := os.MkdirTemp("", "autobuild-e2e-")
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{Dir: dir, opts: opts}
+	if err := h.start(ctx); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Harness) start(ctx context.Context) error {
+	gh, err := githubfake.Start(filepath.Join(h.Dir, "git"), webhookSecret)
+	if err != nil {
+		return fmt.Errorf("failed to start fake github: %w", err)
+	}
+	h.GitHub = gh
+	if err := gh.CreateRepo(Repo, "main"); err != nil {
+		return fmt.Errorf("failed to create %s: %w", Repo, err)
+	}
+
+	keyPath := filepath.Join(h.Dir, "app-key.pem")
+	if err := writeAppKey(keyPath); err != nil {
+		return err
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	h.URL = "http://127.0.0.1:" + strconv.Itoa(port)
+	gh.SetWebhookURL(h.URL + "/api/v1/webhooks/github")
+
+	env := append(os.Environ(),
+		"ENV=test",
+		"HOST=127.0.0.1",
+		"PORT="+strconv.Itoa(port),
+		"ADMIN_TOKEN="+adminToken,
+		// Nothing connects to it unless a test enables archiving
+		"DATABASE_URL=postgres://e2e@127.0.0.1:1/e2e",
+		"QUEUE_BACKEND=memory",
+		"EXECUTOR=github_actions",
+		"WORKTREE_BASE_PATH="+filepath.Join(h.Dir, "worktrees"),
+		"WORKTREE_COPY_ON_WRITE=never",
+		"GITHUB_API_URL="+gh.URL(),
+		"GITHUB_URL="+gh.GitURL(),
+		"GITHUB_APP_ID=1",
+		"GITHUB_INSTALLATION_ID=1",
+		"GITHUB_PRIVATE_KEY_PATH="+keyPath,
+		"GITHUB_WEBHOOK_SECRET="+webhookSecret,
+		"GITHUB_CALLBACK_URL="+h.URL+"/api/v1/callback",
+		"GITHUB_CALLBACK_SIGNING_KEY=e2e-callback-signing-key",
+	)
+	env = append(env, h.opts.Env...)
+
+	h.cmd = exec.Command(h.opts.Binary, "serve")
+	// Keep a developer's .env out of the orchestrator's configuration
+	h.cmd.Dir = h.Dir
+	h.cmd.Env = env
+	output := h.opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+	h.cmd.Stdout, h.cmd.Stderr = output, output
+	if err := h.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start orchestrator: %w", err)
+	}
+	h.done = make(chan struct{})
+	go func() {
+		h.cmd.Wait()
+		close(h.done)
+	}()
+
+	return h.waitHealthy(ctx)
+}
+
+// waitHealthy polls the readiness probe until the orchestrator has loaded
+// its queue and can take jobs
+func (h *Harness) waitHealthy(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	for {
+		if err := h.Do(ctx, http.MethodGet, "/readyz", nil, nil); err == nil {
+			return nil
+		}
+		select {
+		case <-h.done:
+			return fmt.Errorf("orchestrator exited during startup: %s", h.cmd.ProcessState)
+		case <-ctx.Done():
+			return fmt.Errorf("orchestrator did not become healthy within %s", startTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Close stops the orchestrator and the fake and removes the temporary
+// directory
+func (h *Harness) Close() {
+	if h.cmd != nil && h.cmd.Process != nil {
+		h.cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-h.done:
+		case <-time.After(10 * time.Second):
+			h.cmd.Process.Kill()
+			<-h.done
+		}
+	}
+	if h.GitHub != nil {
+		h.GitHub.Close()
+	}
+	if !h.opts.KeepDir {
+		os.RemoveAll(h.Dir)
+	}
+}
+
+// StatusError is an API response with an error status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("orchestrator answered %d: %s", e.StatusCode, e.Body)
+}
+
+// Do calls the orchestrator's API as an admin, decoding the JSON response
+// into out. Error statuses return a *StatusError.
+func (h *Harness) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(data))}
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// SubmitJob submits a job for Repo, filling in what req leaves out
+func (h *Harness) SubmitJob(ctx context.Context, req models.CreateJobRequest) (*models.CreateJobResponse, error) {
+	if req.ProjectID == "" {
+		req.ProjectID = "widgets"
+	}
+	if req.RepoFullName == "" {
+		req.RepoFullName = Repo
+	}
+	if req.BaseBranch == "" {
+		req.BaseBranch = "main"
+	}
+	if req.TicketTitle == "" {
+		req.TicketTitle = "Ticket " + req.TicketID
+	}
+	if req.Prompt == "" {
+		req.Prompt = "Implement " + req.TicketTitle
+	}
+	var resp models.CreateJobResponse
+	if err := h.Do(ctx, http.MethodPost, "/api/v1/jobs", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Job returns a job
+func (h *Harness) Job(ctx context.Context, jobID string) (*models.Job, error) {
+	var job models.Job
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/jobs/"+jobID, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitForJob polls a job until done reports true for it, returning the job
+// as last seen when ctx ends first
+func (h *Harness) WaitForJob(ctx context.Context, jobID string, done func(*models.Job) bool) (*models.Job, error) {
+	for {
+		job, err := h.Job(ctx, jobID)
+		if err == nil && done(job) {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			if job != nil {
+				return job, fmt.Errorf("job %s still %s: %w", jobID, job.Status, ctx.Err())
+			}
+			return nil, fmt.Errorf("job %s: %w", jobID, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Worktrees lists the orchestrator's worktrees
+func (h *Harness) Worktrees(ctx context.Context) ([]models.Worktree, error) {
+	var resp struct {
+		Worktrees []models.Worktree `json:"worktrees"`
+	}
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/worktrees", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Worktrees, nil
+}
+
+// writeAppKey writes a fresh GitHub App private key; the fake accepts any
+func writeAppKey(path string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// freePort returns a local port nothing listens on
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,579 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/githubfake"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// jobTimeout bounds how long a scenario waits for a job to finish
+const jobTimeout = 30 * time.Second
+
+// Scenario is an end-to-end test run against a harness of its own
+type Scenario struct {
+	Name string
+	// Env adds to the orchestrator's environment
+	Env []string
+	Run func(ctx context.Context, h *Harness) error
+}
+
+// Scenarios are the end-to-end tests, run in order
+var Scenarios = []Scenario{
+	{Name: "pull-request", Run: pullRequest},
+	{Name: "no-changes", Run: noChanges},
+	{Name: "failure", Run: failure},
+	{Name: "retry", Run: retry},
+	{Name: "requeue", Env: []string{"RETRY_ATTEMPTS=0"}, Run: requeue},
+	{Name: "cancel", Run: cancel},
+	{Name: "forged-callback", Run: forgedCallback},
+	{Name: "ticket-conflict", Run: ticketConflict},
+	{Name: "dedup-reuse", Env: []string{"DEDUP_MODE=reuse"}, Run: dedupReuse},
+	{Name: "preemption", Env: []string{"QUEUE_PREEMPTION=true"}, Run: preemption},
+	{Name: "other-workflow", Run: otherWorkflow},
+	{Name: "dedup-link", Env: []string{"DEDUP_MODE=link"}, Run: dedupLink},
+}
+
+// pullRequest submits a ticket and follows it through dispatch, the run's
+// callback and its pull request, until the merged pull request's worktree
+// is cleaned up
+func pullRequest(ctx context.Context, h *Harness) error {
+	// The health check reaches the fake GitHub and the worktree disk
+	var health models.HealthResponse
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/health", nil, &health); err != nil {
+		return err
+	}
+	checked := map[string]bool{}
+	for _, check := range health.Checks {
+		if check.Status != models.HealthCheckOK {
+			return fmt.Errorf("health check %s is %s: %s", check.Name, check.Status, check.Error)
+		}
+		checked[check.Name] = true
+	}
+	if health.Status != "healthy" || !checked["github"] || !checked["worktrees"] {
+		return fmt.Errorf("health is %s with checks %v, want healthy with github and worktrees", health.Status, health.Checks)
+	}
+	if err := h.Do(ctx, http.MethodGet, "/livez", nil, nil); err != nil {
+		return fmt.Errorf("liveness probe failed: %w", err)
+	}
+
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-1", TicketTitle: "Add a widget"})
+	if err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, submitted.Job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusCompleted {
+		return fmt.Errorf("job %s, want completed: %s", job.Status, job.ErrorMessage)
+	}
+
+	dispatches := h.GitHub.Dispatches()
+	if len(dispatches) != 1 {
+		return fmt.Errorf("%d dispatches, want 1", len(dispatches))
+	}
+	if d := dispatches[0]; d.Field("job_id") != job.ID || d.Field("branch_name") != job.BranchName {
+		return fmt.Errorf("dispatch for job %s on %s, want job %s on %s", d.Field("job_id"), d.Field("branch_name"), job.ID, job.BranchName)
+	}
+
+	prs := h.GitHub.PullRequests(Repo)
+	if len(prs) != 1 {
+		return fmt.Errorf("%d pull requests, want 1", len(prs))
+	}
+	pr := prs[0]
+	if pr.Head.Ref != job.BranchName || pr.Base.Ref != "main" {
+		return fmt.Errorf("pull request from %s into %s, want %s into main", pr.Head.Ref, pr.Base.Ref, job.BranchName)
+	}
+	if job.Result == nil || job.Result.PRUrl != pr.HTMLURL || job.Result.PRNumber != pr.Number {
+		return fmt.Errorf("job result %+v does not name pull request %s", job.Result, pr.HTMLURL)
+	}
+	if job.PRNumber != pr.Number || job.PRState != models.PRStateOpen {
+		return fmt.Errorf("job tracks pull request %d as %q, want %d open", job.PRNumber, job.PRState, pr.Number)
+	}
+
+	// Dashboards count the job as finished and dispatched
+	var stats models.JobStats
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/stats?range=1h&bucket=1m", nil, &stats); err != nil {
+		return err
+	}
+	var finished, dispatched int
+	for _, b := range stats.Buckets {
+		finished += b.Completed
+		dispatched += b.Dispatched
+	}
+	if finished != 1 || dispatched != 1 {
+		return fmt.Errorf("stats count %d completed and %d dispatched jobs, want 1 of each", finished, dispatched)
+	}
+
+	// The job's worktree waits on the pull request, then goes once merged
+	wt, err := waitWorktree(ctx, h, job.WorktreeID, func(wt *models.Worktree) bool {
+		return wt != nil && wt.Status == models.WorktreeStatusMerging
+	})
+	if err != nil {
+		return err
+	}
+	if wt.PRNumber != pr.Number {
+		return fmt.Errorf("worktree waits on pull request %d, want %d", wt.PRNumber, pr.Number)
+	}
+	if err := h.GitHub.ClosePullRequest(ctx, Repo, pr.Number, true); err != nil {
+		return err
+	}
+	if _, err := waitWorktree(ctx, h, job.WorktreeID, func(wt *models.Worktree) bool {
+		return wt != nil && wt.Status == models.WorktreeStatusCleanup
+	}); err != nil {
+		return err
+	}
+
+	// The job records its pull request as merged
+	var merged models.Job
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/jobs/"+job.ID, nil, &merged); err != nil {
+		return err
+	}
+	if merged.PRState != models.PRStateMerged || merged.PRResolvedAt == nil {
+		return fmt.Errorf("job's pull request is %q, want merged", merged.PRState)
+	}
+	return nil
+}
+
+// noChanges finishes a job whose run changed nothing without a pull
+// request
+func noChanges(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.NoChanges)
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-2"})
+	if err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, submitted.Job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Result == nil || job.Result.Status != "no_changes" {
+		return fmt.Errorf("job result %+v, want no_changes", job.Result)
+	}
+	if prs := h.GitHub.PullRequests(Repo); len(prs) != 0 {
+		return fmt.Errorf("%d pull requests, want none", len(prs))
+	}
+	return nil
+}
+
+// failure fails a job whose run fails, keeping the run's error for search
+func failure(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Fail("tests failed"))
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-3"})
+	if err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, submitted.Job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusFailed || job.ErrorMessage != "tests failed" {
+		return fmt.Errorf("job %s with error %q, want failed with %q", job.Status, job.ErrorMessage, "tests failed")
+	}
+
+	// The failure is found by its error
+	var found struct {
+		Jobs []models.Job `json:"jobs"`
+	}
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/jobs/search?q=Tests+FAILED&status=failed", nil, &found); err != nil {
+		return err
+	}
+	if len(found.Jobs) != 1 || found.Jobs[0].ID != job.ID {
+		return fmt.Errorf("search for the error found %d jobs, want job %s", len(found.Jobs), job.ID)
+	}
+	return nil
+}
+
+// retry fails a job's first run and completes it on the automatic retry,
+// which checks its branch out again in a new worktree
+func retry(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Flaky(1, "flaky test", githubfake.Implement))
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-15"})
+	if err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, submitted.Job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusCompleted || job.Result == nil || job.Result.PRUrl == "" {
+		return fmt.Errorf("job %s, want completed with a pull request: %s", job.Status, job.ErrorMessage)
+	}
+	if job.RetryCount != 1 || len(job.Attempts) != 2 || job.Attempts[0].Error != "flaky test" {
+		return fmt.Errorf("job took %d retries and %d attempts, want the failed attempt and one retry", job.RetryCount, len(job.Attempts))
+	}
+	if dispatches := h.GitHub.Dispatches(); len(dispatches) != 2 {
+		return fmt.Errorf("%d dispatches, want 2", len(dispatches))
+	}
+	return nil
+}
+
+// requeue queues copies of a failed job and of a cancelled one, whose
+// worktree is still on disk, in a fresh worktree. Both copies check out
+// their original's branch and complete.
+func requeue(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Flaky(1, "flaky test", githubfake.Hang))
+	failed, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-16"})
+	if err != nil {
+		return err
+	}
+	if job, err := waitFinished(ctx, h, failed.Job.ID); err != nil {
+		return err
+	} else if job.Status != models.JobStatusFailed {
+		return fmt.Errorf("job %s, want failed", job.Status)
+	}
+
+	// The next run hangs until it is cancelled
+	cancelled, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-17"})
+	if err != nil {
+		return err
+	}
+	waitCtx, done := context.WithTimeout(ctx, jobTimeout)
+	defer done()
+	if _, err := h.WaitForJob(waitCtx, cancelled.Job.ID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusRunning
+	}); err != nil {
+		return err
+	}
+	if err := h.Do(ctx, http.MethodDelete, "/api/v1/jobs/"+cancelled.Job.ID, nil, nil); err != nil {
+		return err
+	}
+
+	h.GitHub.SetWorkflow(githubfake.Implement)
+	for _, r := range []struct {
+		job *models.Job
+		req models.RequeueJobRequest
+	}{
+		{failed.Job, models.RequeueJobRequest{}},
+		{cancelled.Job, models.RequeueJobRequest{ResetWorktree: true}},
+	} {
+		var copied models.CreateJobResponse
+		if err := h.Do(ctx, http.MethodPost, "/api/v1/jobs/"+r.job.ID+"/retry", r.req, &copied); err != nil {
+			return err
+		}
+		job, err := waitFinished(ctx, h, copied.Job.ID)
+		if err != nil {
+			return err
+		}
+		if job.Status != models.JobStatusCompleted || job.BranchName != r.job.BranchName {
+			return fmt.Errorf("copy of %s is %s on %s, want completed on %s: %s", r.job.ID, job.Status, job.BranchName, r.job.BranchName, job.ErrorMessage)
+		}
+	}
+	return nil
+}
+
+// cancel cancels a job whose run never reports back
+func cancel(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Hang)
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-4"})
+	if err != nil {
+		return err
+	}
+	jobID := submitted.Job.ID
+	waitCtx, done := context.WithTimeout(ctx, jobTimeout)
+	defer done()
+	if _, err := h.WaitForJob(waitCtx, jobID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusDispatched || j.Status == models.JobStatusRunning
+	}); err != nil {
+		return err
+	}
+
+	if err := h.Do(ctx, http.MethodDelete, "/api/v1/jobs/"+jobID, nil, nil); err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusCancelled {
+		return fmt.Errorf("job %s, want cancelled", job.Status)
+	}
+	return nil
+}
+
+// forgedCallback rejects a callback whose token was not issued for the job
+func forgedCallback(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Hang)
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-5"})
+	if err != nil {
+		return err
+	}
+	jobID := submitted.Job.ID
+	waitCtx, done := context.WithTimeout(ctx, jobTimeout)
+	defer done()
+	if _, err := h.WaitForJob(waitCtx, jobID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusDispatched || j.Status == models.JobStatusRunning
+	}); err != nil {
+		return err
+	}
+
+	// The admin token the harness sends is no callback token
+	err = h.Do(ctx, http.MethodPost, "/api/v1/callback", models.JobResult{JobID: jobID, Status: "success"}, nil)
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("forged callback answered %v, want 401", err)
+	}
+	job, err := h.Job(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status.IsTerminal() {
+		return fmt.Errorf("forged callback finished the job as %s", job.Status)
+	}
+	return nil
+}
+
+// ticketConflict refuses a second job for a ticket whose first is still
+// running, unless forced
+func ticketConflict(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Hang)
+	first, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-6"})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-6"})
+	statusErr, ok := err.(*StatusError)
+	if !ok || statusErr.StatusCode != http.StatusConflict {
+		return fmt.Errorf("second submission answered %v, want 409", err)
+	}
+	var conflict models.ErrorResponse
+	if err := json.Unmarshal([]byte(statusErr.Body), &conflict); err != nil {
+		return fmt.Errorf("invalid conflict response %s: %w", statusErr.Body, err)
+	}
+	if conflict.Code != models.ErrorCodeTicketActive || conflict.RequestID == "" {
+		return fmt.Errorf("conflict %s has code %q and request id %q, want %s and an id", statusErr.Body, conflict.Code, conflict.RequestID, models.ErrorCodeTicketActive)
+	}
+	if !strings.Contains(statusErr.Body, first.Job.ID) {
+		return fmt.Errorf("conflict %s does not name job %s", statusErr.Body, first.Job.ID)
+	}
+
+	forced, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-6", Force: true})
+	if err != nil {
+		return err
+	}
+	if forced.Job.ID == first.Job.ID {
+		return fmt.Errorf("forced submission returned job %s again", first.Job.ID)
+	}
+	return nil
+}
+
+// dedupReuse returns the earlier job for a near-identical prompt of
+// another ticket instead of dispatching a second run
+func dedupReuse(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Hang)
+	first, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-7", Prompt: "Add a widget."})
+	if err != nil {
+		return err
+	}
+	second, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-8", Prompt: "add a  WIDGET"})
+	if err != nil {
+		return err
+	}
+	if !second.Reused || second.Job.ID != first.Job.ID {
+		return fmt.Errorf("duplicate submission returned job %s (reused %t), want job %s reused", second.Job.ID, second.Reused, first.Job.ID)
+	}
+	return nil
+}
+
+// preemption cancels the running job of a full project for a critical one
+// and queues it again
+func preemption(ctx context.Context, h *Harness) error {
+	h.GitHub.SetWorkflow(githubfake.Hang)
+	if err := h.Do(ctx, http.MethodPut, "/api/v1/projects/widgets", models.ProjectSettings{MaxParallel: 1}, nil); err != nil {
+		return err
+	}
+	low := models.PriorityLow
+	victim, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-13", Priority: &low})
+	if err != nil {
+		return err
+	}
+	waitCtx, done := context.WithTimeout(ctx, jobTimeout)
+	defer done()
+	if _, err := h.WaitForJob(waitCtx, victim.Job.ID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusDispatched || j.Status == models.JobStatusRunning
+	}); err != nil {
+		return err
+	}
+
+	critical := models.PriorityCritical
+	urgent, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-14", Priority: &critical})
+	if err != nil {
+		return err
+	}
+	if _, err := h.WaitForJob(waitCtx, urgent.Job.ID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusDispatched || j.Status == models.JobStatusRunning
+	}); err != nil {
+		return err
+	}
+	preempted, err := h.Job(ctx, victim.Job.ID)
+	if err != nil {
+		return err
+	}
+	if preempted.Status != models.JobStatusCancelled {
+		return fmt.Errorf("preempted job is %s, want cancelled", preempted.Status)
+	}
+
+	var list struct {
+		Jobs []models.Job `json:"jobs"`
+	}
+	if err := h.Do(ctx, http.MethodGet, "/api/v1/jobs?project_id=widgets&status=pending", nil, &list); err != nil {
+		return err
+	}
+	if len(list.Jobs) != 1 || list.Jobs[0].RetryOf != victim.Job.ID {
+		return fmt.Errorf("%d pending jobs, want the preempted job's retry", len(list.Jobs))
+	}
+
+	// The retry runs on the preempted job's branch once the critical job
+	// makes room
+	h.GitHub.SetWorkflow(githubfake.Implement)
+	if err := h.Do(ctx, http.MethodDelete, "/api/v1/jobs/"+urgent.Job.ID, nil, nil); err != nil {
+		return err
+	}
+	job, err := waitFinished(ctx, h, list.Jobs[0].ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusCompleted || job.BranchName != victim.Job.BranchName {
+		return fmt.Errorf("retry is %s on %s, want completed on %s: %s", job.Status, job.BranchName, victim.Job.BranchName, job.ErrorMessage)
+	}
+	return nil
+}
+
+// otherWorkflow ignores a failed run of another workflow on a job's branch,
+// such as the repository's own CI, and completes the job with its own run
+func otherWorkflow(ctx context.Context, h *Harness) error {
+	release := make(chan struct{})
+	h.GitHub.SetWorkflow(githubfake.After(release, githubfake.Implement))
+	submitted, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-12"})
+	if err != nil {
+		return err
+	}
+	waitCtx, done := context.WithTimeout(ctx, jobTimeout)
+	defer done()
+	running, err := h.WaitForJob(waitCtx, submitted.Job.ID, func(j *models.Job) bool {
+		return j.Status == models.JobStatusRunning && j.RunID != ""
+	})
+	if err != nil {
+		return err
+	}
+
+	// Well past the IDs the fake hands out
+	ci := githubfake.Run{
+		ID:           9000,
+		DisplayTitle: "CI",
+		HeadBranch:   running.BranchName,
+		Event:        "push",
+		Status:       "completed",
+		Conclusion:   "failure",
+		CreatedAt:    time.Now(),
+	}
+	if err := h.GitHub.SendWebhook(ctx, "workflow_run", map[string]interface{}{
+		"action":       "completed",
+		"workflow_run": ci,
+		"repository":   map[string]string{"full_name": Repo},
+	}); err != nil {
+		return err
+	}
+	job, err := h.Job(ctx, running.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status.IsTerminal() || job.RunID != running.RunID {
+		return fmt.Errorf("another workflow's run left the job %s with run %s, want running with run %s", job.Status, job.RunID, running.RunID)
+	}
+
+	close(release)
+	job, err = waitFinished(ctx, h, running.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.JobStatusCompleted {
+		return fmt.Errorf("job %s, want completed: %s", job.Status, job.ErrorMessage)
+	}
+	return nil
+}
+
+// dedupLink parks near-identical prompts of other tickets until the first
+// job finishes, then completes them with its result. The third submission
+// waits on the second, which waits on the first.
+func dedupLink(ctx context.Context, h *Harness) error {
+	release := make(chan struct{})
+	h.GitHub.SetWorkflow(githubfake.After(release, githubfake.Implement))
+	first, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: "E2E-9", Prompt: "Add a widget."})
+	if err != nil {
+		return err
+	}
+	var jobs []*models.Job
+	waitsOn := first.Job.ID
+	for _, ticketID := range []string{"E2E-10", "E2E-11"} {
+		dup, err := h.SubmitJob(ctx, models.CreateJobRequest{TicketID: ticketID, Prompt: "add a  WIDGET"})
+		if err != nil {
+			return err
+		}
+		if dup.Job.DuplicateOf != waitsOn {
+			return fmt.Errorf("job %s is a duplicate of %q, want %s", dup.Job.ID, dup.Job.DuplicateOf, waitsOn)
+		}
+		jobs = append(jobs, dup.Job)
+		waitsOn = dup.Job.ID
+	}
+	close(release)
+
+	orig, err := waitFinished(ctx, h, first.Job.ID)
+	if err != nil {
+		return err
+	}
+	if orig.Status != models.JobStatusCompleted || orig.Result == nil {
+		return fmt.Errorf("first job %s, want completed: %s", orig.Status, orig.ErrorMessage)
+	}
+	for _, dup := range jobs {
+		job, err := waitFinished(ctx, h, dup.ID)
+		if err != nil {
+			return err
+		}
+		if job.Status != models.JobStatusCompleted || job.Result == nil || job.Result.PRUrl != orig.Result.PRUrl {
+			return fmt.Errorf("duplicate %s is %s with result %+v, want completed with pull request %s", job.ID, job.Status, job.Result, orig.Result.PRUrl)
+		}
+	}
+	if dispatches := h.GitHub.Dispatches(); len(dispatches) != 1 {
+		return fmt.Errorf("%d dispatches, want 1", len(dispatches))
+	}
+	return nil
+}
+
+// waitFinished waits for a job to end
+func waitFinished(ctx context.Context, h *Harness, jobID string) (*models.Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	return h.WaitForJob(ctx, jobID, func(j *models.Job) bool { return j.Status.IsTerminal() })
+}
+
+// waitWorktree polls a worktree, nil once gone, until done reports true
+func waitWorktree(ctx context.Context, h *Harness, id string, done func(*models.Worktree) bool) (*models.Worktree, error) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	for {
+		worktrees, err := h.Worktrees(ctx)
+		if err == nil {
+			var found *models.Worktree
+			for i := range worktrees {
+				if worktrees[i].ID == id {
+					found = &worktrees[i]
+				}
+			}
+			if done(found) {
+				return found, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("worktree %s: %w", id, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package egress restricts where agents running in containers may connect.
+// Docker containers reach the network only through Proxy, which lets each
+// run through to its project's allowed hosts; Kubernetes pods get a
+// NetworkPolicy allowing the addresses those hosts resolve to.
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Validate checks that allowed hosts are hostnames, "*.example.com"
+// wildcards, IP addresses or CIDR blocks
+func Validate(allowed []string) error {
+	for _, entry := range allowed {
+		if _, err := netip.ParsePrefix(entry); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(entry); err == nil {
+			continue
+		}
+		host := strings.TrimPrefix(entry, "*.")
+		if !validHostname(host) {
+			return fmt.Errorf("invalid allowed host %q: must be a hostname, *.domain wildcard, IP address or CIDR block", entry)
+		}
+	}
+	return nil
+}
+
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Allowed reports whether host, a hostname or IP address, matches an entry
+// of allowed. Wildcards match subdomains but not the domain itself.
+func Allowed(allowed []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	addr, addrErr := netip.ParseAddr(strings.Trim(host, "[]"))
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		switch {
+		case addrErr == nil:
+			if prefix, err := netip.ParsePrefix(entry); err == nil && prefix.Contains(addr) {
+				return true
+			}
+			if a, err := netip.ParseAddr(entry); err == nil && a == addr {
+				return true
+			}
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		case entry == host:
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the CIDR blocks allowed hosts cover, resolving hostnames
+// to their current addresses. Wildcards cannot be resolved and are
+// returned as skipped.
+func Resolve(ctx context.Context, allowed []string) (cidrs, skipped []string, err error) {
+	for _, entry := range allowed {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			cidrs = append(cidrs, prefix.Masked().String())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()).String())
+			continue
+		}
+		if strings.HasPrefix(entry, "*.") {
+			skipped = append(skipped, entry)
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve allowed host %s: %w", entry, err)
+		}
+		for _, addr := range addrs {
+			addr = addr.Unmap()
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()).String())
+		}
+	}
+	return cidrs, skipped, nil
+}
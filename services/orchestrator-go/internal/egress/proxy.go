@@ -0,0 +1,189 @@
+package egress
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// dialTimeout bounds connecting to an allowed host
+const dialTimeout = 10 * time.Second
+
+// hopHeaders are meant for the proxy and are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is an HTTP proxy that lets each run through to its allowed hosts
+// only. Runs authenticate with the credentials Grant puts in their proxy
+// URL. It is only a boundary when containers have no other way out, as on
+// an internal Docker network the proxy is also attached to.
+type Proxy struct {
+	url       *url.URL
+	transport http.RoundTripper
+
+	mu     sync.Mutex
+	grants map[string]grant // username -> grant
+}
+
+type grant struct {
+	password string
+	allowed  []string
+}
+
+// NewProxy creates a proxy that containers reach at proxyURL
+func NewProxy(proxyURL string) (*Proxy, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{
+		url: u,
+		transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+			TLSHandshakeTimeout: dialTimeout,
+		},
+		grants: make(map[string]grant),
+	}, nil
+}
+
+// Grant lets a run reach allowed, returning the proxy URL it connects
+// through and a function revoking the grant when the run ends
+func (p *Proxy) Grant(allowed []string) (string, func()) {
+	user, password := randomToken(), randomToken()
+
+	p.mu.Lock()
+	p.grants[user] = grant{password: password, allowed: allowed}
+	p.mu.Unlock()
+
+	u := *p.url
+	u.User = url.UserPassword(user, password)
+	return u.String(), func() {
+		p.mu.Lock()
+		delete(p.grants, user)
+		p.mu.Unlock()
+	}
+}
+
+// ServeHTTP tunnels CONNECT requests and forwards plain HTTP requests to
+// hosts the run's grant allows
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed, ok := p.authenticate(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="autobuild"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	if !Allowed(allowed, host) {
+		log.Warn().Str("host", host).Msg("Blocked agent egress to a host its project does not allow")
+		http.Error(w, "egress to "+host+" is not allowed", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	p.forward(w, r)
+}
+
+// authenticate returns the hosts the request's credentials allow
+func (p *Proxy) authenticate(r *http.Request) ([]string, bool) {
+	user, password, ok := (&http.Request{Header: http.Header{
+		"Authorization": r.Header.Values("Proxy-Authorization"),
+	}}).BasicAuth()
+	if !ok {
+		return nil, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.grants[user]
+	if !ok || g.password != password {
+		return nil, false
+	}
+	return g.allowed, true
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+	go func() {
+		// Bytes the client sent along with the CONNECT request
+		if n := buf.Reader.Buffered(); n > 0 {
+			data, _ := buf.Reader.Peek(n)
+			upstream.Write(data)
+		}
+		io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/bitbucket"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// RunRecorder notes the run an executor started for a job, for executors
+// that learn it when starting the run rather than from its webhooks
+type RunRecorder func(jobID, runID, url string)
+
+// BitbucketPipelines triggers the custom pipeline of the project's
+// repository on Bitbucket. The pipeline reports its result through the
+// callback endpoint, and its progress through commit status webhooks.
+type BitbucketPipelines struct {
+	bitbucket *bitbucket.Client
+	record    RunRecorder
+}
+
+// NewBitbucketPipelines creates an executor triggering Bitbucket pipelines,
+// recording each job's pipeline with record
+func NewBitbucketPipelines(bb *bitbucket.Client, record RunRecorder) *BitbucketPipelines {
+	return &BitbucketPipelines{bitbucket: bb, record: record}
+}
+
+// Name returns bitbucket_pipelines
+func (e *BitbucketPipelines) Name() string {
+	return models.ExecutorBitbucketPipelines
+}
+
+// Dispatch triggers the job's pipeline. Its commit statuses do not name the
+// job, so the pipeline is recorded as the job's run to match them by.
+func (e *BitbucketPipelines) Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error) {
+	if job.RepoFullName == "" {
+		return nil, fmt.Errorf("job has no repository")
+	}
+	pipeline, err := e.bitbucket.TriggerPipeline(ctx, &job)
+	if err != nil {
+		return nil, err
+	}
+	runID := pipeline.RunID()
+	if e.record != nil {
+		e.record(job.ID, runID, bitbucket.PipelineURL(job.RepoFullName, runID))
+	}
+	log.Info().Str("job_id", job.ID).Str("run_id", runID).Msg("Triggered Bitbucket pipeline")
+	return nil, nil
+}
+
+// Cancel stops the job's pipeline. Soft cancels are left to the pipeline,
+// which polls the control endpoint.
+func (e *BitbucketPipelines) Cancel(ctx context.Context, job models.Job, hard bool) error {
+	if !hard || job.RepoFullName == "" || job.RunID == "" || !e.bitbucket.Configured() {
+		return nil
+	}
+
+	if err := e.bitbucket.StopPipeline(ctx, job.RepoFullName, job.RunID); err != nil {
+		return err
+	}
+	log.Info().Str("job_id", job.ID).Str("run_id", job.RunID).Msg("Stopped Bitbucket pipeline")
+	return nil
+}
+
+// Status looks up the job's pipeline
+func (e *BitbucketPipelines) Status(ctx context.Context, job models.Job) (*models.RunStatus, error) {
+	status := &models.RunStatus{JobID: job.ID, Executor: e.Name(), State: models.RunStateUnknown, RunID: job.RunID, URL: job.RunURL}
+	if job.RepoFullName == "" || job.RunID == "" || !e.bitbucket.Configured() {
+		return status, nil
+	}
+
+	pipeline, err := e.bitbucket.GetPipeline(ctx, job.RepoFullName, job.RunID)
+	if err != nil {
+		return nil, err
+	}
+	status.RunID = pipeline.RunID()
+	status.URL = bitbucket.PipelineURL(job.RepoFullName, status.RunID)
+	status.State = bitbucket.RunState(pipeline)
+	if status.State == models.RunStateCompleted {
+		status.Conclusion = pipeline.State.Result.Name
+	}
+	return status, nil
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/egress"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// createNetworkPolicy restricts the egress of a run's pod to DNS, the
+// policy's allowed hosts and the callback host. NetworkPolicies match
+// addresses, so hostnames are resolved now and wildcards cannot be
+// allowed. It returns false when the project does not restrict egress.
+func (e *Kubernetes) createNetworkPolicy(ctx context.Context, job models.Job, policy *models.EgressPolicy) (bool, error) {
+	if policy == nil {
+		return false, nil
+	}
+	hosts := policy.AllowedHosts
+	if u, err := url.Parse(e.callbackURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts[:len(hosts):len(hosts)], u.Hostname())
+	}
+	cidrs, skipped, err := egress.Resolve(ctx, hosts)
+	if err != nil {
+		return false, err
+	}
+	if len(skipped) > 0 {
+		log.Warn().Str("job_id", job.ID).Strs("hosts", skipped).Msg("Kubernetes NetworkPolicies cannot allow wildcard hosts, skipping them")
+	}
+
+	rules := []interface{}{
+		map[string]interface{}{
+			"ports": []interface{}{
+				map[string]interface{}{"protocol": "UDP", "port": 53},
+				map[string]interface{}{"protocol": "TCP", "port": 53},
+			},
+		},
+	}
+	if len(cidrs) > 0 {
+		to := make([]interface{}, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			to = append(to, map[string]interface{}{"ipBlock": map[string]string{"cidr": cidr}})
+		}
+		rules = append(rules, map[string]interface{}{"to": to})
+	}
+	labels := map[string]string{jobIDLabel: strings.ToLower(job.ID)}
+	manifest := map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]interface{}{
+			"name":   jobName(job),
+			"labels": labels,
+		},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{"matchLabels": labels},
+			"policyTypes": []string{"Egress"},
+			"egress":      rules,
+		},
+	}
+	if err := e.do(ctx, http.MethodPost, e.networkPoliciesPath(""), manifest, nil); err != nil {
+		return false, fmt.Errorf("failed to create NetworkPolicy: %w", err)
+	}
+	return true, nil
+}
+
+// adoptNetworkPolicy makes a run's Job own its NetworkPolicy, so the
+// policy is deleted along with the Job
+func (e *Kubernetes) adoptNetworkPolicy(ctx context.Context, job models.Job, jobUID string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []interface{}{
+				map[string]interface{}{
+					"apiVersion":         "batch/v1",
+					"kind":               "Job",
+					"name":               jobName(job),
+					"uid":                jobUID,
+					"blockOwnerDeletion": true,
+				},
+			},
+		},
+	}
+	return e.do(ctx, http.MethodPatch, e.networkPoliciesPath(jobName(job)), patch, nil)
+}
+
+// deleteNetworkPolicy removes a run's NetworkPolicy when its Job could not
+// be created
+func (e *Kubernetes) deleteNetworkPolicy(ctx context.Context, job models.Job) {
+	err := e.do(ctx, http.MethodDelete, e.networkPoliciesPath(jobName(job)), nil, nil)
+	if err != nil && !isNotFound(err) {
+		log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to delete NetworkPolicy")
+	}
+}
+
+func (e *Kubernetes) networkPoliciesPath(name string) string {
+	path := "/apis/networking.k8s.io/v1/namespaces/" + e.namespace + "/networkpolicies"
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
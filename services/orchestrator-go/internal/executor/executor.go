@@ -0,0 +1,35 @@
+// Package executor runs jobs' agents. Each executor starts a run of a job
+// somewhere (a GitHub Actions workflow, GitLab or Bitbucket pipeline, a local
+// subprocess or container, a Kubernetes Job), stops it on request, and
+// reports where it is, so the queue manager does not depend on any one of
+// them.
+package executor
+
+import (
+	"context"
+	"io"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Executor runs the agent for jobs
+type Executor interface {
+	// Name is what projects select the executor by
+	Name() string
+	// Dispatch starts a run of job in wt, which is nil for jobs without a
+	// worktree. Executors that run the agent themselves return its result
+	// once it finishes, writing its output to out; the others return nil
+	// and the run reports back through the callback endpoint or webhooks.
+	Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error)
+	// Cancel stops job's run. A soft cancel asks the agent to finish its
+	// current step so its partial work is still pushed; a hard one stops
+	// it outright.
+	Cancel(ctx context.Context, job models.Job, hard bool) error
+	// Status reports where job's run is
+	Status(ctx context.Context, job models.Job) (*models.RunStatus, error)
+}
+
+// SettingsSource looks up project settings
+type SettingsSource interface {
+	Get(projectID string) (models.ProjectSettings, bool)
+}
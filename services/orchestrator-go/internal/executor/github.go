@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// GitHubActions dispatches the agent workflow with repository_dispatch. The
+// workflow reports its result through the callback endpoint and polls the
+// control endpoint for soft cancels.
+type GitHubActions struct {
+	github   *github.Client
+	projects SettingsSource
+}
+
+// NewGitHubActions creates an executor dispatching workflow runs
+func NewGitHubActions(gh *github.Client, projects SettingsSource) *GitHubActions {
+	return &GitHubActions{github: gh, projects: projects}
+}
+
+// Name returns github_actions
+func (e *GitHubActions) Name() string {
+	return models.ExecutorGitHubActions
+}
+
+// Dispatch sends a repository_dispatch event using the project's payload
+// template
+func (e *GitHubActions) Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error) {
+	if job.RepoFullName == "" {
+		return nil, fmt.Errorf("job has no repository")
+	}
+	settings, _ := e.projects.Get(job.ProjectID)
+	return nil, e.github.DispatchJob(ctx, &job, settings.DispatchTemplate)
+}
+
+// Cancel cancels the job's workflow run. If the run ID has not been
+// reported yet it is looked up from runs created since dispatch; a run that
+// only starts later is cancelled when its webhook arrives. Soft cancels are
+// left to the workflow, which polls the control endpoint.
+func (e *GitHubActions) Cancel(ctx context.Context, job models.Job, hard bool) error {
+	if !hard || job.RepoFullName == "" || !e.github.Configured() {
+		return nil
+	}
+
+	runID := job.RunID
+	if runID == "" {
+		run, err := e.findRun(ctx, job)
+		if err != nil {
+			return fmt.Errorf("failed to look up workflow run: %w", err)
+		}
+		if run == nil {
+			log.Info().Str("job_id", job.ID).Msg("No workflow run yet, will cancel when it starts")
+			return nil
+		}
+		runID = strconv.FormatInt(run.ID, 10)
+	}
+
+	if err := e.github.CancelWorkflowRun(ctx, job.RepoFullName, runID); err != nil {
+		return err
+	}
+	log.Info().Str("job_id", job.ID).Str("run_id", runID).Msg("Cancelled workflow run")
+	return nil
+}
+
+// Status looks up the job's workflow run
+func (e *GitHubActions) Status(ctx context.Context, job models.Job) (*models.RunStatus, error) {
+	status := &models.RunStatus{JobID: job.ID, Executor: e.Name(), State: models.RunStateUnknown, RunID: job.RunID, URL: job.RunURL}
+	if job.RepoFullName == "" || !e.github.Configured() {
+		return status, nil
+	}
+
+	var run *github.WorkflowRun
+	var err error
+	if job.RunID != "" {
+		run, err = e.github.GetWorkflowRun(ctx, job.RepoFullName, job.RunID)
+	} else {
+		run, err = e.findRun(ctx, job)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		// Dispatched, but GitHub has not created the run yet
+		status.State = models.RunStateQueued
+		return status, nil
+	}
+
+	status.RunID = strconv.FormatInt(run.ID, 10)
+	status.URL = run.HTMLURL
+	status.Conclusion = run.Conclusion
+	switch run.Status {
+	case "completed":
+		status.State = models.RunStateCompleted
+	case "in_progress":
+		status.State = models.RunStateRunning
+	default:
+		status.State = models.RunStateQueued
+	}
+	return status, nil
+}
+
+// findRun looks up the run a job's dispatch created
+func (e *GitHubActions) findRun(ctx context.Context, job models.Job) (*github.WorkflowRun, error) {
+	since := time.Now().Add(-time.Hour)
+	if job.DispatchedAt != nil {
+		since = job.DispatchedAt.Add(-time.Minute)
+	}
+	return e.github.FindDispatchedRun(ctx, job.RepoFullName, job.ID, since)
+}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitlab"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// GitLabCI triggers a pipeline of the project's repository on GitLab. The
+// pipeline reports its result through the callback endpoint, and its
+// progress through pipeline webhooks.
+type GitLabCI struct {
+	gitlab *gitlab.Client
+}
+
+// NewGitLabCI creates an executor triggering GitLab pipelines
+func NewGitLabCI(gl *gitlab.Client) *GitLabCI {
+	return &GitLabCI{gitlab: gl}
+}
+
+// Name returns gitlab_ci
+func (e *GitLabCI) Name() string {
+	return models.ExecutorGitLabCI
+}
+
+// Dispatch triggers the job's pipeline
+func (e *GitLabCI) Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error) {
+	if job.RepoFullName == "" {
+		return nil, fmt.Errorf("job has no repository")
+	}
+	pipeline, err := e.gitlab.TriggerPipeline(ctx, &job)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("job_id", job.ID).Int64("pipeline_id", pipeline.ID).Msg("Triggered GitLab pipeline")
+	return nil, nil
+}
+
+// Cancel cancels the job's pipeline. Until its webhook has reported the
+// pipeline ID there is nothing to cancel by; a pipeline reported after its
+// job was cancelled is cancelled then. Soft cancels are left to the
+// pipeline, which polls the control endpoint.
+func (e *GitLabCI) Cancel(ctx context.Context, job models.Job, hard bool) error {
+	if !hard || job.RepoFullName == "" || !e.gitlab.Configured() {
+		return nil
+	}
+	if job.RunID == "" {
+		log.Info().Str("job_id", job.ID).Msg("No pipeline reported yet, will cancel when it starts")
+		return nil
+	}
+
+	if err := e.gitlab.CancelPipeline(ctx, job.RepoFullName, job.RunID); err != nil {
+		return err
+	}
+	log.Info().Str("job_id", job.ID).Str("run_id", job.RunID).Msg("Cancelled GitLab pipeline")
+	return nil
+}
+
+// Status looks up the job's pipeline
+func (e *GitLabCI) Status(ctx context.Context, job models.Job) (*models.RunStatus, error) {
+	status := &models.RunStatus{JobID: job.ID, Executor: e.Name(), State: models.RunStateUnknown, RunID: job.RunID, URL: job.RunURL}
+	if job.RepoFullName == "" || !e.gitlab.Configured() {
+		return status, nil
+	}
+	if job.RunID == "" {
+		// Triggered, but no webhook has reported the pipeline yet
+		status.State = models.RunStateQueued
+		return status, nil
+	}
+
+	pipeline, err := e.gitlab.GetPipeline(ctx, job.RepoFullName, job.RunID)
+	if err != nil {
+		return nil, err
+	}
+	status.RunID = strconv.FormatInt(pipeline.ID, 10)
+	status.URL = pipeline.WebURL
+	status.State = gitlab.RunState(pipeline.Status)
+	if status.State == models.RunStateCompleted {
+		status.Conclusion = pipeline.Status
+	}
+	return status, nil
+}
@@ -0,0 +1,316 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// jobIDLabel labels the Kubernetes Jobs of an orchestrator job
+const jobIDLabel = "autobuild.dev/job-id"
+
+// finishedJobTTL is how long Kubernetes keeps a finished Job and its pod
+const finishedJobTTL = time.Hour
+
+// Kubernetes starts a Kubernetes Job per run. Its image is expected to do
+// what the agent workflow does with the AUTOBUILD_* environment: check out
+// the branch, run the agent, push, open a pull request, and report to
+// $AUTOBUILD_CALLBACK_URL, polling its control endpoint for soft cancels.
+type Kubernetes struct {
+	cfg         config.KubernetesConfig
+	timeout     time.Duration
+	callbackURL string
+	projects    SettingsSource
+	client      *http.Client
+	namespace   string
+}
+
+// NewKubernetes creates an executor starting Jobs through the API server.
+// It fails without a service account token, as outside a cluster.
+func NewKubernetes(cfg config.ExecutorConfig, gh config.GitHubConfig, projects SettingsSource) (*Kubernetes, error) {
+	k := cfg.Kubernetes
+	if _, err := os.Stat(k.TokenFile); err != nil {
+		return nil, fmt.Errorf("no service account token: %w", err)
+	}
+	tlsConfig := &tls.Config{}
+	if ca, err := os.ReadFile(k.CAFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", k.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	namespace := k.Namespace
+	if namespace == "" {
+		namespace = "default"
+		if b, err := os.ReadFile(filepath.Join(filepath.Dir(k.TokenFile), "namespace")); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+
+	return &Kubernetes{
+		cfg:         k,
+		timeout:     cfg.Timeout,
+		callbackURL: gh.CallbackURL,
+		projects:    projects,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		namespace: namespace,
+	}, nil
+}
+
+// Name returns kubernetes
+func (e *Kubernetes) Name() string {
+	return models.ExecutorKubernetes
+}
+
+// Dispatch creates the run's Job. The pod reports its result later.
+func (e *Kubernetes) Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error) {
+	settings, _ := e.projects.Get(job.ProjectID)
+	image := e.cfg.Image
+	if settings.ExecutorImage != "" {
+		image = settings.ExecutorImage
+	}
+	if image == "" {
+		return nil, fmt.Errorf("no image for the kubernetes executor")
+	}
+
+	// The policy exists before the pod so it never runs unrestricted
+	restricted, err := e.createNetworkPolicy(ctx, job, settings.Egress)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := e.manifest(ctx, job, image)
+	var created struct {
+		Metadata struct {
+			UID string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := e.do(ctx, http.MethodPost, e.jobsPath(""), manifest, &created); err != nil {
+		if restricted {
+			e.deleteNetworkPolicy(ctx, job)
+		}
+		return nil, fmt.Errorf("failed to create Kubernetes Job: %w", err)
+	}
+	fmt.Fprintf(out, "created Kubernetes Job %s/%s with image %s\n", e.namespace, jobName(job), image)
+	if restricted {
+		fmt.Fprintf(out, "restricted its egress to %s\n", strings.Join(append([]string{"the callback host"}, settings.Egress.AllowedHosts...), ", "))
+		if err := e.adoptNetworkPolicy(ctx, job, created.Metadata.UID); err != nil {
+			log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to attach NetworkPolicy to its Job, it will outlive the Job")
+		}
+	}
+	return nil, nil
+}
+
+// Cancel deletes the run's Job and its pod. Soft cancels are left to the
+// pod, which polls the control endpoint.
+func (e *Kubernetes) Cancel(ctx context.Context, job models.Job, hard bool) error {
+	if !hard {
+		return nil
+	}
+	err := e.do(ctx, http.MethodDelete, e.jobsPath(jobName(job))+"?propagationPolicy=Background", nil, nil)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	log.Info().Str("job_id", job.ID).Str("k8s_job", jobName(job)).Msg("Deleted Kubernetes Job")
+	return nil
+}
+
+// Status reads the state of the run's Job
+func (e *Kubernetes) Status(ctx context.Context, job models.Job) (*models.RunStatus, error) {
+	name := jobName(job)
+	status := &models.RunStatus{JobID: job.ID, Executor: e.Name(), State: models.RunStateUnknown, RunID: name}
+
+	var k8sJob struct {
+		Status struct {
+			Active    int `json:"active"`
+			Succeeded int `json:"succeeded"`
+			Failed    int `json:"failed"`
+		} `json:"status"`
+	}
+	if err := e.do(ctx, http.MethodGet, e.jobsPath(name), nil, &k8sJob); err != nil {
+		if isNotFound(err) {
+			// Deleted after it finished, or never created
+			return status, nil
+		}
+		return nil, err
+	}
+
+	switch s := k8sJob.Status; {
+	case s.Succeeded > 0:
+		status.State, status.Conclusion = models.RunStateCompleted, "success"
+	case s.Failed > 0:
+		status.State, status.Conclusion = models.RunStateCompleted, "failure"
+	case s.Active > 0:
+		status.State = models.RunStateRunning
+	default:
+		status.State = models.RunStateQueued
+	}
+	return status, nil
+}
+
+// manifest is the batch/v1 Job running the agent for job
+func (e *Kubernetes) manifest(ctx context.Context, job models.Job, image string) map[string]interface{} {
+	var callbackSecret string
+	if job.Credentials != nil {
+		callbackSecret = job.Credentials.CallbackToken
+	}
+	env := []map[string]string{
+		{"name": "AUTOBUILD_JOB_ID", "value": job.ID},
+		{"name": "AUTOBUILD_JOB_KIND", "value": string(job.Kind)},
+		{"name": "AUTOBUILD_TICKET_ID", "value": job.TicketID},
+		{"name": "AUTOBUILD_TICKET_TITLE", "value": job.TicketTitle},
+		{"name": "AUTOBUILD_TICKET_DESCRIPTION", "value": job.TicketDesc},
+		{"name": "AUTOBUILD_PROMPT", "value": job.DispatchPrompt()},
+		{"name": "AUTOBUILD_PROJECT_CONTEXT", "value": job.ProjectContext},
+		{"name": "AUTOBUILD_REPO", "value": job.RepoFullName},
+		{"name": "AUTOBUILD_BRANCH", "value": job.BranchName},
+		{"name": "AUTOBUILD_BASE_BRANCH", "value": job.BaseBranch},
+		{"name": "AUTOBUILD_CALLBACK_URL", "value": e.callbackURL},
+		{"name": "AUTOBUILD_CALLBACK_SECRET", "value": callbackSecret},
+		{"name": "AUTOBUILD_TRACEPARENT", "value": tracing.Inject(ctx)},
+	}
+	if job.Credentials != nil && job.Credentials.RepoToken != "" {
+		env = append(env, map[string]string{"name": "AUTOBUILD_GITHUB_TOKEN", "value": job.Credentials.RepoToken})
+	}
+	container := map[string]interface{}{
+		"name":  "agent",
+		"image": image,
+		"env":   env,
+	}
+	if e.cfg.EnvSecret != "" {
+		container["envFrom"] = []interface{}{
+			map[string]interface{}{"secretRef": map[string]string{"name": e.cfg.EnvSecret}},
+		}
+	}
+	limits := map[string]string{}
+	if e.cfg.CPU != "" {
+		limits["cpu"] = e.cfg.CPU
+	}
+	if e.cfg.Memory != "" {
+		limits["memory"] = e.cfg.Memory
+	}
+	if len(limits) > 0 {
+		container["resources"] = map[string]interface{}{"limits": limits, "requests": limits}
+	}
+
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers":    []interface{}{container},
+	}
+	if e.cfg.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = e.cfg.ServiceAccount
+	}
+	labels := map[string]string{jobIDLabel: strings.ToLower(job.ID)}
+
+	spec := map[string]interface{}{
+		// A failed run is retried by the queue manager, not by Kubernetes
+		"backoffLimit":            0,
+		"ttlSecondsAfterFinished": int(finishedJobTTL.Seconds()),
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": labels},
+			"spec":     podSpec,
+		},
+	}
+	if e.timeout > 0 {
+		spec["activeDeadlineSeconds"] = int(e.timeout.Seconds())
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":   jobName(job),
+			"labels": labels,
+		},
+		"spec": spec,
+	}
+}
+
+// jobName names the Kubernetes Job of a job's current attempt
+func jobName(job models.Job) string {
+	return fmt.Sprintf("autobuild-%s-%d", strings.ToLower(job.ID), job.RetryCount+1)
+}
+
+func (e *Kubernetes) jobsPath(name string) string {
+	path := "/apis/batch/v1/namespaces/" + e.namespace + "/jobs"
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// apiError is a non-2xx response from the API server
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("kubernetes API returned status %d: %s", e.status, e.msg)
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.status == http.StatusNotFound
+}
+
+// do sends an authenticated API request, decoding the JSON response into out
+func (e *Kubernetes) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(e.cfg.APIURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case method == http.MethodPatch:
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	case body != nil:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Projected service account tokens rotate, so it is read per request
+	if token, err := os.ReadFile(e.cfg.TokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &apiError{status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,106 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/localexec"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Local runs agents on this host through a localexec runner, as
+// subprocesses or Docker containers. Dispatch holds until the agent is done.
+type Local struct {
+	runner *localexec.Runner
+
+	mu   sync.Mutex
+	runs map[string]*localRun // jobID -> agent running here
+	// early holds cancels that arrived before their job's run started,
+	// true for hard ones
+	early map[string]bool
+}
+
+// localRun is an agent running on this host
+type localRun struct {
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// requestStop asks the agent to finish its current step
+func (r *localRun) requestStop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// NewLocal creates an executor running agents with runner
+func NewLocal(runner *localexec.Runner) *Local {
+	return &Local{
+		runner: runner,
+		runs:   make(map[string]*localRun),
+		early:  make(map[string]bool),
+	}
+}
+
+// Name returns local or docker, after how the runner runs agents
+func (e *Local) Name() string {
+	return e.runner.Executor()
+}
+
+// Dispatch runs the agent in wt and returns its result
+func (e *Local) Dispatch(ctx context.Context, job models.Job, wt *models.Worktree, out io.Writer) (*models.JobResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &localRun{cancel: cancel, stop: make(chan struct{})}
+
+	e.mu.Lock()
+	e.runs[job.ID] = run
+	hard, early := e.early[job.ID]
+	delete(e.early, job.ID)
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.runs, job.ID)
+		e.mu.Unlock()
+	}()
+
+	switch {
+	case early && hard:
+		cancel()
+	case early || job.StopRequestedAt != nil:
+		run.requestStop()
+	}
+	return e.runner.Run(ctx, job, wt, run.stop, out), nil
+}
+
+// Cancel interrupts the agent, or kills it when hard
+func (e *Local) Cancel(ctx context.Context, job models.Job, hard bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	run, ok := e.runs[job.ID]
+	if !ok {
+		// The run may be about to start
+		e.early[job.ID] = e.early[job.ID] || hard
+		return nil
+	}
+	if hard {
+		run.cancel()
+	} else {
+		run.requestStop()
+	}
+	return nil
+}
+
+// Status reports whether the agent is running on this host
+func (e *Local) Status(ctx context.Context, job models.Job) (*models.RunStatus, error) {
+	e.mu.Lock()
+	_, running := e.runs[job.ID]
+	e.mu.Unlock()
+
+	status := &models.RunStatus{JobID: job.ID, Executor: e.Name(), State: models.RunStateCompleted, RunID: job.RunID}
+	if running {
+		status.State = models.RunStateRunning
+	}
+	return status, nil
+}
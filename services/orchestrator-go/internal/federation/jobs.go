@@ -0,0 +1,117 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Scope limits the projects whose jobs a caller may see. A nil scope
+// allows every project.
+type Scope interface {
+	Allows(projectID string) bool
+}
+
+// Locate finds the downstream holding a job this orchestrator does not
+// remember forwarding, e.g. one forwarded before a restart, by asking each
+// downstream for it. A job only counts when it belongs to a project the
+// downstream owns.
+func (r *Router) Locate(ctx context.Context, jobID string) (*Downstream, string, bool) {
+	for _, ds := range r.downstreams {
+		var job models.Job
+		found, err := ds.get(ctx, "/api/v1/jobs/"+url.PathEscape(jobID), nil, &job)
+		if err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Str("downstream", ds.cfg.Name).Msg("Failed to look up job on downstream")
+			continue
+		}
+		if found && r.byProject[job.ProjectID] == ds {
+			r.remember(jobID, ds, job.ProjectID)
+			return ds, job.ProjectID, true
+		}
+	}
+	return nil, "", false
+}
+
+// Jobs sends a job listing or search to every downstream owning a project
+// within the scope and returns the jobs they answer with, of those
+// projects only. The query is passed on without the fields it selects, so
+// the jobs can be merged with local ones and rendered here. Downstreams
+// that fail are logged and skipped.
+func (r *Router) Jobs(ctx context.Context, path string, query url.Values, scope Scope) []*models.Job {
+	query = maps.Clone(query)
+	query.Del("fields")
+	projectID := query.Get("project_id")
+
+	var jobs []*models.Job
+	for _, ds := range r.downstreams {
+		if !ds.owns(projectID, scope) {
+			continue
+		}
+		var page struct {
+			Jobs []*models.Job `json:"jobs"`
+		}
+		if _, err := ds.get(ctx, path, query, &page); err != nil {
+			log.Warn().Err(err).Str("downstream", ds.cfg.Name).Msg("Failed to list jobs on downstream")
+			continue
+		}
+		for _, job := range page.Jobs {
+			if r.byProject[job.ProjectID] != ds || scope != nil && !scope.Allows(job.ProjectID) {
+				continue
+			}
+			r.remember(job.ID, ds, job.ProjectID)
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// owns reports whether the downstream owns projectID, or when it is empty
+// any project within the scope
+func (d *Downstream) owns(projectID string, scope Scope) bool {
+	for _, id := range d.cfg.ProjectIDs {
+		if (projectID == "" || id == projectID) && (scope == nil || scope.Allows(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// get fetches a downstream API path into out, reporting false when the
+// downstream answers 404
+func (d *Downstream) get(ctx context.Context, path string, query url.Values, out interface{}) (bool, error) {
+	target := d.cfg.URL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false, err
+	}
+	if d.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.cfg.Token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("downstream %s unreachable: %w", d.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("downstream %s answered %d", d.cfg.Name, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("invalid response from downstream %s: %w", d.cfg.Name, err)
+	}
+	return true, nil
+}
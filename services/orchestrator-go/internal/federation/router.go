@@ -0,0 +1,174 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Downstream is an orchestrator that owns a set of projects
+type Downstream struct {
+	cfg    config.DownstreamConfig
+	client *http.Client
+	proxy  *httputil.ReverseProxy
+}
+
+// Name returns the configured downstream name
+func (d *Downstream) Name() string {
+	return d.cfg.Name
+}
+
+// maxForwardedJobs caps the forwarded jobs remembered; forgotten ones are
+// located again by asking the downstreams
+const maxForwardedJobs = 10000
+
+// Router decides which jobs belong to a downstream orchestrator and keeps
+// track of the jobs it has forwarded
+type Router struct {
+	mu          sync.RWMutex
+	downstreams []*Downstream
+	byProject   map[string]*Downstream
+	byJob       map[string]forwardedJob
+}
+
+// forwardedJob records where a job was forwarded and the project it belongs to
+type forwardedJob struct {
+	downstream *Downstream
+	projectID  string
+	seenAt     time.Time
+}
+
+// NewRouter creates a federation router from configuration
+func NewRouter(cfg config.FederationConfig) (*Router, error) {
+	r := &Router{
+		byProject: make(map[string]*Downstream),
+		byJob:     make(map[string]forwardedJob),
+	}
+
+	for _, dsCfg := range cfg.Downstreams {
+		target, err := url.Parse(dsCfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for downstream %s: %w", dsCfg.Name, err)
+		}
+
+		ds := &Downstream{
+			cfg:    dsCfg,
+			client: &http.Client{Timeout: 30 * time.Second},
+		}
+		ds.proxy = &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+				// Callers' credentials are mapped to the downstream's token
+				pr.Out.Header.Del("Authorization")
+				if ds.cfg.Token != "" {
+					pr.Out.Header.Set("Authorization", "Bearer "+ds.cfg.Token)
+				}
+			},
+			// Flush immediately so streamed responses pass straight through
+			FlushInterval: -1,
+		}
+
+		r.downstreams = append(r.downstreams, ds)
+		for _, projectID := range dsCfg.ProjectIDs {
+			r.byProject[projectID] = ds
+		}
+	}
+
+	return r, nil
+}
+
+// ForProject returns the downstream that owns a project, if any
+func (r *Router) ForProject(projectID string) (*Downstream, bool) {
+	ds, ok := r.byProject[projectID]
+	return ds, ok
+}
+
+// ForJob returns the downstream a job was forwarded to and the job's
+// project, if the job was forwarded
+func (r *Router) ForJob(jobID string) (*Downstream, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fj, ok := r.byJob[jobID]
+	return fj.downstream, fj.projectID, ok
+}
+
+// Submit forwards a job to the downstream and remembers where it went
+func (r *Router) Submit(ctx context.Context, ds *Downstream, req *models.CreateJobRequest) (*models.CreateJobResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, ds.cfg.URL+"/api/v1/jobs", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if ds.cfg.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+ds.cfg.Token)
+	}
+
+	resp, err := ds.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("downstream %s unreachable: %w", ds.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("downstream %s rejected job: %d %s", ds.cfg.Name, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var response models.CreateJobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid response from downstream %s: %w", ds.cfg.Name, err)
+	}
+	if response.Job == nil {
+		return nil, fmt.Errorf("downstream %s returned no job", ds.cfg.Name)
+	}
+
+	r.remember(response.Job.ID, ds, req.ProjectID)
+
+	log.Info().
+		Str("job_id", response.Job.ID).
+		Str("project_id", req.ProjectID).
+		Str("downstream", ds.cfg.Name).
+		Msg("Job forwarded to downstream orchestrator")
+
+	return &response, nil
+}
+
+// remember records where a job lives, forgetting the longest unseen job
+// once maxForwardedJobs are remembered
+func (r *Router) remember(jobID string, ds *Downstream, projectID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byJob[jobID]; !ok && len(r.byJob) >= maxForwardedJobs {
+		var oldest string
+		for id, fj := range r.byJob {
+			if oldest == "" || fj.seenAt.Before(r.byJob[oldest].seenAt) {
+				oldest = id
+			}
+		}
+		delete(r.byJob, oldest)
+	}
+	r.byJob[jobID] = forwardedJob{downstream: ds, projectID: projectID, seenAt: time.Now()}
+}
+
+// Proxy relays a request for a forwarded job to its downstream unchanged
+func (d *Downstream) Proxy(w http.ResponseWriter, req *http.Request) {
+	d.proxy.ServeHTTP(w, req)
+}
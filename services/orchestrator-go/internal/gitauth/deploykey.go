@@ -0,0 +1,99 @@
+package gitauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// envKeyPrefix marks deploy key references to an environment variable
+// holding the key, rather than a key file
+const envKeyPrefix = "env:"
+
+// deployKeys caches deploy key credentials by reference, so keys held in
+// the environment are written out once
+var deployKeys sync.Map
+
+// DeployKey returns credentials authenticating git over SSH with a private
+// key: ref is the key file's path, or "env:NAME" for a key held in the
+// NAME environment variable
+func DeployKey(ref string) Credentials {
+	creds, _ := deployKeys.LoadOrStore(ref, &deployKey{ref: ref})
+	return creds.(*deployKey)
+}
+
+// ValidateDeployKey checks that a deploy key reference names a readable key
+func ValidateDeployKey(ref string) error {
+	_, err := DeployKey(ref).(*deployKey).keyFile()
+	return err
+}
+
+type deployKey struct {
+	ref string
+
+	mu   sync.Mutex
+	path string // key file, written out for keys in the environment
+}
+
+// Env points git's SSH at the key alone. Unknown host keys are accepted
+// the first time, so the first clone works without a known_hosts entry.
+func (k *deployKey) Env(ctx context.Context) ([]string, error) {
+	path, err := k.keyFile()
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND=ssh -i '" + path + "' -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=accept-new",
+	}, nil
+}
+
+// Refresh rereads a key held in the environment, which may have been rotated
+func (k *deployKey) Refresh(ctx context.Context) error {
+	k.mu.Lock()
+	k.path = ""
+	k.mu.Unlock()
+	_, err := k.keyFile()
+	return err
+}
+
+func (k *deployKey) Installation() string {
+	return "deploy key " + k.ref
+}
+
+// keyFile returns the path of the key file ssh reads
+func (k *deployKey) keyFile() (string, error) {
+	name, ok := strings.CutPrefix(k.ref, envKeyPrefix)
+	if !ok {
+		if _, err := os.Stat(k.ref); err != nil {
+			return "", fmt.Errorf("deploy key %s is unreadable: %w", k.ref, err)
+		}
+		return k.ref, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.path != "" {
+		return k.path, nil
+	}
+	key := os.Getenv(name)
+	if key == "" {
+		return "", fmt.Errorf("deploy key environment variable %s is not set", name)
+	}
+	// ssh rejects keys without a trailing newline
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
+	}
+	sum := sha256.Sum256([]byte(name))
+	path := filepath.Join(os.TempDir(), "autobuild-deploy-key-"+hex.EncodeToString(sum[:8]))
+	if err := os.WriteFile(path, []byte(key), 0600); err != nil {
+		return "", fmt.Errorf("failed to write deploy key %s: %w", k.ref, err)
+	}
+	k.path = path
+	return path, nil
+}
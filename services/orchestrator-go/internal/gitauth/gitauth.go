@@ -0,0 +1,129 @@
+// Package gitauth recognizes git operations that failed because their
+// credentials were rejected, so they can be retried with fresh credentials
+// and reported as authentication problems rather than generic git errors.
+package gitauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// authFailures are lowercased fragments of git's output when a remote
+// rejects its credentials, over HTTPS or SSH
+var authFailures = []string{
+	"authentication failed",
+	"could not read username",
+	"could not read password",
+	"invalid username or password",
+	"the requested url returned error: 401",
+	"the requested url returned error: 403",
+	"permission denied (publickey",
+	"bad credentials",
+	"terminal prompts disabled",
+}
+
+// IsAuthFailure reports whether git's output shows the remote rejected its
+// credentials
+func IsAuthFailure(output []byte) bool {
+	lower := strings.ToLower(string(output))
+	for _, fragment := range authFailures {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials supplies git with credentials that can be refreshed
+type Credentials interface {
+	// Env is the environment git runs with to authenticate, nil when no
+	// credentials are configured
+	Env(ctx context.Context) ([]string, error)
+	// Refresh replaces the current credentials, as after they expired or
+	// were revoked
+	Refresh(ctx context.Context) error
+	// Installation names where the credentials come from, for operators to
+	// check when they keep being rejected
+	Installation() string
+}
+
+// Error is a git operation the remote refused to authenticate, even after
+// refreshing the credentials
+type Error struct {
+	Op           string
+	Installation string
+	Output       string
+	Err          error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s failed authentication", e.Op)
+	if e.Installation != "" {
+		msg += " (check " + e.Installation + ")"
+	}
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsAuth reports whether err is, or wraps, an authentication failure
+func IsAuth(err error) bool {
+	var authErr *Error
+	return errors.As(err, &authErr)
+}
+
+// Run runs a git operation with creds, which may be nil. When the remote
+// rejects the credentials they are refreshed and the operation is retried
+// once; if it is rejected again, or the refresh fails, the error is an
+// *Error. run receives the environment to add to git's.
+func Run(ctx context.Context, op string, creds Credentials, run func(env []string) ([]byte, error)) ([]byte, error) {
+	var env []string
+	if creds != nil {
+		var err error
+		if env, err = creds.Env(ctx); err != nil {
+			return nil, authError(op, creds, nil, fmt.Errorf("failed to get credentials: %w", err))
+		}
+	}
+
+	output, err := run(env)
+	if err == nil || !IsAuthFailure(output) {
+		return output, err
+	}
+	if creds == nil {
+		return output, authError(op, nil, output, err)
+	}
+
+	if refreshErr := creds.Refresh(ctx); refreshErr != nil {
+		return output, authError(op, creds, output, fmt.Errorf("failed to refresh credentials: %w", refreshErr))
+	}
+	if env, err = creds.Env(ctx); err != nil {
+		return output, authError(op, creds, output, fmt.Errorf("failed to get credentials: %w", err))
+	}
+	output, err = run(env)
+	if err != nil && IsAuthFailure(output) {
+		return output, authError(op, creds, output, err)
+	}
+	return output, err
+}
+
+func authError(op string, creds Credentials, output []byte, err error) *Error {
+	authErr := &Error{Op: op, Output: lastLine(output), Err: err}
+	if creds != nil {
+		authErr.Installation = creds.Installation()
+	}
+	return authErr
+}
+
+// lastLine returns the last non-empty line of git's output, which carries
+// the reason it failed
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,471 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNotConfigured is returned when GitHub App credentials are missing
+var ErrNotConfigured = errors.New("github app not configured")
+
+// Client calls the GitHub REST API as a GitHub App installation
+type Client struct {
+	mu          sync.Mutex
+	cfg         config.GitHubConfig
+	baseURL     string
+	httpClient  *http.Client
+	keyMu       sync.RWMutex
+	privateKey  *rsa.PrivateKey
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewClient creates a GitHub client. Without app credentials the client is
+// still usable but every API call returns ErrNotConfigured.
+func NewClient(cfg config.GitHubConfig) (*Client, error) {
+	c := &Client{
+		cfg:        cfg,
+		baseURL:    cfg.APIURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+
+	if err := c.SetPrivateKey(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetPrivateKey signs app JWTs with the key cfg holds or names from now on,
+// so a rotated key takes effect without a restart. Installation tokens
+// already minted stay in use until they expire.
+func (c *Client) SetPrivateKey(cfg config.GitHubConfig) error {
+	keyPEM := []byte(cfg.PrivateKey)
+	if len(keyPEM) == 0 {
+		if cfg.PrivateKeyPath == "" {
+			return nil
+		}
+		var err error
+		if keyPEM, err = os.ReadFile(cfg.PrivateKeyPath); err != nil {
+			return fmt.Errorf("failed to read github private key: %w", err)
+		}
+	}
+
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return err
+	}
+	c.keyMu.Lock()
+	c.privateKey = key
+	c.keyMu.Unlock()
+	return nil
+}
+
+// Configured reports whether API calls can be made
+func (c *Client) Configured() bool {
+	c.keyMu.RLock()
+	defer c.keyMu.RUnlock()
+	return c.privateKey != nil && c.cfg.AppID != "" && c.cfg.InstallationID != ""
+}
+
+// Ping checks that the API is reachable and accepts the installation's
+// token. A token GitHub rejects is minted again once before giving up.
+func (c *Client) Ping(ctx context.Context) error {
+	const path = "/installation/repositories?per_page=1"
+	err := c.do(ctx, http.MethodGet, path, nil, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if err := c.RefreshToken(ctx); err != nil {
+			return err
+		}
+		err = c.do(ctx, http.MethodGet, path, nil, nil)
+	}
+	return err
+}
+
+// DispatchRepository sends a repository_dispatch event
+func (c *Client) DispatchRepository(ctx context.Context, repo, eventType string, payload interface{}) error {
+	body := map[string]interface{}{
+		"event_type":     eventType,
+		"client_payload": payload,
+	}
+	return c.do(ctx, http.MethodPost, "/repos/"+repo+"/dispatches", body, nil)
+}
+
+// Repository dispatch types the autobuild workflows listen for
+const (
+	dispatchEventType = "autobuild-ticket"
+	qaRerunEventType  = "autobuild-qa"
+	analysisEventType = "autobuild-analysis"
+)
+
+// DispatchJob triggers the autobuild workflow for a job. A non-empty
+// payloadTemplate replaces the default client_payload with the project's
+// own shape (see ValidatePayloadTemplate).
+func (c *Client) DispatchJob(ctx context.Context, job *models.Job, payloadTemplate string) (err error) {
+	eventType := dispatchEventType
+	switch job.Kind {
+	case models.JobKindQARerun:
+		eventType = qaRerunEventType
+	case models.JobKindAnalysis:
+		eventType = analysisEventType
+	}
+
+	ctx, span := tracing.Start(ctx, "github.dispatch",
+		attribute.String("job.id", job.ID),
+		attribute.String("github.repo", job.RepoFullName),
+		attribute.String("github.event_type", eventType),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// Callbacks carry the trace on so the run shows up under this span
+	traceparent := tracing.Inject(ctx)
+
+	var callbackSecret, repoToken string
+	if creds := job.Credentials; creds != nil {
+		callbackSecret, repoToken = creds.CallbackToken, creds.RepoToken
+	}
+
+	var payload map[string]interface{}
+	if payloadTemplate != "" {
+		payload, err = renderPayload(payloadTemplate, &PayloadData{
+			Job:            job,
+			CallbackURL:    c.cfg.CallbackURL,
+			CallbackSecret: callbackSecret,
+			RepoToken:      repoToken,
+			TraceParent:    traceparent,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		// GitHub allows at most 10 top-level client_payload properties
+		payload = map[string]interface{}{
+			"job_id":             job.ID,
+			"ticket_id":          job.TicketID,
+			"ticket_title":       job.TicketTitle,
+			"ticket_description": job.TicketDesc,
+			"prompt":             job.DispatchPrompt(),
+			"branch_name":        job.BranchName,
+			"base_branch":        job.BaseBranch,
+			"callback_url":       c.cfg.CallbackURL,
+			"callback_secret":    callbackSecret,
+		}
+		if traceparent != "" {
+			payload["traceparent"] = traceparent
+		}
+		// QA runs use neither prompt nor description, leaving room for
+		// the runner label of matrix runs
+		if job.Kind == models.JobKindQARerun {
+			delete(payload, "prompt")
+			delete(payload, "ticket_description")
+			if job.RunsOn != "" {
+				payload["runs_on"] = job.RunsOn
+			}
+		}
+	}
+
+	return c.DispatchRepository(ctx, job.RepoFullName, eventType, payload)
+}
+
+// DispatchWorkflow runs a workflow with a workflow_dispatch trigger on ref
+func (c *Client) DispatchWorkflow(ctx context.Context, repo, workflow, ref string) error {
+	body := map[string]interface{}{"ref": ref}
+	return c.do(ctx, http.MethodPost, "/repos/"+repo+"/actions/workflows/"+url.PathEscape(workflow)+"/dispatches", body, nil)
+}
+
+// CancelWorkflowRun cancels an in-progress Actions run
+func (c *Client) CancelWorkflowRun(ctx context.Context, repo, runID string) error {
+	return c.do(ctx, http.MethodPost, "/repos/"+repo+"/actions/runs/"+runID+"/cancel", nil, nil)
+}
+
+// WorkflowRun is the subset of a workflow run the orchestrator uses
+type WorkflowRun struct {
+	ID           int64     `json:"id"`
+	DisplayTitle string    `json:"display_title"`
+	HeadBranch   string    `json:"head_branch"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FindDispatchedRun looks up the run started by a job's repository_dispatch,
+// matching on the job ID embedded in the run name
+func (c *Client) FindDispatchedRun(ctx context.Context, repo, jobID string, since time.Time) (*WorkflowRun, error) {
+	query := url.Values{}
+	query.Set("event", "repository_dispatch")
+	query.Set("created", ">="+since.UTC().Format(time.RFC3339))
+	query.Set("per_page", "100")
+
+	var resp struct {
+		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repo+"/actions/runs?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	for i := range resp.WorkflowRuns {
+		if JobIDFromRunName(resp.WorkflowRuns[i].DisplayTitle) == jobID {
+			return &resp.WorkflowRuns[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetWorkflowRun returns a workflow run by ID
+func (c *Client) GetWorkflowRun(ctx context.Context, repo, runID string) (*WorkflowRun, error) {
+	var run WorkflowRun
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repo+"/actions/runs/"+runID, nil, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// CompareDiff returns the unified diff of head against its merge base with base
+func (c *Client) CompareDiff(ctx context.Context, repo, base, head string) (string, error) {
+	var diff string
+	path := "/repos/" + repo + "/compare/" + url.PathEscape(base) + "..." + url.PathEscape(head)
+	if err := c.do(ctx, http.MethodGet, path, nil, &diff); err != nil {
+		return "", err
+	}
+	return diff, nil
+}
+
+// do performs an authenticated API request, decoding the JSON response into
+// out. A *string out receives the raw body, requested in diff format.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := c.installationToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.request(ctx, method, path, "token "+token, body, out)
+}
+
+func (c *Client) request(ctx context.Context, method, path, auth string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	raw, isRaw := out.(*string)
+	if isRaw {
+		req.Header.Set("Accept", "application/vnd.github.diff")
+	} else {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", auth)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+
+	if isRaw {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		*raw = string(data)
+		return nil
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// APIError is a non-2xx response from the GitHub API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github api error %d: %s", e.StatusCode, e.Message)
+}
+
+// tokenRefreshMargin is how long before its expiry an installation token is
+// replaced. Git sends the token for the whole of a clone or push, which can
+// take minutes on large repositories.
+const tokenRefreshMargin = 5 * time.Minute
+
+// installationToken returns a cached installation token, minting a new one
+// shortly before the current one expires
+func (c *Client) installationToken(ctx context.Context) (string, error) {
+	if !c.Configured() {
+		return "", ErrNotConfigured
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.tokenExpiry) > tokenRefreshMargin {
+		return c.token, nil
+	}
+
+	jwt, err := c.appJWT()
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + c.cfg.InstallationID + "/access_tokens"
+	if err := c.request(ctx, http.MethodPost, path, "Bearer "+jwt, nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to mint installation token: %w", err)
+	}
+
+	c.token = resp.Token
+	c.tokenExpiry = resp.ExpiresAt
+	return c.token, nil
+}
+
+// ScopedToken is an installation token limited to one repository
+type ScopedToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// RepoToken mints an installation token that can only push to and open
+// pull requests on repo. GitHub expires it after an hour unless it is
+// revoked first.
+func (c *Client) RepoToken(ctx context.Context, repo string) (*ScopedToken, error) {
+	if !c.Configured() {
+		return nil, ErrNotConfigured
+	}
+	jwt, err := c.appJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	name := repo[strings.LastIndex(repo, "/")+1:]
+	body := map[string]interface{}{
+		"repositories": []string{name},
+		"permissions": map[string]string{
+			"contents":      "write",
+			"pull_requests": "write",
+		},
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/app/installations/" + c.cfg.InstallationID + "/access_tokens"
+	if err := c.request(ctx, http.MethodPost, path, "Bearer "+jwt, body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to mint token for %s: %w", repo, err)
+	}
+	return &ScopedToken{Token: resp.Token, ExpiresAt: resp.ExpiresAt}, nil
+}
+
+// RevokeToken revokes an installation token before it expires
+func (c *Client) RevokeToken(ctx context.Context, token string) error {
+	return c.request(ctx, http.MethodDelete, "/installation/token", "token "+token, nil, nil)
+}
+
+// appJWT signs a short-lived JWT identifying the GitHub App
+func (c *Client) appJWT() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		// Backdate to tolerate clock drift, as GitHub recommends
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": c.cfg.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	c.keyMu.RLock()
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, digest[:])
+	c.keyMu.RUnlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app jwt: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func parsePrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("github private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse github private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// runNameMarker tags a job's Actions run name with its job ID, letting
+// webhooks and lookups map runs back to jobs. The autobuild workflow sets
+// run-name to include "autobuild job <job_id>".
+const runNameMarker = "autobuild job "
+
+// JobIDFromRunName extracts the job ID from a workflow run name
+func JobIDFromRunName(name string) string {
+	idx := strings.Index(name, runNameMarker)
+	if idx < 0 {
+		return ""
+	}
+
+	id := name[idx+len(runNameMarker):]
+	if end := strings.IndexAny(id, ") "); end >= 0 {
+		id = id[:end]
+	}
+	return id
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+)
+
+// gitHost is where git operations authenticate with installation tokens
+const gitHost = "https://github.com/"
+
+// CloneURL returns the HTTPS URL git clones a repository ("owner/name") from
+func CloneURL(repo string) string {
+	return gitHost + repo + ".git"
+}
+
+// SSHCloneURL returns the SSH URL git clones a repository from with a
+// deploy key
+func SSHCloneURL(repo string) string {
+	return "git@github.com:" + repo + ".git"
+}
+
+// Name returns github, the SCM provider name projects select GitHub by
+func (c *Client) Name() string {
+	return models.SCMGitHub
+}
+
+// CloneURL returns the HTTPS URL of a repository on the configured GitHub
+// host
+func (c *Client) CloneURL(repo string) string {
+	return c.gitHost() + repo + ".git"
+}
+
+// gitHost returns the configured GitHub host, github.com by default
+func (c *Client) gitHost() string {
+	if c.cfg.URL == "" {
+		return gitHost
+	}
+	return c.cfg.URL + "/"
+}
+
+// SSHCloneURL returns the SSH URL of a repository on GitHub
+func (c *Client) SSHCloneURL(repo string) string {
+	return SSHCloneURL(repo)
+}
+
+// OpenChangeRequest opens a pull request from head into base
+func (c *Client) OpenChangeRequest(ctx context.Context, repo, head, base, title, body string) (*scm.ChangeRequest, error) {
+	pr, err := c.CreatePullRequest(ctx, repo, head, base, title, body)
+	if err != nil {
+		return nil, err
+	}
+	return &scm.ChangeRequest{Number: pr.Number, URL: pr.HTMLURL}, nil
+}
+
+// GitCredentials returns credentials authenticating git over HTTPS with the
+// app's installation token, or nil when the app is not configured and git
+// relies on its own credential setup
+func (c *Client) GitCredentials() gitauth.Credentials {
+	if !c.Configured() {
+		return nil
+	}
+	return gitCredentials{c}
+}
+
+// RefreshToken mints a new installation token, replacing the cached one
+// even if it has not expired, as when it was revoked
+func (c *Client) RefreshToken(ctx context.Context) error {
+	c.mu.Lock()
+	c.token = ""
+	c.tokenExpiry = time.Time{}
+	c.mu.Unlock()
+
+	_, err := c.installationToken(ctx)
+	return err
+}
+
+type gitCredentials struct {
+	c *Client
+}
+
+// Env sends the installation token as the basic auth header git uses for
+// the GitHub host, and keeps git from prompting when it is rejected
+func (g gitCredentials) Env(ctx context.Context) ([]string, error) {
+	token, err := g.c.installationToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + g.c.gitHost() + ".extraheader",
+		"GIT_CONFIG_VALUE_0=AUTHORIZATION: basic " + auth,
+	}, nil
+}
+
+func (g gitCredentials) Refresh(ctx context.Context) error {
+	return g.c.RefreshToken(ctx)
+}
+
+func (g gitCredentials) Installation() string {
+	return "GitHub App " + g.c.cfg.AppID + " installation " + g.c.cfg.InstallationID
+}
@@ -0,0 +1,95 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxListPages bounds paginated listings so a huge repository cannot stall a caller
+const maxListPages = 10
+
+// PullRequest is the subset of a pull request the orchestrator uses
+type PullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// ListOpenPullRequests returns a repository's open pull requests whose head
+// branch starts with prefix
+func (c *Client) ListOpenPullRequests(ctx context.Context, repo, prefix string) ([]PullRequest, error) {
+	var matched []PullRequest
+	for page := 1; page <= maxListPages; page++ {
+		var prs []PullRequest
+		path := "/repos/" + repo + "/pulls?state=open&per_page=100&page=" + strconv.Itoa(page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &prs); err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if strings.HasPrefix(pr.Head.Ref, prefix) {
+				matched = append(matched, pr)
+			}
+		}
+		if len(prs) < 100 {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// ListActiveDispatchedRuns returns the queued and in-progress runs started by
+// repository_dispatch
+func (c *Client) ListActiveDispatchedRuns(ctx context.Context, repo string) ([]WorkflowRun, error) {
+	var runs []WorkflowRun
+	for _, status := range []string{"queued", "in_progress"} {
+		query := url.Values{}
+		query.Set("event", "repository_dispatch")
+		query.Set("status", status)
+		query.Set("per_page", "100")
+
+		var resp struct {
+			WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/repos/"+repo+"/actions/runs?"+query.Encode(), nil, &resp); err != nil {
+			return nil, err
+		}
+		runs = append(runs, resp.WorkflowRuns...)
+	}
+	return runs, nil
+}
+
+// ListBranches returns the names of a repository's branches starting with prefix
+func (c *Client) ListBranches(ctx context.Context, repo, prefix string) ([]string, error) {
+	var refs []struct {
+		Ref string `json:"ref"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repo+"/git/matching-refs/heads/"+prefix, nil, &refs); err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		branches = append(branches, strings.TrimPrefix(ref.Ref, "refs/heads/"))
+	}
+	return branches, nil
+}
+
+// DeleteBranch deletes a branch from a repository
+func (c *Client) DeleteBranch(ctx context.Context, repo, branch string) error {
+	return c.do(ctx, http.MethodDelete, "/repos/"+repo+"/git/refs/heads/"+branch, nil, nil)
+}
+
+// CreatePullRequest opens a pull request from head into base
+func (c *Client) CreatePullRequest(ctx context.Context, repo, head, base, title, body string) (*PullRequest, error) {
+	var pr PullRequest
+	req := map[string]string{"title": title, "head": head, "base": base, "body": body}
+	if err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/pulls", req, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
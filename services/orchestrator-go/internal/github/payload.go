@@ -0,0 +1,91 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// maxPayloadProperties is GitHub's limit on top-level client_payload properties
+const maxPayloadProperties = 10
+
+// PayloadData is what a project's dispatch template is executed against
+type PayloadData struct {
+	Job            *models.Job
+	CallbackURL    string
+	CallbackSecret string
+	// RepoToken is the run's installation token scoped to the job's
+	// repository, empty unless job credentials are on
+	RepoToken string
+	// TraceParent is the W3C trace context callbacks should send back in a
+	// traceparent header, empty when the dispatch is not traced
+	TraceParent string
+}
+
+var payloadFuncs = template.FuncMap{
+	// json encodes a value as a JSON literal so strings are quoted and escaped
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ValidatePayloadTemplate checks that a dispatch template parses and renders
+// a sample job to a JSON object GitHub will accept
+func ValidatePayloadTemplate(src string) error {
+	if src == "" {
+		return nil
+	}
+	sample := &PayloadData{
+		Job: &models.Job{
+			ID:           "00000000-0000-0000-0000-000000000000",
+			ProjectID:    "project",
+			TicketID:     "ticket",
+			TicketTitle:  "Title",
+			TicketDesc:   "Description with \"quotes\"\nand newlines",
+			Prompt:       "Prompt",
+			RepoFullName: "owner/repo",
+			BranchName:   "autobuild/ticket",
+			BaseBranch:   "main",
+			Kind:         models.JobKindImplementation,
+			CreatedAt:    time.Now(),
+		},
+		CallbackURL:    "https://orchestrator.example.com/api/v1/callback",
+		CallbackSecret: "secret",
+		RepoToken:      "ghs_token",
+		TraceParent:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	_, err := renderPayload(src, sample)
+	return err
+}
+
+// renderPayload executes a dispatch template and decodes the result into
+// the client_payload object
+func renderPayload(src string, data *PayloadData) (map[string]interface{}, error) {
+	tmpl, err := template.New("dispatch").Funcs(payloadFuncs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dispatch template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render dispatch template: %w", err)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		return nil, fmt.Errorf("dispatch template must render a JSON object: %w", err)
+	}
+	if payload == nil {
+		return nil, errors.New("dispatch template must render a JSON object")
+	}
+	if len(payload) > maxPayloadProperties {
+		return nil, fmt.Errorf("dispatch template renders %d top-level properties, GitHub allows at most %d", len(payload), maxPayloadProperties)
+	}
+	return payload, nil
+}
@@ -0,0 +1,133 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// VerifySignature checks an X-Hub-Signature-256 header against the payload
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Repository is the repository block common to webhook payloads
+type Repository struct {
+	FullName string `json:"full_name"`
+}
+
+// WorkflowRunEvent is the payload of a workflow_run webhook
+type WorkflowRunEvent struct {
+	Action      string     `json:"action"`
+	Repository  Repository `json:"repository"`
+	WorkflowRun struct {
+		ID           int64  `json:"id"`
+		DisplayTitle string `json:"display_title"`
+		HeadBranch   string `json:"head_branch"`
+		Status       string `json:"status"`
+		Conclusion   string `json:"conclusion"`
+		HTMLURL      string `json:"html_url"`
+		Path         string `json:"path"`
+	} `json:"workflow_run"`
+}
+
+// Update converts the event into a workflow run update for the queue
+func (e *WorkflowRunEvent) Update() *models.WorkflowRunUpdate {
+	return &models.WorkflowRunUpdate{
+		JobID:        JobIDFromRunName(e.WorkflowRun.DisplayTitle),
+		RepoFullName: e.Repository.FullName,
+		Branch:       e.WorkflowRun.HeadBranch,
+		RunID:        strconv.FormatInt(e.WorkflowRun.ID, 10),
+		Status:       e.WorkflowRun.Status,
+		Conclusion:   e.WorkflowRun.Conclusion,
+		URL:          e.WorkflowRun.HTMLURL,
+		Workflow:     e.WorkflowRun.Path,
+	}
+}
+
+// WorkflowJobEvent is the payload of a workflow_job webhook
+type WorkflowJobEvent struct {
+	Action      string     `json:"action"`
+	Repository  Repository `json:"repository"`
+	WorkflowJob struct {
+		RunID      int64    `json:"run_id"`
+		HeadBranch string   `json:"head_branch"`
+		Status     string   `json:"status"`
+		Labels     []string `json:"labels"`
+		RunnerName string   `json:"runner_name"`
+	} `json:"workflow_job"`
+}
+
+// Update converts the event into a workflow run update for the queue. A
+// single job finishing does not complete the run, so only progress is
+// reported.
+func (e *WorkflowJobEvent) Update() *models.WorkflowRunUpdate {
+	status := e.WorkflowJob.Status
+	if status == "completed" {
+		status = "in_progress"
+	}
+
+	return &models.WorkflowRunUpdate{
+		RepoFullName: e.Repository.FullName,
+		Branch:       e.WorkflowJob.HeadBranch,
+		RunID:        strconv.FormatInt(e.WorkflowJob.RunID, 10),
+		Status:       status,
+		RunnerName:   e.WorkflowJob.RunnerName,
+		RunnerLabels: e.WorkflowJob.Labels,
+	}
+}
+
+// PushEvent is the payload of a push webhook
+type PushEvent struct {
+	Ref        string     `json:"ref"`
+	After      string     `json:"after"`
+	Repository Repository `json:"repository"`
+}
+
+// Branch returns the pushed branch name, or "" for tag pushes
+func (e *PushEvent) Branch() string {
+	if !strings.HasPrefix(e.Ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(e.Ref, "refs/heads/")
+}
+
+// PullRequestEvent is the payload of a pull_request webhook
+type PullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Merged bool `json:"merged"`
+	} `json:"pull_request"`
+	Repository Repository `json:"repository"`
+}
+
+// State returns the state the event left the pull request in, or "" when
+// it did not merge, close or reopen it
+func (e *PullRequestEvent) State() models.PRState {
+	switch e.Action {
+	case "closed":
+		if e.PullRequest.Merged {
+			return models.PRStateMerged
+		}
+		return models.PRStateClosed
+	case "reopened":
+		return models.PRStateOpen
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package githubfake
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// CreateRepo creates a repository ("owner/name") whose default branch
+// holds a single commit with a README
+func (s *Server) CreateRepo(repo, defaultBranch string) error {
+	path := s.repoPath(repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if _, err := git(filepath.Dir(path), "init", "--bare", "--initial-branch="+defaultBranch, path); err != nil {
+		return err
+	}
+
+	work, err := os.MkdirTemp("", "githubfake-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	if _, err := git(work, "clone", path, "."); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(work, "README.md"), []byte("# "+repo+"\n"), 0644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"checkout", "-B", defaultBranch},
+		{"add", "README.md"},
+		{"commit", "-m", "Initial commit"},
+		{"push", "origin", defaultBranch},
+	} {
+		if _, err := git(work, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit commits files, keyed by path, onto branch of a repository,
+// creating the branch from base when it does not exist, and returns the
+// new head commit
+func (s *Server) Commit(repo, base, branch, message string, files map[string]string) (string, error) {
+	work, err := os.MkdirTemp("", "githubfake-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+	if _, err := git(work, "clone", s.repoPath(repo), "."); err != nil {
+		return "", err
+	}
+	start := "origin/" + base
+	if s.branchExists(repo, branch) {
+		start = "origin/" + branch
+	}
+	if _, err := git(work, "checkout", "-B", branch, start); err != nil {
+		return "", err
+	}
+	for path, content := range files {
+		full := filepath.Join(work, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			return "", err
+		}
+		if _, err := git(work, "add", path); err != nil {
+			return "", err
+		}
+	}
+	if _, err := git(work, "commit", "-m", message); err != nil {
+		return "", err
+	}
+	if _, err := git(work, "push", "origin", branch); err != nil {
+		return "", err
+	}
+	head, err := git(work, "rev-parse", "HEAD")
+	return strings.TrimSpace(string(head)), err
+}
+
+// Implement plays the autobuild workflow: it commits a change for the
+// ticket onto the job's branch, opens a pull request and reports success
+func Implement(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+	base := d.Field("base_branch")
+	if base == "" {
+		base = "main"
+	}
+	branch, jobID := d.Field("branch_name"), d.Field("job_id")
+	path := "autobuild/" + jobID + ".md"
+	content := "# " + d.Field("ticket_title") + "\n\n" + d.Field("prompt") + "\n"
+
+	head, err := s.Commit(d.Repo, base, branch, "Implement "+d.Field("ticket_title"), map[string]string{path: content})
+	if err != nil {
+		return &models.JobResult{Status: "failure", Error: err.Error()}
+	}
+	pr := s.OpenPullRequest(d.Repo, branch, base, "[AutoBuild] "+d.Field("ticket_title"), "")
+	return &models.JobResult{
+		Status:   "success",
+		PRUrl:    pr.HTMLURL,
+		PRNumber: pr.Number,
+		HeadSHA:  head,
+		Diff: &models.DiffStat{Files: []models.DiffFile{
+			{Path: path, Additions: strings.Count(content, "\n")},
+		}},
+	}
+}
+
+// NoChanges plays a run whose agent changes nothing
+func NoChanges(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+	return &models.JobResult{Status: "no_changes"}
+}
+
+// Fail returns a workflow whose runs fail with msg
+func Fail(msg string) Workflow {
+	return func(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+		return &models.JobResult{Status: "failure", Error: msg}
+	}
+}
+
+// Flaky returns a workflow whose first n runs fail with msg and whose later
+// runs play out as then
+func Flaky(n int, msg string, then Workflow) Workflow {
+	var runs atomic.Int32
+	return func(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+		if int(runs.Add(1)) <= n {
+			return Fail(msg)(ctx, s, d)
+		}
+		return then(ctx, s, d)
+	}
+}
+
+// Hang plays a run that never calls back, until the server closes
+func Hang(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+	<-ctx.Done()
+	return nil
+}
+
+// After returns a workflow whose runs wait until release is closed, then
+// play out as then
+func After(release <-chan struct{}, then Workflow) Workflow {
+	return func(ctx context.Context, s *Server, d Dispatch) *models.JobResult {
+		select {
+		case <-release:
+			return then(ctx, s, d)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// branches lists a repository's branches
+func (s *Server) branches(repo string) []string {
+	out, err := git(s.repoPath(repo), "for-each-ref", "--format=%(refname:short)", "refs/heads/")
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// branchExists reports whether a repository has a branch
+func (s *Server) branchExists(repo, branch string) bool {
+	_, err := git(s.repoPath(repo), "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	return err == nil
+}
+
+// git runs git in dir as the fake's own committer
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=AutoBuild Fake", "-c", "user.email=fake@autobuild.invalid"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,551 @@
+// Package githubfake is an in-memory GitHub for integration tests. It serves
+// the parts of the REST API the orchestrator calls, keeps repositories as
+// bare git repositories on disk, plays the autobuild workflow for each
+// repository_dispatch, and sends the webhooks GitHub would.
+package githubfake
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// runNamePrefix names runs the way the autobuild workflows' run-name does,
+// so the orchestrator maps them back to jobs
+const runNamePrefix = "autobuild job "
+
+// Dispatch is a repository_dispatch the server received
+type Dispatch struct {
+	Repo       string                 `json:"repo"`
+	EventType  string                 `json:"event_type"`
+	Payload    map[string]interface{} `json:"client_payload"`
+	ReceivedAt time.Time              `json:"received_at"`
+}
+
+// Field returns a string field of the dispatch's client_payload
+func (d Dispatch) Field(name string) string {
+	s, _ := d.Payload[name].(string)
+	return s
+}
+
+// Run is a workflow run, as the REST API returns it
+type Run struct {
+	ID           int64     `json:"id"`
+	DisplayTitle string    `json:"display_title"`
+	HeadBranch   string    `json:"head_branch"`
+	Event        string    `json:"event"`
+	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion"`
+	HTMLURL      string    `json:"html_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	repo         string
+}
+
+// Ref is the head or base of a pull request
+type Ref struct {
+	Ref string `json:"ref"`
+}
+
+// PullRequest is a pull request, as the REST API returns it
+type PullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	Merged  bool   `json:"merged"`
+	Head    Ref    `json:"head"`
+	Base    Ref    `json:"base"`
+}
+
+// Workflow plays a workflow run for a dispatch and returns the result it
+// calls back with. It returns nil to never call back, as a run that dies.
+type Workflow func(ctx context.Context, s *Server, d Dispatch) *models.JobResult
+
+// Server is a fake GitHub listening on a local port
+type Server struct {
+	mu            sync.Mutex
+	srv           *http.Server
+	url           string
+	gitDir        string
+	webhookURL    string
+	webhookSecret string
+	workflow      Workflow
+	nextID        int64
+	dispatches    []Dispatch
+	runs          map[int64]*Run
+	pulls         map[string][]*PullRequest
+	wg            sync.WaitGroup
+	ctx           context.Context
+	cancel        context.CancelFunc
+}
+
+// Start serves a fake GitHub on a local port, keeping repositories under
+// gitDir. Runs implement their tickets with Implement until SetWorkflow
+// says otherwise.
+func Start(gitDir, webhookSecret string) (*Server, error) {
+	if err := os.MkdirAll(gitDir, 0755); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		url:           "http://" + ln.Addr().String(),
+		gitDir:        gitDir,
+		webhookSecret: webhookSecret,
+		workflow:      Implement,
+		runs:          make(map[int64]*Run),
+		pulls:         make(map[string][]*PullRequest),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.srv = &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go s.srv.Serve(ln)
+	return s, nil
+}
+
+// Close stops the server and waits for the runs in progress
+func (s *Server) Close() {
+	s.cancel()
+	s.srv.Close()
+	s.wg.Wait()
+}
+
+// URL is where the REST API is served, for GITHUB_API_URL
+func (s *Server) URL() string {
+	return s.url
+}
+
+// GitURL is where repositories are cloned from, for GITHUB_URL
+func (s *Server) GitURL() string {
+	return "file://" + s.gitDir
+}
+
+// SetWebhookURL makes the server send webhooks to url
+func (s *Server) SetWebhookURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhookURL = url
+}
+
+// SetWorkflow replaces the workflow runs play
+func (s *Server) SetWorkflow(w Workflow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflow = w
+}
+
+// Dispatches returns the repository_dispatch events received so far
+func (s *Server) Dispatches() []Dispatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Dispatch(nil), s.dispatches...)
+}
+
+// PullRequests returns a repository's pull requests
+func (s *Server) PullRequests(repo string) []PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prs := make([]PullRequest, len(s.pulls[repo]))
+	for i, pr := range s.pulls[repo] {
+		prs[i] = *pr
+	}
+	return prs
+}
+
+// OpenPullRequest opens a pull request from head into base
+func (s *Server) OpenPullRequest(repo, head, base, title, body string) PullRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := &PullRequest{
+		Number: len(s.pulls[repo]) + 1,
+		Title:  title,
+		Body:   body,
+		State:  "open",
+		Head:   Ref{Ref: head},
+		Base:   Ref{Ref: base},
+	}
+	pr.HTMLURL = fmt.Sprintf("%s/%s/pull/%d", s.url, repo, pr.Number)
+	s.pulls[repo] = append(s.pulls[repo], pr)
+	return *pr
+}
+
+// ClosePullRequest merges or closes a pull request and sends the
+// pull_request webhook saying so
+func (s *Server) ClosePullRequest(ctx context.Context, repo string, number int, merge bool) error {
+	s.mu.Lock()
+	var pr *PullRequest
+	for _, p := range s.pulls[repo] {
+		if p.Number == number {
+			pr = p
+		}
+	}
+	if pr == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("no pull request %s#%d", repo, number)
+	}
+	pr.State = "closed"
+	pr.Merged = merge
+	event := map[string]interface{}{
+		"action":       "closed",
+		"number":       number,
+		"pull_request": *pr,
+		"repository":   map[string]string{"full_name": repo},
+	}
+	s.mu.Unlock()
+	return s.SendWebhook(ctx, "pull_request", event)
+}
+
+// SendWebhook sends a webhook event, signed with the webhook secret. It
+// does nothing until SetWebhookURL is called.
+func (s *Server) SendWebhook(ctx context.Context, event string, payload interface{}) error {
+	s.mu.Lock()
+	url, secret := s.webhookURL, s.webhookSecret
+	s.mu.Unlock()
+	if url == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s answered %d", event, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Server) routes() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/app/installations/{installationID}/access_tokens", s.handleAccessToken)
+	r.Delete("/installation/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Get("/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"total_count": 0, "repositories": []interface{}{}})
+	})
+	r.Route("/repos/{owner}/{repo}", func(r chi.Router) {
+		r.Post("/dispatches", s.handleDispatch)
+		r.Get("/actions/runs", s.handleListRuns)
+		r.Get("/actions/runs/{runID}", s.handleGetRun)
+		r.Post("/actions/runs/{runID}/cancel", s.handleCancelRun)
+		r.Get("/pulls", s.handleListPulls)
+		r.Post("/pulls", s.handleCreatePull)
+		r.Get("/git/matching-refs/heads/*", s.handleMatchingRefs)
+		r.Delete("/git/refs/heads/*", s.handleDeleteRef)
+		r.Get("/compare/{basehead}", s.handleCompare)
+	})
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found: " + r.Method + " " + r.URL.Path})
+	})
+	return r
+}
+
+func repoOf(r *http.Request) string {
+	return chi.URLParam(r, "owner") + "/" + chi.URLParam(r, "repo")
+}
+
+func (s *Server) handleAccessToken(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "A JSON web token is required"})
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	token := "ghs_fake" + strconv.FormatInt(s.nextID, 10)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":      token,
+		"expires_at": time.Now().Add(time.Hour),
+	})
+}
+
+func (s *Server) handleDispatch(w http.ResponseWriter, r *http.Request) {
+	var d Dispatch
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Invalid request"})
+		return
+	}
+	d.Repo = repoOf(r)
+	d.ReceivedAt = time.Now()
+	if _, err := os.Stat(s.repoPath(d.Repo)); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+
+	s.mu.Lock()
+	s.dispatches = append(s.dispatches, d)
+	s.nextID++
+	run := &Run{
+		ID:           s.nextID,
+		DisplayTitle: runNamePrefix + d.Field("job_id"),
+		HeadBranch:   d.Field("branch_name"),
+		Event:        "repository_dispatch",
+		Status:       "queued",
+		CreatedAt:    time.Now(),
+		repo:         d.Repo,
+	}
+	run.HTMLURL = fmt.Sprintf("%s/%s/actions/runs/%d", s.url, d.Repo, run.ID)
+	s.runs[run.ID] = run
+	workflow := s.workflow
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.play(run, workflow, d)
+	}()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// play runs a workflow for a dispatch, reporting its progress through
+// workflow_run webhooks and its result through the dispatch's callback
+func (s *Server) play(run *Run, workflow Workflow, d Dispatch) {
+	ctx := s.ctx
+	s.setRunStatus(ctx, run, "in_progress", "")
+
+	result := workflow(ctx, s, d)
+	if result == nil || ctx.Err() != nil {
+		return
+	}
+	if result.JobID == "" {
+		result.JobID = d.Field("job_id")
+	}
+	if result.TicketID == "" {
+		result.TicketID = d.Field("ticket_id")
+	}
+	result.RunID = strconv.FormatInt(run.ID, 10)
+
+	if err := callback(ctx, d, result); err != nil {
+		s.setRunStatus(ctx, run, "completed", "failure")
+		return
+	}
+	conclusion := "success"
+	if result.Status == "failure" {
+		conclusion = "failure"
+	}
+	s.setRunStatus(ctx, run, "completed", conclusion)
+}
+
+func (s *Server) setRunStatus(ctx context.Context, run *Run, status, conclusion string) {
+	s.mu.Lock()
+	if run.Status == "completed" {
+		// Cancelled in the meantime
+		s.mu.Unlock()
+		return
+	}
+	run.Status, run.Conclusion = status, conclusion
+	event := map[string]interface{}{
+		"action":       map[string]string{"in_progress": "in_progress", "completed": "completed"}[status],
+		"workflow_run": *run,
+		"repository":   map[string]string{"full_name": run.repo},
+	}
+	s.mu.Unlock()
+	s.SendWebhook(ctx, "workflow_run", event)
+}
+
+// callback reports a run's result the way the autobuild workflow does
+func callback(ctx context.Context, d Dispatch, result *models.JobResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Field("callback_url"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.Field("callback_secret"))
+	if tp := d.Field("traceparent"); tp != "" {
+		req.Header.Set("traceparent", tp)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	repo, query := repoOf(r), r.URL.Query()
+	var since time.Time
+	if created, ok := strings.CutPrefix(query.Get("created"), ">="); ok {
+		since, _ = time.Parse(time.RFC3339, created)
+	}
+
+	s.mu.Lock()
+	runs := make([]Run, 0)
+	for _, run := range s.runs {
+		if run.repo != repo || query.Get("status") != "" && run.Status != query.Get("status") ||
+			query.Get("event") != "" && run.Event != query.Get("event") || run.CreatedAt.Before(since) {
+			continue
+		}
+		runs = append(runs, *run)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"total_count": len(runs), "workflow_runs": runs})
+}
+
+func (s *Server) lookupRun(w http.ResponseWriter, r *http.Request) *Run {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	run, ok := s.runs[id]
+	if !ok || run.repo != repoOf(r) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return nil
+	}
+	return run
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if run := s.lookupRun(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	run := s.lookupRun(w, r)
+	if run == nil {
+		s.mu.Unlock()
+		return
+	}
+	if run.Status == "completed" {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusConflict, map[string]string{"message": "Cannot cancel a workflow run that is completed."})
+		return
+	}
+	s.mu.Unlock()
+
+	s.setRunStatus(r.Context(), run, "completed", "cancelled")
+	writeJSON(w, http.StatusAccepted, map[string]string{})
+}
+
+func (s *Server) handleListPulls(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "open"
+	}
+	// Every pull request fits on the first page
+	if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+		writeJSON(w, http.StatusOK, []PullRequest{})
+		return
+	}
+	prs := make([]PullRequest, 0)
+	for _, pr := range s.PullRequests(repoOf(r)) {
+		if state == "all" || pr.State == state {
+			prs = append(prs, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, prs)
+}
+
+func (s *Server) handleCreatePull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"title"`
+		Head  string `json:"head"`
+		Base  string `json:"base"`
+		Body  string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Head == "" || req.Base == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed"})
+		return
+	}
+	repo := repoOf(r)
+	if !s.branchExists(repo, req.Head) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed: head does not exist"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.OpenPullRequest(repo, req.Head, req.Base, req.Title, req.Body))
+}
+
+func (s *Server) handleMatchingRefs(w http.ResponseWriter, r *http.Request) {
+	prefix := chi.URLParam(r, "*")
+	refs := make([]map[string]string, 0)
+	for _, branch := range s.branches(repoOf(r)) {
+		if strings.HasPrefix(branch, prefix) {
+			refs = append(refs, map[string]string{"ref": "refs/heads/" + branch})
+		}
+	}
+	writeJSON(w, http.StatusOK, refs)
+}
+
+func (s *Server) handleDeleteRef(w http.ResponseWriter, r *http.Request) {
+	repo, branch := repoOf(r), chi.URLParam(r, "*")
+	if !s.branchExists(repo, branch) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference does not exist"})
+		return
+	}
+	if _, err := git(s.repoPath(repo), "branch", "-D", branch); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	base, head, ok := strings.Cut(chi.URLParam(r, "basehead"), "...")
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	diff, err := git(s.repoPath(repoOf(r)), "diff", base+"..."+head)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(diff)
+}
+
+// repoPath returns where a repository's bare git repository is kept
+func (s *Server) repoPath(repo string) string {
+	return filepath.Join(s.gitDir, repo+".git")
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,216 @@
+// Package gitlab is the GitLab SCM provider: it triggers pipelines for the
+// gitlab_ci executor, opens merge requests, authenticates git over HTTPS
+// and parses pipeline and push webhooks.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNotConfigured is returned for API calls without a GitLab token
+var ErrNotConfigured = errors.New("gitlab token not configured")
+
+// Client talks to the GitLab API
+type Client struct {
+	cfg         config.GitLabConfig
+	callbackURL string
+	httpClient  *http.Client
+}
+
+// NewClient creates a GitLab client. Runs it triggers report to callbackURL.
+func NewClient(cfg config.GitLabConfig, callbackURL string) *Client {
+	return &Client{
+		cfg:         cfg,
+		callbackURL: callbackURL,
+		httpClient:  &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// Name returns gitlab, the SCM provider name projects select GitLab by
+func (c *Client) Name() string {
+	return models.SCMGitLab
+}
+
+// Configured reports whether API calls can be made
+func (c *Client) Configured() bool {
+	return c.cfg.Token != ""
+}
+
+// CanTrigger reports whether pipelines can be triggered
+func (c *Client) CanTrigger() bool {
+	return c.Configured() && c.cfg.TriggerToken != ""
+}
+
+// Pipeline is the subset of a pipeline the orchestrator uses
+type Pipeline struct {
+	ID     int64  `json:"id"`
+	Ref    string `json:"ref"`
+	Status string `json:"status"`
+	WebURL string `json:"web_url"`
+}
+
+// TriggerPipeline starts a pipeline running the agent for job. Its
+// variables mirror the environment local runs give the agent.
+func (c *Client) TriggerPipeline(ctx context.Context, job *models.Job) (_ *Pipeline, err error) {
+	if !c.CanTrigger() {
+		return nil, ErrNotConfigured
+	}
+
+	ctx, span := tracing.Start(ctx, "gitlab.trigger",
+		attribute.String("job.id", job.ID),
+		attribute.String("gitlab.project", job.RepoFullName),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// QA runs verify the job's branch; the others start from the base
+	ref := job.BaseBranch
+	if job.Kind == models.JobKindQARerun {
+		ref = job.BranchName
+	}
+
+	var callbackSecret string
+	if job.Credentials != nil {
+		callbackSecret = job.Credentials.CallbackToken
+	}
+	variables := map[string]string{
+		"AUTOBUILD_JOB_ID":             job.ID,
+		"AUTOBUILD_JOB_KIND":           string(job.Kind),
+		"AUTOBUILD_TICKET_ID":          job.TicketID,
+		"AUTOBUILD_TICKET_TITLE":       job.TicketTitle,
+		"AUTOBUILD_TICKET_DESCRIPTION": job.TicketDesc,
+		"AUTOBUILD_PROMPT":             job.DispatchPrompt(),
+		"AUTOBUILD_BRANCH_NAME":        job.BranchName,
+		"AUTOBUILD_BASE_BRANCH":        job.BaseBranch,
+		"AUTOBUILD_CALLBACK_URL":       c.callbackURL,
+		"AUTOBUILD_CALLBACK_SECRET":    callbackSecret,
+		"AUTOBUILD_TRACEPARENT":        tracing.Inject(ctx),
+		"AUTOBUILD_RUNS_ON":            job.RunsOn,
+	}
+
+	form := url.Values{}
+	form.Set("token", c.cfg.TriggerToken)
+	form.Set("ref", ref)
+	for key, value := range variables {
+		if value != "" {
+			form.Set("variables["+key+"]", value)
+		}
+	}
+
+	var pipeline Pipeline
+	path := projectPath(job.RepoFullName) + "/trigger/pipeline"
+	if err := c.do(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &pipeline); err != nil {
+		return nil, fmt.Errorf("failed to trigger pipeline: %w", err)
+	}
+	return &pipeline, nil
+}
+
+// GetPipeline returns a pipeline by ID
+func (c *Client) GetPipeline(ctx context.Context, repo, pipelineID string) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := c.doJSON(ctx, http.MethodGet, projectPath(repo)+"/pipelines/"+pipelineID, nil, &pipeline); err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// CancelPipeline cancels a pipeline's running jobs
+func (c *Client) CancelPipeline(ctx context.Context, repo, pipelineID string) error {
+	return c.doJSON(ctx, http.MethodPost, projectPath(repo)+"/pipelines/"+pipelineID+"/cancel", nil, nil)
+}
+
+// OpenChangeRequest opens a merge request from head into base
+func (c *Client) OpenChangeRequest(ctx context.Context, repo, head, base, title, body string) (*scm.ChangeRequest, error) {
+	req := map[string]interface{}{
+		"source_branch":        head,
+		"target_branch":        base,
+		"title":                title,
+		"description":          body,
+		"remove_source_branch": true,
+	}
+	var mr struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, projectPath(repo)+"/merge_requests", req, &mr); err != nil {
+		return nil, err
+	}
+	return &scm.ChangeRequest{Number: mr.IID, URL: mr.WebURL}, nil
+}
+
+// projectPath is the API path of a project ("group/name"), whose path is
+// URL-encoded into a single segment
+func projectPath(repo string) string {
+	return "/projects/" + url.PathEscape(repo)
+}
+
+// doJSON performs an API request with a JSON body
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader, contentType = bytes.NewReader(payload), "application/json"
+	}
+	return c.do(ctx, method, path, contentType, reader, out)
+}
+
+// do performs an authenticated API request, decoding the JSON response
+// into out
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.URL+"/api/v4"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", c.cfg.Token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// APIError is a non-2xx response from the GitLab API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gitlab api error %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,58 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+)
+
+// CloneURL returns the HTTPS URL git clones a project ("group/name") from
+func (c *Client) CloneURL(repo string) string {
+	return c.cfg.URL + "/" + repo + ".git"
+}
+
+// SSHCloneURL returns the SSH URL git clones a project from with a deploy
+// key
+func (c *Client) SSHCloneURL(repo string) string {
+	host := c.cfg.URL
+	if u, err := url.Parse(c.cfg.URL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "git@" + host + ":" + repo + ".git"
+}
+
+// GitCredentials returns credentials authenticating git over HTTPS with
+// the access token, or nil when no token is configured
+func (c *Client) GitCredentials() gitauth.Credentials {
+	if !c.Configured() {
+		return nil
+	}
+	return gitCredentials{c}
+}
+
+type gitCredentials struct {
+	c *Client
+}
+
+// Env sends the access token as the basic auth header git uses for the
+// GitLab instance, and keeps git from prompting when it is rejected
+func (g gitCredentials) Env(ctx context.Context) ([]string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte("oauth2:" + g.c.cfg.Token))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + g.c.cfg.URL + "/.extraheader",
+		"GIT_CONFIG_VALUE_0=AUTHORIZATION: basic " + auth,
+	}, nil
+}
+
+// Refresh does nothing: access tokens are rotated by replacing GITLAB_TOKEN
+func (g gitCredentials) Refresh(ctx context.Context) error {
+	return nil
+}
+
+func (g gitCredentials) Installation() string {
+	return "GITLAB_TOKEN for " + g.c.cfg.URL
+}
@@ -0,0 +1,132 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// VerifyToken checks an X-Gitlab-Token header against the webhook secret
+func VerifyToken(secret, token string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(token)) == 1
+}
+
+// Project is the project block common to webhook payloads
+type Project struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// Variable is a CI variable a pipeline was triggered with
+type Variable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// PipelineEvent is the payload of a pipeline webhook
+type PipelineEvent struct {
+	ObjectAttributes struct {
+		ID        int64      `json:"id"`
+		Ref       string     `json:"ref"`
+		Status    string     `json:"status"`
+		URL       string     `json:"url"`
+		Variables []Variable `json:"variables"`
+	} `json:"object_attributes"`
+	Project Project `json:"project"`
+}
+
+// Update converts the event into a run update for the queue, in the
+// statuses and conclusions of GitHub workflow runs. The job is named by the
+// AUTOBUILD_JOB_ID variable it was triggered with.
+func (e *PipelineEvent) Update() *models.WorkflowRunUpdate {
+	attrs := e.ObjectAttributes
+	update := &models.WorkflowRunUpdate{
+		RepoFullName: e.Project.PathWithNamespace,
+		Branch:       attrs.Ref,
+		RunID:        strconv.FormatInt(attrs.ID, 10),
+		URL:          attrs.URL,
+		SCM:          models.SCMGitLab,
+	}
+	if update.URL == "" && e.Project.WebURL != "" {
+		update.URL = e.Project.WebURL + "/-/pipelines/" + update.RunID
+	}
+	for _, v := range attrs.Variables {
+		if v.Key == "AUTOBUILD_JOB_ID" {
+			update.JobID = v.Value
+		}
+	}
+	update.Status, update.Conclusion = runStatus(attrs.Status)
+	return update
+}
+
+// runStatus maps a pipeline status to a workflow run's status and
+// conclusion
+func runStatus(status string) (string, string) {
+	switch status {
+	case "running":
+		return "in_progress", ""
+	case "success":
+		return "completed", "success"
+	case "failed":
+		return "completed", "failure"
+	case "canceled":
+		return "completed", "cancelled"
+	case "skipped":
+		return "completed", "skipped"
+	default:
+		// created, waiting_for_resource, preparing, pending, scheduled, manual
+		return "queued", ""
+	}
+}
+
+// RunState maps a pipeline status to the state of a job's run
+func RunState(status string) string {
+	switch s, _ := runStatus(status); s {
+	case "completed":
+		return models.RunStateCompleted
+	case "in_progress":
+		return models.RunStateRunning
+	default:
+		return models.RunStateQueued
+	}
+}
+
+// PushEvent is the payload of a push webhook
+type PushEvent struct {
+	Ref     string  `json:"ref"`
+	After   string  `json:"after"`
+	Project Project `json:"project"`
+}
+
+// Branch returns the pushed branch name, or "" for tag pushes
+func (e *PushEvent) Branch() string {
+	if !strings.HasPrefix(e.Ref, "refs/heads/") {
+		return ""
+	}
+	return strings.TrimPrefix(e.Ref, "refs/heads/")
+}
+
+// MergeRequestEvent is the payload of a merge request webhook
+type MergeRequestEvent struct {
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
+	Project Project `json:"project"`
+}
+
+// State returns the state the event left the merge request in, or "" when
+// it did not merge, close or reopen it
+func (e *MergeRequestEvent) State() models.PRState {
+	switch e.ObjectAttributes.Action {
+	case "merge":
+		return models.PRStateMerged
+	case "close":
+		return models.PRStateClosed
+	case "reopen":
+		return models.PRStateOpen
+	}
+	return ""
+}
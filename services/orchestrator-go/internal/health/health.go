@@ -0,0 +1,107 @@
+// Package health probes the dependencies the orchestrator needs to work:
+// the database, the queue backend, the GitHub API and the worktree disk.
+// Results are cached briefly so frequent polling does not hit them.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Probe checks one dependency, returning nil when it is usable
+type Probe func(ctx context.Context) error
+
+type check struct {
+	name  string
+	probe Probe
+	// readiness checks also decide whether the process takes traffic
+	readiness bool
+}
+
+// Checker runs the registered probes concurrently, each bounded by a
+// timeout, and serves their results for a while before running them again
+type Checker struct {
+	timeout time.Duration
+	ttl     time.Duration
+	checks  []check
+
+	mu      sync.Mutex
+	results []models.HealthCheck
+	ranAt   time.Time
+}
+
+// NewChecker creates a checker whose probes time out after timeout and
+// whose results are reused for ttl
+func NewChecker(timeout, ttl time.Duration) *Checker {
+	return &Checker{timeout: timeout, ttl: ttl}
+}
+
+// Add registers a probe. Probes are added before the checker is used.
+func (c *Checker) Add(name string, probe Probe) {
+	c.checks = append(c.checks, check{name: name, probe: probe})
+}
+
+// AddReadiness registers a probe the process is not ready without
+func (c *Checker) AddReadiness(name string, probe Probe) {
+	c.checks = append(c.checks, check{name: name, probe: probe, readiness: true})
+}
+
+// Unready returns the failing readiness checks among results from Run
+func (c *Checker) Unready(results []models.HealthCheck) []models.HealthCheck {
+	var failing []models.HealthCheck
+	for i, result := range results {
+		if c.checks[i].readiness && result.Status != models.HealthCheckOK {
+			failing = append(failing, result)
+		}
+	}
+	return failing
+}
+
+// Run returns the result of every probe, in the order they were added
+func (c *Checker) Run(ctx context.Context) []models.HealthCheck {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results != nil && time.Since(c.ranAt) < c.ttl {
+		return c.results
+	}
+
+	results := make([]models.HealthCheck, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := chk.probe(probeCtx)
+			results[i] = models.HealthCheck{
+				Name:       chk.name,
+				Status:     models.HealthCheckOK,
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				results[i].Status = models.HealthCheckFailing
+				results[i].Error = err.Error()
+			}
+		}(i, chk)
+	}
+	wg.Wait()
+
+	c.results, c.ranAt = results, time.Now()
+	return results
+}
+
+// Healthy reports whether every check passed
+func Healthy(results []models.HealthCheck) bool {
+	for _, result := range results {
+		if result.Status != models.HealthCheckOK {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+// Package ids generates and validates job IDs
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Generator returns a new unique ID
+type Generator func() string
+
+// Formats accepted by New
+const (
+	FormatUUID   = "uuid"   // random UUIDv4
+	FormatUUIDv7 = "uuidv7" // time-ordered UUIDv7
+	FormatULID   = "ulid"   // time-ordered ULID
+)
+
+// MaxLength is the longest client-supplied ID accepted
+const MaxLength = 64
+
+// New returns the generator for an ID format. UUIDv7 and ULID IDs sort by
+// creation time, which keeps database indexes on them append-mostly.
+func New(format string) (Generator, error) {
+	switch format {
+	case FormatUUID, "":
+		return NewUUID, nil
+	case FormatUUIDv7:
+		return NewUUIDv7, nil
+	case FormatULID:
+		return NewULID, nil
+	default:
+		return nil, fmt.Errorf("unknown ID format: %s", format)
+	}
+}
+
+// NewUUID returns a random UUIDv4
+func NewUUID() string {
+	return uuid.New().String()
+}
+
+// NewUUIDv7 returns a UUIDv7, falling back to a UUIDv4 if the system's
+// randomness source fails
+func NewUUIDv7() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return NewUUID()
+	}
+	return id.String()
+}
+
+// crockford is the ULID alphabet (Crockford's base32)
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu      sync.Mutex
+	ulidLastMS  uint64
+	ulidLastRnd [10]byte
+)
+
+// NewULID returns a ULID: a 48-bit millisecond timestamp followed by 80
+// random bits. IDs generated within the same millisecond increment the
+// random part so they still sort in generation order.
+func NewULID() string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= ulidLastMS {
+		ms = ulidLastMS
+		for i := len(ulidLastRnd) - 1; i >= 0; i-- {
+			ulidLastRnd[i]++
+			if ulidLastRnd[i] != 0 {
+				break
+			}
+		}
+	} else if _, err := rand.Read(ulidLastRnd[:]); err != nil {
+		return NewUUID()
+	}
+	ulidLastMS = ms
+
+	var raw [16]byte
+	binary.BigEndian.PutUint16(raw[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(raw[2:6], uint32(ms))
+	copy(raw[6:], ulidLastRnd[:])
+
+	// 128 bits as 26 base32 digits, the first carrying only 3 bits
+	hi := binary.BigEndian.Uint64(raw[0:8])
+	lo := binary.BigEndian.Uint64(raw[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Valid reports whether a client-supplied ID is acceptable: 1 to MaxLength
+// letters, digits, '-' or '_', so it is safe in URLs, branch names and
+// workflow run names
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Suffix returns the last n characters of an ID, or all of it if shorter.
+// The tail is the random part of every generated format, unlike the head of
+// time-ordered IDs, which is shared by IDs created around the same time.
+func Suffix(id string, n int) string {
+	if len(id) <= n {
+		return id
+	}
+	return id[len(id)-n:]
+}
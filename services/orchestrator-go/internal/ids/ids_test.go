@@ -0,0 +1,58 @@
+package ids
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewULIDSortsInGenerationOrder(t *testing.T) {
+	// Most of these fall in the same millisecond, which increments the
+	// random part
+	generated := make([]string, 1000)
+	for i := range generated {
+		generated[i] = NewULID()
+	}
+
+	sorted := append([]string(nil), generated...)
+	sort.Strings(sorted)
+	for i := range generated {
+		if sorted[i] != generated[i] {
+			t.Fatalf("ULID %d sorts at %d: %s", i, sort.SearchStrings(sorted, generated[i]), generated[i])
+		}
+	}
+	for i := 1; i < len(generated); i++ {
+		if generated[i] == generated[i-1] {
+			t.Fatalf("ULID %d repeats %s", i, generated[i])
+		}
+	}
+}
+
+func TestNewULIDFormat(t *testing.T) {
+	id := NewULID()
+	if len(id) != 26 {
+		t.Fatalf("ULID %s has %d characters, want 26", id, len(id))
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("ULID %s has %q outside Crockford's base32", id, c)
+		}
+	}
+	// 128 bits leave the first digit 3 bits
+	if id[0] > '7' {
+		t.Fatalf("ULID %s overflows 128 bits", id)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, id := range []string{"job-1", "01J9Z3K8T6_ab", strings.Repeat("a", MaxLength)} {
+		if !Valid(id) {
+			t.Errorf("Valid(%q) = false, want true", id)
+		}
+	}
+	for _, id := range []string{"", strings.Repeat("a", MaxLength+1), "job/1", "job 1", "job.1", "jöb"} {
+		if Valid(id) {
+			t.Errorf("Valid(%q) = true, want false", id)
+		}
+	}
+}
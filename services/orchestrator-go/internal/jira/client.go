@@ -0,0 +1,192 @@
+// Package jira keeps the Jira issues of jobs' tickets up to date: it
+// comments on an issue as its job moves along and transitions the issue to
+// the status its project maps each step to.
+package jira
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNotConfigured is returned for API calls without Jira credentials
+var ErrNotConfigured = errors.New("jira credentials not configured")
+
+// Client talks to the Jira REST API
+type Client struct {
+	mu         sync.RWMutex
+	cfg        config.JiraConfig
+	httpClient *http.Client
+}
+
+// NewClient creates a Jira client
+func NewClient(cfg config.JiraConfig) *Client {
+	return &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// SetConfig replaces the site and credentials API calls are made with, as
+// when the API token is rotated
+func (c *Client) SetConfig(cfg config.JiraConfig) {
+	c.mu.Lock()
+	c.cfg = cfg
+	c.mu.Unlock()
+}
+
+// Name returns jira, the tracker type projects select Jira by
+func (c *Client) Name() string {
+	return models.TrackerJira
+}
+
+// Configured reports whether API calls can be made
+func (c *Client) Configured() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.URL != "" && c.cfg.APIToken != ""
+}
+
+// UpdateIssue comments on the issue and moves it to the update's status,
+// when it names one. The comment is made first so it is kept when the
+// issue cannot be moved.
+func (c *Client) UpdateIssue(ctx context.Context, update models.TicketUpdate) (err error) {
+	ctx, span := tracing.Start(ctx, "jira.update_issue",
+		attribute.String("job.id", update.JobID),
+		attribute.String("jira.issue", update.IssueID),
+		attribute.String("jira.event", update.Event),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if update.Comment != "" {
+		if err := c.AddComment(ctx, update.IssueID, update.Comment); err != nil {
+			return fmt.Errorf("failed to comment on %s: %w", update.IssueID, err)
+		}
+	}
+	if update.Status != "" {
+		if err := c.Transition(ctx, update.IssueID, update.Status); err != nil {
+			return fmt.Errorf("failed to move %s to %q: %w", update.IssueID, update.Status, err)
+		}
+	}
+	return nil
+}
+
+// AddComment adds a comment to an issue
+func (c *Client) AddComment(ctx context.Context, issue, body string) error {
+	return c.doJSON(ctx, http.MethodPost, issuePath(issue)+"/comment", map[string]string{"body": body}, nil)
+}
+
+// Transition moves an issue to status, through the transition of that name
+// or the one leading to that status. An issue already in status is left
+// alone.
+func (c *Client) Transition(ctx context.Context, issue, status string) error {
+	var resp struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, issuePath(issue)+"/transitions", nil, &resp); err != nil {
+		return err
+	}
+	for _, t := range resp.Transitions {
+		if strings.EqualFold(t.Name, status) || strings.EqualFold(t.To.Name, status) {
+			req := map[string]interface{}{"transition": map[string]string{"id": t.ID}}
+			return c.doJSON(ctx, http.MethodPost, issuePath(issue)+"/transitions", req, nil)
+		}
+	}
+
+	var current struct {
+		Fields struct {
+			Status struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, issuePath(issue)+"?fields=status", nil, &current); err != nil {
+		return err
+	}
+	if strings.EqualFold(current.Fields.Status.Name, status) {
+		return nil
+	}
+	return fmt.Errorf("no transition to %q from %q", status, current.Fields.Status.Name)
+}
+
+// issuePath is the API path of an issue by key or ID
+func issuePath(issue string) string {
+	return "/rest/api/2/issue/" + url.PathEscape(issue)
+}
+
+// doJSON performs an authenticated API request with a JSON body, decoding
+// the JSON response into out
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+	c.mu.RLock()
+	cfg := c.cfg
+	c.mu.RUnlock()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cfg.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cfg.Email != "" {
+		req.SetBasicAuth(cfg.Email, cfg.APIToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// APIError is a non-2xx response from the Jira API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("jira api error %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,276 @@
+package joblog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+)
+
+// segmentExt ends every segment name; the rest of the name is its creation
+// time in nanoseconds, zero-padded so names sort chronologically
+const segmentExt = ".log"
+
+// FileStore keeps job logs on local disk, one directory per job
+type FileStore struct {
+	dir         string
+	segmentSize int64
+	maxSegments int
+
+	mu      sync.Mutex
+	current map[string]*segment // jobID -> segment being written
+
+	// closed is called, with the lock held, for each segment that will
+	// receive no more output
+	closed func(jobID, name string)
+}
+
+type segment struct {
+	name string
+	size int64
+}
+
+// NewFileStore creates a store under dir. A job's segments are rotated at
+// segmentSize bytes and at most maxSegments are kept.
+func NewFileStore(dir string, segmentSize int64, maxSegments int) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if maxSegments < 1 {
+		maxSegments = 1
+	}
+	return &FileStore{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxSegments: maxSegments,
+		current:     make(map[string]*segment),
+	}, nil
+}
+
+// Append adds output to the job's current segment, starting a new segment
+// when it would grow past the segment size
+func (s *FileStore) Append(ctx context.Context, jobID string, data []byte) error {
+	if !ids.Valid(jobID) {
+		return ErrInvalidJobID
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg, err := s.segmentFor(jobID)
+	if err != nil {
+		return err
+	}
+	if seg == nil || (seg.size > 0 && seg.size+int64(len(data)) > s.segmentSize) {
+		if seg, err = s.rotate(jobID, seg); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.segmentPath(jobID, seg.name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(data)
+	seg.size += int64(n)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Open returns the job's segments on disk, oldest first
+func (s *FileStore) Open(ctx context.Context, jobID string) (io.ReadCloser, error) {
+	if !ids.Valid(jobID) {
+		return nil, ErrInvalidJobID
+	}
+	names, err := s.segmentsLocked(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := &multiReader{}
+	for _, name := range names {
+		path := s.segmentPath(jobID, name)
+		r.open = append(r.open, func() (io.ReadCloser, error) { return os.Open(path) })
+	}
+	return r, nil
+}
+
+// Finish closes the job's current segment
+func (s *FileStore) Finish(ctx context.Context, jobID string) error {
+	if !ids.Valid(jobID) {
+		return ErrInvalidJobID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seg, ok := s.current[jobID]; ok && s.closed != nil {
+		s.closed(jobID, seg.name)
+	}
+	delete(s.current, jobID)
+	return nil
+}
+
+// List describes the job logs on disk
+func (s *FileStore) List(ctx context.Context) ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var infos []Info
+	for _, e := range entries {
+		if !e.IsDir() || !ids.Valid(e.Name()) {
+			continue
+		}
+		info, err := s.info(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if info.Size > 0 || !info.UpdatedAt.IsZero() {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// Delete removes a job's segments from disk
+func (s *FileStore) Delete(ctx context.Context, jobID string) (int64, error) {
+	if !ids.Valid(jobID) {
+		return 0, ErrInvalidJobID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.info(jobID)
+	if err != nil {
+		return 0, err
+	}
+	delete(s.current, jobID)
+	return info.Size, os.RemoveAll(filepath.Join(s.dir, jobID))
+}
+
+// info totals a job's segments on disk
+func (s *FileStore) info(jobID string) (Info, error) {
+	info := Info{JobID: jobID}
+	names, err := s.segments(jobID)
+	if err != nil {
+		return info, err
+	}
+	for _, name := range names {
+		fi, err := os.Stat(s.segmentPath(jobID, name))
+		if err != nil {
+			continue
+		}
+		info.Size += fi.Size()
+		if fi.ModTime().After(info.UpdatedAt) {
+			info.UpdatedAt = fi.ModTime()
+		}
+	}
+	return info, nil
+}
+
+// segmentFor returns the segment being written for a job, picking up the
+// newest segment on disk after a restart. It returns nil if there is none.
+func (s *FileStore) segmentFor(jobID string) (*segment, error) {
+	if seg, ok := s.current[jobID]; ok {
+		return seg, nil
+	}
+	names, err := s.segments(jobID)
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	last := names[len(names)-1]
+	info, err := os.Stat(s.segmentPath(jobID, last))
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{name: last, size: info.Size()}
+	s.current[jobID] = seg
+	return seg, nil
+}
+
+// rotate closes the job's current segment, if any, starts a new one and
+// drops the oldest segments beyond the limit
+func (s *FileStore) rotate(jobID string, prev *segment) (*segment, error) {
+	if err := os.MkdirAll(filepath.Join(s.dir, jobID), 0755); err != nil {
+		return nil, err
+	}
+	if prev != nil && s.closed != nil {
+		s.closed(jobID, prev.name)
+	}
+
+	seg := &segment{name: segmentName(time.Now())}
+	if prev != nil && seg.name <= prev.name {
+		seg.name = segmentName(time.Unix(0, segmentTime(prev.name)+1))
+	}
+	s.current[jobID] = seg
+
+	names, err := s.segments(jobID)
+	if err != nil {
+		return nil, err
+	}
+	for len(names) >= s.maxSegments {
+		os.Remove(s.segmentPath(jobID, names[0]))
+		names = names[1:]
+	}
+	return seg, nil
+}
+
+// segments lists a job's segment names on disk, oldest first
+func (s *FileStore) segments(jobID string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, jobID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentExt) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *FileStore) segmentPath(jobID, name string) string {
+	return filepath.Join(s.dir, jobID, name)
+}
+
+func segmentName(t time.Time) string {
+	return fmt.Sprintf("%019d%s", t.UnixNano(), segmentExt)
+}
+
+func segmentTime(name string) int64 {
+	var ns int64
+	fmt.Sscanf(strings.TrimSuffix(name, segmentExt), "%d", &ns)
+	return ns
+}
+
+// segmentsLocked lists a job's segment names on disk, taking the lock
+func (s *FileStore) segmentsLocked(jobID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.segments(jobID)
+}
@@ -0,0 +1,119 @@
+// Package joblog persists the output of each job: agent output uploaded by
+// its workflow, git output from preparing its worktree, and the orchestrator's
+// dispatch and result records. Logs are split into segments of a bounded
+// size, and only the newest segments of a job are kept.
+package joblog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/awsauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+)
+
+// ErrNotFound is returned when a job has no stored log
+var ErrNotFound = errors.New("job log not found")
+
+// ErrInvalidJobID is returned for job IDs that are unsafe as file or object names
+var ErrInvalidJobID = errors.New("invalid job ID for log storage")
+
+// Store keeps job logs
+type Store interface {
+	// Append adds output to the end of a job's log
+	Append(ctx context.Context, jobID string, data []byte) error
+	// Open returns a job's retained log, oldest output first
+	Open(ctx context.Context, jobID string) (io.ReadCloser, error)
+	// Finish closes the job's current segment once no more output is expected
+	Finish(ctx context.Context, jobID string) error
+	// List describes every stored job log
+	List(ctx context.Context) ([]Info, error)
+	// Delete removes a job's log, returning how many bytes it freed
+	Delete(ctx context.Context, jobID string) (int64, error)
+}
+
+// Info describes a stored job log
+type Info struct {
+	JobID string
+	Size  int64
+	// UpdatedAt is when the log was last written
+	UpdatedAt time.Time
+}
+
+// New creates the configured log store. It returns nil when job logs are
+// not kept.
+func New(cfg config.JobLogConfig, creds awsauth.Credentials) (Store, error) {
+	switch cfg.Store {
+	case "none":
+		return nil, nil
+	case "s3":
+		return NewS3Store(cfg, creds)
+	default:
+		return NewFileStore(cfg.Dir, cfg.SegmentSize, cfg.MaxSegments)
+	}
+}
+
+// Line formats one orchestrator log record, tagged with where it came from
+func Line(source, format string, args ...interface{}) []byte {
+	return []byte(time.Now().UTC().Format(time.RFC3339) + " [" + source + "] " + fmt.Sprintf(format, args...) + "\n")
+}
+
+type writerKey struct{}
+
+// WithWriter returns ctx carrying w, so code deep in a job's execution path
+// can add its output to the job's log
+func WithWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, writerKey{}, w)
+}
+
+// Writer returns the log writer in ctx, or one that discards output
+func Writer(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(writerKey{}).(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
+
+// multiReader reads segments one after another, opening each only when the
+// previous one is exhausted
+type multiReader struct {
+	open    []func() (io.ReadCloser, error)
+	current io.ReadCloser
+}
+
+func (m *multiReader) Read(p []byte) (int, error) {
+	for {
+		if m.current == nil {
+			if len(m.open) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := m.open[0]()
+			m.open = m.open[1:]
+			if err != nil {
+				return 0, err
+			}
+			m.current = rc
+		}
+
+		n, err := m.current.Read(p)
+		if err == io.EOF {
+			m.current.Close()
+			m.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (m *multiReader) Close() error {
+	if m.current != nil {
+		return m.current.Close()
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package joblog
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/awsauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/rs/zerolog/log"
+)
+
+// S3Store spools job logs to local disk and uploads each finished segment
+// to an S3-compatible bucket as <prefix><jobID>/<segment>. Reads combine
+// uploaded segments with those still on disk.
+type S3Store struct {
+	spool       *FileStore
+	client      *http.Client
+	endpoint    string // scheme://host, objects are addressed path-style
+	bucket      string
+	region      string
+	prefix      string
+	creds       awsauth.Credentials
+	maxSegments int
+}
+
+// NewS3Store creates a store uploading to the configured bucket
+func NewS3Store(cfg config.JobLogConfig, creds awsauth.Credentials) (*S3Store, error) {
+	if !creds.Valid() {
+		return nil, fmt.Errorf("s3 job logs require AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	spool, err := NewFileStore(cfg.Dir, cfg.SegmentSize, cfg.MaxSegments)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := cfg.S3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.S3Region + ".amazonaws.com"
+	}
+	s := &S3Store{
+		spool:       spool,
+		client:      &http.Client{Timeout: 60 * time.Second},
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		bucket:      cfg.S3Bucket,
+		region:      cfg.S3Region,
+		prefix:      cfg.S3Prefix,
+		creds:       creds,
+		maxSegments: spool.maxSegments,
+	}
+	spool.closed = s.segmentClosed
+	return s, nil
+}
+
+// Append adds output to the job's spooled segment
+func (s *S3Store) Append(ctx context.Context, jobID string, data []byte) error {
+	return s.spool.Append(ctx, jobID, data)
+}
+
+// Finish uploads the job's spooled segment
+func (s *S3Store) Finish(ctx context.Context, jobID string) error {
+	return s.spool.Finish(ctx, jobID)
+}
+
+// Open returns the job's uploaded segments followed by those still spooled
+func (s *S3Store) Open(ctx context.Context, jobID string) (io.ReadCloser, error) {
+	if !ids.Valid(jobID) {
+		return nil, ErrInvalidJobID
+	}
+
+	local, err := s.spool.segmentsLocked(jobID)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := s.list(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A segment can be in both places while its upload is in flight
+	names := append([]string(nil), remote...)
+	isLocal := make(map[string]bool)
+	for _, name := range local {
+		isLocal[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := &multiReader{}
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		name := name
+		path := s.spool.segmentPath(jobID, name)
+		r.open = append(r.open, func() (io.ReadCloser, error) {
+			if isLocal[name] {
+				f, err := os.Open(path)
+				if err == nil || !os.IsNotExist(err) {
+					return f, err
+				}
+				// Uploaded and removed since the listing
+			}
+			return s.get(ctx, s.key(jobID, name))
+		})
+	}
+	return r, nil
+}
+
+// segmentClosed reads a finished segment and uploads it in the background,
+// removing the spooled copy once it is stored. It runs with the spool's
+// lock held, before rotation may delete the file.
+func (s *S3Store) segmentClosed(jobID, name string) {
+	path := s.spool.segmentPath(jobID, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to read job log segment for upload")
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		if err := s.put(ctx, s.key(jobID, name), data); err != nil {
+			log.Error().Err(err).Str("job_id", jobID).Str("segment", name).Msg("Failed to upload job log segment, keeping it on disk")
+			return
+		}
+		s.spool.mu.Lock()
+		if seg, ok := s.spool.current[jobID]; !ok || seg.name != name {
+			os.Remove(path)
+		}
+		s.spool.mu.Unlock()
+
+		s.prune(ctx, jobID)
+	}()
+}
+
+// prune deletes the oldest uploaded segments beyond the per-job limit
+func (s *S3Store) prune(ctx context.Context, jobID string) {
+	names, err := s.list(ctx, jobID)
+	if err != nil {
+		log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to list job log segments")
+		return
+	}
+	for len(names) > s.maxSegments {
+		if err := s.delete(ctx, s.key(jobID, names[0])); err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to delete old job log segment")
+			return
+		}
+		names = names[1:]
+	}
+}
+
+// List describes the uploaded job logs together with those still spooled
+func (s *S3Store) List(ctx context.Context) ([]Info, error) {
+	objects, err := s.listObjects(ctx, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	local, err := s.spool.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byJob := make(map[string]*Info)
+	for _, obj := range objects {
+		jobID, name, ok := strings.Cut(strings.TrimPrefix(obj.Key, s.prefix), "/")
+		if !ok || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		info, ok := byJob[jobID]
+		if !ok {
+			info = &Info{JobID: jobID}
+			byJob[jobID] = info
+		}
+		info.Size += obj.Size
+		if obj.LastModified.After(info.UpdatedAt) {
+			info.UpdatedAt = obj.LastModified
+		}
+	}
+	// A segment being uploaded is briefly counted twice
+	for _, l := range local {
+		info, ok := byJob[l.JobID]
+		if !ok {
+			info = &Info{JobID: l.JobID}
+			byJob[l.JobID] = info
+		}
+		info.Size += l.Size
+		if l.UpdatedAt.After(info.UpdatedAt) {
+			info.UpdatedAt = l.UpdatedAt
+		}
+	}
+
+	infos := make([]Info, 0, len(byJob))
+	for _, info := range byJob {
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// Delete removes a job's uploaded and spooled segments
+func (s *S3Store) Delete(ctx context.Context, jobID string) (int64, error) {
+	if !ids.Valid(jobID) {
+		return 0, ErrInvalidJobID
+	}
+	freed, err := s.spool.Delete(ctx, jobID)
+	if err != nil {
+		return freed, err
+	}
+	objects, err := s.listObjects(ctx, s.key(jobID, ""))
+	if err != nil {
+		return freed, err
+	}
+	for _, obj := range objects {
+		if err := s.delete(ctx, obj.Key); err != nil {
+			return freed, err
+		}
+		freed += obj.Size
+	}
+	return freed, nil
+}
+
+func (s *S3Store) key(jobID, name string) string {
+	return s.prefix + jobID + "/" + name
+}
+
+// list returns the names of a job's uploaded segments, oldest first
+func (s *S3Store) list(ctx context.Context, jobID string) ([]string, error) {
+	prefix := s.key(jobID, "")
+	objects, err := s.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, obj := range objects {
+		if name := strings.TrimPrefix(obj.Key, prefix); strings.HasSuffix(name, segmentExt) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// object is an entry of a bucket listing
+type object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// listObjects lists every object under prefix
+func (s *S3Store) listObjects(ctx context.Context, prefix string) ([]object, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+
+	var objects []object
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents              []object `xml:"Contents"`
+			IsTruncated           bool     `xml:"IsTruncated"`
+			NextContinuationToken string   `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode bucket listing: %w", err)
+		}
+
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	return objects, nil
+}
+
+func (s *S3Store) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for a key in the bucket, or for the bucket
+// itself when key is empty. Non-2xx responses are returned as errors.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := s.endpoint + "/" + s.bucket
+	if key != "" {
+		u += "/" + key
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	awsauth.Sign(req, body, s.creds, s.region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s returned status %d: %s", method, key, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+// Package jobtoken issues and verifies the tokens runs authenticate their
+// callbacks with. A token is an HS256 JWT naming one attempt of one job, so
+// it cannot be used for other jobs or once it expires.
+package jobtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// issuer is the iss claim of every token
+const issuer = "autobuild-orchestrator"
+
+// header is the encoded JWT header of every token
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Verification errors
+var (
+	ErrMalformed = errors.New("malformed callback token")
+	ErrSignature = errors.New("invalid callback token signature")
+	ErrIssuer    = errors.New("callback token has the wrong issuer")
+	ErrExpired   = errors.New("callback token has expired")
+)
+
+// Claims are what a token grants
+type Claims struct {
+	Issuer    string `json:"iss"`
+	JobID     string `json:"sub"`
+	Attempt   int    `json:"attempt"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Issuer signs and verifies tokens with a shared key
+type Issuer struct {
+	ttl time.Duration
+
+	mu  sync.RWMutex
+	key []byte
+	// previous is the key before the last rotation, still accepted until
+	// previousUntil so tokens already issued outlive the rotation
+	previous      []byte
+	previousUntil time.Time
+}
+
+// NewIssuer creates an issuer of tokens valid for ttl
+func NewIssuer(key []byte, ttl time.Duration) *Issuer {
+	return &Issuer{key: key, ttl: ttl}
+}
+
+// Rotate signs tokens with key from now on. Tokens signed with the key it
+// replaces are accepted until they expire.
+func (i *Issuer) Rotate(key []byte) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if hmac.Equal(key, i.key) {
+		return
+	}
+	i.previous, i.previousUntil = i.key, time.Now().Add(i.ttl)
+	i.key = key
+}
+
+// Issue returns a token for an attempt of a job and when it expires
+func (i *Issuer) Issue(jobID string, attempt int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(i.ttl)
+	claims, err := json.Marshal(Claims{
+		Issuer:    issuer,
+		JobID:     jobID,
+		Attempt:   attempt,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return signingInput + "." + sign(i.key, signingInput), expiresAt, nil
+}
+
+// Verify checks a token's signature, issuer and expiry and returns its
+// claims. Callers check the claims name the job being called back for.
+func (i *Issuer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return nil, ErrMalformed
+	}
+	if !i.signedBy(parts[0]+"."+parts[1], parts[2]) {
+		return nil, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if claims.Issuer != issuer {
+		return nil, ErrIssuer
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+// signedBy reports whether signature was made with the current key, or with
+// the previous one while it is still accepted
+func (i *Issuer) signedBy(signingInput, signature string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if hmac.Equal([]byte(signature), []byte(sign(i.key, signingInput))) {
+		return true
+	}
+	return i.previous != nil && time.Now().Before(i.previousUntil) &&
+		hmac.Equal([]byte(signature), []byte(sign(i.previous, signingInput)))
+}
+
+func sign(key []byte, signingInput string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,84 @@
+package jobtoken
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueVerify(t *testing.T) {
+	i := NewIssuer([]byte("key"), time.Hour)
+	token, expiresAt, err := i.Issue("job-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("token expires in %s, want an hour", d)
+	}
+
+	claims, err := i.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.JobID != "job-1" || claims.Attempt != 2 || claims.Issuer != issuer {
+		t.Errorf("claims %+v, want job-1 attempt 2 from %s", claims, issuer)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	valid := NewIssuer([]byte("key"), time.Hour)
+	token, _, err := valid.Issue("job-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := NewIssuer([]byte("key"), -time.Second).Issue("job-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := NewIssuer([]byte("other"), time.Hour).Issue("job-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"job-2","exp":9999999999}`))
+
+	reject := func(what, token string, want error) {
+		t.Helper()
+		if _, err := valid.Verify(token); !errors.Is(err, want) {
+			t.Errorf("Verify of %s = %v, want %v", what, err, want)
+		}
+	}
+	reject("an empty token", "", ErrMalformed)
+	reject("two parts", parts[0]+"."+parts[1], ErrMalformed)
+	reject("another header", "e30."+parts[1]+"."+parts[2], ErrMalformed)
+	reject("another key's token", otherKey, ErrSignature)
+	reject("altered claims", parts[0]+"."+forged+"."+parts[2], ErrSignature)
+	reject("an expired token", expired, ErrExpired)
+}
+
+func TestRotate(t *testing.T) {
+	i := NewIssuer([]byte("old"), time.Hour)
+	before, _, err := i.Issue("job-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.Rotate([]byte("new"))
+	after, _, err := i.Issue("job-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"before": before, "after": after} {
+		if _, err := i.Verify(token); err != nil {
+			t.Errorf("token issued %s the rotation: %v", name, err)
+		}
+	}
+
+	// A second rotation retires the first key
+	i.Rotate([]byte("newer"))
+	if _, err := i.Verify(before); !errors.Is(err, ErrSignature) {
+		t.Errorf("token of a retired key: %v, want %v", err, ErrSignature)
+	}
+}
@@ -0,0 +1,114 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Elector decides which orchestrator instance dispatches jobs. Leadership is
+// a Postgres session-level advisory lock, so it is released automatically if
+// the leader's connection dies.
+type Elector struct {
+	mu       sync.RWMutex
+	cfg      config.LeaderConfig
+	pool     *pgxpool.Pool
+	conn     *pgxpool.Conn // connection holding the lock while leader
+	isLeader bool
+}
+
+// NewElector creates a new leader elector
+func NewElector(cfg config.LeaderConfig, pool *pgxpool.Pool) *Elector {
+	return &Elector{
+		cfg:  cfg,
+		pool: pool,
+	}
+}
+
+// IsLeader reports whether this instance currently holds the lock
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isLeader
+}
+
+// Run campaigns for leadership until the context is cancelled
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		if e.IsLeader() {
+			e.checkLock(ctx)
+		} else {
+			e.tryAcquire(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquire attempts to take the advisory lock without blocking
+func (e *Elector) tryAcquire(ctx context.Context) {
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Leader election: failed to acquire database connection")
+		return
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", e.cfg.LockID).Scan(&acquired); err != nil || !acquired {
+		conn.Release()
+		return
+	}
+
+	e.mu.Lock()
+	e.conn = conn
+	e.isLeader = true
+	e.mu.Unlock()
+
+	log.Info().Int("lock_id", e.cfg.LockID).Msg("Acquired leadership")
+}
+
+// checkLock verifies the lock-holding connection is still alive; losing it
+// means Postgres has already released the lock
+func (e *Elector) checkLock(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.conn.Ping(ctx); err != nil {
+		log.Warn().Err(err).Msg("Lost leadership: lock connection failed")
+		e.conn.Release()
+		e.conn = nil
+		e.isLeader = false
+	}
+}
+
+// release gives up leadership so a follower can take over immediately
+func (e *Elector) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	e.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", e.cfg.LockID)
+	e.conn.Release()
+	e.conn = nil
+	e.isLeader = false
+
+	log.Info().Msg("Released leadership")
+}
@@ -0,0 +1,239 @@
+// Package linear keeps the Linear issues of jobs' tickets up to date through
+// Linear's GraphQL API: it comments on an issue as its job moves along and
+// moves the issue to the workflow state its project maps each step to.
+package linear
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNotConfigured is returned for API calls without a Linear API key
+var ErrNotConfigured = errors.New("linear api key not configured")
+
+// Client talks to the Linear GraphQL API
+type Client struct {
+	mu         sync.RWMutex
+	cfg        config.LinearConfig
+	httpClient *http.Client
+}
+
+// NewClient creates a Linear client
+func NewClient(cfg config.LinearConfig) *Client {
+	return &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// SetConfig replaces the API key calls are made with, as when it is rotated
+func (c *Client) SetConfig(cfg config.LinearConfig) {
+	c.mu.Lock()
+	c.cfg = cfg
+	c.mu.Unlock()
+}
+
+// Name returns linear, the tracker type projects select Linear by
+func (c *Client) Name() string {
+	return models.TrackerLinear
+}
+
+// Configured reports whether API calls can be made
+func (c *Client) Configured() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.APIKey != ""
+}
+
+// UpdateIssue comments on the issue and moves it to the update's state,
+// when it names one. The comment is made first so it is kept when the
+// issue cannot be moved.
+func (c *Client) UpdateIssue(ctx context.Context, update models.TicketUpdate) (err error) {
+	ctx, span := tracing.Start(ctx, "linear.update_issue",
+		attribute.String("job.id", update.JobID),
+		attribute.String("linear.issue", update.IssueID),
+		attribute.String("linear.event", update.Event),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	issue, err := c.getIssue(ctx, update.IssueID)
+	if err != nil {
+		return fmt.Errorf("failed to look up %s: %w", update.IssueID, err)
+	}
+	if update.Comment != "" {
+		if err := c.addComment(ctx, issue.ID, update.Comment); err != nil {
+			return fmt.Errorf("failed to comment on %s: %w", update.IssueID, err)
+		}
+	}
+	if update.Status != "" {
+		if err := c.moveIssue(ctx, issue, update.Status); err != nil {
+			return fmt.Errorf("failed to move %s to %q: %w", update.IssueID, update.Status, err)
+		}
+	}
+	return nil
+}
+
+// issue is the subset of an issue the client uses
+type issue struct {
+	ID    string `json:"id"`
+	State struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Team struct {
+		States struct {
+			Nodes []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"nodes"`
+		} `json:"states"`
+	} `json:"team"`
+}
+
+// getIssue looks an issue up by its identifier ("ENG-123") or ID, with the
+// workflow states of its team
+func (c *Client) getIssue(ctx context.Context, id string) (*issue, error) {
+	const query = `query Issue($id: String!) {
+  issue(id: $id) { id state { name } team { states { nodes { id name } } } }
+}`
+	var data struct {
+		Issue *issue `json:"issue"`
+	}
+	if err := c.do(ctx, query, map[string]interface{}{"id": id}, &data); err != nil {
+		return nil, err
+	}
+	if data.Issue == nil {
+		return nil, fmt.Errorf("issue %s not found", id)
+	}
+	return data.Issue, nil
+}
+
+func (c *Client) addComment(ctx context.Context, issueID, body string) error {
+	const query = `mutation Comment($issueId: String!, $body: String!) {
+  commentCreate(input: { issueId: $issueId, body: $body }) { success }
+}`
+	var data struct {
+		CommentCreate struct {
+			Success bool `json:"success"`
+		} `json:"commentCreate"`
+	}
+	if err := c.do(ctx, query, map[string]interface{}{"issueId": issueID, "body": body}, &data); err != nil {
+		return err
+	}
+	if !data.CommentCreate.Success {
+		return errors.New("comment not created")
+	}
+	return nil
+}
+
+// moveIssue moves an issue to its team's workflow state named state. An
+// issue already in that state is left alone.
+func (c *Client) moveIssue(ctx context.Context, iss *issue, state string) error {
+	if strings.EqualFold(iss.State.Name, state) {
+		return nil
+	}
+	var stateID string
+	for _, s := range iss.Team.States.Nodes {
+		if strings.EqualFold(s.Name, state) {
+			stateID = s.ID
+			break
+		}
+	}
+	if stateID == "" {
+		return fmt.Errorf("the issue's team has no state %q", state)
+	}
+
+	const query = `mutation Move($id: String!, $stateId: String!) {
+  issueUpdate(id: $id, input: { stateId: $stateId }) { success }
+}`
+	var data struct {
+		IssueUpdate struct {
+			Success bool `json:"success"`
+		} `json:"issueUpdate"`
+	}
+	if err := c.do(ctx, query, map[string]interface{}{"id": iss.ID, "stateId": stateID}, &data); err != nil {
+		return err
+	}
+	if !data.IssueUpdate.Success {
+		return errors.New("issue not updated")
+	}
+	return nil
+}
+
+// do performs an authenticated GraphQL request, decoding the response's
+// data into out
+func (c *Client) do(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+	c.mu.RLock()
+	cfg := c.cfg
+	c.mu.RUnlock()
+
+	payload, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.APIURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	// Personal API keys are sent as they are, OAuth tokens as bearer tokens
+	req.Header.Set("Authorization", cfg.APIKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid linear response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		msgs := make([]string, len(result.Errors))
+		for i, e := range result.Errors {
+			msgs[i] = e.Message
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.Join(msgs, "; ")}
+	}
+	if out != nil {
+		return json.Unmarshal(result.Data, out)
+	}
+	return nil
+}
+
+// APIError is a failed response from the Linear API, or one reporting
+// GraphQL errors
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("linear api error %d: %s", e.StatusCode, e.Message)
+}
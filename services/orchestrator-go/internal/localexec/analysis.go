@@ -0,0 +1,59 @@
+package localexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// reportFile is the name analysis runs write their report to, in a
+// directory of its own outside the worktree
+const reportFile = "report.md"
+
+// runAnalysis runs an analysis job's agent and returns its report. Nothing
+// is committed or pushed: the worktree is checked out detached, and any
+// changes the agent makes to it are left to be discarded with it.
+func (r *Runner) runAnalysis(ctx context.Context, job models.Job, wt *models.Worktree, stop <-chan struct{}, out io.Writer, result *models.JobResult) *models.JobResult {
+	fail := func(err error) *models.JobResult {
+		result.Status = "failure"
+		result.Error = err.Error()
+		return result
+	}
+
+	reportDir, err := os.MkdirTemp("", "autobuild-report-")
+	if err != nil {
+		return fail(fmt.Errorf("failed to create report directory: %w", err))
+	}
+	defer os.RemoveAll(reportDir)
+
+	if err := r.runAgent(ctx, job, wt.Path, reportDir, stop, out); err != nil {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("agent did not finish: %w", ctx.Err()))
+		}
+		// An interrupted agent may still have written a useful report
+		fmt.Fprintf(out, "agent exited: %v\n", err)
+	}
+
+	if changed, err := r.git(ctx, wt.Path, out, "status", "--porcelain"); err == nil && changed != "" {
+		fmt.Fprintln(out, "analysis changed the worktree, discarding the changes")
+	}
+
+	report, err := os.ReadFile(filepath.Join(reportDir, reportFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fail(fmt.Errorf("failed to read report: %w", err))
+	}
+	if strings.TrimSpace(string(report)) == "" {
+		return fail(errors.New("analysis run produced no report"))
+	}
+	fmt.Fprintf(out, "analysis report of %d bytes\n", len(report))
+
+	result.Report = string(report)
+	result.Status = "success"
+	return result
+}
@@ -0,0 +1,130 @@
+package localexec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// workspaceDir is where the worktree is mounted inside containers
+const workspaceDir = "/workspace"
+
+// containerReportDir is where analysis runs' report directory is mounted
+const containerReportDir = "/report"
+
+// runContainer runs the agent command in a container with the worktree
+// bind-mounted. The container runs as this process's user so the files the
+// agent writes can be committed from the host, and it is removed however
+// the run ends. Analysis runs get the worktree read-only and reportDir
+// writable.
+func (r *Runner) runContainer(ctx context.Context, job models.Job, dir, reportDir string, stop <-chan struct{}, out io.Writer) error {
+	image := r.Image(job.ProjectID)
+	if image == "" {
+		return fmt.Errorf("no container image configured for project %s", job.ProjectID)
+	}
+	name := "autobuild-" + job.ID + "-" + fmt.Sprint(job.RetryCount+1)
+
+	// The init process forwards signals to the whole process group, so an
+	// interrupt reaches the agent and not just the shell around it
+	args := []string{"run", "--rm", "--init",
+		"--env", "TINI_KILL_PROCESS_GROUP=1",
+		"--name", name,
+		"--label", "autobuild.job_id=" + job.ID,
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--workdir", workspaceDir,
+		"--env", "HOME=/tmp",
+	}
+	if reportDir != "" {
+		args = append(args,
+			"--volume", dir+":"+workspaceDir+":ro",
+			"--volume", reportDir+":"+containerReportDir,
+			"--env", "AUTOBUILD_REPORT_PATH="+containerReportDir+"/"+reportFile,
+		)
+	} else {
+		args = append(args, "--volume", dir+":"+workspaceDir)
+	}
+	if r.cfg.DockerCPUs != "" {
+		args = append(args, "--cpus", r.cfg.DockerCPUs)
+	}
+	if r.cfg.DockerMemory != "" {
+		args = append(args, "--memory", r.cfg.DockerMemory)
+	}
+	for _, kv := range agentEnv(job) {
+		args = append(args, "--env", kv)
+	}
+	for _, name := range r.cfg.DockerEnv {
+		args = append(args, "--env", name)
+	}
+	if settings, _ := r.projects.Get(job.ProjectID); settings.Egress != nil {
+		egressArgs, revoke, err := r.egressArgs(settings.Egress)
+		if err != nil {
+			return err
+		}
+		defer revoke()
+		args = append(args, egressArgs...)
+	}
+	args = append(args, image, "sh", "-c", r.command(job))
+
+	fmt.Fprintf(out, "$ docker run %s (container %s)\n", image, name)
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Killing the docker client would leave the container running
+	cmd.Cancel = func() error {
+		return removeContainer(name)
+	}
+	cmd.WaitDelay = stopWait
+	defer removeContainer(name)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			fmt.Fprintln(out, "stop requested, interrupting the agent")
+			exec.Command("docker", "kill", "--signal", "INT", name).Run()
+			select {
+			case <-time.After(stopWait):
+				removeContainer(name)
+			case <-done:
+			}
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// egressArgs restricts a container's network to policy. Without allowed
+// hosts it has none; otherwise it runs on the internal egress network and
+// its only way out is the egress proxy, which lets it through to the
+// allowed hosts. The returned function revokes its access to the proxy.
+func (r *Runner) egressArgs(policy *models.EgressPolicy) ([]string, func(), error) {
+	if len(policy.AllowedHosts) == 0 {
+		return []string{"--network", "none"}, func() {}, nil
+	}
+	if r.proxy == nil || r.cfg.DockerEgressNetwork == "" {
+		return nil, nil, fmt.Errorf("project restricts egress but DOCKER_EGRESS_NETWORK and DOCKER_EGRESS_PROXY_LISTEN are not configured")
+	}
+	proxyURL, revoke := r.proxy.Grant(policy.AllowedHosts)
+	args := []string{"--network", r.cfg.DockerEgressNetwork}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		args = append(args, "--env", name+"="+proxyURL)
+	}
+	return args, revoke, nil
+}
+
+// removeContainer force-removes a container; it is a no-op once the
+// container is gone
+func removeContainer(name string) error {
+	return exec.Command("docker", "rm", "--force", name).Run()
+}
@@ -0,0 +1,314 @@
+// Package localexec runs the coding agent on this host for self-hosted
+// setups without GitHub Actions, either as a subprocess inside a job's
+// worktree or in a Docker container with the worktree mounted. It does what
+// the agent workflow does: run the agent, commit and push its changes, and
+// open a pull request, reporting the outcome as a job result.
+package localexec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/egress"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+)
+
+// stopWait is how long an interrupted agent gets to exit before it is killed
+const stopWait = 30 * time.Second
+
+// SettingsSource looks up project settings
+type SettingsSource interface {
+	Get(projectID string) (models.ProjectSettings, bool)
+}
+
+// Runner runs agents locally
+type Runner struct {
+	cfg       config.ExecutorConfig
+	providers *scm.Registry
+	projects  SettingsSource
+	hostname  string
+	proxy     *egress.Proxy
+	messages  *messages.Catalog
+}
+
+// NewRunner creates a runner. Branches are pushed with the credentials of
+// their project's SCM provider, which opens their pull or merge request;
+// branches of unconfigured providers are pushed with git's own credential
+// setup and no request is opened.
+func NewRunner(cfg config.ExecutorConfig, providers *scm.Registry, projects SettingsSource) *Runner {
+	hostname, _ := os.Hostname()
+	return &Runner{cfg: cfg, providers: providers, projects: projects, hostname: hostname}
+}
+
+// SetEgressProxy sets the proxy containers of projects restricting egress
+// connect through. Without it those projects' runs fail unless they allow
+// no egress at all.
+func (r *Runner) SetEgressProxy(proxy *egress.Proxy) {
+	r.proxy = proxy
+}
+
+// SetMessages sets the catalog pull request titles and bodies are rendered
+// from. Without one they are in the built-in English.
+func (r *Runner) SetMessages(catalog *messages.Catalog) {
+	r.messages = catalog
+}
+
+// Executor names how the runner runs agents
+func (r *Runner) Executor() string {
+	if r.cfg.Type == models.ExecutorDocker {
+		return models.ExecutorDocker
+	}
+	return models.ExecutorLocal
+}
+
+// Image returns the container image a project's agents run in, or "" when
+// agents run as plain subprocesses
+func (r *Runner) Image(projectID string) string {
+	if r.cfg.Type != models.ExecutorDocker {
+		return ""
+	}
+	if settings, _ := r.projects.Get(projectID); settings.ExecutorImage != "" {
+		return settings.ExecutorImage
+	}
+	return r.cfg.DockerImage
+}
+
+// Run runs the agent for job in wt, writing the agent's and git's output to
+// out. Closing stop interrupts the agent so it ends after its current step
+// and its partial work is still committed; cancelling ctx kills it.
+func (r *Runner) Run(ctx context.Context, job models.Job, wt *models.Worktree, stop <-chan struct{}, out io.Writer) *models.JobResult {
+	result := &models.JobResult{
+		JobID:       job.ID,
+		TicketID:    job.TicketID,
+		RunID:       r.Executor() + "-" + job.ID + "-" + fmt.Sprint(job.RetryCount+1),
+		RunnerName:  r.hostname,
+		RunnerImage: r.Image(job.ProjectID),
+	}
+	fail := func(err error) *models.JobResult {
+		result.Status = "failure"
+		result.Error = err.Error()
+		return result
+	}
+
+	if wt == nil {
+		return fail(fmt.Errorf("local executor needs a worktree"))
+	}
+
+	base, err := r.git(ctx, wt.Path, out, "rev-parse", "HEAD")
+	if err != nil {
+		return fail(fmt.Errorf("failed to read base commit: %w", err))
+	}
+	result.BaseSHA = base
+
+	if r.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.Timeout)
+		defer cancel()
+	}
+	if job.Kind == models.JobKindAnalysis {
+		return r.runAnalysis(ctx, job, wt, stop, out, result)
+	}
+	if err := r.runAgent(ctx, job, wt.Path, "", stop, out); err != nil {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("agent did not finish: %w", ctx.Err()))
+		}
+		// The agent exits non-zero when interrupted or out of turns; what it
+		// changed is still worth committing, as the workflow does
+		fmt.Fprintf(out, "agent exited: %v\n", err)
+	}
+
+	if _, err := r.git(ctx, wt.Path, out, "add", "-A"); err != nil {
+		return fail(fmt.Errorf("failed to stage changes: %w", err))
+	}
+	if _, err := r.git(ctx, wt.Path, out, "diff", "--staged", "--quiet"); err == nil {
+		result.Status = "no_changes"
+		return result
+	}
+	if _, err := r.git(ctx, wt.Path, out,
+		"-c", "user.name=AutoBuild Agent", "-c", "user.email=autobuild@users.noreply.github.com",
+		"commit", "-m", "feat: "+job.TicketTitle); err != nil {
+		return fail(fmt.Errorf("failed to commit changes: %w", err))
+	}
+	head, err := r.git(ctx, wt.Path, out, "rev-parse", "HEAD")
+	if err != nil {
+		return fail(fmt.Errorf("failed to read head commit: %w", err))
+	}
+	result.HeadSHA = head
+	numstat, err := r.git(ctx, wt.Path, io.Discard, "diff", "--numstat", "--no-renames", base, head)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read diff: %w", err))
+	}
+	result.Diff = parseNumstat(numstat)
+
+	if !r.cfg.LocalPush {
+		result.Status = "success"
+		return result
+	}
+	if err := r.push(ctx, job.ProjectID, wt.Path, job.BranchName, out); err != nil {
+		if gitauth.IsAuth(err) {
+			result.FailureKind = models.FailureKindAuth
+		}
+		return fail(fmt.Errorf("failed to push %s: %w", job.BranchName, err))
+	}
+
+	if p := r.providers.ForProject(job.ProjectID); job.RepoFullName != "" && p != nil && p.Configured() {
+		// The pull request body summarizes the run's changes
+		job.Result = result
+		title, body := r.pullRequest(job)
+		cr, err := p.OpenChangeRequest(ctx, job.RepoFullName, job.BranchName, job.BaseBranch, title, body)
+		if err != nil {
+			return fail(fmt.Errorf("failed to open pull request: %w", err))
+		}
+		result.PRUrl = cr.URL
+		result.PRNumber = cr.Number
+		if p.Name() == models.SCMGitLab {
+			result.MRUrl, result.MRIID = cr.URL, cr.Number
+		}
+		fmt.Fprintf(out, "opened %s change request #%d: %s\n", p.Name(), cr.Number, cr.URL)
+	}
+
+	result.Status = "success"
+	return result
+}
+
+// agentEnv is the job's environment for the agent command
+func agentEnv(job models.Job) []string {
+	return []string{
+		"AUTOBUILD_JOB_ID=" + job.ID,
+		"AUTOBUILD_JOB_KIND=" + string(job.Kind),
+		"AUTOBUILD_TICKET_ID=" + job.TicketID,
+		"AUTOBUILD_TICKET_TITLE=" + job.TicketTitle,
+		"AUTOBUILD_PROMPT=" + job.DispatchPrompt(),
+		"AUTOBUILD_PROJECT_CONTEXT=" + job.ProjectContext,
+	}
+}
+
+// runAgent runs the agent command with the job's prompt in its environment.
+// Analysis runs get reportDir to write their report to.
+func (r *Runner) runAgent(ctx context.Context, job models.Job, dir, reportDir string, stop <-chan struct{}, out io.Writer) error {
+	if r.cfg.Type == models.ExecutorDocker {
+		return r.runContainer(ctx, job, dir, reportDir, stop, out)
+	}
+	return r.runProcess(ctx, job, dir, reportDir, stop, out)
+}
+
+// command is the command a job's agent runs
+func (r *Runner) command(job models.Job) string {
+	if job.Kind == models.JobKindAnalysis {
+		return r.cfg.LocalAnalysisCommand
+	}
+	return r.cfg.LocalCommand
+}
+
+// runProcess runs the agent command as a subprocess. It runs in its own
+// process group so interrupts reach the agent rather than just the shell
+// around it.
+func (r *Runner) runProcess(ctx context.Context, job models.Job, dir, reportDir string, stop <-chan struct{}, out io.Writer) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.command(job))
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), agentEnv(job)...)
+	if reportDir != "" {
+		cmd.Env = append(cmd.Env, "AUTOBUILD_REPORT_PATH="+filepath.Join(reportDir, reportFile))
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = stopWait
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			fmt.Fprintln(out, "stop requested, interrupting the agent")
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+			select {
+			case <-time.After(stopWait):
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			case <-done:
+			}
+		case <-done:
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// push pushes branch, refreshing the credentials and retrying once if the
+// remote rejects them. Projects with a deploy key push with it, the others
+// with their provider's credentials.
+func (r *Runner) push(ctx context.Context, projectID, dir, branch string, out io.Writer) error {
+	var creds gitauth.Credentials
+	if settings, _ := r.projects.Get(projectID); settings.DeployKey != "" {
+		creds = gitauth.DeployKey(settings.DeployKey)
+	} else if p := r.providers.ForProject(projectID); p != nil {
+		creds = p.GitCredentials()
+	}
+	_, err := gitauth.Run(ctx, "push", creds, func(env []string) ([]byte, error) {
+		output, err := r.gitEnv(ctx, dir, out, env, "push", "--force", "origin", branch)
+		return []byte(output), err
+	})
+	return err
+}
+
+// git runs a git command in dir, copying its output to out, and returns
+// its trimmed output
+func (r *Runner) git(ctx context.Context, dir string, out io.Writer, args ...string) (string, error) {
+	return r.gitEnv(ctx, dir, out, nil, args...)
+}
+
+// gitEnv runs a git command with env added to its environment
+func (r *Runner) gitEnv(ctx context.Context, dir string, out io.Writer, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	fmt.Fprintf(out, "$ git %s\n%s", strings.Join(args, " "), output)
+	return strings.TrimSpace(string(output)), err
+}
+
+// parseNumstat reads the output of git diff --numstat. Binary files, which
+// it lists with "-" counts, count no lines.
+func parseNumstat(numstat string) *models.DiffStat {
+	diff := &models.DiffStat{Files: []models.DiffFile{}}
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		added, _ := strconv.Atoi(fields[0])
+		deleted, _ := strconv.Atoi(fields[1])
+		diff.Files = append(diff.Files, models.DiffFile{Path: fields[2], Additions: added, Deletions: deleted})
+	}
+	return diff
+}
+
+// pullRequest renders the title and body of a job's pull request in its
+// project's locale
+func (r *Runner) pullRequest(job models.Job) (string, string) {
+	settings, _ := r.projects.Get(job.ProjectID)
+	data := messages.JobData(&job)
+	return r.messages.Render(settings.Locale, settings.Messages, messages.PRTitle, data),
+		r.messages.Render(settings.Locale, settings.Messages, messages.PRBody, data)
+}
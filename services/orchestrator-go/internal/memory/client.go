@@ -0,0 +1,112 @@
+// Package memory talks to the memory service, which indexes projects' code
+// and keeps what earlier jobs learned. Jobs are dispatched with the context
+// it finds relevant to their ticket, and their outcomes are written back.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Memory types outcomes are recorded as
+const (
+	TypeExecutionSuccess = "execution_success"
+	TypeExecutionFailure = "execution_failure"
+)
+
+// Client calls the memory service API
+type Client struct {
+	cfg        config.MemoryServiceConfig
+	httpClient *http.Client
+}
+
+// NewClient creates a memory service client
+func NewClient(cfg config.MemoryServiceConfig) *Client {
+	return &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: tracing.Transport(http.DefaultTransport)},
+	}
+}
+
+// ProjectContext is code and learned patterns relevant to a task
+type ProjectContext struct {
+	Context  string                   `json:"context"`
+	Sources  []string                 `json:"sources"`
+	Patterns []map[string]interface{} `json:"patterns"`
+}
+
+// Context fetches the project context relevant to a task description
+func (c *Client) Context(ctx context.Context, projectID, task string) (_ *ProjectContext, err error) {
+	ctx, span := tracing.Start(ctx, "memory.context", attribute.String("project.id", projectID))
+	defer func() { tracing.End(span, err) }()
+
+	req := map[string]interface{}{
+		"project_id":       projectID,
+		"task_description": task,
+		"max_tokens":       c.cfg.ContextMaxTokens,
+		"include_patterns": true,
+	}
+	var resp ProjectContext
+	if err := c.post(ctx, "/api/v1/context", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Record stores a memory for a project, such as the outcome of a job
+func (c *Client) Record(ctx context.Context, projectID, ticketID, memoryType string, content map[string]interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "memory.record",
+		attribute.String("project.id", projectID),
+		attribute.String("memory.type", memoryType),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	req := map[string]interface{}{
+		"project_id":  projectID,
+		"memory_type": memoryType,
+		"content":     content,
+	}
+	if ticketID != "" {
+		req["ticket_id"] = ticketID
+	}
+	return c.post(ctx, "/api/v1/memory", req, nil)
+}
+
+// post sends a JSON request, decoding the JSON response into out
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.cfg.URL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("memory service returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,301 @@
+// Package messages renders the user-facing strings of API responses,
+// delivered results and group notifications, and the pull requests local
+// runs open, from a catalog of Go templates. Deployments add locales as
+// JSON files; projects pick a locale and may override single messages.
+package messages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Keys of the catalog's messages
+const (
+	JobQueued          = "job.queued"
+	JobQueuedDuplicate = "job.queued_duplicate"
+	JobLinked          = "job.linked"
+	JobReused          = "job.reused"
+	JobRequeued        = "job.requeued"
+	JobUpdated         = "job.updated"
+
+	ResultSuccess   = "result.success"
+	ResultNoChanges = "result.no_changes"
+	ResultFailure   = "result.failure"
+	ResultCancelled = "result.cancelled"
+
+	GroupComplete       = "group.complete"
+	GroupPartialFailure = "group.partial_failure"
+
+	PRTitle = "pr.title"
+	PRBody  = "pr.body"
+
+	TicketDispatched = "ticket.dispatched"
+	TicketPROpened   = "ticket.pr_opened"
+	TicketNoChanges  = "ticket.no_changes"
+	TicketFailed     = "ticket.failed"
+)
+
+// DefaultLocale is the locale of the built-in messages
+const DefaultLocale = "en"
+
+// builtin are the English messages every other locale falls back to
+var builtin = map[string]string{
+	JobQueued:          "Job queued successfully",
+	JobQueuedDuplicate: "Job queued successfully (probable duplicate of {{.OriginalJobID}})",
+	JobLinked:          "Job linked to the result of job {{.OriginalJobID}}",
+	JobReused:          "Identical to job {{.JobID}}, which is returned instead of queueing another",
+	JobRequeued:        "Job requeued as {{.JobID}}",
+	JobUpdated:         "Job updated",
+
+	ResultSuccess:   "{{.TicketTitle}}: changes are ready for review{{if .PRUrl}} in {{.PRUrl}}{{end}}",
+	ResultNoChanges: "{{.TicketTitle}}: the agent finished without changes",
+	ResultFailure:   "{{.TicketTitle}}: the job failed{{if .Error}}: {{.Error}}{{end}}",
+	ResultCancelled: "{{.TicketTitle}}: the job was cancelled",
+
+	GroupComplete:       "All {{.Total}} jobs of group {{.GroupID}} finished",
+	GroupPartialFailure: "{{.Failed}} of {{.Total}} jobs of group {{.GroupID}} did not complete",
+
+	PRTitle: "[AutoBuild] {{.TicketTitle}}",
+	PRBody: "## AutoBuild Agent Implementation\n\n### Ticket\n**{{.TicketTitle}}**\n\n{{.TicketDescription}}\n\n" +
+		"{{if .Summary}}### Changes\n{{.Summary}}\n\n{{end}}---\n*This PR was automatically generated by AutoBuild Agent*",
+
+	TicketDispatched: "AutoBuild started working on this ticket (job {{.JobID}}){{if .BranchName}} on branch {{.BranchName}}{{end}}",
+	TicketPROpened:   "AutoBuild opened a pull request for this ticket: {{.PRUrl}}",
+	TicketNoChanges:  "AutoBuild finished job {{.JobID}} without changes",
+	TicketFailed:     "AutoBuild job {{.JobID}} failed{{if .Error}}: {{.Error}}{{end}}",
+}
+
+// Data is what message templates are executed with. Each message uses the
+// fields that apply to it.
+type Data struct {
+	JobID             string
+	TicketID          string
+	TicketTitle       string
+	TicketDescription string
+	ProjectID         string
+	BranchName        string
+	// OriginalJobID is the job a duplicate was matched to
+	OriginalJobID string
+	Status        string
+	PRUrl         string
+	PRNumber      int
+	Error         string
+	// Summary counts what a run changed, e.g. "3 files changed, 120
+	// insertions(+), 4 deletions(-)", when it reported its diff
+	Summary string
+	// GroupID, Total and Failed describe a finished group
+	GroupID string
+	Total   int
+	Failed  int
+}
+
+// JobData collects the template fields of a job
+func JobData(job *models.Job) Data {
+	d := Data{
+		JobID:             job.ID,
+		TicketID:          job.TicketID,
+		TicketTitle:       job.TicketTitle,
+		TicketDescription: job.TicketDesc,
+		ProjectID:         job.ProjectID,
+		BranchName:        job.BranchName,
+		OriginalJobID:     job.DuplicateOf,
+		Status:            string(job.Status),
+		Error:             job.ErrorMessage,
+	}
+	if job.Result != nil {
+		d.PRUrl, d.PRNumber = job.Result.PRUrl, job.Result.PRNumber
+		if diff := job.Result.Diff; diff != nil {
+			d.Summary = diffSummary(diff)
+		}
+	}
+	return d
+}
+
+// diffSummary describes a diff as git diff --shortstat does
+func diffSummary(diff *models.DiffStat) string {
+	var added, deleted int
+	for _, f := range diff.Files {
+		added += f.Additions
+		deleted += f.Deletions
+	}
+	files := "files"
+	if len(diff.Files) == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s changed, %d insertions(+), %d deletions(-)", len(diff.Files), files, added, deleted)
+}
+
+// Catalog holds the messages of each locale
+type Catalog struct {
+	defaultLocale string
+	locales       map[string]map[string]*template.Template
+}
+
+// Load reads the locales of dir, one <locale>.json file per locale mapping
+// message keys to templates. Messages a locale leaves out fall back to the
+// default locale's, then to the built-in English ones. An empty dir loads
+// only the built-in messages.
+func Load(dir, defaultLocale string) (*Catalog, error) {
+	c := &Catalog{defaultLocale: defaultLocale, locales: make(map[string]map[string]*template.Template)}
+	if c.defaultLocale == "" {
+		c.defaultLocale = DefaultLocale
+	}
+	builtins, err := parseAll(builtin)
+	if err != nil {
+		return nil, err
+	}
+	c.locales[DefaultLocale] = builtins
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var raw map[string]string
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return nil, fmt.Errorf("invalid message catalog %s: %w", file, err)
+			}
+			if err := Validate(raw); err != nil {
+				return nil, fmt.Errorf("invalid message catalog %s: %w", file, err)
+			}
+			parsed, err := parseAll(raw)
+			if err != nil {
+				return nil, err
+			}
+			locale := strings.TrimSuffix(filepath.Base(file), ".json")
+			if existing, ok := c.locales[locale]; ok {
+				// A file for the built-in locale replaces single messages
+				for key, tmpl := range parsed {
+					existing[key] = tmpl
+				}
+				continue
+			}
+			c.locales[locale] = parsed
+		}
+	}
+
+	if _, ok := c.locales[c.defaultLocale]; !ok {
+		return nil, fmt.Errorf("no messages for the default locale %q", c.defaultLocale)
+	}
+	return c, nil
+}
+
+// Locales lists the locales with messages
+func (c *Catalog) Locales() []string {
+	if c == nil {
+		return []string{DefaultLocale}
+	}
+	locales := make([]string, 0, len(c.locales))
+	for locale := range c.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// HasLocale reports whether the catalog has messages for locale
+func (c *Catalog) HasLocale(locale string) bool {
+	if c == nil {
+		return locale == DefaultLocale
+	}
+	_, ok := c.locales[locale]
+	return ok
+}
+
+// Render renders a message for a project in its locale (the default when
+// empty), preferring the project's overrides. A template that fails to
+// render falls back to the next source, ending with the built-in message.
+// A nil catalog renders the built-in messages.
+func (c *Catalog) Render(locale string, overrides map[string]string, key string, data Data) string {
+	if src, ok := overrides[key]; ok {
+		if tmpl, err := parse(key, src); err == nil {
+			if out, err := execute(tmpl, data); err == nil {
+				return out
+			}
+		}
+	}
+	if c != nil {
+		for _, l := range []string{locale, c.defaultLocale} {
+			if tmpl, ok := c.locales[l][key]; ok {
+				if out, err := execute(tmpl, data); err == nil {
+					return out
+				}
+			}
+		}
+	}
+	tmpl, err := parse(key, builtin[key])
+	if err != nil {
+		return builtin[key]
+	}
+	out, _ := execute(tmpl, data)
+	return out
+}
+
+// Validate checks message overrides: every key must be a known message and
+// every template must render
+func Validate(overrides map[string]string) error {
+	for key, src := range overrides {
+		if _, ok := builtin[key]; !ok {
+			return fmt.Errorf("unknown message %q; messages are: %s", key, strings.Join(Keys(), ", "))
+		}
+		tmpl, err := parse(key, src)
+		if err != nil {
+			return err
+		}
+		if _, err := execute(tmpl, Data{}); err != nil {
+			return fmt.Errorf("message %q does not render: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Keys lists the keys of the catalog's messages
+func Keys() []string {
+	keys := make([]string, 0, len(builtin))
+	for key := range builtin {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseAll(sources map[string]string) (map[string]*template.Template, error) {
+	parsed := make(map[string]*template.Template, len(sources))
+	for key, src := range sources {
+		tmpl, err := parse(key, src)
+		if err != nil {
+			return nil, err
+		}
+		parsed[key] = tmpl
+	}
+	return parsed, nil
+}
+
+func parse(key, src string) (*template.Template, error) {
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for message %q: %w", key, err)
+	}
+	return tmpl, nil
+}
+
+func execute(tmpl *template.Template, data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
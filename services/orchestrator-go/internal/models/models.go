@@ -1,7 +1,11 @@
 package models
 
 import (
+	"strings"
 	"time"
+	"unicode"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/prompt"
 )
 
 // JobPriority represents the priority level of a job
@@ -27,108 +31,1329 @@ const (
 	JobStatusCancelled  JobStatus = "cancelled"
 )
 
+// IsTerminal reports whether a job in this status will not change again
+func (s JobStatus) IsTerminal() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+// JobKind distinguishes full agent runs from follow-up runs on an existing
+// branch and from read-only analyses
+type JobKind string
+
+const (
+	JobKindImplementation JobKind = "implementation"
+	JobKindQARerun        JobKind = "qa_rerun"
+	// JobKindAnalysis runs the agent read-only on the base branch; it
+	// produces a markdown report instead of a branch and pull request
+	JobKindAnalysis JobKind = "analysis"
+)
+
+// QAStatus tracks whether a job's QA result can still be trusted for merging
+type QAStatus string
+
+const (
+	QAStatusPassed    QAStatus = "passed"
+	QAStatusFailed    QAStatus = "failed"
+	QAStatusStale     QAStatus = "stale"
+	QAStatusRerunning QAStatus = "rerunning"
+	// QAStatusPending is a job whose matrix runs have not all reported
+	QAStatusPending QAStatus = "pending"
+)
+
+// PRState is where the pull request a job opened is in its review
+type PRState string
+
+const (
+	PRStateOpen   PRState = "open"
+	PRStateMerged PRState = "merged"
+	PRStateClosed PRState = "closed"
+)
+
+// MatrixEntry is a runner a job's changes are verified on after its run
+// succeeds, e.g. {"name": "macos-arm64", "runs_on": "macos-14"}
+type MatrixEntry struct {
+	Name string `json:"name"`
+	// RunsOn is the runs-on label of the GitHub Actions runner
+	RunsOn string `json:"runs_on"`
+}
+
+// MatrixRun is the QA run of a job on one of its matrix entries
+type MatrixRun struct {
+	MatrixEntry
+	JobID    string   `json:"job_id"`
+	QAStatus QAStatus `json:"qa_status"`
+}
+
+// QACheck is a check a project's successful runs must pass before their
+// jobs complete, e.g. {"name": "lint", "workflow": "lint.yml"}
+type QACheck struct {
+	Name string `json:"name"`
+	// Workflow is the file name of the GitHub Actions workflow run on the
+	// job's branch; it must have a workflow_dispatch trigger
+	Workflow string `json:"workflow"`
+}
+
+// CheckStatus is where one of a job's QA checks is
+type CheckStatus string
+
+const (
+	CheckStatusPending CheckStatus = "pending"
+	CheckStatusPassed  CheckStatus = "passed"
+	CheckStatusFailed  CheckStatus = "failed"
+)
+
+// CheckResult is the outcome of one of a job's QA checks
+type CheckResult struct {
+	QACheck
+	Status CheckStatus `json:"status"`
+	// Conclusion is the conclusion of the check's workflow run, or why it
+	// did not run
+	Conclusion  string     `json:"conclusion,omitempty"`
+	RunID       string     `json:"run_id,omitempty"`
+	RunURL      string     `json:"run_url,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
 // Job represents an agent execution job
 type Job struct {
-	ID           string      `json:"id"`
-	TicketID     string      `json:"ticket_id"`
-	ProjectID    string      `json:"project_id"`
-	Priority     JobPriority `json:"priority"`
-	Status       JobStatus   `json:"status"`
-	WorktreeID   string      `json:"worktree_id,omitempty"`
-	WorkerID     string      `json:"worker_id,omitempty"`
-	Prompt       string      `json:"prompt"`
-	BranchName   string      `json:"branch_name"`
-	BaseBranch   string      `json:"base_branch"`
-	CallbackURL  string      `json:"callback_url"`
-	CallbackSecret string    `json:"callback_secret,omitempty"`
-	RetryCount   int         `json:"retry_count"`
-	ErrorMessage string      `json:"error_message,omitempty"`
-	CreatedAt    time.Time   `json:"created_at"`
-	DispatchedAt *time.Time  `json:"dispatched_at,omitempty"`
-	StartedAt    *time.Time  `json:"started_at,omitempty"`
-	CompletedAt  *time.Time  `json:"completed_at,omitempty"`
+	ID             string      `json:"id"`
+	TicketID       string      `json:"ticket_id"`
+	ProjectID      string      `json:"project_id"`
+	Source         string      `json:"source"`
+	GroupID        string      `json:"group_id,omitempty"`
+	Kind           JobKind     `json:"kind"`
+	ParentJobID    string      `json:"parent_job_id,omitempty"`
+	RetryOf        string      `json:"retry_of,omitempty"`
+	RepoFullName   string      `json:"repo_full_name,omitempty"`
+	Priority       JobPriority `json:"priority"`
+	Status         JobStatus   `json:"status"`
+	WorktreeID     string      `json:"worktree_id,omitempty"`
+	WorkerID       string      `json:"worker_id,omitempty"`
+	RunID          string      `json:"run_id,omitempty"`
+	RunURL         string      `json:"run_url,omitempty"`
+	Prompt         string      `json:"prompt"`
+	TicketTitle    string      `json:"ticket_title,omitempty"`
+	TicketDesc     string      `json:"ticket_description,omitempty"`
+	BranchName     string      `json:"branch_name"`
+	BaseBranch     string      `json:"base_branch"`
+	CallbackURL    string      `json:"callback_url"`
+	CallbackSecret string      `json:"callback_secret,omitempty"`
+	Delivery       *Delivery   `json:"delivery,omitempty"`
+	RetryCount     int         `json:"retry_count"`
+	ErrorMessage   string      `json:"error_message,omitempty"`
+	Fingerprint    string      `json:"fingerprint,omitempty"`
+	DuplicateOf    string      `json:"duplicate_of,omitempty"`
+	Result         *JobResult  `json:"result,omitempty"`
+	QAStatus       QAStatus    `json:"qa_status,omitempty"`
+	QARerunJobID   string      `json:"qa_rerun_job_id,omitempty"`
+	// PRNumber and PRUrl name the pull request the job's run opened, and
+	// PRState follows it from webhooks until it is merged or closed
+	PRNumber     int        `json:"pr_number,omitempty"`
+	PRUrl        string     `json:"pr_url,omitempty"`
+	PRState      PRState    `json:"pr_state,omitempty"`
+	PRResolvedAt *time.Time `json:"pr_resolved_at,omitempty"`
+	// Matrix fans QA out to a run per entry once the job succeeds; its
+	// QA status combines theirs, tracked in MatrixRuns
+	Matrix     []MatrixEntry `json:"matrix,omitempty"`
+	MatrixRuns []MatrixRun   `json:"matrix_runs,omitempty"`
+	// Checks are its project's QA checks on the branch of its successful
+	// run; the job stays running until they have all passed
+	Checks []CheckResult `json:"checks,omitempty"`
+	// RunsOn is the runner label a matrix run dispatches to
+	RunsOn       string       `json:"runs_on,omitempty"`
+	Attempts     []Attempt    `json:"attempts,omitempty"`
+	Events       []JobEvent   `json:"events,omitempty"`
+	Environment  *Environment `json:"environment,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	DispatchedAt *time.Time   `json:"dispatched_at,omitempty"`
+	StartedAt    *time.Time   `json:"started_at,omitempty"`
+	CompletedAt  *time.Time   `json:"completed_at,omitempty"`
+	// TraceParent is the W3C trace context of the request that created the
+	// job; spans for its dispatch and result continue that trace
+	TraceParent string `json:"trace_parent,omitempty"`
+	// StopRequestedAt is when a soft cancel asked the running agent to
+	// finish its current step and push what it has
+	StopRequestedAt *time.Time `json:"stop_requested_at,omitempty"`
+	// BlockedReason says why the scheduler is holding back a pending job
+	BlockedReason string `json:"blocked_reason,omitempty"`
+	// RetainUntil keeps the job's logs past its project's retention policy
+	RetainUntil *time.Time `json:"retain_until,omitempty"`
+	// FailureKind classifies why a failed job failed, when that is known
+	FailureKind string `json:"failure_kind,omitempty"`
+	// ProjectContext is the code and learned patterns the memory service
+	// found relevant to the ticket, fetched before each dispatch
+	ProjectContext string `json:"project_context,omitempty"`
+	// Instructions are its project's standing instructions as of its
+	// latest dispatch
+	Instructions string `json:"instructions,omitempty"`
+	// Credentials are what the current run was dispatched with
+	Credentials *JobCredentials `json:"credentials,omitempty"`
+	// TemplateID is the job template it was submitted with
+	TemplateID string   `json:"template_id,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+	// Executor runs the job in place of its project's executor
+	Executor string `json:"executor,omitempty"`
+	// Vars are the custom variables of its prompt, substituted when it is
+	// dispatched
+	Vars map[string]string `json:"vars,omitempty"`
+	// Deadline is when the job should be done by. DeadlineAtRisk is set
+	// while it is queued so far back that, at the current throughput, it
+	// would finish after its deadline.
+	Deadline       *time.Time `json:"deadline,omitempty"`
+	DeadlineAtRisk bool       `json:"deadline_at_risk,omitempty"`
+}
+
+// JobCredentials are short-lived credentials minted for one run of a job
+// and revoked when it finishes. The tokens themselves are never returned by
+// the API.
+type JobCredentials struct {
+	// RepoToken is an installation token scoped to the job's repository
+	RepoToken          string     `json:"-"`
+	RepoTokenExpiresAt *time.Time `json:"repo_token_expires_at,omitempty"`
+	// CallbackToken authenticates the run's callbacks for this job only
+	CallbackToken          string     `json:"-"`
+	CallbackTokenExpiresAt time.Time  `json:"callback_token_expires_at"`
+	RevokedAt              *time.Time `json:"revoked_at,omitempty"`
+}
+
+// DispatchPrompt is the prompt the agent is given: its project's
+// instructions when it has any, then the job's prompt with its variables
+// substituted, followed by its project context when it has any
+func (j *Job) DispatchPrompt() string {
+	rendered := prompt.Render(j.Prompt, j.PromptVars())
+	if j.Instructions != "" {
+		rendered = "## Project Instructions\n\n" + j.Instructions + "\n\n## Task\n\n" + rendered
+	}
+	if j.ProjectContext == "" {
+		return rendered
+	}
+	return rendered + "\n\n## Project Context\n\n" + j.ProjectContext
+}
+
+// PromptVars are the values of the variables the job's prompt may use: its
+// custom vars, and the builtins taken from its fields
+func (j *Job) PromptVars() map[string]string {
+	vars := make(map[string]string, len(j.Vars)+len(prompt.Builtins))
+	for k, v := range j.Vars {
+		vars[k] = v
+	}
+	vars["ticket_id"] = j.TicketID
+	vars["ticket_title"] = j.TicketTitle
+	vars["project_id"] = j.ProjectID
+	vars["repo"] = j.RepoFullName
+	vars["base_branch"] = j.BaseBranch
+	vars["branch_name"] = j.BranchName
+	return vars
+}
+
+// CancelMode selects how a running job is cancelled
+type CancelMode string
+
+const (
+	// CancelModeHard cancels the workflow run immediately
+	CancelModeHard CancelMode = "hard"
+	// CancelModeSoft lets the agent finish its current step and push its
+	// partial work; the job ends cancelled with that work in its result
+	CancelModeSoft CancelMode = "soft"
+)
+
+// JobControl is what a running job's workflow polls to learn whether it
+// should stop early
+type JobControl struct {
+	JobID string `json:"job_id"`
+	Stop  bool   `json:"stop"`
 }
 
 // JobResult represents the result of a completed job
 type JobResult struct {
-	JobID      string    `json:"job_id"`
-	TicketID   string    `json:"ticket_id"`
-	Status     string    `json:"status"`
-	PRUrl      string    `json:"pr_url,omitempty"`
-	PRNumber   int       `json:"pr_number,omitempty"`
-	QAPassed   bool      `json:"qa_passed"`
-	RunID      string    `json:"run_id,omitempty"`
-	Error      string    `json:"error,omitempty"`
-	ReceivedAt time.Time `json:"received_at"`
+	JobID    string `json:"job_id"`
+	TicketID string `json:"ticket_id"`
+	Status   string `json:"status"`
+	PRUrl    string `json:"pr_url,omitempty"`
+	PRNumber int    `json:"pr_number,omitempty"`
+	QAPassed bool   `json:"qa_passed"`
+	RunID    string `json:"run_id,omitempty"`
+	HeadSHA  string `json:"head_sha,omitempty"`
+	// BaseSHA is the base branch commit the run started from
+	BaseSHA     string    `json:"base_sha,omitempty"`
+	RunnerName  string    `json:"runner_name,omitempty"`
+	RunnerImage string    `json:"runner_image,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ReceivedAt  time.Time `json:"received_at"`
+	// ReportedBy is how the result arrived: callback, webhook or reconcile
+	ReportedBy string `json:"reported_by,omitempty"`
+	// FailureKind classifies a failed run, e.g. auth when git's credentials
+	// were rejected
+	FailureKind string `json:"failure_kind,omitempty"`
+	// Report is the markdown report of an analysis run
+	Report string `json:"report,omitempty"`
+	// MRUrl and MRIID report the merge request of a GitLab project's run.
+	// They are copied to PRUrl and PRNumber when the result is received.
+	MRUrl string `json:"mr_url,omitempty"`
+	MRIID int    `json:"mr_iid,omitempty"`
+	// Diff is what the run changed relative to its base commit
+	Diff *DiffStat `json:"diff,omitempty"`
+	// Split suggests how to divide the ticket when the diff exceeded the
+	// project's limit
+	Split *SplitSuggestion `json:"split_suggestion,omitempty"`
+	// Message summarizes the outcome for people, in the project's locale.
+	// It is only set on delivered results.
+	Message string `json:"message,omitempty"`
+}
+
+// DiffStat lists the files a run changed, as git diff --numstat does
+type DiffStat struct {
+	Files []DiffFile `json:"files"`
+}
+
+// DiffFile is one changed file. Binary files count no lines.
+type DiffFile struct {
+	Path      string `json:"path"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// Lines is the number of added and deleted lines
+func (d *DiffStat) Lines() int {
+	n := 0
+	for _, f := range d.Files {
+		n += f.Additions + f.Deletions
+	}
+	return n
+}
+
+// DiffLimit bounds the size of the changes a job may make
+type DiffLimit struct {
+	// MaxLines and MaxFiles bound the added plus deleted lines and the
+	// changed files; zero leaves either unbounded
+	MaxLines int `json:"max_lines,omitempty"`
+	MaxFiles int `json:"max_files,omitempty"`
+	// Action is fail (the default) to fail jobs over the limit, or flag to
+	// let them succeed with a split suggestion
+	Action string `json:"action,omitempty"`
+	// SuggestSplit lists the areas an oversized diff touched, so the ticket
+	// can be split along them
+	SuggestSplit bool `json:"suggest_split,omitempty"`
+}
+
+// Actions on jobs whose diff exceeds their limit
+const (
+	DiffLimitFail = "fail"
+	DiffLimitFlag = "flag"
+)
+
+// SplitSuggestion is the guidance given when a job's diff exceeded its
+// limit: why, and the areas it touched, largest first
+type SplitSuggestion struct {
+	Reason string        `json:"reason"`
+	Areas  []TouchedArea `json:"areas,omitempty"`
+}
+
+// TouchedArea is a directory a diff changed files in
+type TouchedArea struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Lines int    `json:"lines"`
+}
+
+// Failure kinds of jobs
+const (
+	// FailureKindAuth is a job whose git credentials were rejected, even
+	// after refreshing them; its error names the installation to check
+	FailureKindAuth = "auth"
+	// FailureKindDiskQuota is a job aborted because its worktree grew past
+	// the disk quota
+	FailureKindDiskQuota = "disk_quota"
+	// FailureKindDiffTooLarge is a job whose changes exceeded its diff
+	// limit
+	FailureKindDiffTooLarge = "diff_too_large"
+	// FailureKindBaseBranch is a job whose base branch was missing from
+	// its repository when it was dispatched
+	FailureKindBaseBranch = "base_branch_not_found"
+	// FailureKindQACheck is a job whose run succeeded but one of its
+	// project's QA checks failed or never reported
+	FailureKindQACheck = "qa_check_failed"
+)
+
+// Executor types that run jobs
+const (
+	ExecutorGitHubActions      = "github_actions"
+	ExecutorLocal              = "local"
+	ExecutorDocker             = "docker"
+	ExecutorKubernetes         = "kubernetes"
+	ExecutorGitLabCI           = "gitlab_ci"
+	ExecutorBitbucketPipelines = "bitbucket_pipelines"
+)
+
+// SCM providers hosting projects' repositories
+const (
+	SCMGitHub    = "github"
+	SCMGitLab    = "gitlab"
+	SCMBitbucket = "bitbucket"
+)
+
+// Issue trackers projects' tickets can be kept up to date in
+const (
+	TrackerJira   = "jira"
+	TrackerLinear = "linear"
+)
+
+// Events of a job its ticket's issue is updated on
+const (
+	TicketEventDispatched = "dispatched"
+	TicketEventPROpened   = "pr_opened"
+	TicketEventNoChanges  = "no_changes"
+	TicketEventFailed     = "failed"
+)
+
+// TicketEvents lists the ticket events in the order a job may reach them
+var TicketEvents = []string{TicketEventDispatched, TicketEventPROpened, TicketEventNoChanges, TicketEventFailed}
+
+// TrackerSettings keep the issues of a project's tickets in step with their
+// jobs: each event of a job comments on its ticket's issue and, when
+// Transitions names a status for the event, moves the issue to it
+type TrackerSettings struct {
+	// Type is the issue tracker the project's tickets are in: jira or
+	// linear
+	Type string `json:"type"`
+	// Transitions maps ticket events (dispatched, pr_opened, no_changes,
+	// failed) to the status, or Linear workflow state, issues move to, e.g.
+	// {"pr_opened": "In Review"}
+	Transitions map[string]string `json:"transitions,omitempty"`
+}
+
+// TicketUpdate is what a tracker does to the issue of a job's ticket
+type TicketUpdate struct {
+	Event   string
+	JobID   string
+	IssueID string
+	Comment string
+	// Status is the status the issue moves to, empty to leave it
+	Status string
+}
+
+// States of an executor's run of a job
+const (
+	RunStateQueued    = "queued"
+	RunStateRunning   = "running"
+	RunStateCompleted = "completed"
+	RunStateUnknown   = "unknown"
+)
+
+// RunStatus is where an executor's run of a job is, as the executor sees it
+type RunStatus struct {
+	JobID    string `json:"job_id"`
+	Executor string `json:"executor"`
+	State    string `json:"state"`
+	// Conclusion is how a completed run ended, e.g. success or failure
+	Conclusion string `json:"conclusion,omitempty"`
+	RunID      string `json:"run_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+// Environment records what a job ran with, so runs that behave differently
+// can be compared. It is filled in at dispatch and completed from the
+// runner's webhooks and callback.
+type Environment struct {
+	OrchestratorVersion string   `json:"orchestrator_version"`
+	GitVersion          string   `json:"git_version,omitempty"`
+	Executor            string   `json:"executor"`
+	ExecutorImage       string   `json:"executor_image,omitempty"`
+	RunnerName          string   `json:"runner_name,omitempty"`
+	RunnerLabels        []string `json:"runner_labels,omitempty"`
+	BaseSHA             string   `json:"base_sha,omitempty"`
+}
+
+// Attempt records one finished run of a job. Failed runs are retried up to
+// the configured limit, each retry adding an attempt.
+type Attempt struct {
+	Number      int          `json:"number"`
+	Status      JobStatus    `json:"status"`
+	Prompt      string       `json:"prompt"`
+	RunID       string       `json:"run_id,omitempty"`
+	RunURL      string       `json:"run_url,omitempty"`
+	HeadSHA     string       `json:"head_sha,omitempty"`
+	PRUrl       string       `json:"pr_url,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Environment *Environment `json:"environment,omitempty"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+// JobEvent records one state change of a job: who made it, when, and why.
+// Events are only ever appended. From is empty for the job's creation.
+type JobEvent struct {
+	Seq    int       `json:"seq"`
+	At     time.Time `json:"at"`
+	From   JobStatus `json:"from,omitempty"`
+	To     JobStatus `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// AttemptComparison shows what changed between two attempts of a job
+type AttemptComparison struct {
+	JobID       string   `json:"job_id"`
+	From        *Attempt `json:"from"`
+	To          *Attempt `json:"to"`
+	PromptDiff  string   `json:"prompt_diff"`
+	ChangesDiff string   `json:"changes_diff"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// DeliveryStatus is the state of forwarding a job's result to its callback URL
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// Delivery tracks forwarding a job's result to its callback URL
+type Delivery struct {
+	Status      DeliveryStatus `json:"status"`
+	Attempts    int            `json:"attempts"`
+	LastError   string         `json:"last_error,omitempty"`
+	DeliveredAt *time.Time     `json:"delivered_at,omitempty"`
+}
+
+// WorkflowRunUpdate is a status change for the CI run executing a job
+type WorkflowRunUpdate struct {
+	JobID        string // set when the run name identifies the job
+	RepoFullName string
+	Branch       string
+	RunID        string
+	Status       string // queued, in_progress, completed
+	Conclusion   string // success, failure, cancelled, ... when completed
+	URL          string
+	RunnerName   string   // set by workflow_job events once a runner picks the job up
+	RunnerLabels []string // runs-on labels, set by workflow_job events
+	SCM          string   // provider that reported the run; github when empty
+	Workflow     string   // path of the run's workflow file, set by workflow_run events
 }
 
 // WorktreeStatus represents the status of a worktree
 type WorktreeStatus string
 
 const (
-	WorktreeStatusActive   WorktreeStatus = "active"
-	WorktreeStatusMerging  WorktreeStatus = "merging"
-	WorktreeStatusCleanup  WorktreeStatus = "cleanup"
-	WorktreeStatusDeleted  WorktreeStatus = "deleted"
+	WorktreeStatusActive  WorktreeStatus = "active"
+	WorktreeStatusMerging WorktreeStatus = "merging"
+	WorktreeStatusCleanup WorktreeStatus = "cleanup"
+	WorktreeStatusDeleted WorktreeStatus = "deleted"
+	// WorktreeStatusPooled is a cleaned worktree waiting to be reused by
+	// another of its project's jobs
+	WorktreeStatusPooled WorktreeStatus = "pooled"
 )
 
 // Worktree represents a git worktree
 type Worktree struct {
-	ID         string         `json:"id"`
-	ProjectID  string         `json:"project_id"`
-	TicketID   string         `json:"ticket_id,omitempty"`
-	Path       string         `json:"path"`
-	BranchName string         `json:"branch_name"`
-	Status     WorktreeStatus `json:"status"`
-	CreatedAt  time.Time      `json:"created_at"`
-	LastUsedAt time.Time      `json:"last_used_at"`
-	CleanupAt  *time.Time     `json:"cleanup_at,omitempty"`
+	ID          string         `json:"id"`
+	ProjectID   string         `json:"project_id"`
+	TicketID    string         `json:"ticket_id,omitempty"`
+	Path        string         `json:"path"`
+	BranchName  string         `json:"branch_name"`
+	Status      WorktreeStatus `json:"status"`
+	CreatedAt   time.Time      `json:"created_at"`
+	LastUsedAt  time.Time      `json:"last_used_at"`
+	CleanupAt   *time.Time     `json:"cleanup_at,omitempty"`
+	CopyOnWrite bool           `json:"copy_on_write,omitempty"`
+	// DiskUsageBytes is the size of the worktree's files when last measured
+	DiskUsageBytes int64      `json:"disk_usage_bytes"`
+	DiskCheckedAt  *time.Time `json:"disk_checked_at,omitempty"`
+	// RepoFullName, PRNumber and PRUrl name the pull request a merging
+	// worktree is kept for until it is merged or closed
+	RepoFullName string     `json:"repo_full_name,omitempty"`
+	PRNumber     int        `json:"pr_number,omitempty"`
+	PRUrl        string     `json:"pr_url,omitempty"`
+	MergingAt    *time.Time `json:"merging_at,omitempty"`
+}
+
+// WorktreeMergingRequest marks a worktree as waiting on its pull request
+type WorktreeMergingRequest struct {
+	RepoFullName string `json:"repo_full_name"`
+	PRNumber     int    `json:"pr_number"`
+	PRUrl        string `json:"pr_url,omitempty"`
 }
 
 // QueueStats represents queue statistics
 type QueueStats struct {
-	TotalJobs      int            `json:"total_jobs"`
-	PendingJobs    int            `json:"pending_jobs"`
-	RunningJobs    int            `json:"running_jobs"`
-	CompletedJobs  int            `json:"completed_jobs"`
-	FailedJobs     int            `json:"failed_jobs"`
-	JobsByProject  map[string]int `json:"jobs_by_project"`
-	ActiveWorkers  int            `json:"active_workers"`
-	MaxWorkers     int            `json:"max_workers"`
+	TotalJobs     int            `json:"total_jobs"`
+	PendingJobs   int            `json:"pending_jobs"`
+	RunningJobs   int            `json:"running_jobs"`
+	CompletedJobs int            `json:"completed_jobs"`
+	FailedJobs    int            `json:"failed_jobs"`
+	JobsByProject map[string]int `json:"jobs_by_project"`
+	JobsBySource  map[string]int `json:"jobs_by_source"`
+	ActiveWorkers int            `json:"active_workers"`
+	MaxWorkers    int            `json:"max_workers"`
+	Leader        bool           `json:"leader"`
+	Paused        bool           `json:"paused"`
+	Pause         *QueuePause    `json:"pause,omitempty"`
+	Draining      bool           `json:"draining"`
+	Reservations  []Reservation  `json:"reservations,omitempty"`
+	// PullRequests counts the pull requests of jobs in memory by state:
+	// open, merged or closed
+	PullRequests map[string]int `json:"pull_requests"`
+	// DeadlinesAtRisk counts queued jobs expected to miss their deadlines
+	DeadlinesAtRisk int `json:"deadlines_at_risk"`
+}
+
+// Totals returns the stats without their per-project and per-source
+// breakdowns or reservations, for callers not scoped to any project
+func (s QueueStats) Totals() QueueStats {
+	s.JobsByProject = map[string]int{}
+	s.JobsBySource = map[string]int{}
+	s.Reservations = nil
+	return s
+}
+
+// SchedulerStats describes how the queue manager's dispatch loop performs
+type SchedulerStats struct {
+	Ticks uint64 `json:"ticks"`
+	// TickDuration is how long each pass holds the queue lock
+	TickDuration Histogram `json:"tick_duration"`
+	// LockWait is how long callers wait for the queue lock, by operation
+	LockWait map[string]Histogram `json:"lock_wait"`
+	// QueueLength and ScanLength are the queued jobs listed and the jobs
+	// examined by the latest pass, which stops early once workers run out
+	QueueLength  int    `json:"queue_length"`
+	ScanLength   int    `json:"scan_length"`
+	ScannedTotal uint64 `json:"scanned_total"`
+	Dispatched   uint64 `json:"dispatched"`
+	// Deferrals counts passes that dispatched nothing because a host
+	// resource (disk, load or memory) was short, and DeferredFor is the
+	// resource holding back the latest pass, if any
+	Deferrals   map[string]uint64 `json:"deferrals"`
+	DeferredFor string            `json:"deferred_for,omitempty"`
+}
+
+// Histogram is a snapshot of observed durations in seconds. Bucket counts
+// are cumulative, as in Prometheus.
+type Histogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	// InfExemplar is the exemplar of observations above the last bucket
+	InfExemplar *Exemplar `json:"inf_exemplar,omitempty"`
+}
+
+// HistogramBucket counts observations no greater than UpperBound seconds
+type HistogramBucket struct {
+	UpperBound float64   `json:"le"`
+	Count      uint64    `json:"count"`
+	Exemplar   *Exemplar `json:"exemplar,omitempty"`
+}
+
+// Exemplar links a histogram bucket to the trace of an observation in it
+type Exemplar struct {
+	TraceID   string    `json:"trace_id"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// JobLatencyStats describes how long jobs wait for a worker and run
+type JobLatencyStats struct {
+	// DispatchLatency is how long jobs wait from submission to dispatch
+	DispatchLatency Histogram `json:"dispatch_latency"`
+	// Duration is how long runs take from dispatch to their result, by the
+	// status they end in
+	Duration map[string]Histogram `json:"duration"`
+}
+
+// DrainStatus reports the in-flight work a draining instance is waiting for
+type DrainStatus struct {
+	Draining          bool       `json:"draining"`
+	Drained           bool       `json:"drained"`
+	RunningJobs       int        `json:"running_jobs"`
+	PendingResults    int        `json:"pending_results"`
+	PendingDeliveries int        `json:"pending_deliveries"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+}
+
+// ReconcileRequest selects what an admin reconciliation covers
+type ReconcileRequest struct {
+	// ProjectID limits reconciliation to one project's repositories
+	ProjectID string `json:"project_id,omitempty"`
+	// Repos adds repositories that no job in memory refers to
+	Repos []string `json:"repos,omitempty"`
+	// Fix acts on orphans instead of only reporting them
+	Fix bool `json:"fix,omitempty"`
+	// DeleteBranches also deletes orphaned branches when fixing
+	DeleteBranches bool `json:"delete_branches,omitempty"`
+}
+
+// Kinds of reconciliation findings
+const (
+	OrphanRun    = "orphan_run"    // active workflow run without an unfinished job
+	OrphanJob    = "orphan_job"    // dispatched job without an active workflow run
+	OrphanPR     = "orphan_pr"     // open autobuild pull request without a job
+	OrphanBranch = "orphan_branch" // autobuild branch without a job or pull request
+)
+
+// ReconcileFinding is one mismatch between GitHub and orchestrator state
+type ReconcileFinding struct {
+	Kind      string `json:"kind"`
+	ProjectID string `json:"project_id,omitempty"`
+	Repo      string `json:"repo"`
+	JobID     string `json:"job_id,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	PRNumber  int    `json:"pr_number,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Detail    string `json:"detail"`
+	// Action is what was done about the finding, if anything
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReconcileReport is the outcome of comparing GitHub state with job state
+type ReconcileReport struct {
+	Fixed       bool               `json:"fixed"`
+	Repos       []string           `json:"repos"`
+	Findings    []ReconcileFinding `json:"findings"`
+	Errors      []string           `json:"errors,omitempty"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
+
+// PurgeRequest asks for finished jobs completed more than OlderThan ago
+// (a Go duration such as "720h") to be evicted and purged from the archive
+type PurgeRequest struct {
+	OlderThan string `json:"older_than"`
+}
+
+// ReloadResult reports a configuration reload
+type ReloadResult struct {
+	ReloadedAt time.Time `json:"reloaded_at"`
+	// Changed names the runtime-tunable settings the reload changed
+	Changed []string `json:"changed"`
+}
+
+// PurgeResult reports how many jobs a purge removed
+type PurgeResult struct {
+	Before  time.Time `json:"before"`
+	Evicted int       `json:"evicted"`
+	Purged  int64     `json:"purged"`
+}
+
+// JobRollup aggregates the jobs of one project that finished on one day
+// (UTC). It keeps sums rather than averages so rollups can be combined into
+// weeks and months.
+type JobRollup struct {
+	ProjectID string `json:"project_id"`
+	// Day is the day the jobs finished, as 2006-01-02
+	Day       string `json:"day"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	Cancelled int    `json:"cancelled"`
+	// Attempts counts runs, including retries
+	Attempts int `json:"attempts"`
+	// DurationSeconds sums the jobs' times from submission to completion
+	DurationSeconds    float64 `json:"duration_seconds"`
+	MaxDurationSeconds float64 `json:"max_duration_seconds"`
+	// RunSeconds sums the time runners spent on the jobs' attempts, the
+	// compute they cost
+	RunSeconds float64 `json:"run_seconds"`
+}
+
+// JobStats are recent jobs' throughput, failures, durations and queue waits
+// in buckets of equal length, oldest first, for dashboard graphs
+type JobStats struct {
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	BucketSeconds float64          `json:"bucket_seconds"`
+	ProjectID     string           `json:"project_id,omitempty"`
+	Buckets       []JobStatsBucket `json:"buckets"`
+}
+
+// JobStatsBucket covers the jobs that finished, or were dispatched, from
+// Start until the next bucket's start
+type JobStatsBucket struct {
+	Start     time.Time `json:"start"`
+	Finished  int       `json:"finished"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	Cancelled int       `json:"cancelled"`
+	// FailureRate is the share of finished jobs that failed
+	FailureRate float64 `json:"failure_rate"`
+	// AvgDurationSeconds is how long finished jobs took from dispatch to
+	// completion; jobs cancelled while queued are left out
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+	Dispatched         int     `json:"dispatched"`
+	// AvgWaitSeconds is how long dispatched jobs waited in the queue
+	AvgWaitSeconds float64 `json:"avg_wait_seconds"`
+	// PRsOpened counts finished jobs that opened a pull request, and
+	// PRsMerged and PRsClosed the jobs' pull requests resolved either way
+	PRsOpened int `json:"prs_opened"`
+	PRsMerged int `json:"prs_merged"`
+	PRsClosed int `json:"prs_closed"`
+}
+
+// JobReport is the rolled-up history of finished jobs, in buckets of a
+// day, week or month per project
+type JobReport struct {
+	Interval  string            `json:"interval"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	ProjectID string            `json:"project_id,omitempty"`
+	Buckets   []JobReportBucket `json:"buckets"`
+}
+
+// JobReportBucket is one project's rollups over one interval. Day is the
+// interval's first day.
+type JobReportBucket struct {
+	JobRollup
+	// SuccessRate is the share of completed jobs among those that
+	// completed or failed
+	SuccessRate        float64 `json:"success_rate"`
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+}
+
+// Report intervals
+const (
+	ReportIntervalDay   = "day"
+	ReportIntervalWeek  = "week"
+	ReportIntervalMonth = "month"
+)
+
+// RollupRequest asks for the rollups of a range of days to be recomputed
+type RollupRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RollupResult reports what a rollup run wrote
+type RollupResult struct {
+	Days    int   `json:"days"`
+	Rollups int   `json:"rollups"`
+	Purged  int64 `json:"purged,omitempty"`
+}
+
+// DebugDump is a snapshot of scheduler and worktree state, taken at one
+// instant, for attaching to bug reports
+type DebugDump struct {
+	TakenAt   time.Time          `json:"taken_at"`
+	Queue     QueueDebugState    `json:"queue"`
+	Worktrees WorktreeDebugState `json:"worktrees"`
+}
+
+// QueueDebugState is the queue manager's internal state
+type QueueDebugState struct {
+	Leader   bool        `json:"leader"`
+	Paused   *QueuePause `json:"paused,omitempty"`
+	Draining bool        `json:"draining"`
+	// Order lists queued jobs in the order they will be considered
+	Order []QueuedJobState `json:"order"`
+	// OrderError is set when the queue backend could not be listed
+	OrderError      string         `json:"order_error,omitempty"`
+	ActiveJobs      map[string]int `json:"active_jobs"`
+	ReservedSlots   map[string]int `json:"reserved_slots"`
+	WorkerSlotsHeld int            `json:"worker_slots_held"`
+	WorkerSlotsMax  int            `json:"worker_slots_max"`
+	PendingResults  int64          `json:"pending_results"`
+	JobsByStatus    map[string]int `json:"jobs_by_status"`
+	// Bindings lists unfinished jobs and the worktrees they hold
+	Bindings []WorktreeBinding `json:"bindings"`
+}
+
+// QueuedJobState is a queued job as the scheduler sees it
+type QueuedJobState struct {
+	JobID     string      `json:"job_id"`
+	ProjectID string      `json:"project_id"`
+	Priority  JobPriority `json:"priority"`
+	Status    JobStatus   `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// WorktreeBinding ties an unfinished job to its worktree
+type WorktreeBinding struct {
+	JobID      string    `json:"job_id"`
+	Status     JobStatus `json:"status"`
+	WorktreeID string    `json:"worktree_id,omitempty"`
+}
+
+// WorktreeDebugState is the worktree manager's internal state
+type WorktreeDebugState struct {
+	Worktrees []Worktree        `json:"worktrees"`
+	RepoCache map[string]string `json:"repo_cache"`
+	Templates map[string]string `json:"templates"`
+}
+
+// QueuePause describes why and since when dispatching is paused
+type QueuePause struct {
+	Reason   string    `json:"reason,omitempty"`
+	PausedBy string    `json:"paused_by,omitempty"`
+	PausedAt time.Time `json:"paused_at"`
+}
+
+// Reservation guarantees a project a number of worker slots for a time window
+type Reservation struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	ProjectID string    `json:"project_id"`
+	Slots     int       `json:"slots"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateReservationRequest represents a request to reserve worker slots
+type CreateReservationRequest struct {
+	Name      string    `json:"name"`
+	ProjectID string    `json:"project_id"`
+	Slots     int       `json:"slots"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
 }
 
 // CreateJobRequest represents a request to create a new job
 type CreateJobRequest struct {
-	TicketID       string      `json:"ticket_id"`
-	ProjectID      string      `json:"project_id"`
-	Priority       JobPriority `json:"priority"`
-	Prompt         string      `json:"prompt"`
-	TicketTitle    string      `json:"ticket_title"`
-	TicketDesc     string      `json:"ticket_description"`
-	BaseBranch     string      `json:"base_branch"`
-	RepoFullName   string      `json:"repo_full_name"`
-	CallbackURL    string      `json:"callback_url"`
-	CallbackSecret string      `json:"callback_secret"`
+	// ID is an optional client-supplied job ID, e.g. the submitter's own
+	// record ID; it must be unique. One is generated when omitted.
+	ID             string       `json:"id,omitempty"`
+	TicketID       string       `json:"ticket_id"`
+	ProjectID      string       `json:"project_id"`
+	Priority       *JobPriority `json:"priority,omitempty"` // project default when omitted
+	Prompt         string       `json:"prompt"`
+	TicketTitle    string       `json:"ticket_title"`
+	TicketDesc     string       `json:"ticket_description"`
+	BaseBranch     string       `json:"base_branch"`
+	RepoFullName   string       `json:"repo_full_name"`
+	CallbackURL    string       `json:"callback_url"`
+	CallbackSecret string       `json:"callback_secret"`
+	// Source names the submitting integration (jira, linear, dashboard, ...).
+	// Authenticated submissions use the API token's name instead.
+	Source string `json:"source"`
+	// GroupID collects related jobs, e.g. the tickets of one epic
+	GroupID string `json:"group_id,omitempty"`
+	// Kind is implementation (the default) or analysis
+	Kind JobKind `json:"kind,omitempty"`
+	// Matrix verifies an implementation's changes on each entry's runner
+	Matrix []MatrixEntry `json:"matrix,omitempty"`
+	// Force submits an implementation even while another of the ticket is
+	// unfinished, when both then share the ticket's branch, and a probable
+	// duplicate that would otherwise be reused
+	Force bool `json:"force,omitempty"`
+	// TemplateID names one of the project's job templates; the fields the
+	// submission sets override the template's
+	TemplateID string `json:"template_id,omitempty"`
+	// Labels tag the job for filtering
+	Labels []string `json:"labels,omitempty"`
+	// Executor runs the job in place of its project's executor
+	Executor string `json:"executor,omitempty"`
+	// Vars are custom variables the prompt uses as {{name}}, alongside
+	// ticket_id, ticket_title, project_id, repo, base_branch and branch_name
+	Vars map[string]string `json:"vars,omitempty"`
+	// Deadline is when the job should be done by; under deadline
+	// scheduling it orders the queue within its priority
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// JobTemplate holds the defaults of jobs submitted with its ID as their
+// template_id. Its prompt scaffolds theirs: a submitted prompt is appended
+// to it after a blank line.
+type JobTemplate struct {
+	Prompt     string       `json:"prompt,omitempty"`
+	Priority   *JobPriority `json:"priority,omitempty"`
+	BaseBranch string       `json:"base_branch,omitempty"`
+	Labels     []string     `json:"labels,omitempty"`
+	Executor   string       `json:"executor,omitempty"`
+}
+
+// JobFilter narrows job listings; empty fields match everything
+type JobFilter struct {
+	ProjectID string
+	Source    string
+	Status    JobStatus
+	GroupID   string
+	// FailureKind selects failed jobs by why they failed, e.g. auth
+	FailureKind string
+	// Label selects jobs tagged with it
+	Label string
+}
+
+// JobSearch is a full-text search over jobs' prompts, ticket titles and
+// descriptions and error messages. Empty filters match everything.
+type JobSearch struct {
+	// Query holds the words every match contains, in any case
+	Query     string
+	ProjectID string
+	// ProjectIDs, when not nil, limits matches to the caller's projects
+	ProjectIDs []string
+	Status     JobStatus
+	// From and To bound when matching jobs were created, To exclusive
+	From *time.Time
+	To   *time.Time
+	// Limit caps the matches, newest first
+	Limit int
+}
+
+// Terms splits the query into the lowercase words a match must contain
+func (s JobSearch) Terms() []string {
+	return strings.FieldsFunc(strings.ToLower(s.Query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// GroupStatus is the rolled-up status of a job group
+type GroupStatus string
+
+const (
+	GroupStatusInProgress     GroupStatus = "in_progress"
+	GroupStatusComplete       GroupStatus = "complete"
+	GroupStatusPartialFailure GroupStatus = "partial_failure"
+)
+
+// JobGroup is a set of jobs submitted under one group ID, such as an epic.
+// A requeued job is counted through its retry rather than itself.
+type JobGroup struct {
+	ID          string            `json:"id"`
+	Status      GroupStatus       `json:"status"`
+	Total       int               `json:"total"`
+	Counts      map[JobStatus]int `json:"counts"`
+	Jobs        []*Job            `json:"jobs"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	NotifiedAt  *time.Time        `json:"notified_at,omitempty"`
+	// Message summarizes the outcome for people; it is only set on
+	// notifications
+	Message string `json:"message,omitempty"`
+}
+
+// UpdateJobRequest changes a queued job; omitted fields are left as they are
+type UpdateJobRequest struct {
+	Priority   *JobPriority `json:"priority,omitempty"`
+	Prompt     *string      `json:"prompt,omitempty"`
+	BaseBranch *string      `json:"base_branch,omitempty"`
+}
+
+// RequeueJobRequest controls how a failed or cancelled job is retried
+type RequeueJobRequest struct {
+	// ResetBranch starts the retry on a new branch instead of continuing the
+	// original's; it implies ResetWorktree
+	ResetBranch bool `json:"reset_branch,omitempty"`
+	// ResetWorktree starts the retry in a fresh worktree instead of the original's
+	ResetWorktree bool `json:"reset_worktree,omitempty"`
 }
 
 // CreateJobResponse represents the response after creating a job
 type CreateJobResponse struct {
-	Job      *Job   `json:"job"`
-	Position int    `json:"position"`
-	Message  string `json:"message"`
+	Job      *Job     `json:"job"`
+	Position int      `json:"position"`
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings,omitempty"`
+	// Reused is set when Job is an earlier, near-identical job returned
+	// instead of a new one
+	Reused bool `json:"reused,omitempty"`
+}
+
+// ProjectSettings are per-project scheduling settings
+type ProjectSettings struct {
+	ProjectID string `json:"project_id"`
+	// Repo is the repository of jobs submitted without one, as owner/name;
+	// clone URLs are accepted and reduced to that
+	Repo string `json:"repo,omitempty"`
+	// DefaultPriority applies to jobs submitted without a priority
+	DefaultPriority *JobPriority `json:"default_priority,omitempty"`
+	// MaxPriority is the highest priority submitters may request; higher
+	// requests are clamped
+	MaxPriority *JobPriority `json:"max_priority,omitempty"`
+	// MaxParallel limits the project's concurrently running jobs (0 uses the default)
+	MaxParallel int `json:"max_parallel,omitempty"`
+	// MaxQueueDepth caps the project's jobs waiting in the queue;
+	// submissions beyond it are refused (0 uses the default)
+	MaxQueueDepth int `json:"max_queue_depth,omitempty"`
+	// SchedulingWeight is the project's share of workers under fair
+	// scheduling relative to other projects' (0 counts as 1), e.g. 3 to
+	// run three times as many jobs as a default project when both wait
+	SchedulingWeight int `json:"scheduling_weight,omitempty"`
+	// DispatchTemplate is a Go text/template rendering the repository_dispatch
+	// client_payload as a JSON object, executed with .Job, .CallbackURL,
+	// .CallbackSecret and .RepoToken; empty uses the default payload
+	DispatchTemplate string `json:"dispatch_template,omitempty"`
+	// BranchTemplate is a Go text/template naming the branches of the
+	// project's jobs, executed with .TicketID, .TicketShort, .Slug (of the
+	// title), .Date, .JobID, .ProjectID and .Kind and sanitized into a valid
+	// branch name; empty uses autobuild/ticket-{{.TicketShort}}
+	BranchTemplate string `json:"branch_template,omitempty"`
+	// DiffLimit bounds the size of the project's jobs' changes, replacing
+	// the configured default
+	DiffLimit *DiffLimit `json:"diff_limit,omitempty"`
+	// Locale selects the language of the project's user-facing messages,
+	// and Messages overrides single messages by key (such as job.queued or
+	// pr.body) with Go templates
+	Locale   string            `json:"locale,omitempty"`
+	Messages map[string]string `json:"messages,omitempty"`
+	// SCM is where the project's repository is hosted: github (the
+	// default), gitlab or bitbucket
+	SCM string `json:"scm,omitempty"`
+	// Executor runs the project's agents: github_actions, gitlab_ci,
+	// bitbucket_pipelines, local, docker or kubernetes; empty uses the
+	// configured default
+	Executor string `json:"executor,omitempty"`
+	// ExecutorImage is the container image the docker and kubernetes
+	// executors run the project's agents in; empty uses the configured default
+	ExecutorImage string `json:"executor_image,omitempty"`
+	// DispatchRates limit how often the project's jobs are dispatched at
+	// certain times of day, evaluated in Timezone (an IANA name, UTC when
+	// empty). Outside every rule dispatching is unlimited.
+	DispatchRates []DispatchRateRule `json:"dispatch_rates,omitempty"`
+	Timezone      string             `json:"timezone,omitempty"`
+	// ArtifactRetention replaces the default retention of the project's job logs
+	ArtifactRetention *ArtifactRetention `json:"artifact_retention,omitempty"`
+	// Submodules initializes the repository's submodules, recursively, in
+	// each new worktree
+	Submodules bool `json:"submodules,omitempty"`
+	// DeployKey authenticates git over SSH for the project's clones,
+	// fetches and pushes in place of the GitHub App: the path of a private
+	// key file, or env:NAME for a key held in the NAME environment variable
+	DeployKey string `json:"deploy_key,omitempty"`
+	// SparsePaths are the directories new worktrees check out, along with
+	// the files at the repository root; empty checks out everything
+	SparsePaths []string `json:"sparse_paths,omitempty"`
+	// LFS is when new worktrees get their Git LFS objects: auto (the
+	// default) when the repository tracks files with LFS, always, or skip
+	// to leave pointer files for speed
+	LFS string `json:"lfs,omitempty"`
+	// Egress restricts where the project's agents may connect; nil leaves
+	// it unrestricted. It needs the docker or kubernetes executor.
+	Egress *EgressPolicy `json:"egress,omitempty"`
+	// Tracker keeps the issues of the project's tickets up to date as
+	// their jobs progress; nil leaves them alone
+	Tracker *TrackerSettings `json:"tracker,omitempty"`
+	// OpenPR has the orchestrator open the pull request of each successful
+	// run that pushed its branch without one, from the pr.title and pr.body
+	// messages, instead of leaving it to the CI workflow
+	OpenPR bool `json:"open_pr,omitempty"`
+	// QAChecks are workflows run on the branch of each successful run; its
+	// job completes only once they all pass and fails if one does not
+	QAChecks []QACheck `json:"qa_checks,omitempty"`
+	// Templates are the job templates submissions may name as their
+	// template_id, by ID
+	Templates map[string]JobTemplate `json:"templates,omitempty"`
+	// Instructions are standing instructions for the project's agents,
+	// such as coding standards, directory conventions or paths not to
+	// touch, put ahead of every job's prompt when it is dispatched
+	Instructions string `json:"instructions,omitempty"`
+	// ArchivedAt is set while the project is archived: it accepts no new
+	// jobs and keeps no repository cache or pooled worktrees. It is changed
+	// through the archive endpoint, not by replacing the settings.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// StaleProject is a project without new jobs for longer than the stale
+// threshold, a candidate for archiving
+type StaleProject struct {
+	ProjectID string `json:"project_id"`
+	// LastJobAt is when its latest job was submitted, if this instance
+	// knows of any
+	LastJobAt *time.Time `json:"last_job_at,omitempty"`
+	// IdleSince is LastJobAt, or when the orchestrator started
+	IdleSince  time.Time  `json:"idle_since"`
+	IdleDays   int        `json:"idle_days"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// StaleProjectsReport lists stale projects
+type StaleProjectsReport struct {
+	StaleAfter  string         `json:"stale_after"`
+	AutoArchive bool           `json:"auto_archive"`
+	Projects    []StaleProject `json:"projects"`
+}
+
+// When new worktrees get their Git LFS objects
+const (
+	LFSModeAuto   = "auto"
+	LFSModeAlways = "always"
+	LFSModeSkip   = "skip"
+)
+
+// EgressPolicy is the outbound network access of a project's agents
+type EgressPolicy struct {
+	// AllowedHosts are hostnames, "*.example.com" wildcards, IP addresses
+	// or CIDR blocks; empty allows no egress at all. The orchestrator's
+	// callback host is always reachable.
+	AllowedHosts []string `json:"allowed_hosts"`
+}
+
+// ArtifactRetention says how long job logs are kept
+type ArtifactRetention struct {
+	// Days deletes logs this many days after they were last written; zero
+	// keeps them until MaxBytes applies
+	Days int `json:"days,omitempty"`
+	// MaxBytes caps the project's stored logs, deleting the oldest first;
+	// zero is unlimited
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// ExtendRetentionRequest keeps a job's logs for Days more days from now
+type ExtendRetentionRequest struct {
+	Days int `json:"days"`
+}
+
+// ExtendRetentionResponse says until when a job's logs are kept
+type ExtendRetentionResponse struct {
+	JobID       string    `json:"job_id"`
+	RetainUntil time.Time `json:"retain_until"`
+}
+
+// JobArtifact is a file a job left behind, embedded in jobs fetched with
+// ?include=artifacts
+type JobArtifact struct {
+	// Name is log or report
+	Name string `json:"name"`
+	// URL is the API path the artifact is downloaded from
+	URL       string     `json:"url"`
+	Size      int64      `json:"size"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ArtifactRetentionStats counts what the retention sweeper has reclaimed
+type ArtifactRetentionStats struct {
+	Sweeps         uint64     `json:"sweeps"`
+	DeletedLogs    uint64     `json:"deleted_logs"`
+	ReclaimedBytes uint64     `json:"reclaimed_bytes"`
+	StoredBytes    int64      `json:"stored_bytes"`
+	LastSweepAt    *time.Time `json:"last_sweep_at,omitempty"`
+}
+
+// DispatchRateRule caps dispatches during part of the day, e.g. at most 2
+// per hour from 09:00 to 17:00 on weekdays
+type DispatchRateRule struct {
+	// Start and End are "HH:MM" wall-clock times; a rule ending before it
+	// starts runs past midnight
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days limits the rule to some weekdays ("mon" to "sun"); empty means every day
+	Days []string `json:"days,omitempty"`
+	// MaxPerHour is how many jobs may be dispatched in any rolling hour
+	// while the rule applies; zero holds all dispatching
+	MaxPerHour int `json:"max_per_hour"`
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Version   string            `json:"version"`
-	Uptime    string            `json:"uptime"`
-	Queue     QueueStats        `json:"queue"`
-	Worktrees WorktreeStats     `json:"worktrees"`
+	Status    string        `json:"status"`
+	Version   string        `json:"version"`
+	Uptime    string        `json:"uptime"`
+	Queue     QueueStats    `json:"queue"`
+	Worktrees WorktreeStats `json:"worktrees"`
+	// Checks holds the dependency probes; any failing one makes the
+	// status "degraded"
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Health check statuses
+const (
+	HealthCheckOK      = "ok"
+	HealthCheckFailing = "failing"
+)
+
+// ErrorResponse is the body of every API error. Code is stable for clients
+// to branch on, while Error is a human-readable message that may change.
+// RequestID matches the X-Request-Id header, for finding the request in
+// the logs.
+type ErrorResponse struct {
+	Error     string                 `json:"error"`
+	Code      string                 `json:"code"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// FieldViolation is what is wrong with one field of a request, listed in
+// the violations detail of a VALIDATION_FAILED error
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error codes. Errors without a code of their own have the code of their
+// HTTP status.
+const (
+	ErrorCodeBadRequest       = "BAD_REQUEST"
+	ErrorCodeUnauthorized     = "UNAUTHORIZED"
+	ErrorCodeForbidden        = "FORBIDDEN"
+	ErrorCodeNotFound         = "NOT_FOUND"
+	ErrorCodeConflict         = "CONFLICT"
+	ErrorCodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	ErrorCodeValidationFailed = "VALIDATION_FAILED"
+	ErrorCodeRateLimited      = "RATE_LIMITED"
+	ErrorCodeInternal         = "INTERNAL_ERROR"
+	ErrorCodeBadGateway       = "BAD_GATEWAY"
+	ErrorCodeUnavailable      = "UNAVAILABLE"
+
+	ErrorCodeJobNotFound          = "JOB_NOT_FOUND"
+	ErrorCodeJobIDExists          = "JOB_ID_EXISTS"
+	ErrorCodeJobAlreadyCompleted  = "JOB_ALREADY_COMPLETED"
+	ErrorCodeJobNotPending        = "JOB_NOT_PENDING"
+	ErrorCodeJobNotStarted        = "JOB_NOT_STARTED"
+	ErrorCodeJobNotRetryable      = "JOB_NOT_RETRYABLE"
+	ErrorCodeAttemptNotFound      = "ATTEMPT_NOT_FOUND"
+	ErrorCodeTicketActive         = "TICKET_ACTIVE"
+	ErrorCodeQueueFull            = "QUEUE_FULL"
+	ErrorCodeBaseBranchNotFound   = "BASE_BRANCH_NOT_FOUND"
+	ErrorCodeProjectNotFound      = "PROJECT_NOT_FOUND"
+	ErrorCodeProjectArchived      = "PROJECT_ARCHIVED"
+	ErrorCodeProjectBusy          = "PROJECT_BUSY"
+	ErrorCodeGroupNotFound        = "GROUP_NOT_FOUND"
+	ErrorCodeLogsNotKept          = "LOGS_NOT_KEPT"
+	ErrorCodeRollupsDisabled      = "ROLLUPS_DISABLED"
+	ErrorCodeReservationNotFound  = "RESERVATION_NOT_FOUND"
+	ErrorCodeReservationConflict  = "RESERVATION_CONFLICT"
+	ErrorCodeWorktreeNotFound     = "WORKTREE_NOT_FOUND"
+	ErrorCodeWorktreeConflict     = "WORKTREE_CONFLICT"
+	ErrorCodeWorktreeLimit        = "WORKTREE_LIMIT"
+	ErrorCodeRepoUnavailable      = "REPO_UNAVAILABLE"
+	ErrorCodeInvalidCallbackToken = "INVALID_CALLBACK_TOKEN"
+)
+
+// ProbeResponse answers the liveness and readiness probes of orchestration
+// platforms, saying why the process is not live or ready
+type ProbeResponse struct {
+	Status  string   `json:"status"` // "ok" or "unavailable"
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// HealthCheck is the result of probing one dependency
+type HealthCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// StatusSummary is the public status snapshot served at /statusz. Fields
+// are only ever added, never renamed or removed, so status pages can rely on them.
+type StatusSummary struct {
+	Status               string    `json:"status"` // "ok" or "degraded"
+	AcceptingSubmissions bool      `json:"accepting_submissions"`
+	AverageWaitSeconds   float64   `json:"average_wait_seconds"`
+	DegradedComponents   []string  `json:"degraded_components"`
+	GeneratedAt          time.Time `json:"generated_at"`
 }
 
 // WorktreeStats represents worktree statistics
 type WorktreeStats struct {
 	Active    int `json:"active"`
 	MaxActive int `json:"max_active"`
+	// DiskUsageBytes totals the last measured usage of all worktrees
+	DiskUsageBytes int64 `json:"disk_usage_bytes"`
+	// DiskQuotaBytes is each worktree's quota, zero when unlimited
+	DiskQuotaBytes int64 `json:"disk_quota_bytes,omitempty"`
+	// OverQuota counts worktrees last measured above the quota
+	OverQuota int `json:"over_quota"`
+	// Pooled counts cleaned worktrees waiting to be reused
+	Pooled int `json:"pooled"`
+	// Merging counts worktrees kept until their pull requests are resolved,
+	// and Cleanup those about to be removed; neither counts as active
+	Merging int `json:"merging"`
+	Cleanup int `json:"cleanup"`
+	// CreatedTotal and RemovedTotal count worktrees checked out and removed
+	// from disk since startup; pooled worktrees reused for another job are
+	// neither
+	CreatedTotal uint64 `json:"created_total"`
+	RemovedTotal uint64 `json:"removed_total"`
 }
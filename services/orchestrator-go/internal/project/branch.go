@@ -0,0 +1,140 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// DefaultBranchTemplate names the branches of projects that set no template
+const DefaultBranchTemplate = "autobuild/ticket-{{.TicketShort}}"
+
+const (
+	// maxBranchLength keeps branch names well within git's and hosts' limits
+	maxBranchLength = 100
+	// maxSlugLength bounds the part of a branch name taken from the title
+	maxSlugLength = 40
+)
+
+// BranchData is what branch templates are executed with
+type BranchData struct {
+	// TicketID is the full ticket ID and TicketShort its first 8 characters
+	TicketID    string
+	TicketShort string
+	// Slug is the ticket title in lowercase words joined by dashes
+	Slug string
+	// Date is the day the job was submitted, as 2006-01-02
+	Date      string
+	JobID     string
+	ProjectID string
+	Kind      string
+}
+
+// NewBranchData collects the branch template variables of a job
+func NewBranchData(job *models.Job) BranchData {
+	short := job.TicketID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return BranchData{
+		TicketID:    job.TicketID,
+		TicketShort: short,
+		Slug:        slugify(job.TicketTitle, maxSlugLength),
+		Date:        job.CreatedAt.Format(time.DateOnly),
+		JobID:       job.ID,
+		ProjectID:   job.ProjectID,
+		Kind:        string(job.Kind),
+	}
+}
+
+// ValidateBranchTemplate checks that a branch template parses and renders a
+// sample job to a usable branch name
+func ValidateBranchTemplate(src string) error {
+	if src == "" {
+		return nil
+	}
+	_, err := BranchName(src, &models.Job{
+		ID:          "00000000-0000-0000-0000-000000000000",
+		ProjectID:   "project",
+		TicketID:    "ticket-1234",
+		TicketTitle: "Title",
+		Kind:        models.JobKindImplementation,
+		CreatedAt:   time.Now(),
+	})
+	return err
+}
+
+// BranchName renders a job's branch name from a branch template (the
+// default when empty), sanitized into a valid git ref name
+func BranchName(src string, job *models.Job) (string, error) {
+	if src == "" {
+		src = DefaultBranchTemplate
+	}
+	tmpl, err := template.New("branch").Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("invalid branch template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, NewBranchData(job)); err != nil {
+		return "", fmt.Errorf("failed to render branch template: %w", err)
+	}
+
+	name := sanitizeBranch(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("branch template renders an empty branch name")
+	}
+	return name, nil
+}
+
+var (
+	// invalidBranchChars are characters kept out of branch names; git
+	// forbids some of them and the rest need quoting in shells and URLs
+	invalidBranchChars = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+	repeatedSeparators = regexp.MustCompile(`-{2,}|/{2,}|\.{2,}`)
+	slugBreaks         = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// sanitizeBranch makes name a valid git ref name of at most
+// maxBranchLength characters
+func sanitizeBranch(name string) string {
+	name = invalidBranchChars.ReplaceAllString(strings.TrimSpace(name), "-")
+	name = repeatedSeparators.ReplaceAllStringFunc(name, func(s string) string { return s[:1] })
+	if len(name) > maxBranchLength {
+		name = name[:maxBranchLength]
+	}
+
+	// No component may be empty, start with a dot or end in .lock
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		part = strings.TrimLeft(part, ".-")
+		part = strings.TrimSuffix(part, ".lock")
+		part = strings.TrimRight(part, ".-")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// slugify lowercases s into words joined by dashes, cut at a word boundary
+// within max characters
+func slugify(s string, max int) string {
+	slug := strings.Trim(slugBreaks.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(slug) <= max {
+		return slug
+	}
+	// The cut may already fall between words
+	if slug[max] == '-' {
+		return slug[:max]
+	}
+	slug = slug[:max]
+	if i := strings.LastIndexByte(slug, '-'); i > 0 {
+		slug = slug[:i]
+	}
+	return slug
+}
@@ -0,0 +1,50 @@
+package project
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeBranch(t *testing.T) {
+	for in, want := range map[string]string{
+		"autobuild/PROJ-1-add-widget": "autobuild/PROJ-1-add-widget",
+		" feature/add a widget!? ":    "feature/add-a-widget",
+		"a//b--c..d":                  "a/b-c.d",
+		".hidden/-dash":               "hidden/dash",
+		"branch.lock/x.lock":          "branch/x",
+		"/a/":                         "a",
+		"???":                         "",
+	} {
+		if got := sanitizeBranch(in); got != want {
+			t.Errorf("sanitizeBranch(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeBranchLength(t *testing.T) {
+	got := sanitizeBranch(strings.Repeat("a", maxBranchLength+20))
+	if len(got) != maxBranchLength {
+		t.Fatalf("sanitized branch has %d characters, want %d", len(got), maxBranchLength)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"Add a Widget", 40, "add-a-widget"},
+		{"  Fix: the *login* page!  ", 40, "fix-the-login-page"},
+		{"Add a widget to the page", 12, "add-a-widget"},
+		{"Add a widget to the page", 14, "add-a-widget"},
+		{"Add a widget to the page", 11, "add-a"},
+		{"Supercalifragilistic", 5, "super"},
+		{"", 10, ""},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.in, tt.max); got != tt.want {
+			t.Errorf("slugify(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
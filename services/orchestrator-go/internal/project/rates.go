@@ -0,0 +1,102 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ValidateDispatchRates checks a project's timezone and dispatch rate rules
+func ValidateDispatchRates(settings models.ProjectSettings) error {
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", settings.Timezone)
+	}
+	for i, rule := range settings.DispatchRates {
+		start, err := parseClock(rule.Start)
+		if err != nil {
+			return fmt.Errorf("dispatch_rates[%d].start: %w", i, err)
+		}
+		end, err := parseClock(rule.End)
+		if err != nil {
+			return fmt.Errorf("dispatch_rates[%d].end: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("dispatch_rates[%d] starts and ends at the same time", i)
+		}
+		for _, day := range rule.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("dispatch_rates[%d]: unknown day %q", i, day)
+			}
+		}
+		if rule.MaxPerHour < 0 {
+			return fmt.Errorf("dispatch_rates[%d].max_per_hour may not be negative", i)
+		}
+	}
+	return nil
+}
+
+// ActiveDispatchRate returns the first of a project's dispatch rate rules
+// that applies at now, or nil when dispatching is unlimited
+func ActiveDispatchRate(settings models.ProjectSettings, now time.Time) *models.DispatchRateRule {
+	if len(settings.DispatchRates) == 0 {
+		return nil
+	}
+	if loc, err := time.LoadLocation(settings.Timezone); err == nil {
+		now = now.In(loc)
+	}
+	minute := now.Hour()*60 + now.Minute()
+
+	for i := range settings.DispatchRates {
+		rule := &settings.DispatchRates[i]
+		start, err1 := parseClock(rule.Start)
+		end, err2 := parseClock(rule.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		// For rules past midnight, the early-morning part belongs to the
+		// day the rule started on
+		day := now.Weekday()
+		var inside bool
+		if start < end {
+			inside = minute >= start && minute < end
+		} else {
+			inside = minute >= start || minute < end
+			if minute < end {
+				day = (day + 6) % 7
+			}
+		}
+		if inside && onDay(rule.Days, day) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func onDay(days []string, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
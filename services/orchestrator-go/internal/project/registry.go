@@ -0,0 +1,102 @@
+package project
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Registry holds per-project settings. Projects without settings use the
+// orchestrator defaults.
+type Registry struct {
+	mu       sync.RWMutex
+	projects map[string]*models.ProjectSettings
+}
+
+// NewRegistry creates an empty project registry
+func NewRegistry() *Registry {
+	return &Registry{projects: make(map[string]*models.ProjectSettings)}
+}
+
+// Get returns a copy of a project's settings
+func (r *Registry) Get(projectID string) (models.ProjectSettings, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	settings, ok := r.projects[projectID]
+	if !ok {
+		return models.ProjectSettings{ProjectID: projectID}, false
+	}
+	return *settings, true
+}
+
+// Put creates or replaces a project's settings
+func (r *Registry) Put(settings models.ProjectSettings) models.ProjectSettings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	settings.Repo = RepoName(settings.Repo)
+	settings.UpdatedAt = time.Now()
+	r.projects[settings.ProjectID] = &settings
+	return settings
+}
+
+// SetArchived archives or unarchives a project, creating its settings if
+// it has none
+func (r *Registry) SetArchived(projectID string, archived bool) models.ProjectSettings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	settings, ok := r.projects[projectID]
+	if !ok {
+		settings = &models.ProjectSettings{ProjectID: projectID}
+		r.projects[projectID] = settings
+	}
+	now := time.Now()
+	switch {
+	case archived && settings.ArchivedAt == nil:
+		settings.ArchivedAt = &now
+	case !archived:
+		settings.ArchivedAt = nil
+	}
+	settings.UpdatedAt = now
+	return *settings
+}
+
+// Delete removes a project's settings, reporting whether it had any
+func (r *Registry) Delete(projectID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.projects[projectID]
+	delete(r.projects, projectID)
+	return ok
+}
+
+// List returns all project settings ordered by project ID
+func (r *Registry) List() []models.ProjectSettings {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]models.ProjectSettings, 0, len(r.projects))
+	for _, settings := range r.projects {
+		list = append(list, *settings)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ProjectID < list[j].ProjectID
+	})
+	return list
+}
+
+// RepoName reduces a clone URL, such as https://github.com/owner/name.git or
+// git@github.com:owner/name.git, to the repository's owner/name
+func RepoName(repo string) string {
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		repo = u.Path
+	} else if at := strings.Index(repo, "@"); at >= 0 {
+		if _, path, ok := strings.Cut(repo[at:], ":"); ok {
+			repo = path
+		}
+	}
+	return strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+}
@@ -0,0 +1,54 @@
+package project
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// ValidateTemplates checks a project's job templates against the
+// executors available to run them
+func ValidateTemplates(settings models.ProjectSettings, executors []string) error {
+	for id, tmpl := range settings.Templates {
+		if strings.TrimSpace(id) == "" {
+			return fmt.Errorf("templates need an ID")
+		}
+		if p := tmpl.Priority; p != nil && (*p < models.PriorityLow || *p > models.PriorityCritical) {
+			return fmt.Errorf("templates[%s].priority must be between %d (low) and %d (critical)", id, models.PriorityLow, models.PriorityCritical)
+		}
+		if tmpl.Executor != "" && !slices.Contains(executors, tmpl.Executor) {
+			return fmt.Errorf("templates[%s].executor must be one of: %s", id, strings.Join(executors, ", "))
+		}
+		if slices.Contains(tmpl.Labels, "") {
+			return fmt.Errorf("templates[%s].labels may not be empty", id)
+		}
+	}
+	return nil
+}
+
+// ApplyTemplate fills in the fields a submission leaves unset from a job
+// template, and puts the template's prompt ahead of the submitted one
+func ApplyTemplate(tmpl models.JobTemplate, req *models.CreateJobRequest) {
+	switch {
+	case tmpl.Prompt == "":
+	case req.Prompt == "":
+		req.Prompt = tmpl.Prompt
+	default:
+		req.Prompt = tmpl.Prompt + "\n\n" + req.Prompt
+	}
+	if req.Priority == nil && tmpl.Priority != nil {
+		priority := *tmpl.Priority
+		req.Priority = &priority
+	}
+	if req.BaseBranch == "" {
+		req.BaseBranch = tmpl.BaseBranch
+	}
+	if len(req.Labels) == 0 {
+		req.Labels = slices.Clone(tmpl.Labels)
+	}
+	if req.Executor == "" {
+		req.Executor = tmpl.Executor
+	}
+}
@@ -0,0 +1,51 @@
+// Package prompt substitutes variables such as {{ticket_title}} into job
+// prompts. Prompts are stored as submitted and rendered when dispatched.
+package prompt
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Builtins are the variables every job defines from its own fields
+var Builtins = []string{"ticket_id", "ticket_title", "project_id", "repo", "base_branch", "branch_name"}
+
+// variable matches a {{name}} placeholder, allowing spaces inside the braces
+var variable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// name matches what a variable may be called
+var name = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidName reports whether a custom variable can be referenced in a prompt
+func ValidName(s string) bool {
+	return name.MatchString(s)
+}
+
+// Render replaces the variables of a prompt with their values, leaving
+// undefined ones as written
+func Render(src string, vars map[string]string) string {
+	return variable.ReplaceAllStringFunc(src, func(placeholder string) string {
+		if value, ok := vars[variable.FindStringSubmatch(placeholder)[1]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Missing lists the variables a prompt uses that neither vars nor the
+// builtins define, each once in order of first use
+func Missing(src string, vars map[string]string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, match := range variable.FindAllStringSubmatch(src, -1) {
+		v := match[1]
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if _, ok := vars[v]; !ok && !slices.Contains(Builtins, v) {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
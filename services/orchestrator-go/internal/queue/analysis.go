@@ -0,0 +1,23 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// maxReportSize bounds the analysis report kept with a job
+const maxReportSize = 1 << 20
+
+// checkReport holds an analysis run's result to producing a report. A run
+// that succeeded without one failed, and an overlong report is truncated.
+func checkReport(job *models.Job, result *models.JobResult) {
+	if job.Kind != models.JobKindAnalysis {
+		return
+	}
+	if len(result.Report) > maxReportSize {
+		result.Report = result.Report[:maxReportSize] + "\n\n*Report truncated.*\n"
+	}
+	if result.Status == "success" && result.Report == "" {
+		result.Status = "failure"
+		result.Error = "analysis run produced no report"
+	}
+}
@@ -0,0 +1,277 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrLogsNotKept is returned when job logs are not kept, so there is nothing
+// to retain
+var ErrLogsNotKept = NewQueueError("job logs are not kept")
+
+// artifactStats counts what the retention sweeper has reclaimed
+type artifactStats struct {
+	mu    sync.Mutex
+	stats models.ArtifactRetentionStats
+}
+
+// logOwner is what the sweeper needs to know about a stored log's job
+type logOwner struct {
+	projectID string
+	held      bool // retained past the policy by ExtendRetention
+	active    bool // still running, its log is being written
+}
+
+// runArtifactRetention sweeps stored job logs every RetentionInterval
+func (m *Manager) runArtifactRetention(ctx context.Context) {
+	if m.logs == nil || m.logCfg.RetentionInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.logCfg.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sweepArtifacts(ctx)
+		}
+	}
+}
+
+// sweepArtifacts deletes job logs past their project's retention days, then
+// the oldest logs of projects storing more than their byte limit. Logs of
+// unfinished jobs and of jobs whose retention was extended are kept.
+func (m *Manager) sweepArtifacts(ctx context.Context) {
+	infos, err := m.logs.List(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list job logs for retention")
+		return
+	}
+	owners := m.logOwners(ctx, infos)
+	now := time.Now()
+
+	// Oldest first, so byte limits delete the oldest logs
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].UpdatedAt.Before(infos[j].UpdatedAt)
+	})
+
+	var deleted, reclaimed, stored int64
+	expired := make(map[string]bool)
+	byProject := make(map[string][]int)
+	for i, info := range infos {
+		owner := owners[info.JobID]
+		stored += info.Size
+		if owner.held || owner.active {
+			continue
+		}
+		policy := m.artifactRetention(owner.projectID)
+		if policy.Days > 0 && now.Sub(info.UpdatedAt) > time.Duration(policy.Days)*24*time.Hour {
+			expired[info.JobID] = true
+			continue
+		}
+		byProject[owner.projectID] = append(byProject[owner.projectID], i)
+	}
+
+	// Held and active logs count toward a project's bytes but are never
+	// deleted for it
+	projectBytes := make(map[string]int64)
+	for _, info := range infos {
+		if !expired[info.JobID] {
+			projectBytes[owners[info.JobID].projectID] += info.Size
+		}
+	}
+	for projectID, indexes := range byProject {
+		policy := m.artifactRetention(projectID)
+		for _, i := range indexes {
+			if policy.MaxBytes <= 0 || projectBytes[projectID] <= policy.MaxBytes {
+				break
+			}
+			expired[infos[i].JobID] = true
+			projectBytes[projectID] -= infos[i].Size
+		}
+	}
+
+	for jobID := range expired {
+		freed, err := m.logs.Delete(ctx, jobID)
+		reclaimed += freed
+		stored -= freed
+		if err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to delete expired job log")
+			continue
+		}
+		deleted++
+	}
+
+	m.artifacts.mu.Lock()
+	m.artifacts.stats.Sweeps++
+	m.artifacts.stats.DeletedLogs += uint64(deleted)
+	m.artifacts.stats.ReclaimedBytes += uint64(reclaimed)
+	m.artifacts.stats.StoredBytes = stored
+	m.artifacts.stats.LastSweepAt = &now
+	m.artifacts.mu.Unlock()
+
+	if deleted > 0 {
+		log.Info().
+			Int64("deleted", deleted).
+			Int64("reclaimed_bytes", reclaimed).
+			Int64("stored_bytes", stored).
+			Msg("Deleted expired job logs")
+	}
+}
+
+// logOwners looks up the jobs of stored logs in memory, then in the archive.
+// Logs whose job is gone entirely fall under the default policy.
+func (m *Manager) logOwners(ctx context.Context, infos []joblog.Info) map[string]logOwner {
+	now := time.Now()
+	owners := make(map[string]logOwner, len(infos))
+	var missing []string
+
+	m.mu.RLock()
+	archiver := m.archiver
+	for _, info := range infos {
+		job, ok := m.jobs[info.JobID]
+		if !ok {
+			missing = append(missing, info.JobID)
+			continue
+		}
+		owners[info.JobID] = ownerOf(job, now)
+	}
+	m.mu.RUnlock()
+
+	if archiver == nil {
+		return owners
+	}
+	for _, jobID := range missing {
+		job, err := archiver.Get(ctx, jobID)
+		if err != nil {
+			// Keep the log rather than judge it without its job
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to look up archived job for log retention")
+			owners[jobID] = logOwner{held: true}
+			continue
+		}
+		if job != nil {
+			owners[jobID] = ownerOf(job, now)
+		}
+	}
+	return owners
+}
+
+func ownerOf(job *models.Job, now time.Time) logOwner {
+	return logOwner{
+		projectID: job.ProjectID,
+		held:      job.RetainUntil != nil && job.RetainUntil.After(now),
+		active:    !job.Status.IsTerminal(),
+	}
+}
+
+// artifactRetention returns the project's retention policy, or the default
+func (m *Manager) artifactRetention(projectID string) models.ArtifactRetention {
+	if projectID != "" {
+		if settings, ok := m.projects.Get(projectID); ok && settings.ArtifactRetention != nil {
+			return *settings.ArtifactRetention
+		}
+	}
+	return models.ArtifactRetention{
+		Days:     m.logCfg.RetentionDays,
+		MaxBytes: m.logCfg.RetentionMaxBytes,
+	}
+}
+
+// ArtifactRetentionStats returns what the retention sweeper has reclaimed
+func (m *Manager) ArtifactRetentionStats() models.ArtifactRetentionStats {
+	m.artifacts.mu.Lock()
+	defer m.artifacts.mu.Unlock()
+	return m.artifacts.stats
+}
+
+// ExtendRetention keeps a job's logs for at least days more days, whatever
+// its project's retention policy. Retention is never shortened.
+func (m *Manager) ExtendRetention(ctx context.Context, jobID string, days int, scope Scope) (*time.Time, error) {
+	if m.logs == nil {
+		return nil, ErrLogsNotKept
+	}
+	until := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+
+	m.mu.Lock()
+	job, ok := m.jobs[jobID]
+	if ok {
+		defer m.mu.Unlock()
+		if !inScope(scope, job.ProjectID) {
+			return nil, ErrJobNotFound
+		}
+		job.RetainUntil = laterOf(job.RetainUntil, until)
+		m.jobLog(job.ID, logSourceOrchestrator, "Logs retained until %s by %s", job.RetainUntil.UTC().Format(time.RFC3339), actorOf(scope))
+		return job.RetainUntil, nil
+	}
+	archiver := m.archiver
+	m.mu.Unlock()
+
+	// Evicted jobs are extended in the archive
+	job, found, err := m.GetArchivedJob(ctx, jobID, scope)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrJobNotFound
+	}
+	job.RetainUntil = laterOf(job.RetainUntil, until)
+	if err := archiver.Archive(ctx, []*models.Job{job}); err != nil {
+		return nil, err
+	}
+	return job.RetainUntil, nil
+}
+
+func laterOf(current *time.Time, t time.Time) *time.Time {
+	if current != nil && current.After(t) {
+		return current
+	}
+	return &t
+}
+
+// JobArtifacts lists the stored log and analysis report of each job. Logs
+// are listed once for all jobs, as the log store cannot look up one job.
+func (m *Manager) JobArtifacts(ctx context.Context, jobs []*models.Job) (map[string][]models.JobArtifact, error) {
+	logs := make(map[string]joblog.Info)
+	if m.logs != nil {
+		infos, err := m.logs.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			logs[info.JobID] = info
+		}
+	}
+
+	artifacts := make(map[string][]models.JobArtifact, len(jobs))
+	for _, job := range jobs {
+		list := []models.JobArtifact{}
+		if info, ok := logs[job.ID]; ok {
+			updatedAt := info.UpdatedAt
+			list = append(list, models.JobArtifact{
+				Name:      "log",
+				URL:       "/api/v1/jobs/" + job.ID + "/logs/download",
+				Size:      info.Size,
+				UpdatedAt: &updatedAt,
+			})
+		}
+		if job.Result != nil && job.Result.Report != "" {
+			receivedAt := job.Result.ReceivedAt
+			list = append(list, models.JobArtifact{
+				Name:      "report",
+				URL:       "/api/v1/jobs/" + job.ID + "/report",
+				Size:      int64(len(job.Result.Report)),
+				UpdatedAt: &receivedAt,
+			})
+		}
+		artifacts[job.ID] = list
+	}
+	return artifacts, nil
+}
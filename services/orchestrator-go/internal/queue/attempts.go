@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/textdiff"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrAttemptNotFound is returned when a comparison names an attempt the job does not have
+var ErrAttemptNotFound = NewQueueError("attempt not found")
+
+// recordAttempt snapshots the run that just finished into the job's attempt
+// history and its duration into the latency metrics
+func (m *Manager) recordAttempt(job *models.Job) {
+	m.latency.observeRun(job)
+
+	attempt := models.Attempt{
+		Number:      len(job.Attempts) + 1,
+		Status:      job.Status,
+		Prompt:      job.Prompt,
+		RunID:       job.RunID,
+		RunURL:      job.RunURL,
+		Error:       job.ErrorMessage,
+		Environment: job.Environment,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	if job.Result != nil {
+		attempt.HeadSHA = job.Result.HeadSHA
+		attempt.PRUrl = job.Result.PRUrl
+	}
+	job.Attempts = append(job.Attempts, attempt)
+}
+
+// shouldRetry reports whether a failed run gets another attempt
+func (m *Manager) shouldRetry(job *models.Job) bool {
+	return job.Status == models.JobStatusFailed &&
+		job.Kind != models.JobKindQARerun &&
+		// Credentials were refreshed already; retrying won't fix them
+		job.FailureKind != models.FailureKindAuth &&
+		// A retry would likely make the same oversized changes
+		job.FailureKind != models.FailureKindDiffTooLarge &&
+		job.RetryCount < m.cfg.RetryAttempts
+}
+
+// retry puts a failed job back in the queue for another attempt. The
+// previous worktree is removed first so the retry starts from a clean tree.
+func (m *Manager) retry(job *models.Job) {
+	m.revokeCredentials(job)
+	job.RetryCount++
+	transition(job, models.JobStatusPending, actorOrchestrator, fmt.Sprintf("retry %d of %d", job.RetryCount, m.cfg.RetryAttempts))
+	job.ErrorMessage = ""
+	job.FailureKind = ""
+	job.Result = nil
+	job.RunID = ""
+	job.RunURL = ""
+	job.DispatchedAt = nil
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.Environment = nil
+	job.Credentials = nil
+	job.Checks = nil
+
+	worktreeID := job.WorktreeID
+	job.WorktreeID = ""
+
+	log.Info().
+		Str("job_id", job.ID).
+		Int("retry", job.RetryCount).
+		Int("max_retries", m.cfg.RetryAttempts).
+		Msg("Retrying failed job")
+
+	go func() {
+		if worktreeID != "" {
+			if err := m.worktreeManager.Delete(worktreeID); err != nil {
+				log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to remove worktree before retry")
+			}
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// The job may have been cancelled while its worktree was removed
+		if job.Status == models.JobStatusPending {
+			m.enqueue(job)
+		}
+	}()
+}
+
+// isPastRun reports whether a run belongs to an earlier attempt of the job,
+// so late webhooks and callbacks for it are not applied to the current one
+func isPastRun(job *models.Job, runID string) bool {
+	if runID == "" {
+		return false
+	}
+	for _, a := range job.Attempts {
+		if a.RunID == runID {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareAttempts diffs the prompts and the resulting changes of two
+// attempts of a job. Attempts are numbered from 1; zero selects the
+// second-to-last attempt for from and the last attempt for to.
+func (m *Manager) CompareAttempts(ctx context.Context, jobID string, from, to int, scope Scope) (*models.AttemptComparison, error) {
+	m.mu.RLock()
+	job, ok := m.jobs[jobID]
+	if !ok || !inScope(scope, job.ProjectID) {
+		m.mu.RUnlock()
+		return nil, ErrJobNotFound
+	}
+	attempts := append([]models.Attempt(nil), job.Attempts...)
+	repo, base, onGitHub := job.RepoFullName, job.BaseBranch, m.onGitHub(job.ProjectID)
+	m.mu.RUnlock()
+
+	if to == 0 {
+		to = len(attempts)
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || from > len(attempts) || to < 1 || to > len(attempts) {
+		return nil, ErrAttemptNotFound
+	}
+
+	a, b := attempts[from-1], attempts[to-1]
+	cmp := &models.AttemptComparison{
+		JobID:      jobID,
+		From:       &a,
+		To:         &b,
+		PromptDiff: textdiff.Unified(attemptName(from, "prompt"), attemptName(to, "prompt"), a.Prompt, b.Prompt),
+	}
+
+	fromChanges, err := m.attemptChanges(ctx, repo, base, onGitHub, &a)
+	if err != nil {
+		cmp.Warnings = append(cmp.Warnings, fmt.Sprintf("changes of attempt %d unavailable: %v", from, err))
+	}
+	toChanges, err := m.attemptChanges(ctx, repo, base, onGitHub, &b)
+	if err != nil {
+		cmp.Warnings = append(cmp.Warnings, fmt.Sprintf("changes of attempt %d unavailable: %v", to, err))
+	}
+	cmp.ChangesDiff = textdiff.Unified(attemptName(from, "changes"), attemptName(to, "changes"), fromChanges, toChanges)
+
+	return cmp, nil
+}
+
+// attemptChanges fetches the diff an attempt pushed, relative to the base
+// branch. Attempts that pushed nothing have no changes. Diffs come from
+// GitHub's API, so other hosts' changes are not compared.
+func (m *Manager) attemptChanges(ctx context.Context, repo, base string, onGitHub bool, a *models.Attempt) (string, error) {
+	if a.HeadSHA == "" {
+		return "", nil
+	}
+	if repo == "" {
+		return "", fmt.Errorf("job has no repository")
+	}
+	if !onGitHub {
+		return "", fmt.Errorf("changes are only compared on GitHub")
+	}
+	return m.github.CompareDiff(ctx, repo, base, a.HeadSHA)
+}
+
+func attemptName(n int, what string) string {
+	return fmt.Sprintf("attempt-%d/%s", n, what)
+}
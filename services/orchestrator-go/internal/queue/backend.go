@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Backend stores the ordered list of jobs waiting for a worker. Claim must be
+// atomic across every orchestrator sharing the backend so that a job is
+// dispatched exactly once.
+type Backend interface {
+	// Push adds a job to the queue in priority order
+	Push(ctx context.Context, job *models.Job) error
+	// Remove drops a job from the queue if it is still there
+	Remove(ctx context.Context, jobID string) error
+	// Claim removes a job from the queue, reporting false if another
+	// orchestrator claimed it first
+	Claim(ctx context.Context, jobID string) (bool, error)
+	// List returns queued jobs, highest priority first
+	List(ctx context.Context) ([]*models.Job, error)
+	// Publish stores the latest state of a job, queued or not, for the
+	// other orchestrators sharing the backend
+	Publish(ctx context.Context, job *models.Job) error
+	// Published returns the latest states published of the jobs given,
+	// skipping those never published
+	Published(ctx context.Context, jobIDs []string) ([]*models.Job, error)
+	// PublishedIDs lists the jobs with a published state
+	PublishedIDs(ctx context.Context) ([]string, error)
+	// Unpublish drops the published state of a job
+	Unpublish(ctx context.Context, jobID string) error
+	// RequestCancel leaves a request for the orchestrator running a job to
+	// cancel it
+	RequestCancel(ctx context.Context, req CancelRequest) error
+	// TakeCancelRequests removes and returns the requests left for the
+	// jobs given
+	TakeCancelRequests(ctx context.Context, jobIDs []string) ([]CancelRequest, error)
+}
+
+// NewBackend creates the queue backend selected in configuration
+func NewBackend(cfg config.QueueConfig, redisCfg config.RedisConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryBackend(), nil
+	case "redis":
+		return NewRedisBackend(redisCfg)
+	default:
+		return nil, fmt.Errorf("unknown queue backend: %s", cfg.Backend)
+	}
+}
+
+// MemoryBackend keeps the queue in process memory. Jobs are stored encoded,
+// as in a shared backend, so callers never share them.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	queue   []memoryEntry
+	states  map[string][]byte
+	cancels map[string]CancelRequest
+}
+
+type memoryEntry struct {
+	id       string
+	priority models.JobPriority
+	payload  []byte
+}
+
+// NewMemoryBackend creates an in-memory queue backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		queue:   make([]memoryEntry, 0),
+		states:  make(map[string][]byte),
+		cancels: make(map[string]CancelRequest),
+	}
+}
+
+// Push inserts a job into the queue sorted by priority
+func (b *MemoryBackend) Push(ctx context.Context, job *models.Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Find insertion point
+	insertIdx := len(b.queue)
+	for i, e := range b.queue {
+		if job.Priority > e.priority {
+			insertIdx = i
+			break
+		}
+	}
+
+	// Insert at position
+	entry := memoryEntry{id: job.ID, priority: job.Priority, payload: payload}
+	b.queue = append(b.queue[:insertIdx], append([]memoryEntry{entry}, b.queue[insertIdx:]...)...)
+	return nil
+}
+
+// Remove removes a job from the queue
+func (b *MemoryBackend) Remove(ctx context.Context, jobID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(jobID)
+	return nil
+}
+
+// Claim removes a job from the queue
+func (b *MemoryBackend) Claim(ctx context.Context, jobID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remove(jobID), nil
+}
+
+// List returns a snapshot of the queue
+func (b *MemoryBackend) List(ctx context.Context) ([]*models.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]*models.Job, 0, len(b.queue))
+	for _, e := range b.queue {
+		job, err := decodeJob(e.payload)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Publish stores the job's state
+func (b *MemoryBackend) Publish(ctx context.Context, job *models.Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.states[job.ID] = payload
+	return nil
+}
+
+// Published returns the stored states of the jobs given
+func (b *MemoryBackend) Published(ctx context.Context, jobIDs []string) ([]*models.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]*models.Job, 0, len(jobIDs))
+	for _, id := range jobIDs {
+		payload, ok := b.states[id]
+		if !ok {
+			continue
+		}
+		job, err := decodeJob(payload)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// PublishedIDs lists the jobs with a stored state
+func (b *MemoryBackend) PublishedIDs(ctx context.Context) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]string, 0, len(b.states))
+	for id := range b.states {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Unpublish drops the job's state
+func (b *MemoryBackend) Unpublish(ctx context.Context, jobID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, jobID)
+	return nil
+}
+
+// RequestCancel stores the request, replacing any earlier one for the job
+func (b *MemoryBackend) RequestCancel(ctx context.Context, req CancelRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cancels[req.JobID] = req
+	return nil
+}
+
+// TakeCancelRequests removes and returns the stored requests of the jobs
+func (b *MemoryBackend) TakeCancelRequests(ctx context.Context, jobIDs []string) ([]CancelRequest, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var reqs []CancelRequest
+	for _, id := range jobIDs {
+		if req, ok := b.cancels[id]; ok {
+			reqs = append(reqs, req)
+			delete(b.cancels, id)
+		}
+	}
+	return reqs, nil
+}
+
+func (b *MemoryBackend) remove(jobID string) bool {
+	for i, e := range b.queue {
+		if e.id == jobID {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func decodeJob(payload []byte) (*models.Job, error) {
+	var job models.Job
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
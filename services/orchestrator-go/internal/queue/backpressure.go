@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// ErrQueueFull is returned when a submission would take the queue, or its
+// project's share of it, past the configured depth
+var ErrQueueFull = NewQueueError("queue is full")
+
+// QueueFullError reports the depth limit a submission ran into, and about
+// how long until a worker frees up
+type QueueFullError struct {
+	// ProjectID is set when the project's limit was reached, empty for the
+	// global one
+	ProjectID  string
+	Depth      int
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	if e.ProjectID != "" {
+		return fmt.Sprintf("%s (project %s has %d of %d jobs waiting)", ErrQueueFull, e.ProjectID, e.Depth, e.Limit)
+	}
+	return fmt.Sprintf("%s (%d of %d jobs waiting)", ErrQueueFull, e.Depth, e.Limit)
+}
+
+func (e *QueueFullError) Unwrap() error {
+	return ErrQueueFull
+}
+
+// checkQueueDepth refuses a project's submission while the project or the
+// whole queue has as many jobs waiting as it may. A project's own
+// max_queue_depth overrides the configured per-project default. Callers
+// hold m.mu.
+func (m *Manager) checkQueueDepth(projectID string) error {
+	limit := m.cfg.ProjectMaxQueueDepth
+	if settings, _ := m.projects.Get(projectID); settings.MaxQueueDepth > 0 {
+		limit = settings.MaxQueueDepth
+	}
+	if limit == 0 && m.cfg.MaxQueueDepth == 0 {
+		return nil
+	}
+
+	var depth, projectDepth int
+	for _, job := range m.jobs {
+		if job.Status != models.JobStatusPending && job.Status != models.JobStatusQueued {
+			continue
+		}
+		depth++
+		if job.ProjectID == projectID {
+			projectDepth++
+		}
+	}
+
+	if limit > 0 && projectDepth >= limit {
+		return &QueueFullError{ProjectID: projectID, Depth: projectDepth, Limit: limit, RetryAfter: m.retryAfter()}
+	}
+	if m.cfg.MaxQueueDepth > 0 && depth >= m.cfg.MaxQueueDepth {
+		return &QueueFullError{Depth: depth, Limit: m.cfg.MaxQueueDepth, RetryAfter: m.retryAfter()}
+	}
+	return nil
+}
+
+// retryAfter estimates how soon a worker frees up: the mean run spread
+// across the workers, or half a minute before any run has finished
+func (m *Manager) retryAfter() time.Duration {
+	run := m.latency.meanRun()
+	if run == 0 || m.cfg.MaxParallelJobs <= 0 {
+		return 30 * time.Second
+	}
+	return max(run/time.Duration(m.cfg.MaxParallelJobs), time.Second)
+}
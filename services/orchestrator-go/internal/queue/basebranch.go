@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// baseBranchCheckTimeout bounds how long a submission waits on the remote
+const baseBranchCheckTimeout = 10 * time.Second
+
+// ErrBaseBranchNotFound is returned for jobs based on a branch their
+// repository does not have
+var ErrBaseBranchNotFound = NewQueueError("base branch not found")
+
+// checkBaseBranch asks the repository's remote whether a job's base branch
+// exists, so a mistyped branch is rejected at submission rather than failing
+// the job deep in git. A remote that cannot be reached lets the job through;
+// the branch is checked again when its worktree is created.
+func (m *Manager) checkBaseBranch(ctx context.Context, projectID, repo, branch string) error {
+	if !m.cfg.CheckBaseBranch || branch == "" || repo == "" || m.worktreeManager == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, baseBranchCheckTimeout)
+	defer cancel()
+	exists, err := m.worktreeManager.RemoteBranchExists(ctx, projectID, repo, branch)
+	if err != nil {
+		log.Warn().Err(err).
+			Str("project_id", projectID).
+			Str("base_branch", branch).
+			Msg("Could not check the base branch, accepting the job")
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s has no branch %s", ErrBaseBranchNotFound, repo, branch)
+	}
+	return nil
+}
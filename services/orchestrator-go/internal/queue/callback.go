@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// deliverResult forwards a finished job's result to the submitter's callback
+// destination in the background, recording delivery progress on the job
+func (m *Manager) deliverResult(job *models.Job) {
+	dest := m.delivery.Destination(job.ProjectID, job.CallbackURL)
+	if dest == "" || job.Delivery != nil {
+		return
+	}
+	// Delivered once its matrix runs have all reported
+	if job.QAStatus == models.QAStatusPending {
+		return
+	}
+
+	result := resultFor(job)
+	result.Message = m.resultMessage(job, result)
+	event := "job." + string(job.Status)
+	secret := job.CallbackSecret
+	job.Delivery = &models.Delivery{Status: models.DeliveryStatusPending}
+
+	go func() {
+		attempts, err := m.delivery.Deliver(context.Background(), dest, secret, event, result)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		job.Delivery.Attempts = attempts
+		if err != nil {
+			job.Delivery.Status = models.DeliveryStatusFailed
+			job.Delivery.LastError = err.Error()
+			log.Error().Err(err).Str("job_id", job.ID).Int("attempts", attempts).Msg("Failed to deliver job result")
+			return
+		}
+
+		now := time.Now()
+		job.Delivery.Status = models.DeliveryStatusDelivered
+		job.Delivery.DeliveredAt = &now
+		log.Info().Str("job_id", job.ID).Int("attempts", attempts).Msg("Delivered job result")
+	}()
+}
+
+// ValidateDestination checks that results can be delivered to a job's
+// callback destination
+func (m *Manager) ValidateDestination(dest string) error {
+	return m.delivery.ValidateCallback(dest)
+}
+
+// resultFor builds the result reported for a finished job. Jobs that ended
+// without a callback (dispatch failures, cancellations) get one synthesized.
+func resultFor(job *models.Job) *models.JobResult {
+	if job.Result != nil {
+		result := *job.Result
+		result.JobID = job.ID
+		result.TicketID = job.TicketID
+		return &result
+	}
+
+	status := "failure"
+	switch job.Status {
+	case models.JobStatusCompleted:
+		status = "success"
+	case models.JobStatusCancelled:
+		status = "cancelled"
+	}
+
+	return &models.JobResult{
+		JobID:      job.ID,
+		TicketID:   job.TicketID,
+		Status:     status,
+		RunID:      job.RunID,
+		Error:      job.ErrorMessage,
+		ReceivedAt: time.Now(),
+	}
+}
@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// checkPollInterval is how often pending QA checks are checked against
+	// the check timeout
+	checkPollInterval = time.Minute
+	// checkDispatchTimeout bounds starting one QA check's workflow
+	checkDispatchTimeout = 30 * time.Second
+)
+
+// awaitingChecks reports whether a job's run succeeded and the job is
+// waiting on its project's QA checks
+func awaitingChecks(job *models.Job) bool {
+	return len(job.Checks) > 0 && !job.Status.IsTerminal()
+}
+
+// startChecks starts the QA checks of a successful implementation run's
+// project on the run's branch, leaving the job running until they report.
+// It reports whether there were any. Callers must hold m.mu.
+func (m *Manager) startChecks(job *models.Job, result *models.JobResult, actor string) bool {
+	if result.Status != "success" || job.StopRequestedAt != nil ||
+		job.Kind != models.JobKindImplementation || job.RepoFullName == "" {
+		return false
+	}
+	settings, _ := m.projects.Get(job.ProjectID)
+	if len(settings.QAChecks) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	job.Checks = make([]models.CheckResult, len(settings.QAChecks))
+	for i, check := range settings.QAChecks {
+		job.Checks[i] = models.CheckResult{QACheck: check, Status: models.CheckStatusPending, StartedAt: now}
+	}
+	transition(job, models.JobStatusRunning, actor, "run succeeded, waiting for QA checks")
+	m.jobLog(job.ID, logSourceOrchestrator, "Running %d QA checks on %s", len(job.Checks), job.BranchName)
+	log.Info().Str("job_id", job.ID).Int("checks", len(job.Checks)).Msg("Starting QA checks")
+
+	go m.dispatchChecks(job.ID, job.RepoFullName, job.BranchName, settings.QAChecks)
+	return true
+}
+
+// dispatchChecks runs the workflow of each QA check on a job's branch. A
+// check whose workflow cannot be started fails, and with it the job.
+func (m *Manager) dispatchChecks(jobID, repo, branch string, checks []models.QACheck) {
+	for _, check := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), checkDispatchTimeout)
+		err := m.github.DispatchWorkflow(ctx, repo, check.Workflow, branch)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		log.Error().Err(err).Str("job_id", jobID).Str("check", check.Name).Msg("Failed to start QA check")
+		m.lock(lockResult)
+		if job, ok := m.jobs[jobID]; ok && awaitingChecks(job) {
+			for i := range job.Checks {
+				if job.Checks[i].Name == check.Name && job.Checks[i].Status == models.CheckStatusPending {
+					m.completeCheck(job, &job.Checks[i], models.CheckStatusFailed, "not started: "+err.Error(), actorOrchestrator)
+				}
+			}
+		}
+		m.mu.Unlock()
+		return
+	}
+}
+
+// handleCheckRun records a workflow run of one of the QA checks a job is
+// waiting on, reporting whether the run was one. Callers must hold m.mu.
+func (m *Manager) handleCheckRun(update *models.WorkflowRunUpdate) bool {
+	if update.Workflow == "" {
+		return false
+	}
+	workflow := path.Base(update.Workflow)
+
+	for _, job := range m.jobs {
+		if !awaitingChecks(job) || job.BranchName != update.Branch || job.RepoFullName != update.RepoFullName {
+			continue
+		}
+		for i := range job.Checks {
+			check := &job.Checks[i]
+			if check.Workflow != workflow || (check.RunID != "" && check.RunID != update.RunID) {
+				continue
+			}
+			check.RunID = update.RunID
+			if update.URL != "" {
+				check.RunURL = update.URL
+			}
+			if check.Status != models.CheckStatusPending || update.Status != "completed" {
+				return true
+			}
+			status := models.CheckStatusPassed
+			if update.Conclusion != "success" {
+				status = models.CheckStatusFailed
+			}
+			m.completeCheck(job, check, status, update.Conclusion, runSCM(update)+" (webhook)")
+			return true
+		}
+	}
+	return false
+}
+
+// completeCheck records the outcome of one of a job's QA checks, ending the
+// job once one has failed or all have passed. Callers must hold m.mu.
+func (m *Manager) completeCheck(job *models.Job, check *models.CheckResult, status models.CheckStatus, conclusion, actor string) {
+	now := time.Now()
+	check.Status = status
+	check.Conclusion = conclusion
+	check.CompletedAt = &now
+	m.jobLog(job.ID, logSourceOrchestrator, "QA check %s %s: %s", check.Name, status, conclusion)
+	log.Info().Str("job_id", job.ID).Str("check", check.Name).Str("status", string(status)).Msg("QA check finished")
+
+	if status == models.CheckStatusPassed {
+		for _, c := range job.Checks {
+			if c.Status == models.CheckStatusPending {
+				return
+			}
+		}
+	}
+
+	result := *job.Result
+	if status == models.CheckStatusFailed {
+		result.Status = "failure"
+		result.Error = "QA check " + check.Name + " failed: " + conclusion
+		result.FailureKind = models.FailureKindQACheck
+	}
+	job.Result = &result
+	m.finishResult(job, &result, actor)
+}
+
+// runCheckTimeouts fails QA checks that have not reported within the check
+// timeout
+func (m *Manager) runCheckTimeouts(ctx context.Context) {
+	if m.cfg.QACheckTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(checkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.expireChecks()
+		}
+	}
+}
+
+func (m *Manager) expireChecks() {
+	m.lock(lockResult)
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if !awaitingChecks(job) {
+			continue
+		}
+		for i := range job.Checks {
+			check := &job.Checks[i]
+			if check.Status == models.CheckStatusPending && time.Since(check.StartedAt) >= m.cfg.QACheckTimeout {
+				m.completeCheck(job, check, models.CheckStatusFailed, "timed out", actorOrchestrator)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/jobtoken"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Callback tokens rejected for the job they were sent for
+var (
+	ErrTokenOtherJob    = NewQueueError("callback token was issued for another job")
+	ErrTokenPastAttempt = NewQueueError("callback token was issued for an earlier attempt")
+)
+
+// SetCallbackTokens makes runs of executors that report back through
+// callbacks dispatch with a token from issuer, which callbacks must carry
+func (m *Manager) SetCallbackTokens(issuer *jobtoken.Issuer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callbackTokens = issuer
+}
+
+// SetRepoTokens makes those runs also get an installation token scoped to
+// the job's repository, revoked when the run ends
+func (m *Manager) SetRepoTokens() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.repoTokens = true
+}
+
+// issueCredentials mints the credentials for a run of job on executor. It
+// returns nil for executors that run the agent here, which need neither.
+func (m *Manager) issueCredentials(ctx context.Context, job models.Job, executor string) (*models.JobCredentials, error) {
+	if m.callbackTokens == nil || executor == models.ExecutorLocal || executor == models.ExecutorDocker {
+		return nil, nil
+	}
+
+	token, expiresAt, err := m.callbackTokens.Issue(job.ID, job.RetryCount+1)
+	if err != nil {
+		return nil, err
+	}
+	creds := &models.JobCredentials{
+		CallbackToken:          token,
+		CallbackTokenExpiresAt: expiresAt,
+	}
+	if m.repoTokens && job.RepoFullName != "" && m.github.Configured() && m.onGitHub(job.ProjectID) {
+		repoToken, err := m.github.RepoToken(ctx, job.RepoFullName)
+		if err != nil {
+			return nil, err
+		}
+		creds.RepoToken = repoToken.Token
+		creds.RepoTokenExpiresAt = &repoToken.ExpiresAt
+	}
+	return creds, nil
+}
+
+// revokeCredentials revokes the credentials of a job's finished run, the
+// installation token in the background. Its callback token stops working
+// on its own once the job finishes or moves on to another attempt. Callers
+// must hold m.mu.
+func (m *Manager) revokeCredentials(job *models.Job) {
+	creds := job.Credentials
+	if creds == nil || creds.RevokedAt != nil {
+		return
+	}
+	now := time.Now()
+	creds.RevokedAt = &now
+
+	if creds.RepoToken == "" || creds.RepoTokenExpiresAt.Before(now) {
+		return
+	}
+	token, jobID := creds.RepoToken, job.ID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := m.github.RevokeToken(ctx, token); err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to revoke job installation token")
+		}
+	}()
+}
+
+// VerifyCallbackToken checks that a callback token is valid and was issued
+// for the current attempt of jobID, which has not finished. Invalid tokens
+// return one of the jobtoken errors.
+func (m *Manager) VerifyCallbackToken(token, jobID string) error {
+	if m.callbackTokens == nil {
+		return errors.New("callback tokens are not configured")
+	}
+	claims, err := m.callbackTokens.Verify(token)
+	if err != nil {
+		return err
+	}
+	if claims.JobID != jobID {
+		return ErrTokenOtherJob
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.Status.IsTerminal() {
+		return ErrJobAlreadyCompleted
+	}
+	if claims.Attempt != job.RetryCount+1 {
+		return ErrTokenPastAttempt
+	}
+	return nil
+}
+
+// onGitHub reports whether a project's repository is hosted on GitHub, so
+// GitHub's API applies to it
+func (m *Manager) onGitHub(projectID string) bool {
+	settings, _ := m.projects.Get(projectID)
+	return settings.SCM == "" || settings.SCM == models.SCMGitHub
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// schedulingDeadline is the QueueConfig.Scheduling that takes the jobs of
+// each priority earliest deadline first
+const schedulingDeadline = "deadline"
+
+// deadlineOrder reorders the queue, which comes sorted by priority then
+// age, so that within each priority jobs with deadlines come first, the
+// earliest first. Jobs without one keep their order behind them.
+func deadlineOrder(queued []*models.Job) {
+	sort.SliceStable(queued, func(i, j int) bool {
+		a, b := queued[i], queued[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Deadline == nil || b.Deadline == nil {
+			return a.Deadline != nil && b.Deadline == nil
+		}
+		return a.Deadline.Before(*b.Deadline)
+	})
+}
+
+// flagDeadlines estimates when each queued job will finish, with every
+// worker taking the next job in queue order and runs lasting as long as
+// they have on average, and flags those that would miss their deadlines.
+// Running jobs count as just started. Nothing is flagged before any run
+// has finished. The caller must hold m.mu.
+func (m *Manager) flagDeadlines(queued []*models.Job) {
+	run := m.latency.meanRun()
+	workers := m.cfg.MaxParallelJobs
+	if run == 0 || workers <= 0 {
+		return
+	}
+
+	now := time.Now()
+	ahead := m.workers.inUse()
+	for _, queuedJob := range queued {
+		job, ok := m.jobs[queuedJob.ID]
+		if !ok || job.Status != models.JobStatusPending {
+			continue
+		}
+		finish := now.Add(time.Duration(ahead/workers+1) * run)
+		ahead++
+		if job.Deadline == nil {
+			continue
+		}
+
+		atRisk := finish.After(*job.Deadline)
+		if atRisk && !job.DeadlineAtRisk {
+			m.jobLog(job.ID, logSourceOrchestrator, "Deadline %s will likely be missed: at the current throughput the job finishes around %s",
+				job.Deadline.UTC().Format(time.RFC3339), finish.UTC().Format(time.RFC3339))
+			log.Warn().Str("job_id", job.ID).Time("deadline", *job.Deadline).Time("estimated_finish", finish).Msg("Job deadline at risk")
+		}
+		job.DeadlineAtRisk = atRisk
+	}
+}
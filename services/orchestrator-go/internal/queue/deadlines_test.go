@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// dueIn returns a deadline d from now
+func dueIn(d time.Duration) *time.Time {
+	t := time.Now().Add(d)
+	return &t
+}
+
+func TestDeadlineOrder(t *testing.T) {
+	queued := []*models.Job{
+		{ID: "none-1"},
+		{ID: "late", Deadline: dueIn(2 * time.Hour)},
+		{ID: "none-2"},
+		{ID: "soon", Deadline: dueIn(time.Hour)},
+	}
+	deadlineOrder(queued)
+	if got, want := jobIDs(queued), "soon late none-1 none-2"; got != want {
+		t.Fatalf("deadlineOrder = %s, want %s", got, want)
+	}
+}
+
+// TestDeadlineOrderKeepsPriority orders by deadline only among jobs of the
+// same priority; a deadline never lifts a job over a higher priority
+func TestDeadlineOrderKeepsPriority(t *testing.T) {
+	queued := []*models.Job{
+		{ID: "high-none", Priority: models.PriorityHigh},
+		{ID: "high-late", Priority: models.PriorityHigh, Deadline: dueIn(time.Hour)},
+		{ID: "normal-soon", Priority: models.PriorityNormal, Deadline: dueIn(time.Minute)},
+		{ID: "low-none", Priority: models.PriorityLow},
+		{ID: "low-soon", Priority: models.PriorityLow, Deadline: dueIn(time.Minute)},
+	}
+	deadlineOrder(queued)
+	if got, want := jobIDs(queued), "high-late high-none normal-soon low-soon low-none"; got != want {
+		t.Fatalf("deadlineOrder = %s, want %s", got, want)
+	}
+}
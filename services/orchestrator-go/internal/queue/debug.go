@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// DebugDump snapshots the scheduler's state along with the worktree
+// manager's. The queue lock is held throughout, so nothing is dispatched,
+// finished or bound to a worktree part way through.
+func (m *Manager) DebugDump(ctx context.Context) *models.DebugDump {
+	m.lock(lockDump)
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	state := models.QueueDebugState{
+		Leader:          m.isLeader(),
+		Draining:        m.drainStartedAt != nil,
+		Order:           []models.QueuedJobState{},
+		ActiveJobs:      make(map[string]int, len(m.activeJobs)),
+		ReservedSlots:   m.reservedSlots(now),
+		WorkerSlotsHeld: m.workers.inUse(),
+		WorkerSlotsMax:  m.cfg.MaxParallelJobs,
+		PendingResults:  m.pendingResults.Load(),
+		JobsByStatus:    make(map[string]int),
+		Bindings:        []models.WorktreeBinding{},
+	}
+	if m.paused != nil {
+		pause := *m.paused
+		state.Paused = &pause
+	}
+	for projectID, n := range m.activeJobs {
+		state.ActiveJobs[projectID] = n
+	}
+
+	queued, err := m.backend.List(ctx)
+	if err != nil {
+		state.OrderError = err.Error()
+	}
+	for _, q := range queued {
+		// Another orchestrator's jobs are listed by their queued copy
+		job, ok := m.jobs[q.ID]
+		if !ok {
+			job = q
+		}
+		state.Order = append(state.Order, models.QueuedJobState{
+			JobID:     job.ID,
+			ProjectID: job.ProjectID,
+			Priority:  job.Priority,
+			Status:    job.Status,
+			CreatedAt: job.CreatedAt,
+		})
+	}
+
+	for _, job := range m.jobs {
+		state.JobsByStatus[string(job.Status)]++
+		if job.Status.IsTerminal() {
+			continue
+		}
+		state.Bindings = append(state.Bindings, models.WorktreeBinding{
+			JobID:      job.ID,
+			Status:     job.Status,
+			WorktreeID: job.WorktreeID,
+		})
+	}
+	sort.Slice(state.Bindings, func(i, j int) bool {
+		return state.Bindings[i].JobID < state.Bindings[j].JobID
+	})
+
+	return &models.DebugDump{
+		TakenAt:   now,
+		Queue:     state,
+		Worktrees: m.worktreeManager.DebugState(),
+	}
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// What Submit does with a probable duplicate (QueueConfig.DedupMode)
+const (
+	// dedupFlag queues the duplicate, marked with the job it duplicates
+	dedupFlag = "flag"
+	// dedupLink parks the duplicate until the earlier job's result is known
+	dedupLink = "link"
+	// dedupReuse returns the earlier job instead of creating another
+	dedupReuse = "reuse"
+)
+
+// fingerprintPrompt hashes a project's prompt so that submissions differing
+// only in case, whitespace or punctuation produce the same fingerprint
+func fingerprintPrompt(projectID, prompt string) string {
+	words := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	normalized := strings.Join(words, " ")
+
+	sum := sha256.Sum256([]byte(projectID + "\x00" + normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// findDuplicate returns the most recent job from another ticket with the same
+// fingerprint inside the dedup window. Failed and cancelled jobs are ignored
+// so that a genuine retry is never linked to a dead result.
+func (m *Manager) findDuplicate(job *models.Job) *models.Job {
+	cutoff := job.CreatedAt.Add(-m.cfg.DedupWindow)
+
+	var match *models.Job
+	for _, j := range m.jobs {
+		if j.Fingerprint != job.Fingerprint || j.TicketID == job.TicketID {
+			continue
+		}
+		if j.Status == models.JobStatusFailed || j.Status == models.JobStatusCancelled {
+			continue
+		}
+		if j.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if match == nil || j.CreatedAt.After(match.CreatedAt) {
+			match = j
+		}
+	}
+	return match
+}
+
+// linkToOriginal parks a duplicate job until the original finishes, or
+// completes it immediately if the original already has a result
+func (m *Manager) linkToOriginal(job, orig *models.Job) {
+	if orig.Status == models.JobStatusCompleted {
+		m.completeFromOriginal(job, orig)
+		return
+	}
+	m.linked[orig.ID] = append(m.linked[orig.ID], job)
+}
+
+// resolveLinked settles the duplicates waiting on a job that just reached a
+// terminal state. Duplicates of a successful job share its result; otherwise
+// they are queued to run on their own.
+func (m *Manager) resolveLinked(orig *models.Job) {
+	dups, ok := m.linked[orig.ID]
+	if !ok {
+		return
+	}
+	delete(m.linked, orig.ID)
+
+	for _, job := range dups {
+		if job.Status != models.JobStatusPending {
+			continue
+		}
+
+		if orig.Status == models.JobStatusCompleted {
+			m.completeFromOriginal(job, orig)
+			continue
+		}
+
+		transition(job, models.JobStatusPending, actorOrchestrator, "job "+orig.ID+" did not succeed, queued to run on its own")
+		m.enqueue(job)
+
+		log.Info().
+			Str("job_id", job.ID).
+			Str("original_job_id", orig.ID).
+			Msg("Original job did not succeed, queueing duplicate")
+	}
+}
+
+// unlink removes a job from the duplicates waiting on its original
+func (m *Manager) unlink(job *models.Job) {
+	dups := m.linked[job.DuplicateOf]
+	for i, j := range dups {
+		if j.ID == job.ID {
+			m.linked[job.DuplicateOf] = append(dups[:i], dups[i+1:]...)
+			return
+		}
+	}
+}
+
+// completeFromOriginal marks a duplicate job completed with the original's
+// result. Later duplicates may have been linked to this one rather than to
+// the original, so they are settled with it.
+func (m *Manager) completeFromOriginal(job, orig *models.Job) {
+	now := time.Now()
+	transition(job, models.JobStatusCompleted, actorOrchestrator, "completed with the result of job "+orig.ID)
+	job.CompletedAt = &now
+	job.Result = orig.Result
+	m.deliverResult(job)
+	m.settleGroup(job)
+	m.resolveLinked(job)
+
+	log.Info().
+		Str("job_id", job.ID).
+		Str("original_job_id", orig.ID).
+		Msg("Duplicate job completed with original job's result")
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+func TestFingerprintPrompt(t *testing.T) {
+	fp := fingerprintPrompt("p", "Add a widget")
+	if got := fingerprintPrompt("p", "  add a\tWIDGET "); got != fp {
+		t.Error("case and whitespace change the fingerprint")
+	}
+	if got := fingerprintPrompt("p", "Add a widget."); got != fp {
+		t.Error("punctuation changes the fingerprint")
+	}
+	if got := fingerprintPrompt("p", "Remove a widget"); got == fp {
+		t.Error("another prompt has the same fingerprint")
+	}
+	if got := fingerprintPrompt("q", "Add a widget"); got == fp {
+		t.Error("the same prompt in another project has the same fingerprint")
+	}
+}
+
+// linkChain holds a running job, a duplicate waiting on it and a second
+// duplicate waiting on the first
+func linkChain(m *Manager) (orig, dup, next *models.Job) {
+	orig = &models.Job{ID: "orig", ProjectID: "p", Status: models.JobStatusRunning}
+	dup = &models.Job{ID: "dup-1", ProjectID: "p", Status: models.JobStatusPending, DuplicateOf: orig.ID}
+	next = &models.Job{ID: "dup-2", ProjectID: "p", Status: models.JobStatusPending, DuplicateOf: dup.ID}
+	addJobs(m, orig, dup, next)
+	m.linkToOriginal(dup, orig)
+	m.linkToOriginal(next, dup)
+	return orig, dup, next
+}
+
+// finish ends a job the way completing a dispatch does
+func finish(m *Manager, job *models.Job, status models.JobStatus) {
+	now := time.Now()
+	job.Status, job.CompletedAt = status, &now
+	job.Result = &models.JobResult{JobID: job.ID, Status: "success", PRUrl: "https://example.com/pr/1"}
+	m.resolveLinked(job)
+}
+
+func TestLinkChainCompletes(t *testing.T) {
+	m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+	orig, dup, next := linkChain(m)
+	finish(m, orig, models.JobStatusCompleted)
+
+	for _, job := range []*models.Job{dup, next} {
+		if job.Status != models.JobStatusCompleted || job.Result != orig.Result {
+			t.Errorf("%s is %s with result %+v, want completed with the original's", job.ID, job.Status, job.Result)
+		}
+	}
+	if len(m.linked) != 0 {
+		t.Errorf("%d jobs left waiting", len(m.linked))
+	}
+}
+
+// TestLinkChainOriginalFails queues the first duplicate to run on its own
+// and leaves the second waiting on it
+func TestLinkChainOriginalFails(t *testing.T) {
+	m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+	orig, dup, next := linkChain(m)
+	finish(m, orig, models.JobStatusFailed)
+
+	queued, err := m.backend.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(queued); got != dup.ID {
+		t.Fatalf("queued %q, want %s", got, dup.ID)
+	}
+	if next.Status != models.JobStatusPending || len(m.linked[dup.ID]) != 1 {
+		t.Fatalf("%s is %s with %d jobs waiting on %s, want it pending and waiting", next.ID, next.Status, len(m.linked[dup.ID]), dup.ID)
+	}
+}
+
+func TestLinkToCompletedOriginal(t *testing.T) {
+	m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+	orig := &models.Job{ID: "orig", ProjectID: "p", Status: models.JobStatusCompleted, Result: &models.JobResult{Status: "success"}}
+	dup := &models.Job{ID: "dup", ProjectID: "p", Status: models.JobStatusPending, DuplicateOf: orig.ID}
+	addJobs(m, orig, dup)
+
+	m.linkToOriginal(dup, orig)
+	if dup.Status != models.JobStatusCompleted || dup.Result != orig.Result || dup.CompletedAt == nil {
+		t.Fatalf("duplicate of a completed job is %s with result %+v, want completed with the original's", dup.Status, dup.Result)
+	}
+	if len(m.linked) != 0 {
+		t.Fatalf("%d jobs left waiting", len(m.linked))
+	}
+}
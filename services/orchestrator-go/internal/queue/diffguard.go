@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+const (
+	// areaDepth is how many leading directories name a touched area
+	areaDepth = 2
+	// maxSplitAreas bounds the areas listed in a split suggestion
+	maxSplitAreas = 20
+)
+
+// diffLimit returns the project's diff limit, or the configured default;
+// nil when neither bounds anything
+func (m *Manager) diffLimit(projectID string) *models.DiffLimit {
+	if settings, ok := m.projects.Get(projectID); ok && settings.DiffLimit != nil {
+		return settings.DiffLimit
+	}
+	if m.cfg.DiffMaxLines <= 0 && m.cfg.DiffMaxFiles <= 0 {
+		return nil
+	}
+	return &models.DiffLimit{
+		MaxLines:     m.cfg.DiffMaxLines,
+		MaxFiles:     m.cfg.DiffMaxFiles,
+		Action:       m.cfg.DiffLimitAction,
+		SuggestSplit: m.cfg.DiffSuggestSplit,
+	}
+}
+
+// checkDiff holds a successful implementation run to its diff limit. An
+// oversized diff fails the run, or with the flag action is only marked,
+// and either way the result suggests splitting the ticket. Runs that did
+// not report their diff are not checked.
+func (m *Manager) checkDiff(job *models.Job, result *models.JobResult) {
+	if job.Kind != models.JobKindImplementation || result.Status != "success" || result.Diff == nil {
+		return
+	}
+	limit := m.diffLimit(job.ProjectID)
+	if limit == nil {
+		return
+	}
+
+	lines, files := result.Diff.Lines(), len(result.Diff.Files)
+	var over []string
+	if limit.MaxLines > 0 && lines > limit.MaxLines {
+		over = append(over, fmt.Sprintf("%d changed lines exceed the limit of %d", lines, limit.MaxLines))
+	}
+	if limit.MaxFiles > 0 && files > limit.MaxFiles {
+		over = append(over, fmt.Sprintf("%d changed files exceed the limit of %d", files, limit.MaxFiles))
+	}
+	if len(over) == 0 {
+		return
+	}
+
+	reason := "diff too large: " + strings.Join(over, " and ") + "; consider splitting the ticket into smaller ones"
+	result.Split = &models.SplitSuggestion{Reason: reason}
+	if limit.SuggestSplit {
+		result.Split.Areas = touchedAreas(result.Diff)
+	}
+	if limit.Action == models.DiffLimitFlag {
+		m.jobLog(job.ID, logSourceOrchestrator, "Flagged: %s", reason)
+		return
+	}
+	m.jobLog(job.ID, logSourceOrchestrator, "Failing run: %s", reason)
+	result.Status = "failure"
+	result.Error = reason
+	result.FailureKind = models.FailureKindDiffTooLarge
+}
+
+// touchedAreas groups a diff's files by their leading directories, largest
+// first. Files at the repository root are grouped as ".".
+func touchedAreas(diff *models.DiffStat) []models.TouchedArea {
+	byPath := make(map[string]*models.TouchedArea)
+	var areas []*models.TouchedArea
+	for _, f := range diff.Files {
+		path := "."
+		if dirs := strings.Split(f.Path, "/"); len(dirs) > 1 {
+			dirs = dirs[:len(dirs)-1]
+			if len(dirs) > areaDepth {
+				dirs = dirs[:areaDepth]
+			}
+			path = strings.Join(dirs, "/")
+		}
+		area, ok := byPath[path]
+		if !ok {
+			area = &models.TouchedArea{Path: path}
+			byPath[path] = area
+			areas = append(areas, area)
+		}
+		area.Files++
+		area.Lines += f.Additions + f.Deletions
+	}
+
+	sort.SliceStable(areas, func(i, j int) bool {
+		if areas[i].Lines != areas[j].Lines {
+			return areas[i].Lines > areas[j].Lines
+		}
+		return areas[i].Path < areas[j].Path
+	})
+	if len(areas) > maxSplitAreas {
+		areas = areas[:maxSplitAreas]
+	}
+	out := make([]models.TouchedArea, len(areas))
+	for i, area := range areas {
+		out[i] = *area
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// drainPollInterval is how often WaitDrained rechecks outstanding work
+const drainPollInterval = time.Second
+
+// Drain stops dispatching new jobs so in-flight work can settle before the
+// instance is stopped. Submissions are still queued for the next instance.
+func (m *Manager) Drain() models.DrainStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.drainStartedAt == nil {
+		now := time.Now()
+		m.drainStartedAt = &now
+		log.Warn().Msg("Draining, dispatching stopped")
+	}
+	return m.drainStatus()
+}
+
+// CancelDrain resumes dispatching after a drain, reporting whether one was in progress
+func (m *Manager) CancelDrain() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.drainStartedAt == nil {
+		return false
+	}
+	m.drainStartedAt = nil
+	log.Info().Msg("Drain cancelled, dispatching restarted")
+	return true
+}
+
+// DrainStatus reports how much in-flight work a drain is waiting for
+func (m *Manager) DrainStatus() models.DrainStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.drainStatus()
+}
+
+// WaitDrained blocks until a drain has settled or ctx is done
+func (m *Manager) WaitDrained(ctx context.Context) models.DrainStatus {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		status := m.DrainStatus()
+		if status.Drained {
+			return status
+		}
+		select {
+		case <-ctx.Done():
+			return status
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainStatus counts dispatched jobs still awaiting a result, results not
+// yet handled and result deliveries still being attempted
+func (m *Manager) drainStatus() models.DrainStatus {
+	status := models.DrainStatus{
+		Draining:       m.drainStartedAt != nil,
+		StartedAt:      m.drainStartedAt,
+		PendingResults: int(m.pendingResults.Load()),
+	}
+	for _, job := range m.jobs {
+		if job.Status == models.JobStatusDispatched || job.Status == models.JobStatusRunning {
+			status.RunningJobs++
+		}
+		if job.Delivery != nil && job.Delivery.Status == models.DeliveryStatusPending {
+			status.PendingDeliveries++
+		}
+	}
+	status.Drained = status.Draining &&
+		status.RunningJobs == 0 &&
+		status.PendingResults == 0 &&
+		status.PendingDeliveries == 0
+	return status
+}
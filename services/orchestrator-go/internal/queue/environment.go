@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/version"
+)
+
+// newEnvironment snapshots the orchestrator side of a job's environment at
+// dispatch to the named executor
+func (m *Manager) newEnvironment(name string) *models.Environment {
+	return &models.Environment{
+		OrchestratorVersion: version.Version,
+		GitVersion:          m.worktreeManager.GitVersion(),
+		Executor:            name,
+	}
+}
+
+// environment returns the job's environment, creating it for jobs picked up
+// by a run without passing through dispatch here
+func (m *Manager) environment(job *models.Job) *models.Environment {
+	if job.Environment == nil {
+		job.Environment = m.newEnvironment(m.jobExecutor(job).Name())
+	}
+	return job.Environment
+}
+
+// applyRunnerUpdate records the runner reported by a workflow_job webhook
+func (m *Manager) applyRunnerUpdate(job *models.Job, update *models.WorkflowRunUpdate) {
+	if update.RunnerName == "" && len(update.RunnerLabels) == 0 {
+		return
+	}
+	env := m.environment(job)
+	if update.RunnerName != "" {
+		env.RunnerName = update.RunnerName
+	}
+	if len(update.RunnerLabels) > 0 {
+		env.RunnerLabels = update.RunnerLabels
+	}
+}
+
+// applyResultEnvironment records what the run itself reported
+func (m *Manager) applyResultEnvironment(job *models.Job, result *models.JobResult) {
+	if result.BaseSHA == "" && result.RunnerName == "" && result.RunnerImage == "" {
+		return
+	}
+	env := m.environment(job)
+	if result.BaseSHA != "" {
+		env.BaseSHA = result.BaseSHA
+	}
+	if result.RunnerName != "" {
+		env.RunnerName = result.RunnerName
+	}
+	if result.RunnerImage != "" {
+		env.ExecutorImage = result.RunnerImage
+	}
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// actorOrchestrator is the actor of state changes the orchestrator makes itself
+const actorOrchestrator = "orchestrator"
+
+// actorOf names the caller behind a scope for the event trail. Scopes that
+// cannot name themselves are reported as the orchestrator.
+func actorOf(scope Scope) string {
+	if s, ok := scope.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return actorOrchestrator
+}
+
+// recordCreated starts a new job's event trail at its initial status
+func recordCreated(job *models.Job, actor, reason string) {
+	appendEvent(job, "", job.Status, actor, reason)
+}
+
+// transition moves a job to a new status and records who did it and why.
+// Only pending jobs are held back, so leaving pending clears the reason.
+func transition(job *models.Job, to models.JobStatus, actor, reason string) {
+	appendEvent(job, job.Status, to, actor, reason)
+	job.Status = to
+	if to != models.JobStatusPending {
+		job.BlockedReason = ""
+	}
+}
+
+func appendEvent(job *models.Job, from, to models.JobStatus, actor, reason string) {
+	event := models.JobEvent{
+		Seq:    len(job.Events) + 1,
+		At:     time.Now(),
+		From:   from,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+	}
+	job.Events = append(job.Events, event)
+
+	log.Debug().
+		Str("job_id", job.ID).
+		Str("from", string(from)).
+		Str("to", string(to)).
+		Str("actor", actor).
+		Str("reason", reason).
+		Msg("Job state changed")
+}
+
+// JobEvents returns a copy of a job's event trail, looking in the archive
+// for jobs evicted from memory
+func (m *Manager) JobEvents(ctx context.Context, jobID string, scope Scope) ([]models.JobEvent, error) {
+	m.mu.RLock()
+	job, ok := m.jobs[jobID]
+	if ok && inScope(scope, job.ProjectID) {
+		events := append([]models.JobEvent{}, job.Events...)
+		m.mu.RUnlock()
+		return events, nil
+	}
+	m.mu.RUnlock()
+
+	archived, found, err := m.GetArchivedJob(ctx, jobID, scope)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrJobNotFound
+	}
+	return append([]models.JobEvent{}, archived.Events...), nil
+}
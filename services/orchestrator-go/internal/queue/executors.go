@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/executor"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrJobNotStarted is returned for run status of jobs not dispatched yet
+var ErrJobNotStarted = NewQueueError("job has not been dispatched")
+
+// SetExecutors registers executors projects may select, alongside GitHub
+// Actions, and makes defaultName the one used by projects that select none.
+// It must be called before Start.
+func (m *Manager) SetExecutors(defaultName string, executors ...executor.Executor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range executors {
+		m.executors[e.Name()] = e
+	}
+	if _, ok := m.executors[defaultName]; !ok {
+		return fmt.Errorf("executor %s is not available", defaultName)
+	}
+	m.defaultExecutor = defaultName
+	return nil
+}
+
+// Executors lists the names of the available executors
+func (m *Manager) Executors() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.executors))
+	for name := range m.executors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectExecutor returns the executor a job is dispatched to, its own or
+// its project's. The caller must hold m.mu.
+func (m *Manager) selectExecutor(job *models.Job) (executor.Executor, error) {
+	name := m.executorName(job)
+	settings, _ := m.projects.Get(job.ProjectID)
+	e, ok := m.executors[name]
+	if !ok {
+		return nil, fmt.Errorf("executor %s is not available", name)
+	}
+	if settings.Egress != nil && !EnforcesEgress(name) {
+		return nil, fmt.Errorf("project %s restricts egress, which the %s executor cannot enforce", job.ProjectID, name)
+	}
+	return e, nil
+}
+
+// executorName names the executor a job selects, or else its project, or
+// the default
+func (m *Manager) executorName(job *models.Job) string {
+	if job.Executor != "" {
+		return job.Executor
+	}
+	if settings, ok := m.projects.Get(job.ProjectID); ok && settings.Executor != "" {
+		return settings.Executor
+	}
+	return m.defaultExecutor
+}
+
+// RunOnly restricts this instance to dispatching jobs of the named
+// executors, leaving the others queued for processes that run them. It must
+// be called before Start.
+func (m *Manager) RunOnly(names ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runOnly = make(map[string]bool)
+	for _, name := range names {
+		if _, ok := m.executors[name]; !ok {
+			return fmt.Errorf("executor %s is not available", name)
+		}
+		m.runOnly[name] = true
+	}
+	return nil
+}
+
+// DefaultExecutor names the executor of projects that select none
+func (m *Manager) DefaultExecutor() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.defaultExecutor
+}
+
+// EnforcesEgress reports whether an executor can restrict the network
+// access of the agents it runs
+func EnforcesEgress(executor string) bool {
+	return executor == models.ExecutorDocker || executor == models.ExecutorKubernetes
+}
+
+// jobExecutor returns the executor running a dispatched job, as recorded
+// in its environment. The caller must hold m.mu.
+func (m *Manager) jobExecutor(job *models.Job) executor.Executor {
+	if job.Environment != nil {
+		if e, ok := m.executors[job.Environment.Executor]; ok {
+			return e
+		}
+	}
+	if e, err := m.selectExecutor(job); err == nil {
+		return e
+	}
+	return m.executors[m.defaultExecutor]
+}
+
+// cancelRun stops a job's run in the background. The caller must hold m.mu.
+func (m *Manager) cancelRun(job *models.Job, hard bool) {
+	e := m.jobExecutor(job)
+	snapshot := *job
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := e.Cancel(ctx, snapshot, hard); err != nil {
+			log.Error().Err(err).Str("job_id", snapshot.ID).Str("executor", e.Name()).Msg("Failed to cancel run")
+		}
+	}()
+}
+
+// RunStatus asks a job's executor where its run is
+func (m *Manager) RunStatus(ctx context.Context, jobID string, scope Scope) (*models.RunStatus, error) {
+	m.mu.RLock()
+	job, ok := m.jobs[jobID]
+	if !ok || !inScope(scope, job.ProjectID) {
+		m.mu.RUnlock()
+		return nil, ErrJobNotFound
+	}
+	if job.DispatchedAt == nil {
+		m.mu.RUnlock()
+		return nil, ErrJobNotStarted
+	}
+	e := m.jobExecutor(job)
+	snapshot := *job
+	m.mu.RUnlock()
+
+	return e.Status(ctx, snapshot)
+}
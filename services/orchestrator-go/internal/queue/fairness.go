@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// schedulingFair is the QueueConfig.Scheduling that interleaves projects
+const schedulingFair = "fair"
+
+// fairOrder reorders the queue, which comes sorted by priority then age,
+// so that projects take turns: each next job is the first queued one of the
+// project with the fewest jobs running or ordered ahead of it, relative to
+// its scheduling weight. Within a project jobs keep their order. The caller
+// must hold m.mu.
+func (m *Manager) fairOrder(queued []*models.Job) []*models.Job {
+	type projectQueue struct {
+		jobs []*models.Job
+		// heads holds the queue positions of jobs, for breaking ties in
+		// favour of the higher priority, older job
+		heads  []int
+		load   int
+		weight int
+	}
+	projects := make(map[string]*projectQueue)
+	var order []*projectQueue
+	for i, job := range queued {
+		pq, ok := projects[job.ProjectID]
+		if !ok {
+			pq = &projectQueue{load: m.activeJobs[job.ProjectID], weight: m.schedulingWeight(job.ProjectID)}
+			projects[job.ProjectID] = pq
+			order = append(order, pq)
+		}
+		pq.jobs = append(pq.jobs, job)
+		pq.heads = append(pq.heads, i)
+	}
+
+	fair := make([]*models.Job, 0, len(queued))
+	for len(fair) < len(queued) {
+		var next *projectQueue
+		for _, pq := range order {
+			if len(pq.jobs) == 0 {
+				continue
+			}
+			if next == nil {
+				next = pq
+				continue
+			}
+			// Compare load/weight without dividing
+			share, nextShare := pq.load*next.weight, next.load*pq.weight
+			if share < nextShare || share == nextShare && pq.heads[0] < next.heads[0] {
+				next = pq
+			}
+		}
+		job := next.jobs[0]
+		next.jobs, next.heads = next.jobs[1:], next.heads[1:]
+		fair = append(fair, job)
+		// Only pending jobs will take a worker
+		if held, ok := m.jobs[job.ID]; !ok || held.Status == models.JobStatusPending {
+			next.load++
+		}
+	}
+	return fair
+}
+
+// schedulingWeight returns a project's share of workers under fair
+// scheduling
+func (m *Manager) schedulingWeight(projectID string) int {
+	if settings, ok := m.projects.Get(projectID); ok && settings.SchedulingWeight > 0 {
+		return settings.SchedulingWeight
+	}
+	return 1
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// queuedJobs makes pending jobs from IDs naming their project before the
+// dash, e.g. a-1, in queue order
+func queuedJobs(ids ...string) []*models.Job {
+	jobs := make([]*models.Job, len(ids))
+	for i, id := range ids {
+		projectID, _, _ := strings.Cut(id, "-")
+		jobs[i] = &models.Job{ID: id, ProjectID: projectID, Status: models.JobStatusPending}
+	}
+	return jobs
+}
+
+func jobIDs(jobs []*models.Job) string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestFairOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		queued  []string
+		running map[string]int
+		want    string
+	}{
+		{
+			name:   "projects take turns",
+			queued: []string{"a-1", "a-2", "a-3", "b-1"},
+			want:   "a-1 b-1 a-2 a-3",
+		},
+		{
+			name:    "running jobs count",
+			queued:  []string{"a-1", "a-2", "b-1", "b-2"},
+			running: map[string]int{"a": 2},
+			want:    "b-1 b-2 a-1 a-2",
+		},
+		{
+			name:   "one project keeps its order",
+			queued: []string{"a-1", "a-2", "a-3"},
+			want:   "a-1 a-2 a-3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+			for projectID, n := range tt.running {
+				m.activeJobs[projectID] = n
+			}
+			queued := queuedJobs(tt.queued...)
+			addJobs(m, queued...)
+
+			if got := jobIDs(m.fairOrder(queued)); got != tt.want {
+				t.Errorf("fairOrder = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFairOrderWeights gives a project of weight 2 two turns for each of
+// another's one
+func TestFairOrderWeights(t *testing.T) {
+	m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+	m.projects.Put(models.ProjectSettings{ProjectID: "a", SchedulingWeight: 2})
+	queued := queuedJobs("a-1", "a-2", "a-3", "a-4", "b-1", "b-2")
+	addJobs(m, queued...)
+
+	if got, want := jobIDs(m.fairOrder(queued)), "a-1 b-1 a-2 a-3 b-2 a-4"; got != want {
+		t.Fatalf("fairOrder = %s, want %s", got, want)
+	}
+}
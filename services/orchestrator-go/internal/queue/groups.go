@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrGroupNotFound is returned when no visible job belongs to a group
+var ErrGroupNotFound = NewQueueError("group not found")
+
+// GetGroup returns a group's member jobs and rolled-up status. Only members
+// within the scope are included.
+func (m *Manager) GetGroup(groupID string, scope Scope) (*models.JobGroup, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	group := m.buildGroup(groupID, scope)
+	if group == nil {
+		return nil, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+// buildGroup rolls up the members of a group. Jobs that have been requeued
+// are represented by their retry, so a failure that was retried
+// successfully does not count against the group.
+func (m *Manager) buildGroup(groupID string, scope Scope) *models.JobGroup {
+	retried := make(map[string]bool)
+	var members []*models.Job
+	for _, job := range m.jobs {
+		if job.GroupID != groupID || !inScope(scope, job.ProjectID) {
+			continue
+		}
+		members = append(members, job)
+		if job.RetryOf != "" {
+			retried[job.RetryOf] = true
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].CreatedAt.Before(members[j].CreatedAt)
+	})
+
+	group := &models.JobGroup{
+		ID:     groupID,
+		Status: models.GroupStatusComplete,
+		Counts: make(map[models.JobStatus]int),
+		Jobs:   members,
+	}
+	for _, job := range members {
+		if retried[job.ID] {
+			continue
+		}
+		group.Total++
+		group.Counts[job.Status]++
+
+		switch {
+		case !job.Status.IsTerminal():
+			group.Status = models.GroupStatusInProgress
+		case job.Status != models.JobStatusCompleted && group.Status == models.GroupStatusComplete:
+			group.Status = models.GroupStatusPartialFailure
+		}
+		if job.CompletedAt != nil && (group.CompletedAt == nil || job.CompletedAt.After(*group.CompletedAt)) {
+			group.CompletedAt = job.CompletedAt
+		}
+	}
+	if group.Status == models.GroupStatusInProgress {
+		group.CompletedAt = nil
+	}
+	// The group counts as notified once every project's share of it was
+	for _, job := range members {
+		notified, ok := m.groupsNotified[groupKey(job.ProjectID, groupID)]
+		if !ok {
+			group.NotifiedAt = nil
+			break
+		}
+		if group.NotifiedAt == nil || notified.After(*group.NotifiedAt) {
+			group.NotifiedAt = &notified
+		}
+	}
+	return group
+}
+
+// groupKey identifies a project's share of a group. Group IDs are chosen by
+// submitters, so the same ID in two projects makes two groups as far as
+// notifications go, and no project is told about another's jobs.
+func groupKey(projectID, groupID string) string {
+	return projectID + "/" + groupID
+}
+
+// projectScope limits a group to the jobs of one project
+type projectScope string
+
+func (s projectScope) Allows(projectID string) bool {
+	return string(s) == projectID
+}
+
+func (s projectScope) ScopedProjects() []string {
+	return []string{string(s)}
+}
+
+// settleGroup notifies a finished job's group once its last member in the
+// job's project finishes. Each distinct callback destination among those
+// members is notified once, with the project's members only.
+func (m *Manager) settleGroup(job *models.Job) {
+	if job.GroupID == "" {
+		return
+	}
+	key := groupKey(job.ProjectID, job.GroupID)
+	if _, ok := m.groupsNotified[key]; ok {
+		return
+	}
+
+	group := m.buildGroup(job.GroupID, projectScope(job.ProjectID))
+	if group == nil || group.Status == models.GroupStatusInProgress {
+		return
+	}
+	m.groupsNotified[key] = time.Now()
+
+	// Members keep changing after this, so notify with a snapshot
+	snapshot := *group
+	snapshot.Jobs = make([]*models.Job, len(group.Jobs))
+	for i, member := range group.Jobs {
+		c := *member
+		c.CallbackSecret = "" // each destination gets all of the project's jobs
+		snapshot.Jobs[i] = &c
+	}
+	snapshot.Message = m.groupMessage(group)
+
+	type target struct{ dest, secret string }
+	targets := make(map[target]bool)
+	for _, member := range group.Jobs {
+		if dest := m.delivery.Destination(member.ProjectID, member.CallbackURL); dest != "" {
+			targets[target{dest, member.CallbackSecret}] = true
+		}
+	}
+
+	log.Info().
+		Str("group_id", group.ID).
+		Str("project_id", job.ProjectID).
+		Str("status", string(group.Status)).
+		Int("jobs", group.Total).
+		Msg("Job group finished")
+
+	event := "group." + string(group.Status)
+	for t := range targets {
+		go func(t target) {
+			attempts, err := m.delivery.Deliver(context.Background(), t.dest, t.secret, event, &snapshot)
+			if err != nil {
+				log.Error().Err(err).Str("group_id", group.ID).Int("attempts", attempts).Msg("Failed to deliver group notification")
+			}
+		}(t)
+	}
+}
+
+// reopenGroup allows a project's share of a group to be notified again when
+// a job joins it after it finished
+func (m *Manager) reopenGroup(projectID, groupID string) {
+	if groupID != "" {
+		delete(m.groupsNotified, groupKey(projectID, groupID))
+	}
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+)
+
+// jobBuckets are the upper bounds of the job latency histograms, from jobs
+// dispatched straight away up to runs near the workflow timeout
+var jobBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	15 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+}
+
+// jobLatency records how long jobs wait and run, with the job's trace as
+// exemplar
+type jobLatency struct {
+	mu              sync.Mutex
+	dispatchLatency histogram
+	duration        map[string]*histogram // by final status
+}
+
+// observeDispatch records how long a job waited to be dispatched. The
+// caller must hold m.mu.
+func (l *jobLatency) observeDispatch(job *models.Job) {
+	if job.DispatchedAt == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dispatchLatency.observeTraced(job.DispatchedAt.Sub(job.CreatedAt), tracing.TraceID(job.TraceParent))
+}
+
+// observeRun records how long a finished run took, from dispatch to the
+// job's current status. The caller must hold m.mu.
+func (l *jobLatency) observeRun(job *models.Job) {
+	if job.DispatchedAt == nil || job.CompletedAt == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.duration == nil {
+		l.duration = make(map[string]*histogram)
+	}
+	status := string(job.Status)
+	h, ok := l.duration[status]
+	if !ok {
+		h = &histogram{bounds: jobBuckets}
+		l.duration[status] = h
+	}
+	h.observeTraced(job.CompletedAt.Sub(*job.DispatchedAt), tracing.TraceID(job.TraceParent))
+}
+
+// meanRun returns how long completed and failed runs took on average, zero
+// before any has finished
+func (l *jobLatency) meanRun() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sum time.Duration
+	var count uint64
+	for _, status := range []models.JobStatus{models.JobStatusCompleted, models.JobStatusFailed} {
+		if h, ok := l.duration[string(status)]; ok {
+			sum += h.sum
+			count += h.count
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / time.Duration(count)
+}
+
+// JobLatencyStats returns how long jobs waited for dispatch and ran
+func (m *Manager) JobLatencyStats() *models.JobLatencyStats {
+	l := &m.latency
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := &models.JobLatencyStats{
+		DispatchLatency: l.dispatchLatency.snapshot(),
+		Duration:        make(map[string]models.Histogram, len(l.duration)),
+	}
+	for status, h := range l.duration {
+		stats.Duration[status] = h.snapshot()
+	}
+	return stats
+}
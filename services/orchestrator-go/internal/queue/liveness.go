@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"time"
+)
+
+// beat records that the dispatch loop finished a pass
+func (m *Manager) beat() {
+	m.loopBeat.Store(time.Now().UnixNano())
+}
+
+// Started reports whether the dispatch loop has finished its first pass,
+// taking in the jobs an earlier process left in the queue
+func (m *Manager) Started() bool {
+	return m.loopBeat.Load() != 0
+}
+
+// LoopStalledFor returns how long the dispatch loop has gone without
+// finishing a pass, counting from startup before the first. The loop passes
+// every second, so a long stall means it is wedged, as on a lock that is
+// never released. It takes no lock itself.
+func (m *Manager) LoopStalledFor() time.Duration {
+	last := m.startedAt
+	if beat := m.loopBeat.Load(); beat != 0 {
+		last = time.Unix(0, beat)
+	}
+	return time.Since(last)
+}
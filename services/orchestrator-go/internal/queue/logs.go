@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of job log records
+const (
+	logSourceOrchestrator = "orchestrator"
+	logSourceGit          = "git"
+	logSourceDispatch     = "dispatch"
+	logSourceAgent        = "agent"
+)
+
+// SetLogStore makes the manager keep per-job logs, deleting them under the
+// config's default retention. It must be called before Start; without a
+// store job logs are not kept.
+func (m *Manager) SetLogStore(store joblog.Store, cfg config.JobLogConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logs = store
+	m.logCfg = cfg
+}
+
+// jobLog appends a record to a job's log. Failures are logged, never
+// returned, so logging cannot fail a job.
+func (m *Manager) jobLog(jobID, source, format string, args ...interface{}) {
+	if m.logs == nil {
+		return
+	}
+	if err := m.logs.Append(context.Background(), jobID, joblog.Line(source, format, args...)); err != nil {
+		log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to write job log")
+	}
+}
+
+// finishJobLog closes a finished job's log segment in the background
+func (m *Manager) finishJobLog(jobID string) {
+	if m.logs == nil {
+		return
+	}
+	go func() {
+		if err := m.logs.Finish(context.Background(), jobID); err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to finish job log")
+		}
+	}()
+}
+
+// jobLogWriter adds everything written to it to a job's log as records
+type jobLogWriter struct {
+	m      *Manager
+	jobID  string
+	source string
+}
+
+func (w *jobLogWriter) Write(p []byte) (int, error) {
+	w.m.jobLog(w.jobID, w.source, "%s", bytes.TrimRight(p, "\n"))
+	return len(p), nil
+}
+
+// jobOutputWriter adds process output to a job's log as it is
+type jobOutputWriter struct {
+	m     *Manager
+	jobID string
+}
+
+func (w *jobOutputWriter) Write(p []byte) (int, error) {
+	if w.m.logs == nil {
+		return len(p), nil
+	}
+	if err := w.m.logs.Append(context.Background(), w.jobID, p); err != nil {
+		log.Warn().Err(err).Str("job_id", w.jobID).Msg("Failed to write job log")
+	}
+	return len(p), nil
+}
+
+// AppendJobLog adds output uploaded by a job's workflow to the job's log
+func (m *Manager) AppendJobLog(ctx context.Context, jobID string, data []byte) error {
+	m.mu.RLock()
+	_, ok := m.jobs[jobID]
+	m.mu.RUnlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	if m.logs == nil {
+		return nil
+	}
+
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	record := append(joblog.Line(logSourceAgent, "%d bytes of workflow output", len(data)), data...)
+	return m.logs.Append(ctx, jobID, record)
+}
+
+// OpenJobLog returns a job's retained log. Jobs evicted from memory are
+// looked up in the archive so their logs stay reachable.
+func (m *Manager) OpenJobLog(ctx context.Context, jobID string, scope Scope) (io.ReadCloser, error) {
+	if _, ok := m.GetJob(jobID, scope); !ok {
+		_, found, err := m.GetArchivedJob(ctx, jobID, scope)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrJobNotFound
+		}
+	}
+	if m.logs == nil {
+		return nil, joblog.ErrNotFound
+	}
+	return m.logs.Open(ctx, jobID)
+}
+
+// logResult records a run's outcome in the job's log
+func (m *Manager) logResult(job *models.Job, result *models.JobResult) {
+	switch {
+	case result.Error != "":
+		m.jobLog(job.ID, logSourceOrchestrator, "Run %s reported %s (via %s): %s", result.RunID, result.Status, result.ReportedBy, result.Error)
+	case result.PRUrl != "":
+		m.jobLog(job.ID, logSourceOrchestrator, "Run %s reported %s (via %s), pull request %s", result.RunID, result.Status, result.ReportedBy, result.PRUrl)
+	case result.Report != "":
+		m.jobLog(job.ID, logSourceOrchestrator, "Run %s reported %s (via %s), report of %d bytes", result.RunID, result.Status, result.ReportedBy, len(result.Report))
+	default:
+		m.jobLog(job.ID, logSourceOrchestrator, "Run %s reported %s (via %s)", result.RunID, result.Status, result.ReportedBy)
+	}
+}
@@ -1,15 +1,35 @@
 package queue
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/bitbucket"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/delivery"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/executor"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitlab"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/jobtoken"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/worktree"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Manager handles the job queue and worker pool
@@ -17,74 +37,323 @@ type Manager struct {
 	mu              sync.RWMutex
 	cfg             config.QueueConfig
 	jobs            map[string]*models.Job
-	queue           []*models.Job
+	backend         Backend
 	worktreeManager *worktree.Manager
+	github          *github.Client
+	delivery        *delivery.Deliverer
+	projects        *project.Registry
 	activeJobs      map[string]int // projectID -> count of active jobs
-	workers         chan struct{}  // semaphore for worker pool
+	workers         workerSlots    // bounds the jobs running at once
 	resultChan      chan *models.JobResult
+	pendingResults  atomic.Int64             // results received but not yet handled
+	linked          map[string][]*models.Job // original jobID -> duplicates awaiting its result
+	reservations    map[string]*models.Reservation
+	groupsNotified  map[string]time.Time // groupKey -> when its finish was notified
+	paused          *models.QueuePause   // set while dispatching is paused
+	drainStartedAt  *time.Time           // set while draining
+	archiver        Archiver             // receives jobs evicted by retention
+	logs            joblog.Store         // per-job logs, nil when not kept
+	executors       map[string]executor.Executor
+	defaultExecutor string // used by projects that select none
+	newID           ids.Generator
+	sched           schedulerMetrics
+	leader          LeaderChecker
+	// dispatches holds each project's dispatch times within the rate window
+	dispatches map[string][]time.Time
+	// logCfg holds the default retention of job logs
+	logCfg    config.JobLogConfig
+	artifacts artifactStats
+	latency   jobLatency
+	memory    Memory
+	// callbackTokens issues the tokens runs call back with
+	callbackTokens *jobtoken.Issuer
+	repoTokens     bool
+	// lastJobAt holds when each project's latest job was submitted, beyond
+	// the retention of the jobs themselves
+	lastJobAt map[string]time.Time
+	startedAt time.Time
+	// loopBeat holds when the dispatch loop last finished a pass, in Unix
+	// nanoseconds, zero before the first
+	loopBeat atomic.Int64
+	// runOnly holds the executors this instance dispatches to when it
+	// leaves the others' jobs to other processes; nil runs every executor
+	runOnly map[string]bool
+	// adopted holds jobs taken from the shared queue that were submitted
+	// elsewhere and are not yet claimed here
+	adopted map[string]bool
+	// shared holds the state of each job last published here or taken
+	// from another instance
+	shared map[string]sharedState
+	// owned holds the jobs this instance claimed to dispatch, whose cancel
+	// requests it takes
+	owned map[string]bool
+	// rollups holds the store daily job rollups are written to
+	rollups rollupState
+	// messages renders user-facing strings; nil uses the built-in ones
+	messages *messages.Catalog
+	// trackers update the issues of projects' tickets by tracker type, in
+	// the order ticketUpdates receives them
+	trackers      map[string]Tracker
+	ticketUpdates chan ticketUpdate
+	// providers open the pull requests of projects with open_pr
+	providers *scm.Registry
+	// executing holds the jobs holding a worker while they are dispatched
+	// or, for executors that run agents here, until their runs finish
+	executing map[string]bool
+	// preempted holds the job each critical job preempted, until the
+	// critical job is dispatched
+	preempted map[string]string
+}
+
+// Scope limits which projects' jobs a caller may see and act on. A nil
+// scope is unrestricted.
+type Scope interface {
+	Allows(projectID string) bool
+	// ScopedProjects lists the projects allowed, nil when every project is
+	ScopedProjects() []string
+}
+
+func inScope(scope Scope, projectID string) bool {
+	return scope == nil || scope.Allows(projectID)
+}
+
+// LeaderChecker reports whether this instance is allowed to dispatch jobs
+type LeaderChecker interface {
+	IsLeader() bool
 }
 
 // NewManager creates a new queue manager
-func NewManager(cfg config.QueueConfig, wm *worktree.Manager) *Manager {
+func NewManager(cfg config.QueueConfig, backend Backend, wm *worktree.Manager, gh *github.Client, dl *delivery.Deliverer, projects *project.Registry) *Manager {
+	// The format was checked when the config was loaded
+	newID, err := ids.New(cfg.IDFormat)
+	if err != nil {
+		newID = ids.NewUUID
+	}
+
 	return &Manager{
 		cfg:             cfg,
 		jobs:            make(map[string]*models.Job),
-		queue:           make([]*models.Job, 0),
+		backend:         backend,
 		worktreeManager: wm,
+		github:          gh,
+		delivery:        dl,
+		projects:        projects,
 		activeJobs:      make(map[string]int),
-		workers:         make(chan struct{}, cfg.MaxParallelJobs),
+		workers:         workerSlots{max: cfg.MaxParallelJobs},
 		resultChan:      make(chan *models.JobResult, 100),
+		linked:          make(map[string][]*models.Job),
+		reservations:    make(map[string]*models.Reservation),
+		groupsNotified:  make(map[string]time.Time),
+		adopted:         make(map[string]bool),
+		shared:          make(map[string]sharedState),
+		owned:           make(map[string]bool),
+		executors: map[string]executor.Executor{
+			models.ExecutorGitHubActions: executor.NewGitHubActions(gh, projects),
+		},
+		defaultExecutor: models.ExecutorGitHubActions,
+		dispatches:      make(map[string][]time.Time),
+		newID:           newID,
+		latency:         jobLatency{dispatchLatency: histogram{bounds: jobBuckets}},
+		lastJobAt:       make(map[string]time.Time),
+		startedAt:       time.Now(),
+		executing:       make(map[string]bool),
+		preempted:       make(map[string]string),
 	}
 }
 
+// SetLeader restricts dispatching to when this instance is the elected leader.
+// Without a leader checker every instance dispatches.
+func (m *Manager) SetLeader(leader LeaderChecker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leader = leader
+}
+
+// isLeader reports whether this instance should dispatch jobs
+func (m *Manager) isLeader() bool {
+	return m.leader == nil || m.leader.IsLeader()
+}
+
 // Start begins processing jobs from the queue
 func (m *Manager) Start(ctx context.Context) {
 	log.Info().Int("max_workers", m.cfg.MaxParallelJobs).Msg("Starting queue manager")
 
+	go m.routeResults(ctx)
+	go m.runRetention(ctx)
+	go m.runStopEscalation(ctx)
+	go m.runCheckTimeouts(ctx)
+	go m.runArtifactRetention(ctx)
+	go m.runStaleProjects(ctx)
+	go m.runRollups(ctx)
+
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
+	// The first pass adopts what is already in a shared queue
+	m.processQueue(ctx)
+	m.beat()
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info().Msg("Queue manager shutting down")
 			return
-		case result := <-m.resultChan:
-			m.handleResult(result)
 		case <-ticker.C:
 			m.processQueue(ctx)
+			m.beat()
 		}
 	}
 }
 
-// Submit adds a new job to the queue
+// Submit adds a new job to the queue. A client-supplied ID must not belong to
+// any job held in memory or archived, and an implementation is refused while
+// another of the same ticket is unfinished unless forced.
 func (m *Manager) Submit(ctx context.Context, req *models.CreateJobRequest) (*models.CreateJobResponse, error) {
-	m.mu.Lock()
+	settings, _ := m.projects.Get(req.ProjectID)
+	if settings.ArchivedAt != nil {
+		return nil, ErrProjectArchived
+	}
+	if req.RepoFullName == "" {
+		req.RepoFullName = settings.Repo
+	}
+	if err := m.checkBaseBranch(ctx, req.ProjectID, req.RepoFullName, req.BaseBranch); err != nil {
+		return nil, err
+	}
+	if req.ID != "" {
+		if _, archived, err := m.GetArchivedJob(ctx, req.ID, nil); err != nil {
+			return nil, err
+		} else if archived {
+			return nil, ErrJobIDExists
+		}
+	}
+
+	m.lock(lockSubmit)
 	defer m.mu.Unlock()
 
+	jobID := req.ID
+	if jobID == "" {
+		jobID = m.newID()
+	} else if _, ok := m.jobs[jobID]; ok {
+		return nil, ErrJobIDExists
+	}
+
+	// A second implementation of a ticket would push to the same branch
+	if req.Kind != models.JobKindAnalysis && !req.Force {
+		if active := m.activeForTicket(req.ProjectID, req.TicketID); active != nil {
+			return nil, &TicketActiveError{Job: active}
+		}
+	}
+
+	if limit, ok := m.cfg.SourceMaxActive[req.Source]; ok && m.activeForSource(req.Source) >= limit {
+		return nil, ErrSourceQuotaExceeded
+	}
+	if err := m.checkQueueDepth(req.ProjectID); err != nil {
+		return nil, err
+	}
+
+	priority, warnings := m.resolvePriority(req)
+
+	kind := models.JobKindImplementation
+	if req.Kind == models.JobKindAnalysis {
+		kind = models.JobKindAnalysis
+	}
+
 	// Create job
 	job := &models.Job{
-		ID:             uuid.New().String(),
+		ID:             jobID,
 		TicketID:       req.TicketID,
 		ProjectID:      req.ProjectID,
-		Priority:       req.Priority,
+		Source:         req.Source,
+		GroupID:        req.GroupID,
+		Kind:           kind,
+		RepoFullName:   req.RepoFullName,
+		Priority:       priority,
 		Status:         models.JobStatusPending,
 		Prompt:         req.Prompt,
-		BranchName:     "autobuild/ticket-" + req.TicketID[:8],
+		TicketTitle:    req.TicketTitle,
+		TicketDesc:     req.TicketDesc,
 		BaseBranch:     req.BaseBranch,
+		Matrix:         req.Matrix,
 		CallbackURL:    req.CallbackURL,
 		CallbackSecret: req.CallbackSecret,
+		TemplateID:     req.TemplateID,
+		Labels:         req.Labels,
+		Executor:       req.Executor,
+		Vars:           req.Vars,
+		Deadline:       req.Deadline,
+		TraceParent:    tracing.Inject(ctx),
 		CreatedAt:      time.Now(),
 	}
 
+	// Analyses only read the base branch
+	if kind != models.JobKindAnalysis {
+		settings, _ := m.projects.Get(job.ProjectID)
+		branch, err := project.BranchName(settings.BranchTemplate, job)
+		if err != nil {
+			// Templates are checked when set, so only a ticket that
+			// renders to nothing gets here
+			warnings = append(warnings, err.Error()+", using the default")
+			branch, _ = project.BranchName("", job)
+		}
+		job.BranchName = branch
+	}
+
+	// Flag probable duplicates of a recent job on the same project
+	var orig *models.Job
+	if m.cfg.DedupWindow > 0 {
+		job.Fingerprint = fingerprintPrompt(job.ProjectID, job.Prompt)
+		if orig = m.findDuplicate(job); orig != nil {
+			job.DuplicateOf = orig.ID
+			log.Warn().
+				Str("job_id", job.ID).
+				Str("original_job_id", orig.ID).
+				Msg("Job is a probable duplicate")
+		}
+	}
+
+	// Reusing the earlier job runs no second agent; forcing opts out
+	if orig != nil && m.cfg.DedupMode == dedupReuse && !req.Force {
+		position := -1
+		if orig.Status == models.JobStatusPending {
+			position = m.getQueuePosition(ctx, orig.ID)
+		}
+		return &models.CreateJobResponse{
+			Job:      orig,
+			Position: position,
+			Message:  m.message(orig.ProjectID, messages.JobReused, messages.JobData(orig)),
+			Warnings: warnings,
+			Reused:   true,
+		}, nil
+	}
+
+	reason := "submitted"
+	if orig != nil {
+		reason = "submitted as probable duplicate of job " + orig.ID
+	}
+	recordCreated(job, req.Source, reason)
+
 	// Add to jobs map
 	m.jobs[job.ID] = job
+	m.lastJobAt[job.ProjectID] = job.CreatedAt
+	m.reopenGroup(job.ProjectID, job.GroupID)
+
+	if orig != nil && m.cfg.DedupMode == dedupLink {
+		m.linkToOriginal(job, orig)
+		return &models.CreateJobResponse{
+			Job:      job,
+			Position: -1,
+			Message:  m.message(job.ProjectID, messages.JobLinked, messages.JobData(job)),
+			Warnings: warnings,
+		}, nil
+	}
 
 	// Add to priority queue
-	m.insertByPriority(job)
+	if err := m.backend.Push(ctx, job); err != nil {
+		delete(m.jobs, job.ID)
+		return nil, err
+	}
 
 	// Calculate position
-	position := m.getQueuePosition(job.ID)
+	position := m.getQueuePosition(ctx, job.ID)
 
 	log.Info().
 		Str("job_id", job.ID).
@@ -93,59 +362,166 @@ func (m *Manager) Submit(ctx context.Context, req *models.CreateJobRequest) (*mo
 		Int("position", position).
 		Msg("Job submitted to queue")
 
+	message := m.message(job.ProjectID, messages.JobQueued, messages.JobData(job))
+	if orig != nil {
+		message = m.message(job.ProjectID, messages.JobQueuedDuplicate, messages.JobData(job))
+	}
+
 	return &models.CreateJobResponse{
 		Job:      job,
 		Position: position,
-		Message:  "Job queued successfully",
+		Message:  message,
+		Warnings: warnings,
 	}, nil
 }
 
-// GetJob retrieves a job by ID
-func (m *Manager) GetJob(jobID string) (*models.Job, bool) {
+// GetJob retrieves a job by ID. Jobs outside the scope are not found. A job
+// submitted to another orchestrator since the last pass here is read from
+// the shared backend.
+func (m *Manager) GetJob(jobID string, scope Scope) (*models.Job, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	job, ok := m.jobs[jobID]
-	return job, ok
+	if !ok {
+		job, ok = m.findShared(context.Background(), jobID)
+	}
+	if !ok || !inScope(scope, job.ProjectID) {
+		return nil, false
+	}
+	return job, true
 }
 
-// CancelJob cancels a pending or running job
-func (m *Manager) CancelJob(jobID string) error {
-	m.mu.Lock()
+// ListJobs returns the jobs within the scope matching the filter, newest first
+func (m *Manager) ListJobs(scope Scope, filter models.JobFilter) []*models.Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*models.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if !inScope(scope, job.ProjectID) ||
+			(filter.ProjectID != "" && job.ProjectID != filter.ProjectID) ||
+			(filter.Source != "" && job.Source != filter.Source) ||
+			(filter.Status != "" && job.Status != filter.Status) ||
+			(filter.GroupID != "" && job.GroupID != filter.GroupID) ||
+			(filter.FailureKind != "" && job.FailureKind != filter.FailureKind) ||
+			(filter.Label != "" && !slices.Contains(job.Labels, filter.Label)) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// CancelJob cancels a pending or running job. It reports whether the job
+// was cancelled here; a job another orchestrator runs is cancelled by it on
+// its next pass.
+func (m *Manager) CancelJob(jobID string, scope Scope) (bool, error) {
+	m.lock(lockCancel)
 	defer m.mu.Unlock()
 
 	job, ok := m.jobs[jobID]
-	if !ok {
-		return ErrJobNotFound
+	if !ok || !inScope(scope, job.ProjectID) {
+		return false, ErrJobNotFound
+	}
+
+	// Cancelling twice would finish the job's log and revoke its
+	// credentials again
+	if job.Status.IsTerminal() {
+		return false, ErrJobAlreadyCompleted
+	}
+	if m.cancelsElsewhere(context.Background(), job) {
+		return false, m.forwardCancel(context.Background(), job, actorOf(scope), false)
 	}
 
-	if job.Status == models.JobStatusCompleted || job.Status == models.JobStatusFailed {
-		return ErrJobAlreadyCompleted
+	m.cancelJob(job, actorOf(scope), "cancelled")
+	return true, nil
+}
+
+// cancelJob cancels a job immediately, stopping its run. The caller must
+// hold m.mu.
+func (m *Manager) cancelJob(job *models.Job, actor, reason string) {
+	// Free the project slot held by a dispatched job and stop its run. Jobs
+	// still being prepared for dispatch have no run yet.
+	started := job.Status == models.JobStatusDispatched || job.Status == models.JobStatusRunning
+	if started {
+		m.activeJobs[job.ProjectID]--
+		if m.activeJobs[job.ProjectID] < 0 {
+			m.activeJobs[job.ProjectID] = 0
+		}
+	}
+	if job.Status == models.JobStatusRunning && !awaitingChecks(job) {
+		m.cancelRun(job, true)
 	}
 
-	job.Status = models.JobStatusCancelled
+	transition(job, models.JobStatusCancelled, actor, reason)
 	now := time.Now()
 	job.CompletedAt = &now
+	delete(m.preempted, job.ID)
+	if started {
+		m.recordAttempt(job)
+	}
 
 	// Remove from queue if still pending
-	m.removeFromQueue(jobID)
-
-	log.Info().Str("job_id", jobID).Msg("Job cancelled")
+	m.removeFromQueue(job.ID)
+	if job.DuplicateOf != "" {
+		m.unlink(job)
+	}
+	m.resolveLinked(job)
+	m.applyQAResult(job, nil)
+	m.deliverResult(job)
+	m.settleGroup(job)
+	m.jobLog(job.ID, logSourceOrchestrator, "Job cancelled by %s: %s", actor, reason)
+	m.revokeCredentials(job)
+	m.finishJobLog(job.ID)
+
+	log.Info().Str("job_id", job.ID).Str("reason", reason).Msg("Job cancelled")
+}
 
-	return nil
+// Reload applies the runtime-tunable settings of a reloaded configuration:
+// the worker count, the per-source limits and the queue depth limits.
+// Lowering the worker count lets running jobs finish and holds new ones
+// until they fit.
+func (m *Manager) Reload(cfg config.QueueConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cfg.MaxParallelJobs = cfg.MaxParallelJobs
+	m.cfg.SourceMaxActive = cfg.SourceMaxActive
+	m.cfg.MaxQueueDepth = cfg.MaxQueueDepth
+	m.cfg.ProjectMaxQueueDepth = cfg.ProjectMaxQueueDepth
+	m.workers.resize(cfg.MaxParallelJobs)
 }
 
-// GetStats returns current queue statistics
-func (m *Manager) GetStats() *models.QueueStats {
+// GetStats returns current queue statistics. Jobs and reservations are
+// counted within the scope, while worker counts cover the whole queue.
+func (m *Manager) GetStats(scope Scope) *models.QueueStats {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	stats := &models.QueueStats{
-		TotalJobs:     len(m.jobs),
 		JobsByProject: make(map[string]int),
+		JobsBySource:  make(map[string]int),
+		PullRequests:  make(map[string]int),
 		MaxWorkers:    m.cfg.MaxParallelJobs,
+		Leader:        m.isLeader(),
 	}
+	if m.paused != nil {
+		pause := *m.paused
+		stats.Paused = true
+		stats.Pause = &pause
+	}
+	stats.Draining = m.drainStartedAt != nil
 
 	for _, job := range m.jobs {
+		if job.Status == models.JobStatusRunning || job.Status == models.JobStatusDispatched {
+			stats.ActiveWorkers++
+		}
+		if !inScope(scope, job.ProjectID) {
+			continue
+		}
+		stats.TotalJobs++
 		switch job.Status {
 		case models.JobStatusPending, models.JobStatusQueued:
 			stats.PendingJobs++
@@ -157,135 +533,414 @@ func (m *Manager) GetStats() *models.QueueStats {
 			stats.FailedJobs++
 		}
 		stats.JobsByProject[job.ProjectID]++
+		stats.JobsBySource[job.Source]++
+		if job.PRState != "" {
+			stats.PullRequests[string(job.PRState)]++
+		}
+		if job.DeadlineAtRisk && job.Status == models.JobStatusPending {
+			stats.DeadlinesAtRisk++
+		}
 	}
 
-	stats.ActiveWorkers = stats.RunningJobs
+	stats.Reservations = m.upcomingReservations(time.Now(), scope)
 
 	return stats
 }
 
+// LimitsSource reports whether SOURCE_MAX_ACTIVE sets a limit for a
+// submission source
+func (m *Manager) LimitsSource(source string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.cfg.SourceMaxActive[source]
+	return ok
+}
+
+// activeForSource counts a submission source's unfinished jobs
+func (m *Manager) activeForSource(source string) int {
+	n := 0
+	for _, job := range m.jobs {
+		if job.Source == source && !job.Status.IsTerminal() {
+			n++
+		}
+	}
+	return n
+}
+
+// AverageWait returns how long jobs dispatched within the window waited in
+// the queue on average
+func (m *Manager) AverageWait(window time.Duration) time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	since := time.Now().Add(-window)
+	var total time.Duration
+	var n int
+	for _, job := range m.jobs {
+		if job.DispatchedAt == nil || job.DispatchedAt.Before(since) {
+			continue
+		}
+		total += job.DispatchedAt.Sub(job.CreatedAt)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// CheckBackend reports whether the queue backend is reachable
+func (m *Manager) CheckBackend(ctx context.Context) error {
+	_, err := m.backend.List(ctx)
+	return err
+}
+
+// CanDispatch reports whether jobs can be dispatched to GitHub Actions
+func (m *Manager) CanDispatch() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.github.Configured() && m.paused == nil && m.drainStartedAt == nil
+}
+
 // HandleCallback processes a callback from GitHub Actions
 func (m *Manager) HandleCallback(result *models.JobResult) {
-	m.resultChan <- result
+	result.ReportedBy = "callback"
+	m.submitResult(result)
 }
 
 // processQueue dispatches pending jobs to workers
 func (m *Manager) processQueue(ctx context.Context) {
-	m.mu.Lock()
+	m.lock(lockProcessQueue)
 	defer m.mu.Unlock()
 
-	for i := 0; i < len(m.queue); i++ {
-		job := m.queue[i]
+	start := time.Now()
+	var scanned, dispatched int
+	queued, err := m.backend.List(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list queued jobs")
+		return
+	}
+	queued = m.syncShared(ctx, queued)
+
+	// Followers accept submissions but leave dispatching to the leader
+	if !m.isLeader() {
+		return
+	}
+	if m.paused != nil || m.drainStartedAt != nil {
+		return
+	}
+	defer func() {
+		m.sched.observeTick(time.Since(start), len(queued), scanned, dispatched)
+	}()
+
+	switch m.cfg.Scheduling {
+	case schedulingFair:
+		queued = m.fairOrder(queued)
+	case schedulingDeadline:
+		deadlineOrder(queued)
+	}
+	m.flagDeadlines(queued)
+	if len(queued) > 0 && m.deferForResources(queued) {
+		return
+	}
+	reserved := m.reservedSlots(start)
+	// Rate rules are evaluated once per project per pass
+	limited := make(map[string]string)
+
+	for i, job := range queued {
+		scanned++
 
 		if job.Status != models.JobStatusPending {
 			continue
 		}
 
-		// Check if we can start this job (project parallelism limit)
-		if m.activeJobs[job.ProjectID] >= m.getProjectMaxParallel(job.ProjectID) {
+		// Jobs of executors this instance does not run are left to others
+		if name := m.executorName(job); m.runOnly != nil && !m.runOnly[name] {
+			m.block(job, "waiting for a worker running the "+name+" executor")
 			continue
 		}
 
-		// Try to acquire a worker slot
-		select {
-		case m.workers <- struct{}{}:
-			// Got a worker, dispatch the job
-			job.Status = models.JobStatusDispatched
-			now := time.Now()
-			job.DispatchedAt = &now
-			m.activeJobs[job.ProjectID]++
+		// Hold back jobs of projects over their time-of-day dispatch rate
+		reason, seen := limited[job.ProjectID]
+		if !seen {
+			reason = m.rateLimited(job.ProjectID, start)
+			limited[job.ProjectID] = reason
+		}
+		if reason != "" {
+			m.block(job, reason)
+			continue
+		}
 
-			go m.executeJob(ctx, job)
+		// Check if we can start this job (project parallelism limit and
+		// slots reserved for other projects)
+		if !m.hasCapacity(job, reserved) {
+			m.block(job, cmp.Or(m.preemptFor(ctx, job, m.projectFull(job, reserved)), blockedCapacity))
+			continue
+		}
 
-		default:
-			// No workers available
+		// Try to acquire a worker slot
+		if !m.workers.tryAcquire() {
+			// No workers available. Fair scheduling may order a critical job
+			// after this one, and it preempts all the same.
+			if critical := m.nextCritical(queued[i:], reserved, limited, start); critical != nil {
+				if reason := m.preemptFor(ctx, critical, false); reason != "" {
+					m.block(critical, reason)
+				}
+			}
 			return
 		}
+
+		// Got a worker, make sure no other orchestrator has the job
+		claimed, err := m.backend.Claim(ctx, job.ID)
+		if err != nil || !claimed {
+			m.workers.release()
+			if err != nil {
+				log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to claim job")
+			} else if m.adopted[job.ID] {
+				// Another orchestrator runs it
+				delete(m.jobs, job.ID)
+				delete(m.adopted, job.ID)
+			}
+			continue
+		}
+		delete(m.adopted, job.ID)
+		delete(m.preempted, job.ID)
+		m.executing[job.ID] = true
+		m.owned[job.ID] = true
+
+		// Dispatch the job
+		transition(job, models.JobStatusDispatched, actorOrchestrator, "worker slot acquired")
+		now := time.Now()
+		job.DispatchedAt = &now
+		m.latency.observeDispatch(job)
+		m.activeJobs[job.ProjectID]++
+		m.recordDispatch(job.ProjectID, now)
+		m.updateTicket(job)
+		delete(limited, job.ProjectID)
+		dispatched++
+
+		go m.executeJob(ctx, job)
+	}
+}
+
+// releaseAdopted forgets adopted jobs that have left the shared queue
+// without being claimed here. Those another orchestrator has published a
+// state of are kept as it runs or cancels them; the others are dropped. The
+// caller must hold m.mu.
+func (m *Manager) releaseAdopted(queued []*models.Job, published map[string]bool) {
+	if len(m.adopted) == 0 {
+		return
+	}
+	stillQueued := make(map[string]bool, len(queued))
+	for _, job := range queued {
+		stillQueued[job.ID] = true
+	}
+	for id := range m.adopted {
+		if stillQueued[id] {
+			continue
+		}
+		if job, ok := m.jobs[id]; ok && job.Status == models.JobStatusPending && !published[id] {
+			delete(m.jobs, id)
+		}
+		delete(m.adopted, id)
 	}
 }
 
 // executeJob runs a job in a goroutine
 func (m *Manager) executeJob(ctx context.Context, job *models.Job) {
 	defer func() {
-		<-m.workers // Release worker slot
+		m.mu.Lock()
+		delete(m.executing, job.ID)
+		m.mu.Unlock()
+		m.workers.release()
 	}()
 
+	m.mu.RLock()
+	ctx, span := tracing.Start(tracing.Extract(ctx, job.TraceParent), "job.execute",
+		attribute.String("job.id", job.ID),
+		attribute.String("job.kind", string(job.Kind)),
+		attribute.String("project.id", job.ProjectID),
+		attribute.Int("job.attempt", job.RetryCount+1),
+		attribute.Int64("job.queue_wait_ms", job.DispatchedAt.Sub(job.CreatedAt).Milliseconds()),
+	)
+	m.mu.RUnlock()
+	defer span.End()
+
+	// Git output from preparing the worktree goes to the job's log
+	ctx = joblog.WithWriter(ctx, &jobLogWriter{m: m, jobID: job.ID, source: logSourceGit})
+
 	log.Info().
 		Str("job_id", job.ID).
 		Str("ticket_id", job.TicketID).
 		Msg("Executing job")
 
-	// Create worktree for the job
-	wt, err := m.worktreeManager.Create(job.ProjectID, job.TicketID, job.BranchName)
+	// Create worktree for the job. QA re-runs test a branch that already
+	// exists, so CI checks it out directly. A requeued job may carry over the
+	// worktree of the job it retries.
+	var wt *models.Worktree
+	if job.WorktreeID != "" {
+		var ok bool
+		if wt, ok = m.worktreeManager.Get(job.WorktreeID); ok {
+			m.worktreeManager.Touch(wt.ID)
+		}
+	}
+	if wt == nil && job.Kind != models.JobKindQARerun {
+		var err error
+		wt, err = m.worktreeManager.Create(ctx, job.ProjectID, job.RepoFullName, job.BaseBranch, job.TicketID, job.BranchName)
+		if err != nil {
+			span.SetStatus(codes.Error, "failed to create worktree")
+			log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to create worktree")
+			m.failJob(job, "Failed to create worktree: "+err.Error(), failureKind(err))
+			return
+		}
+	}
+
+	projectContext := m.projectContext(ctx, job)
+
+	m.lock(lockExecute)
+	if job.Status != models.JobStatusDispatched {
+		// Cancelled or preempted while its worktree was prepared, which
+		// would otherwise hold its branch until it aged out
+		m.mu.Unlock()
+		if wt != nil {
+			if err := m.worktreeManager.Delete(wt.ID); err != nil {
+				log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to release worktree of cancelled job")
+			}
+		}
+		return
+	}
+	if wt != nil {
+		job.WorktreeID = wt.ID
+	}
+	exec, err := m.selectExecutor(job)
 	if err != nil {
-		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to create worktree")
-		m.failJob(job, "Failed to create worktree: "+err.Error())
+		m.mu.Unlock()
+		span.SetStatus(codes.Error, "no executor")
+		m.failJob(job, err.Error(), "")
 		return
 	}
-
-	m.mu.Lock()
-	job.WorktreeID = wt.ID
-	job.Status = models.JobStatusRunning
+	transition(job, models.JobStatusRunning, actorOrchestrator, "dispatching to "+exec.Name())
 	now := time.Now()
 	job.StartedAt = &now
+	job.Environment = m.newEnvironment(exec.Name())
+	job.ProjectContext = projectContext
+	settings, _ := m.projects.Get(job.ProjectID)
+	job.Instructions = settings.Instructions
+	snapshot := *job
 	m.mu.Unlock()
 
-	// Dispatch to GitHub Actions
-	err = m.dispatchToGitHubActions(ctx, job, wt)
+	creds, err := m.issueCredentials(ctx, snapshot, exec.Name())
 	if err != nil {
-		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to dispatch to GitHub Actions")
-		m.failJob(job, "Failed to dispatch: "+err.Error())
+		span.SetStatus(codes.Error, "failed to mint credentials")
+		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to mint job credentials")
+		m.failJob(job, "Failed to mint job credentials: "+err.Error(), failureKind(err))
 		return
 	}
+	if creds != nil {
+		m.lock(lockExecute)
+		if job.Status != models.JobStatusRunning {
+			// Cancelled while its credentials were minted
+			m.mu.Unlock()
+			return
+		}
+		job.Credentials = creds
+		m.mu.Unlock()
+		snapshot.Credentials = creds
+	}
 
-	log.Info().
-		Str("job_id", job.ID).
-		Str("worktree_id", wt.ID).
-		Msg("Job dispatched to GitHub Actions")
-}
+	span.SetAttributes(attribute.String("job.executor", exec.Name()))
+	m.jobLog(job.ID, logSourceDispatch, "Dispatching to %s (attempt %d)", exec.Name(), job.RetryCount+1)
+	result, err := exec.Dispatch(ctx, snapshot, wt, &jobOutputWriter{m: m, jobID: job.ID})
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to dispatch")
+		m.jobLog(job.ID, logSourceDispatch, "Dispatch to %s failed: %v", exec.Name(), err)
+		log.Error().Err(err).Str("job_id", job.ID).Str("executor", exec.Name()).Msg("Failed to dispatch job")
+		m.failJob(job, "Failed to dispatch: "+err.Error(), failureKind(err))
+		return
+	}
 
-// dispatchToGitHubActions sends a repository_dispatch event
-func (m *Manager) dispatchToGitHubActions(ctx context.Context, job *models.Job, wt *models.Worktree) error {
-	// TODO: Implement GitHub Actions dispatch
-	// This will use the GitHub API to trigger a repository_dispatch event
-	// with the job details as the client_payload
+	// Executors that ran the agent here have its result already; the others
+	// report back through callbacks and webhooks
+	if result != nil {
+		result.ReceivedAt = time.Now()
+		result.ReportedBy = exec.Name()
+		m.submitResult(result)
+		return
+	}
 
+	m.jobLog(job.ID, logSourceDispatch, "Dispatched to %s", exec.Name())
 	log.Info().
 		Str("job_id", job.ID).
-		Str("branch", job.BranchName).
-		Msg("Would dispatch to GitHub Actions (not yet implemented)")
-
-	return nil
+		Str("worktree_id", job.WorktreeID).
+		Str("executor", exec.Name()).
+		Msg("Job dispatched")
 }
 
 // handleResult processes a job result from GitHub Actions
 func (m *Manager) handleResult(result *models.JobResult) {
-	m.mu.Lock()
+	m.lock(lockResult)
 	defer m.mu.Unlock()
 
-	// Find job by ticket ID
-	var job *models.Job
-	for _, j := range m.jobs {
-		if j.TicketID == result.TicketID {
-			job = j
-			break
-		}
-	}
-
+	job := m.findJobForResult(result)
 	if job == nil {
 		log.Warn().Str("ticket_id", result.TicketID).Msg("Received result for unknown job")
 		return
 	}
 
+	// Callbacks and webhooks can both report the same run
+	if job.Status.IsTerminal() || isPastRun(job, result.RunID) {
+		log.Debug().Str("job_id", job.ID).Msg("Ignoring result for finished job")
+		return
+	}
+	// A run whose QA checks have started has already reported
+	if awaitingChecks(job) {
+		log.Debug().Str("job_id", job.ID).Msg("Ignoring result for job awaiting QA checks")
+		return
+	}
+
+	_, span := tracing.Start(tracing.Extract(context.Background(), job.TraceParent), "job.result",
+		attribute.String("job.id", job.ID),
+		attribute.String("job.result", result.Status),
+		attribute.String("job.reported_by", result.ReportedBy),
+	)
+	defer span.End()
+
+	checkReport(job, result)
+	m.checkDiff(job, result)
+	job.Result = result
+	recordPullRequest(job, result)
+	if job.RunID == "" {
+		job.RunID = result.RunID
+	}
+	m.applyResultEnvironment(job, result)
+	m.logResult(job, result)
+	actor := "github"
+	if result.ReportedBy != "" {
+		actor += " (" + result.ReportedBy + ")"
+	}
+	if m.startChecks(job, result, actor) {
+		return
+	}
+	m.finishResult(job, result, actor)
+}
+
+// finishResult ends a job with the result of its run. Callers must hold m.mu.
+func (m *Manager) finishResult(job *models.Job, result *models.JobResult, actor string) {
 	now := time.Now()
 	job.CompletedAt = &now
 
-	if result.Status == "success" {
-		job.Status = models.JobStatusCompleted
+	if job.StopRequestedAt != nil {
+		// A soft cancel ends the job cancelled, keeping whatever the run
+		// pushed before it stopped
+		transition(job, models.JobStatusCancelled, actor, "run stopped on request: "+result.Status)
+	} else if result.Status == "success" {
+		transition(job, models.JobStatusCompleted, actor, "run succeeded")
 	} else {
-		job.Status = models.JobStatusFailed
+		transition(job, models.JobStatusFailed, actor, "run failed: "+result.Error)
 		job.ErrorMessage = result.Error
+		job.FailureKind = result.FailureKind
 	}
+	m.recordAttempt(job)
 
 	// Decrement active job count
 	m.activeJobs[job.ProjectID]--
@@ -293,12 +948,26 @@ func (m *Manager) handleResult(result *models.JobResult) {
 		m.activeJobs[job.ProjectID] = 0
 	}
 
+	if m.shouldRetry(job) {
+		m.retry(job)
+		return
+	}
+
+	m.applyQAResult(job, result)
+	m.deliverResult(job)
+	m.recordOutcome(job)
+	m.updateTicket(job)
+	m.settleGroup(job)
+	m.revokeCredentials(job)
+	m.finishJobLog(job.ID)
+
 	// Remove from queue
 	m.removeFromQueue(job.ID)
+	m.resolveLinked(job)
 
-	// Cleanup worktree
+	// Cleanup worktree, or keep it while its pull request is open
 	if job.WorktreeID != "" {
-		go m.worktreeManager.Delete(job.WorktreeID)
+		go m.releaseWorktree(job.ID, job.WorktreeID, job.RepoFullName, job.Status, result)
 	}
 
 	log.Info().
@@ -308,15 +977,40 @@ func (m *Manager) handleResult(result *models.JobResult) {
 		Msg("Job completed")
 }
 
-// failJob marks a job as failed
-func (m *Manager) failJob(job *models.Job, errorMsg string) {
-	m.mu.Lock()
+// failureKind classifies the error a job failed with. GitHub refusing the
+// app's credentials is an auth failure like git refusing them.
+func failureKind(err error) string {
+	var apiErr *github.APIError
+	var glErr *gitlab.APIError
+	var bbErr *bitbucket.APIError
+	if gitauth.IsAuth(err) ||
+		errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) ||
+		errors.As(err, &glErr) && (glErr.StatusCode == http.StatusUnauthorized || glErr.StatusCode == http.StatusForbidden) ||
+		errors.As(err, &bbErr) && (bbErr.StatusCode == http.StatusUnauthorized || bbErr.StatusCode == http.StatusForbidden) {
+		return models.FailureKindAuth
+	}
+	if errors.Is(err, worktree.ErrBaseBranchNotFound) {
+		return models.FailureKindBaseBranch
+	}
+	return ""
+}
+
+// failJob marks a job as failed with the kind of failure, if known
+func (m *Manager) failJob(job *models.Job, errorMsg, kind string) {
+	m.lock(lockExecute)
 	defer m.mu.Unlock()
+	m.fail(job, errorMsg, kind)
+}
 
+// fail marks a job as failed. Callers must hold m.mu.
+func (m *Manager) fail(job *models.Job, errorMsg, kind string) {
 	now := time.Now()
-	job.Status = models.JobStatusFailed
+	transition(job, models.JobStatusFailed, actorOrchestrator, errorMsg)
 	job.ErrorMessage = errorMsg
+	job.FailureKind = kind
 	job.CompletedAt = &now
+	m.recordAttempt(job)
+	m.jobLog(job.ID, logSourceOrchestrator, "Job failed: %s", errorMsg)
 
 	m.activeJobs[job.ProjectID]--
 	if m.activeJobs[job.ProjectID] < 0 {
@@ -324,36 +1018,42 @@ func (m *Manager) failJob(job *models.Job, errorMsg string) {
 	}
 
 	m.removeFromQueue(job.ID)
+	m.resolveLinked(job)
+	m.applyQAResult(job, nil)
+	m.deliverResult(job)
+	m.recordOutcome(job)
+	m.updateTicket(job)
+	m.settleGroup(job)
+	m.revokeCredentials(job)
+	m.finishJobLog(job.ID)
 }
 
-// insertByPriority inserts a job into the queue sorted by priority
-func (m *Manager) insertByPriority(job *models.Job) {
-	// Find insertion point
-	insertIdx := len(m.queue)
-	for i, j := range m.queue {
-		if job.Priority > j.Priority {
-			insertIdx = i
-			break
-		}
+// enqueue adds a job to the queue backend, failing the job if that is not possible
+func (m *Manager) enqueue(job *models.Job) {
+	delete(m.owned, job.ID)
+	if err := m.backend.Push(context.Background(), job); err != nil {
+		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to enqueue job")
+		now := time.Now()
+		job.ErrorMessage = "Failed to enqueue job: " + err.Error()
+		transition(job, models.JobStatusFailed, actorOrchestrator, job.ErrorMessage)
+		job.CompletedAt = &now
 	}
-
-	// Insert at position
-	m.queue = append(m.queue[:insertIdx], append([]*models.Job{job}, m.queue[insertIdx:]...)...)
 }
 
 // removeFromQueue removes a job from the queue
 func (m *Manager) removeFromQueue(jobID string) {
-	for i, j := range m.queue {
-		if j.ID == jobID {
-			m.queue = append(m.queue[:i], m.queue[i+1:]...)
-			return
-		}
+	if err := m.backend.Remove(context.Background(), jobID); err != nil {
+		log.Error().Err(err).Str("job_id", jobID).Msg("Failed to remove job from queue")
 	}
 }
 
 // getQueuePosition returns the position of a job in the queue
-func (m *Manager) getQueuePosition(jobID string) int {
-	for i, j := range m.queue {
+func (m *Manager) getQueuePosition(ctx context.Context, jobID string) int {
+	queued, err := m.backend.List(ctx)
+	if err != nil {
+		return -1
+	}
+	for i, j := range queued {
 		if j.ID == jobID {
 			return i + 1
 		}
@@ -363,16 +1063,22 @@ func (m *Manager) getQueuePosition(jobID string) int {
 
 // getProjectMaxParallel returns the max parallel jobs for a project
 func (m *Manager) getProjectMaxParallel(projectID string) int {
-	// TODO: Fetch from database
+	if settings, ok := m.projects.Get(projectID); ok && settings.MaxParallel > 0 {
+		return settings.MaxParallel
+	}
 	return 3 // Default
 }
 
 // Errors
 var (
-	ErrJobNotFound        = NewQueueError("job not found")
+	ErrJobNotFound         = NewQueueError("job not found")
 	ErrJobAlreadyCompleted = NewQueueError("job already completed")
+	ErrSourceQuotaExceeded = NewQueueError("submission source has too many unfinished jobs")
+	ErrJobIDExists         = NewQueueError("a job with this ID already exists")
 )
 
+// QueueError is a sentinel error of the queue manager. Errors returned for
+// it may wrap it with more detail, so callers compare with errors.Is.
 type QueueError struct {
 	message string
 }
@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/delivery"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
+)
+
+// newTestManager creates a manager with an in-memory queue that delivers
+// no results and has no worktrees or GitHub
+func newTestManager(cfg config.QueueConfig) *Manager {
+	return NewManager(cfg, NewMemoryBackend(), nil, nil, delivery.NewDeliverer(config.DeliveryConfig{}), project.NewRegistry())
+}
+
+// addJobs holds jobs in the manager's memory
+func addJobs(m *Manager, jobs ...*models.Job) {
+	for _, job := range jobs {
+		m.jobs[job.ID] = job
+	}
+}
+
+func TestCancelJobRefusesFinishedJobs(t *testing.T) {
+	m := newTestManager(config.QueueConfig{MaxParallelJobs: 1})
+	for _, status := range []models.JobStatus{models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCancelled} {
+		job := &models.Job{ID: "job-" + string(status), ProjectID: "p", Status: status}
+		addJobs(m, job)
+
+		if _, err := m.CancelJob(job.ID, nil); !errors.Is(err, ErrJobAlreadyCompleted) {
+			t.Errorf("CancelJob of a %s job = %v, want %v", status, err, ErrJobAlreadyCompleted)
+		}
+		if job.Status != status || len(job.Events) != 0 {
+			t.Errorf("refused cancel left a %s job %s with %d events", status, job.Status, len(job.Events))
+		}
+	}
+
+	pending := &models.Job{ID: "job-pending", ProjectID: "p", Status: models.JobStatusPending}
+	addJobs(m, pending)
+	if _, err := m.CancelJob(pending.ID, nil); err != nil {
+		t.Fatalf("CancelJob of a pending job: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// maxMatrixEntries bounds the runs one job fans out to
+const maxMatrixEntries = 8
+
+// ValidateMatrix checks a job's matrix: only implementations have one, of
+// at most maxMatrixEntries uniquely named entries with a runner label
+func ValidateMatrix(kind models.JobKind, matrix []models.MatrixEntry) error {
+	if len(matrix) == 0 {
+		return nil
+	}
+	if kind == models.JobKindAnalysis {
+		return fmt.Errorf("analysis jobs cannot have a matrix")
+	}
+	if len(matrix) > maxMatrixEntries {
+		return fmt.Errorf("matrix may have at most %d entries", maxMatrixEntries)
+	}
+	names := make(map[string]bool, len(matrix))
+	for _, entry := range matrix {
+		if entry.Name == "" || entry.RunsOn == "" {
+			return fmt.Errorf("matrix entries need a name and runs_on")
+		}
+		if names[entry.Name] {
+			return fmt.Errorf("duplicate matrix entry %s", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+	return nil
+}
+
+// startMatrix queues a QA run of a succeeded job per matrix entry, leaving
+// its QA status pending until they all report. It reports whether any were
+// queued. The caller must hold m.mu.
+func (m *Manager) startMatrix(job *models.Job) bool {
+	if len(job.Matrix) == 0 || job.Status != models.JobStatusCompleted ||
+		job.Result == nil || job.Result.PRNumber == 0 {
+		return false
+	}
+
+	job.MatrixRuns = make([]models.MatrixRun, 0, len(job.Matrix))
+	job.QAStatus = models.QAStatusPending
+	var unqueued []int
+	for i, entry := range job.Matrix {
+		run := m.newMatrixRun(job, entry)
+		job.MatrixRuns = append(job.MatrixRuns, models.MatrixRun{
+			MatrixEntry: entry,
+			JobID:       run.ID,
+			QAStatus:    models.QAStatusPending,
+		})
+		if run.Status != models.JobStatusPending {
+			unqueued = append(unqueued, i)
+		}
+	}
+	m.jobLog(job.ID, logSourceOrchestrator, "Queued QA runs on %d matrix entries", len(job.Matrix))
+	for _, i := range unqueued {
+		m.applyMatrixResult(job, i, models.QAStatusStale)
+	}
+	return true
+}
+
+// newMatrixRun queues a QA-only job running on a matrix entry's runner
+func (m *Manager) newMatrixRun(parent *models.Job, entry models.MatrixEntry) *models.Job {
+	run := m.newQAJob(parent)
+	run.RunsOn = entry.RunsOn
+	recordCreated(run, actorOrchestrator, "matrix entry "+entry.Name+" of job "+parent.ID)
+	m.jobs[run.ID] = run
+	m.enqueue(run)
+	return run
+}
+
+// matrixRunIndex returns the index of the matrix run a QA job reports for,
+// or -1 when it is not one of parent's matrix runs
+func matrixRunIndex(parent *models.Job, jobID string) int {
+	for i, run := range parent.MatrixRuns {
+		if run.JobID == jobID {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyMatrixResult records a matrix run's QA outcome on its parent. Once
+// every run reported, the parent's QA status and result combine theirs and
+// the result is delivered.
+func (m *Manager) applyMatrixResult(parent *models.Job, i int, status models.QAStatus) {
+	parent.MatrixRuns[i].QAStatus = status
+
+	combined := models.QAStatusPassed
+	for _, run := range parent.MatrixRuns {
+		switch {
+		case run.QAStatus == models.QAStatusPending:
+			return
+		case run.QAStatus == models.QAStatusFailed:
+			combined = models.QAStatusFailed
+		case run.QAStatus == models.QAStatusStale && combined == models.QAStatusPassed:
+			combined = models.QAStatusStale
+		}
+	}
+
+	parent.QAStatus = combined
+	if parent.Result != nil {
+		parent.Result.QAPassed = combined == models.QAStatusPassed
+	}
+	m.jobLog(parent.ID, logSourceOrchestrator, "Matrix QA %s on all %d entries", combined, len(parent.MatrixRuns))
+	log.Info().
+		Str("job_id", parent.ID).
+		Str("qa_status", string(combined)).
+		Msg("Matrix QA finished")
+	m.deliverResult(parent)
+}
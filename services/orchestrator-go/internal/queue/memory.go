@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/memory"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// memoryTimeout bounds writing a job's outcome back to the memory service
+const memoryTimeout = 30 * time.Second
+
+// Memory supplies project context for jobs and keeps their outcomes
+type Memory interface {
+	Context(ctx context.Context, projectID, task string) (*memory.ProjectContext, error)
+	Record(ctx context.Context, projectID, ticketID, memoryType string, content map[string]interface{}) error
+}
+
+// SetMemory makes jobs dispatch with project context from the memory
+// service and report their outcomes to it
+func (m *Manager) SetMemory(mem Memory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.memory = mem
+}
+
+// projectContext fetches the context relevant to a job's ticket. Jobs are
+// dispatched without it when the memory service cannot provide any.
+func (m *Manager) projectContext(ctx context.Context, job *models.Job) string {
+	if m.memory == nil || job.Kind == models.JobKindQARerun {
+		return ""
+	}
+
+	task := job.TicketTitle
+	if job.TicketDesc != "" {
+		task += "\n\n" + job.TicketDesc
+	}
+	if task == "" {
+		task = job.Prompt
+	}
+	pc, err := m.memory.Context(ctx, job.ProjectID, task)
+	if err != nil {
+		log.Warn().Err(err).Str("job_id", job.ID).Msg("Failed to fetch project context, dispatching without it")
+		m.jobLog(job.ID, logSourceDispatch, "No project context: %v", err)
+		return ""
+	}
+	if pc.Context != "" {
+		m.jobLog(job.ID, logSourceDispatch, "Attached project context from %d sources and %d patterns", len(pc.Sources), len(pc.Patterns))
+	}
+	return pc.Context
+}
+
+// recordOutcome writes a finished job's outcome back to the memory service
+// in the background, so later jobs on the project can learn from it
+func (m *Manager) recordOutcome(job *models.Job) {
+	if m.memory == nil || job.Kind == models.JobKindQARerun {
+		return
+	}
+
+	memoryType := memory.TypeExecutionFailure
+	if job.Status == models.JobStatusCompleted {
+		memoryType = memory.TypeExecutionSuccess
+	}
+	content := map[string]interface{}{
+		"job_id":       job.ID,
+		"ticket_title": job.TicketTitle,
+		"prompt":       job.Prompt,
+		"branch_name":  job.BranchName,
+		"status":       string(job.Status),
+		"attempts":     len(job.Attempts),
+	}
+	if job.StartedAt != nil && job.CompletedAt != nil {
+		content["duration_seconds"] = job.CompletedAt.Sub(*job.StartedAt).Seconds()
+	}
+	if job.ErrorMessage != "" {
+		content["error"] = job.ErrorMessage
+	}
+	if job.FailureKind != "" {
+		content["failure_kind"] = job.FailureKind
+	}
+	if job.Result != nil {
+		content["result"] = job.Result.Status
+		if job.Result.PRUrl != "" {
+			content["pr_url"] = job.Result.PRUrl
+		}
+	}
+	mem, projectID, ticketID, jobID := m.memory, job.ProjectID, job.TicketID, job.ID
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), memoryTimeout)
+		defer cancel()
+		if err := mem.Record(ctx, projectID, ticketID, memoryType, content); err != nil {
+			log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to record job outcome in the memory service")
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// SetMessages sets the catalog user-facing messages are rendered from.
+// Without one the built-in English messages are used.
+func (m *Manager) SetMessages(catalog *messages.Catalog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = catalog
+}
+
+// HasLocale reports whether projects can select locale
+func (m *Manager) HasLocale(locale string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.messages.HasLocale(locale)
+}
+
+// message renders a user-facing message in a project's locale, with its
+// overrides. Callers must hold m.mu.
+func (m *Manager) message(projectID, key string, data messages.Data) string {
+	settings, _ := m.projects.Get(projectID)
+	return m.messages.Render(settings.Locale, settings.Messages, key, data)
+}
+
+// resultMessage summarizes a delivered result. Callers must hold m.mu.
+func (m *Manager) resultMessage(job *models.Job, result *models.JobResult) string {
+	key := messages.ResultFailure
+	switch result.Status {
+	case "success":
+		key = messages.ResultSuccess
+	case "no_changes":
+		key = messages.ResultNoChanges
+	case "cancelled":
+		key = messages.ResultCancelled
+	}
+	data := messages.JobData(job)
+	data.Status = result.Status
+	data.PRUrl, data.PRNumber = result.PRUrl, result.PRNumber
+	if result.Error != "" {
+		data.Error = result.Error
+	}
+	return m.message(job.ProjectID, key, data)
+}
+
+// groupMessage summarizes a finished group, in the locale of its first
+// member's project. Callers must hold m.mu.
+func (m *Manager) groupMessage(group *models.JobGroup) string {
+	if len(group.Jobs) == 0 {
+		return ""
+	}
+	key := messages.GroupComplete
+	if group.Status == models.GroupStatusPartialFailure {
+		key = messages.GroupPartialFailure
+	}
+	return m.message(group.Jobs[0].ProjectID, key, messages.Data{
+		GroupID: group.ID,
+		Status:  string(group.Status),
+		Total:   group.Total,
+		Failed:  group.Total - group.Counts[models.JobStatusCompleted],
+	})
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Pause stops dispatching new jobs until Resume. Submissions are still
+// accepted and queued, and jobs already dispatched run to completion.
+// Pausing an already paused queue keeps the original pause time.
+func (m *Manager) Pause(reason, by string) models.QueuePause {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.paused == nil {
+		m.paused = &models.QueuePause{PausedAt: time.Now()}
+	}
+	m.paused.Reason = reason
+	m.paused.PausedBy = by
+
+	log.Warn().Str("reason", reason).Str("by", by).Msg("Queue paused, dispatching stopped")
+	return *m.paused
+}
+
+// Resume restarts dispatching, reporting whether the queue was paused
+func (m *Manager) Resume(by string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.paused == nil {
+		return false
+	}
+	log.Info().
+		Str("by", by).
+		Dur("paused_for", time.Since(m.paused.PausedAt)).
+		Msg("Queue resumed, dispatching restarted")
+	m.paused = nil
+	return true
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// preemptFor makes room for a critical job that cannot be dispatched, when
+// preemption is enabled: the lowest-priority running job in its way, the
+// latest dispatched among equals, is cancelled and a copy of it queued
+// again. In the way are the running jobs of its project when the project is
+// full, and otherwise those holding workers. A critical job preempts one
+// job at a time, waiting while that job's agent still holds a worker. It
+// returns why the critical job is held back, empty when nothing was or is
+// being preempted for it. The caller must hold m.mu.
+func (m *Manager) preemptFor(ctx context.Context, job *models.Job, projectFull bool) string {
+	if !m.cfg.Preemption || job.Priority != models.PriorityCritical {
+		return ""
+	}
+	if victimID, ok := m.preempted[job.ID]; ok {
+		if m.executing[victimID] {
+			return "waiting for preempted job " + victimID + " to stop"
+		}
+		delete(m.preempted, job.ID)
+	}
+
+	var victim *models.Job
+	for _, running := range m.jobs {
+		if running.Status != models.JobStatusDispatched && running.Status != models.JobStatusRunning ||
+			running.Priority >= models.PriorityCritical || running.StopRequestedAt != nil || awaitingChecks(running) {
+			continue
+		}
+		if projectFull && running.ProjectID != job.ProjectID || !projectFull && !m.executing[running.ID] {
+			continue
+		}
+		if victim == nil || running.Priority < victim.Priority ||
+			running.Priority == victim.Priority && running.DispatchedAt.After(*victim.DispatchedAt) {
+			victim = running
+		}
+	}
+	if victim == nil {
+		return ""
+	}
+
+	// An agent running here may still be writing to its worktree as it is
+	// stopped, so the copy starts in a fresh one, queued once the victim's
+	// worktree and branch are removed, or on a fresh branch if the victim
+	// is still preparing its worktree
+	executing := m.executing[victim.ID]
+	m.cancelJob(victim, actorOrchestrator, "preempted by critical job "+job.ID)
+	retry, err := m.requeue(ctx, victim, &models.RequeueJobRequest{ResetWorktree: executing}, actorOrchestrator)
+	if err != nil {
+		log.Error().Err(err).Str("job_id", victim.ID).Msg("Failed to requeue preempted job")
+	} else {
+		log.Info().Str("job_id", victim.ID).Str("retry_job_id", retry.ID).Msg("Preempted job queued again")
+	}
+	m.preempted[job.ID] = victim.ID
+	m.jobLog(job.ID, logSourceOrchestrator, "Preempted job %s (priority %d) to make room", victim.ID, victim.Priority)
+	log.Info().
+		Str("job_id", job.ID).
+		Str("preempted_job_id", victim.ID).
+		Int("preempted_priority", int(victim.Priority)).
+		Msg("Preempted running job for critical job")
+	return "waiting for preempted job " + victim.ID + " to stop"
+}
+
+// nextCritical returns the first pending critical job of the rest of a
+// dispatch pass that only lacks a worker, nil when there is none. Rate rules
+// are evaluated into limited as processQueue does. The caller must hold
+// m.mu.
+func (m *Manager) nextCritical(queued []*models.Job, reserved map[string]int, limited map[string]string, now time.Time) *models.Job {
+	if !m.cfg.Preemption {
+		return nil
+	}
+	for _, queuedJob := range queued {
+		job, ok := m.jobs[queuedJob.ID]
+		if !ok || job.Status != models.JobStatusPending || job.Priority != models.PriorityCritical {
+			continue
+		}
+		if m.runOnly != nil && !m.runOnly[m.executorName(job)] {
+			continue
+		}
+		reason, seen := limited[job.ProjectID]
+		if !seen {
+			reason = m.rateLimited(job.ProjectID, now)
+			limited[job.ProjectID] = reason
+		}
+		if reason == "" && m.hasCapacity(job, reserved) {
+			return job
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// resolvePriority picks a job's priority from the request and its project's
+// settings. Omitted priorities take the project default; priorities above the
+// project ceiling or outside the valid range are clamped, with a warning for
+// the submitter.
+func (m *Manager) resolvePriority(req *models.CreateJobRequest) (models.JobPriority, []string) {
+	settings, _ := m.projects.Get(req.ProjectID)
+
+	if req.Priority == nil {
+		if settings.DefaultPriority != nil {
+			return *settings.DefaultPriority, nil
+		}
+		return models.PriorityLow, nil
+	}
+
+	var warnings []string
+	priority := *req.Priority
+
+	if priority < models.PriorityLow || priority > models.PriorityCritical {
+		clamped := min(max(priority, models.PriorityLow), models.PriorityCritical)
+		warnings = append(warnings, fmt.Sprintf("priority %d is out of range, using %d", priority, clamped))
+		priority = clamped
+	}
+
+	if settings.MaxPriority != nil && priority > *settings.MaxPriority {
+		warnings = append(warnings, fmt.Sprintf("priority %d exceeds the maximum of %d for project %s, using %d",
+			priority, *settings.MaxPriority, req.ProjectID, *settings.MaxPriority))
+		priority = *settings.MaxPriority
+	}
+
+	if len(warnings) > 0 {
+		log.Warn().
+			Str("project_id", req.ProjectID).
+			Int("requested", int(*req.Priority)).
+			Int("priority", int(priority)).
+			Msg("Clamped job priority")
+	}
+
+	return priority, warnings
+}
@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/rs/zerolog/log"
+)
+
+// pullRequestTimeout bounds opening a job's pull request
+const pullRequestTimeout = 30 * time.Second
+
+// SetProviders sets the SCM providers the pull requests of projects with
+// open_pr are opened through. Without them those projects' runs are left
+// to open their own.
+func (m *Manager) SetProviders(providers *scm.Registry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers = providers
+}
+
+// openPullRequest opens the pull request of a successful run that pushed
+// its branch without opening one, when its project has the orchestrator
+// open them, and adds it to the result. A pull request that cannot be
+// opened fails the run, as it does for local runs.
+func (m *Manager) openPullRequest(result *models.JobResult) {
+	// Only callbacks report the head commit of a pushed branch, and local
+	// runs open their pull requests as they push
+	if result.Status != "success" || result.PRNumber > 0 || result.HeadSHA == "" ||
+		result.ReportedBy == models.ExecutorLocal || result.ReportedBy == models.ExecutorDocker {
+		return
+	}
+
+	m.mu.RLock()
+	job := m.findJobForResult(result)
+	if job == nil || job.Kind != models.JobKindImplementation || job.Status.IsTerminal() || isPastRun(job, result.RunID) {
+		m.mu.RUnlock()
+		return
+	}
+	settings, _ := m.projects.Get(job.ProjectID)
+	if !settings.OpenPR || m.providers == nil || job.RepoFullName == "" {
+		m.mu.RUnlock()
+		return
+	}
+	provider := m.providers.ForProject(job.ProjectID)
+	run := *job
+	run.Result = result
+	data := messages.JobData(&run)
+	title := m.message(run.ProjectID, messages.PRTitle, data)
+	body := m.message(run.ProjectID, messages.PRBody, data)
+	m.mu.RUnlock()
+
+	if provider == nil || !provider.Configured() {
+		log.Warn().Str("job_id", run.ID).Str("project_id", run.ProjectID).Msg("SCM provider not configured, cannot open the pull request")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pullRequestTimeout)
+	defer cancel()
+	cr, err := provider.OpenChangeRequest(ctx, run.RepoFullName, run.BranchName, run.BaseBranch, title, body)
+	if err != nil {
+		log.Error().Err(err).Str("job_id", run.ID).Str("branch", run.BranchName).Msg("Failed to open pull request")
+		m.jobLog(run.ID, logSourceOrchestrator, "Failed to open pull request from %s into %s: %v", run.BranchName, run.BaseBranch, err)
+		result.Status = "failure"
+		result.Error = "Failed to open pull request: " + err.Error()
+		result.FailureKind = failureKind(err)
+		return
+	}
+
+	result.PRUrl, result.PRNumber = cr.URL, cr.Number
+	if provider.Name() == models.SCMGitLab {
+		result.MRUrl, result.MRIID = cr.URL, cr.Number
+	}
+	m.jobLog(run.ID, logSourceOrchestrator, "Opened %s change request #%d: %s", provider.Name(), cr.Number, cr.URL)
+	log.Info().Str("job_id", run.ID).Int("pr_number", cr.Number).Str("pr_url", cr.URL).Msg("Opened pull request")
+}
+
+// recordPullRequest notes the pull request a finished implementation's run
+// opened, open until its webhooks say otherwise. The caller must hold m.mu.
+func recordPullRequest(job *models.Job, result *models.JobResult) {
+	if job.Kind != models.JobKindImplementation || result.PRNumber == 0 {
+		return
+	}
+	job.PRNumber, job.PRUrl = result.PRNumber, result.PRUrl
+	job.PRState = models.PRStateOpen
+	job.PRResolvedAt = nil
+}
+
+// HandlePullRequest records that a repository's pull request was merged,
+// closed or reopened on the jobs that opened it
+func (m *Manager) HandlePullRequest(repo string, number int, state models.PRState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.PRNumber != number || job.RepoFullName != repo || job.PRState == state {
+			continue
+		}
+		job.PRState = state
+		job.PRResolvedAt = nil
+		if state != models.PRStateOpen {
+			now := time.Now()
+			job.PRResolvedAt = &now
+		}
+		m.jobLog(job.ID, logSourceOrchestrator, "Pull request #%d is %s", number, state)
+		log.Info().Str("job_id", job.ID).Str("repo", repo).Int("pr_number", number).Str("pr_state", string(state)).Msg("Pull request state changed")
+	}
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// HandleBaseBranchPush reacts to a push on a repository branch. Completed jobs
+// whose PR targets that branch and whose QA had passed get their QA marked
+// stale, and a QA-only re-run is queued so merging waits for a fresh result.
+func (m *Manager) HandleBaseBranchPush(repo, branch, sha string) {
+	if !m.cfg.QARerunOnBaseChange {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.Kind != models.JobKindImplementation || job.Status != models.JobStatusCompleted {
+			continue
+		}
+		if job.RepoFullName != repo || job.BaseBranch != branch || job.QAStatus != models.QAStatusPassed {
+			continue
+		}
+		if job.Result == nil || job.Result.PRNumber == 0 {
+			continue
+		}
+
+		// Jobs with a matrix are verified on all of its entries again
+		if m.startMatrix(job) {
+			log.Info().
+				Str("job_id", job.ID).
+				Str("base_branch", branch).
+				Str("base_sha", sha).
+				Msg("Base branch moved, re-running matrix QA")
+			continue
+		}
+		job.QAStatus = models.QAStatusStale
+		rerun := m.newQARerun(job)
+
+		log.Info().
+			Str("job_id", job.ID).
+			Str("rerun_job_id", rerun.ID).
+			Str("base_branch", branch).
+			Str("base_sha", sha).
+			Msg("Base branch moved, re-running QA")
+	}
+}
+
+// newQARerun queues a QA-only job against the parent's existing branch
+func (m *Manager) newQARerun(parent *models.Job) *models.Job {
+	rerun := m.newQAJob(parent)
+	recordCreated(rerun, actorOrchestrator, "base branch "+parent.BaseBranch+" of job "+parent.ID+" moved")
+	m.jobs[rerun.ID] = rerun
+	m.enqueue(rerun)
+
+	if rerun.Status == models.JobStatusPending {
+		parent.QAStatus = models.QAStatusRerunning
+		parent.QARerunJobID = rerun.ID
+	}
+	return rerun
+}
+
+// newQAJob builds a QA-only job testing the parent's branch
+func (m *Manager) newQAJob(parent *models.Job) *models.Job {
+	return &models.Job{
+		ID:           m.newID(),
+		TicketID:     parent.TicketID,
+		ProjectID:    parent.ProjectID,
+		Source:       parent.Source,
+		Kind:         models.JobKindQARerun,
+		ParentJobID:  parent.ID,
+		RepoFullName: parent.RepoFullName,
+		Priority:     parent.Priority,
+		Status:       models.JobStatusPending,
+		TicketTitle:  parent.TicketTitle,
+		TicketDesc:   parent.TicketDesc,
+		BranchName:   parent.BranchName,
+		BaseBranch:   parent.BaseBranch,
+		TraceParent:  parent.TraceParent,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// applyQAResult records the QA outcome of a finished job. A QA re-run or
+// matrix run reports onto its parent; one that ends without a result leaves
+// the parent stale. A job with a matrix starts its matrix runs.
+func (m *Manager) applyQAResult(job *models.Job, result *models.JobResult) {
+	passed := result != nil && job.Status == models.JobStatusCompleted && result.QAPassed
+
+	if job.Kind != models.JobKindQARerun {
+		if m.startMatrix(job) {
+			return
+		}
+		if passed {
+			job.QAStatus = models.QAStatusPassed
+		}
+		return
+	}
+
+	parent, ok := m.jobs[job.ParentJobID]
+	if !ok {
+		return
+	}
+	if i := matrixRunIndex(parent, job.ID); i >= 0 {
+		switch {
+		case result == nil:
+			m.applyMatrixResult(parent, i, models.QAStatusStale)
+		case passed:
+			m.applyMatrixResult(parent, i, models.QAStatusPassed)
+		default:
+			m.applyMatrixResult(parent, i, models.QAStatusFailed)
+		}
+		return
+	}
+	if parent.QARerunJobID != job.ID {
+		return
+	}
+
+	switch {
+	case result == nil:
+		parent.QAStatus = models.QAStatusStale
+	case passed:
+		parent.QAStatus = models.QAStatusPassed
+	default:
+		parent.QAStatus = models.QAStatusFailed
+	}
+}
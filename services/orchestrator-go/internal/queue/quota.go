@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// HandleWorktreeOverQuota aborts the job using a worktree that grew past
+// its disk quota, failing it as disk_quota, and removes the worktree to
+// free the space
+func (m *Manager) HandleWorktreeOverQuota(wt models.Worktree) {
+	m.lock(lockCancel)
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		// Jobs waiting to be retried in the worktree get a new one instead
+		if job.WorktreeID != wt.ID ||
+			job.Status != models.JobStatusDispatched && job.Status != models.JobStatusRunning {
+			continue
+		}
+		if job.Status == models.JobStatusRunning {
+			m.cancelRun(job, true)
+		}
+		msg := fmt.Sprintf("Worktree uses %d bytes, over its disk quota", wt.DiskUsageBytes)
+		m.fail(job, msg, models.FailureKindDiskQuota)
+		log.Warn().Str("job_id", job.ID).Str("worktree_id", wt.ID).Msg("Aborted job over its worktree disk quota")
+	}
+
+	go func() {
+		if err := m.worktreeManager.Delete(wt.ID); err != nil {
+			log.Warn().Err(err).Str("worktree_id", wt.ID).Msg("Failed to remove worktree over its disk quota")
+		}
+	}()
+}
@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// autobuildBranchPrefix is the prefix of every branch the orchestrator creates
+const autobuildBranchPrefix = "autobuild/"
+
+// reconcileGrace is how long after dispatch a job may go without a visible
+// workflow run before it counts as orphaned
+const reconcileGrace = 10 * time.Minute
+
+// Reconcile compares GitHub's view of each repository the orchestrator works
+// in (open autobuild PRs, active dispatched runs, autobuild branches) with job
+// state and reports what has no counterpart. With Fix set, orphaned runs are
+// cancelled and orphaned jobs are settled from their run's outcome; orphaned
+// branches are deleted only with DeleteBranches, since branches of jobs from
+// before a restart are unknown to this instance. Orphaned PRs are reported only.
+func (m *Manager) Reconcile(ctx context.Context, req *models.ReconcileRequest) (*models.ReconcileReport, error) {
+	if !m.github.Configured() {
+		return nil, github.ErrNotConfigured
+	}
+
+	type repoKey struct{ projectID, repo string }
+	m.mu.RLock()
+	repos := make(map[repoKey]bool)
+	jobs := make([]models.Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if job.RepoFullName == "" || (req.ProjectID != "" && job.ProjectID != req.ProjectID) || !m.onGitHub(job.ProjectID) {
+			continue
+		}
+		repos[repoKey{job.ProjectID, job.RepoFullName}] = true
+		jobs = append(jobs, *job)
+	}
+	m.mu.RUnlock()
+	for _, repo := range req.Repos {
+		repos[repoKey{req.ProjectID, repo}] = true
+	}
+
+	report := &models.ReconcileReport{
+		Fixed:    req.Fix,
+		Findings: []models.ReconcileFinding{},
+	}
+	for key := range repos {
+		report.Repos = append(report.Repos, key.repo)
+		findings, err := m.reconcileRepo(ctx, key.projectID, key.repo, jobs, req)
+		if err != nil {
+			log.Warn().Err(err).Str("repo", key.repo).Msg("Failed to reconcile repository")
+			report.Errors = append(report.Errors, key.repo+": "+err.Error())
+			continue
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+	sort.Strings(report.Repos)
+	report.GeneratedAt = time.Now()
+
+	log.Info().
+		Int("repos", len(report.Repos)).
+		Int("findings", len(report.Findings)).
+		Bool("fix", req.Fix).
+		Msg("Reconciled with GitHub")
+
+	return report, nil
+}
+
+func (m *Manager) reconcileRepo(ctx context.Context, projectID, repo string, jobs []models.Job, req *models.ReconcileRequest) ([]models.ReconcileFinding, error) {
+	runs, err := m.github.ListActiveDispatchedRuns(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	prs, err := m.github.ListOpenPullRequests(ctx, repo, autobuildBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := m.github.ListBranches(ctx, repo, autobuildBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*models.Job)
+	byBranch := make(map[string]*models.Job)
+	for i := range jobs {
+		job := &jobs[i]
+		if job.RepoFullName != repo {
+			continue
+		}
+		byID[job.ID] = job
+		if prev, ok := byBranch[job.BranchName]; !ok || job.CreatedAt.After(prev.CreatedAt) {
+			byBranch[job.BranchName] = job
+		}
+	}
+
+	var findings []models.ReconcileFinding
+
+	// Runs whose job is unknown or already finished
+	activeRuns := make(map[string]bool)
+	for _, run := range runs {
+		job := byID[github.JobIDFromRunName(run.DisplayTitle)]
+		if job == nil {
+			job = byBranch[run.HeadBranch]
+		}
+		if job != nil && !job.Status.IsTerminal() {
+			activeRuns[job.ID] = true
+			continue
+		}
+
+		runID := strconv.FormatInt(run.ID, 10)
+		finding := models.ReconcileFinding{
+			Kind:      models.OrphanRun,
+			ProjectID: projectID,
+			Repo:      repo,
+			RunID:     runID,
+			Branch:    run.HeadBranch,
+			URL:       run.HTMLURL,
+			Detail:    "workflow run has no unfinished job",
+		}
+		if job != nil {
+			finding.JobID = job.ID
+			finding.Detail = "workflow run outlived its job (" + string(job.Status) + ")"
+		}
+		if req.Fix {
+			finding.Action = "cancel_run"
+			if err := m.github.CancelWorkflowRun(ctx, repo, runID); err != nil {
+				finding.Error = err.Error()
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	// Dispatched jobs GitHub has no active run for
+	for _, job := range byID {
+		if job.Status != models.JobStatusDispatched && job.Status != models.JobStatusRunning {
+			continue
+		}
+		if activeRuns[job.ID] || job.DispatchedAt == nil || time.Since(*job.DispatchedAt) < reconcileGrace {
+			continue
+		}
+
+		finding := models.ReconcileFinding{
+			Kind:      models.OrphanJob,
+			ProjectID: job.ProjectID,
+			Repo:      repo,
+			JobID:     job.ID,
+			RunID:     job.RunID,
+			Branch:    job.BranchName,
+			Detail:    "job is " + string(job.Status) + " but has no active workflow run",
+		}
+		if req.Fix {
+			finding.Action = "settle_job"
+			if err := m.settleOrphanJob(ctx, job); err != nil {
+				finding.Error = err.Error()
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	// Open PRs and branches no job accounts for
+	withPR := make(map[string]bool)
+	for _, pr := range prs {
+		withPR[pr.Head.Ref] = true
+		if _, ok := byBranch[pr.Head.Ref]; ok {
+			continue
+		}
+		findings = append(findings, models.ReconcileFinding{
+			Kind:      models.OrphanPR,
+			ProjectID: projectID,
+			Repo:      repo,
+			Branch:    pr.Head.Ref,
+			PRNumber:  pr.Number,
+			URL:       pr.HTMLURL,
+			Detail:    "open pull request has no job",
+		})
+	}
+	for _, branch := range branches {
+		if _, ok := byBranch[branch]; ok || withPR[branch] {
+			continue
+		}
+		finding := models.ReconcileFinding{
+			Kind:      models.OrphanBranch,
+			ProjectID: projectID,
+			Repo:      repo,
+			Branch:    branch,
+			Detail:    "branch has no job and no open pull request",
+		}
+		if req.Fix && req.DeleteBranches {
+			finding.Action = "delete_branch"
+			if err := m.github.DeleteBranch(ctx, repo, branch); err != nil {
+				finding.Error = err.Error()
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// settleOrphanJob finishes a dispatched job whose run is no longer active,
+// using the run's conclusion if the run can still be found
+func (m *Manager) settleOrphanJob(ctx context.Context, job *models.Job) error {
+	run, err := m.github.FindDispatchedRun(ctx, job.RepoFullName, job.ID, job.DispatchedAt.Add(-time.Minute))
+	if err != nil {
+		return err
+	}
+
+	result := &models.JobResult{
+		JobID:      job.ID,
+		TicketID:   job.TicketID,
+		Status:     "failure",
+		RunID:      job.RunID,
+		Error:      "Workflow run not found on GitHub",
+		ReceivedAt: time.Now(),
+		ReportedBy: "reconcile",
+	}
+	if run != nil {
+		result.RunID = strconv.FormatInt(run.ID, 10)
+		result.Error = "Workflow run concluded with " + run.Conclusion
+		if run.Conclusion == "success" {
+			result.Status = "success"
+			result.Error = ""
+		}
+	}
+
+	m.submitResult(result)
+	return nil
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// priorityScoreStep separates priority classes in the sorted set. It is larger
+// than any millisecond timestamp, so jobs order by priority and then FIFO.
+const priorityScoreStep = 1e13
+
+// RedisBackend shares the queue between orchestrator replicas using a sorted
+// set of job IDs and a hash of job payloads. Published job states and
+// cancel requests are kept in hashes of their own.
+type RedisBackend struct {
+	client     *redis.Client
+	queueKey   string
+	jobsKey    string
+	statesKey  string
+	cancelsKey string
+}
+
+// NewRedisBackend connects to Redis and returns a queue backend
+func NewRedisBackend(cfg config.RedisConfig) (*RedisBackend, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	return &RedisBackend{
+		client:     redis.NewClient(opts),
+		queueKey:   cfg.KeyPrefix + "queue",
+		jobsKey:    cfg.KeyPrefix + "queue:jobs",
+		statesKey:  cfg.KeyPrefix + "queue:states",
+		cancelsKey: cfg.KeyPrefix + "queue:cancels",
+	}, nil
+}
+
+// Push stores the job payload and adds it to the sorted set
+func (b *RedisBackend) Push(ctx context.Context, job *models.Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, b.jobsKey, job.ID, payload)
+		pipe.ZAdd(ctx, b.queueKey, redis.Z{Score: score(job), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+// Remove drops a job from the sorted set and payload hash
+func (b *RedisBackend) Remove(ctx context.Context, jobID string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, b.queueKey, jobID)
+		pipe.HDel(ctx, b.jobsKey, jobID)
+		return nil
+	})
+	return err
+}
+
+// Claim relies on ZREM being atomic: only the replica that actually removes
+// the member wins the job
+func (b *RedisBackend) Claim(ctx context.Context, jobID string) (bool, error) {
+	removed, err := b.client.ZRem(ctx, b.queueKey, jobID).Result()
+	if err != nil {
+		return false, err
+	}
+	if removed == 0 {
+		return false, nil
+	}
+
+	b.client.HDel(ctx, b.jobsKey, jobID)
+	return true, nil
+}
+
+// List returns queued jobs in score order
+func (b *RedisBackend) List(ctx context.Context) ([]*models.Job, error) {
+	ids, err := b.client.ZRange(ctx, b.queueKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*models.Job{}, nil
+	}
+
+	// A job claimed between ZRANGE and HMGET has no payload any more
+	return b.load(ctx, b.jobsKey, ids)
+}
+
+// Publish stores the job's state in the states hash
+func (b *RedisBackend) Publish(ctx context.Context, job *models.Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	return b.client.HSet(ctx, b.statesKey, job.ID, payload).Err()
+}
+
+// Published returns the stored states of the jobs given
+func (b *RedisBackend) Published(ctx context.Context, jobIDs []string) ([]*models.Job, error) {
+	if len(jobIDs) == 0 {
+		return []*models.Job{}, nil
+	}
+	return b.load(ctx, b.statesKey, jobIDs)
+}
+
+// PublishedIDs lists the fields of the states hash
+func (b *RedisBackend) PublishedIDs(ctx context.Context) ([]string, error) {
+	return b.client.HKeys(ctx, b.statesKey).Result()
+}
+
+// Unpublish drops the job's state from the states hash
+func (b *RedisBackend) Unpublish(ctx context.Context, jobID string) error {
+	return b.client.HDel(ctx, b.statesKey, jobID).Err()
+}
+
+// RequestCancel stores the request in the cancels hash, replacing any
+// earlier one for the job
+func (b *RedisBackend) RequestCancel(ctx context.Context, req CancelRequest) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode cancel request: %w", err)
+	}
+	return b.client.HSet(ctx, b.cancelsKey, req.JobID, payload).Err()
+}
+
+// TakeCancelRequests reads and deletes the jobs' requests in one
+// transaction, so each is taken once
+func (b *RedisBackend) TakeCancelRequests(ctx context.Context, jobIDs []string) ([]CancelRequest, error) {
+	if len(jobIDs) == 0 {
+		return nil, nil
+	}
+
+	var get *redis.SliceCmd
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.HMGet(ctx, b.cancelsKey, jobIDs...)
+		pipe.HDel(ctx, b.cancelsKey, jobIDs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var reqs []CancelRequest
+	for _, payload := range get.Val() {
+		raw, ok := payload.(string)
+		if !ok {
+			continue
+		}
+		var req CancelRequest
+		if err := json.Unmarshal([]byte(raw), &req); err != nil {
+			return nil, fmt.Errorf("failed to decode cancel request: %w", err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// load decodes the payloads of a hash's fields, skipping missing ones
+func (b *RedisBackend) load(ctx context.Context, key string, ids []string) ([]*models.Job, error) {
+	payloads, err := b.client.HMGet(ctx, key, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*models.Job, 0, len(ids))
+	for _, payload := range payloads {
+		raw, ok := payload.(string)
+		if !ok {
+			continue
+		}
+		job, err := decodeJob([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func score(job *models.Job) float64 {
+	return float64(models.PriorityCritical-job.Priority)*priorityScoreStep + float64(job.CreatedAt.UnixMilli())
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/ids"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrJobNotRetryable is returned when requeueing a job that has not failed or been cancelled
+var ErrJobNotRetryable = NewQueueError("only failed or cancelled jobs can be retried")
+
+// Requeue queues a copy of a failed or cancelled job under a new ID. By
+// default the copy continues on the original branch in the original's
+// worktree, if it is still on disk; ResetWorktree starts it in a fresh
+// worktree and ResetBranch on a fresh branch (which implies a fresh worktree).
+func (m *Manager) Requeue(ctx context.Context, jobID string, req *models.RequeueJobRequest, scope Scope) (*models.CreateJobResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orig, ok := m.jobs[jobID]
+	if !ok || !inScope(scope, orig.ProjectID) {
+		return nil, ErrJobNotFound
+	}
+	if orig.Status != models.JobStatusFailed && orig.Status != models.JobStatusCancelled {
+		return nil, fmt.Errorf("%w (job is %s)", ErrJobNotRetryable, orig.Status)
+	}
+	if limit, ok := m.cfg.SourceMaxActive[orig.Source]; ok && m.activeForSource(orig.Source) >= limit {
+		return nil, ErrSourceQuotaExceeded
+	}
+	if settings, _ := m.projects.Get(orig.ProjectID); settings.ArchivedAt != nil {
+		return nil, ErrProjectArchived
+	}
+	if err := m.checkQueueDepth(orig.ProjectID); err != nil {
+		return nil, err
+	}
+
+	job, err := m.requeue(ctx, orig, req, actorOf(scope))
+	if err != nil {
+		return nil, err
+	}
+
+	position := m.getQueuePosition(ctx, job.ID)
+
+	log.Info().
+		Str("job_id", job.ID).
+		Str("retry_of", orig.ID).
+		Bool("reset_branch", req.ResetBranch).
+		Bool("reuse_worktree", job.WorktreeID != "").
+		Int("position", position).
+		Msg("Job requeued")
+
+	return &models.CreateJobResponse{
+		Job:      job,
+		Position: position,
+		Message:  m.message(job.ProjectID, messages.JobRequeued, messages.JobData(job)),
+	}, nil
+}
+
+// requeue queues a copy of a finished job, as Requeue does. It ignores the
+// queue depth limits, so a preempted job is never dropped. The caller must
+// hold m.mu.
+func (m *Manager) requeue(ctx context.Context, orig *models.Job, req *models.RequeueJobRequest, actor string) (*models.Job, error) {
+	job := &models.Job{
+		ID:             m.newID(),
+		TicketID:       orig.TicketID,
+		ProjectID:      orig.ProjectID,
+		Source:         orig.Source,
+		GroupID:        orig.GroupID,
+		Kind:           orig.Kind,
+		ParentJobID:    orig.ParentJobID,
+		RetryOf:        orig.ID,
+		RepoFullName:   orig.RepoFullName,
+		Priority:       orig.Priority,
+		Status:         models.JobStatusPending,
+		Prompt:         orig.Prompt,
+		TicketTitle:    orig.TicketTitle,
+		TicketDesc:     orig.TicketDesc,
+		BranchName:     orig.BranchName,
+		BaseBranch:     orig.BaseBranch,
+		Matrix:         orig.Matrix,
+		RunsOn:         orig.RunsOn,
+		CallbackURL:    orig.CallbackURL,
+		CallbackSecret: orig.CallbackSecret,
+		Fingerprint:    orig.Fingerprint,
+		TemplateID:     orig.TemplateID,
+		Labels:         orig.Labels,
+		Executor:       orig.Executor,
+		Vars:           orig.Vars,
+		Deadline:       orig.Deadline,
+		TraceParent:    tracing.Inject(ctx),
+		CreatedAt:      time.Now(),
+	}
+
+	// Hand the original's worktree to the copy, or release it. A released
+	// worktree's branch is deleted with it, so a copy on the same branch is
+	// queued once the worktree is gone. An original still preparing its
+	// worktree holds its branch until then, and its copy takes a fresh one.
+	var release string
+	resetBranch := req.ResetBranch
+	if orig.WorktreeID != "" && job.Kind != models.JobKindQARerun {
+		if wt, ok := m.worktreeManager.Get(orig.WorktreeID); ok && wt.Status == models.WorktreeStatusActive {
+			if resetBranch || req.ResetWorktree {
+				release = orig.WorktreeID
+			} else {
+				job.WorktreeID = orig.WorktreeID
+			}
+		}
+	} else if m.executing[orig.ID] && job.Kind != models.JobKindQARerun {
+		resetBranch = true
+	}
+	if resetBranch && orig.BranchName != "" {
+		job.BranchName = orig.BranchName + "-" + ids.Suffix(job.ID, 8)
+	}
+
+	recordCreated(job, actor, "retry of job "+orig.ID)
+	m.jobs[job.ID] = job
+	m.lastJobAt[job.ProjectID] = job.CreatedAt
+	m.reopenGroup(job.ProjectID, job.GroupID)
+	if release == "" || resetBranch {
+		if err := m.backend.Push(ctx, job); err != nil {
+			delete(m.jobs, job.ID)
+			return nil, err
+		}
+	}
+	if release != "" {
+		go func() {
+			if err := m.worktreeManager.Delete(release); err != nil {
+				log.Warn().Err(err).Str("job_id", orig.ID).Msg("Failed to remove worktree of requeued job")
+			}
+			if resetBranch {
+				return
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			// The copy may have been cancelled while the worktree was removed
+			if job.Status == models.JobStatusPending {
+				m.enqueue(job)
+			}
+		}()
+	}
+
+	// A retried QA re-run or matrix run reports onto the parent in place
+	// of the original
+	if job.Kind == models.JobKindQARerun {
+		if parent, ok := m.jobs[job.ParentJobID]; ok {
+			if i := matrixRunIndex(parent, orig.ID); i >= 0 {
+				parent.MatrixRuns[i].JobID = job.ID
+				parent.MatrixRuns[i].QAStatus = models.QAStatusPending
+				parent.QAStatus = models.QAStatusPending
+			} else if parent.QARerunJobID == orig.ID {
+				parent.QAStatus = models.QAStatusRerunning
+				parent.QARerunJobID = job.ID
+			}
+		}
+	}
+
+	return job, nil
+}
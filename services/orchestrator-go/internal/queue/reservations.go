@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Reservation errors
+var (
+	ErrReservationNotFound = NewQueueError("reservation not found")
+	ErrReservationConflict = NewQueueError("reservation exceeds worker capacity during its window")
+	ErrInvalidReservation  = NewQueueError("reservation needs a project, at least one slot, and an end after its start")
+)
+
+// Reserve books worker slots for a project over a time window. Overlapping
+// reservations may not together hold more slots than there are workers.
+func (m *Manager) Reserve(req *models.CreateReservationRequest) (*models.Reservation, error) {
+	if req.ProjectID == "" || req.Slots < 1 || !req.EndsAt.After(req.StartsAt) || !req.EndsAt.After(time.Now()) {
+		return nil, ErrInvalidReservation
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := &models.Reservation{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		ProjectID: req.ProjectID,
+		Slots:     req.Slots,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		CreatedAt: time.Now(),
+	}
+
+	if m.peakReservedSlots(res)+res.Slots > m.cfg.MaxParallelJobs {
+		return nil, ErrReservationConflict
+	}
+
+	m.reservations[res.ID] = res
+
+	log.Info().
+		Str("reservation_id", res.ID).
+		Str("project_id", res.ProjectID).
+		Int("slots", res.Slots).
+		Time("starts_at", res.StartsAt).
+		Time("ends_at", res.EndsAt).
+		Msg("Worker slots reserved")
+
+	return res, nil
+}
+
+// CancelReservation releases a reservation
+func (m *Manager) CancelReservation(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[id]; !ok {
+		return ErrReservationNotFound
+	}
+	delete(m.reservations, id)
+
+	log.Info().Str("reservation_id", id).Msg("Reservation cancelled")
+	return nil
+}
+
+// ListReservations returns active and upcoming reservations, soonest first
+func (m *Manager) ListReservations(scope Scope) []models.Reservation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.upcomingReservations(time.Now(), scope)
+}
+
+func (m *Manager) upcomingReservations(now time.Time, scope Scope) []models.Reservation {
+	list := make([]models.Reservation, 0, len(m.reservations))
+	for _, r := range m.reservations {
+		if !r.EndsAt.After(now) || !inScope(scope, r.ProjectID) {
+			continue
+		}
+		res := *r
+		res.Active = !r.StartsAt.After(now)
+		list = append(list, res)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartsAt.Before(list[j].StartsAt)
+	})
+	return list
+}
+
+// peakReservedSlots returns the most slots other reservations hold at any
+// point during res's window. The peak is always at the start of res or of
+// one of the reservations overlapping it.
+func (m *Manager) peakReservedSlots(res *models.Reservation) int {
+	points := []time.Time{res.StartsAt}
+	for _, r := range m.reservations {
+		if r.StartsAt.After(res.StartsAt) && r.StartsAt.Before(res.EndsAt) {
+			points = append(points, r.StartsAt)
+		}
+	}
+
+	peak := 0
+	for _, t := range points {
+		held := 0
+		for _, r := range m.reservations {
+			if !r.StartsAt.After(t) && r.EndsAt.After(t) {
+				held += r.Slots
+			}
+		}
+		peak = max(peak, held)
+	}
+	return peak
+}
+
+// reservedSlots returns the slots held per project by reservations active at
+// now, dropping reservations that have ended
+func (m *Manager) reservedSlots(now time.Time) map[string]int {
+	reserved := make(map[string]int)
+	for id, r := range m.reservations {
+		if !r.EndsAt.After(now) {
+			delete(m.reservations, id)
+			continue
+		}
+		if !r.StartsAt.After(now) {
+			reserved[r.ProjectID] += r.Slots
+		}
+	}
+	return reserved
+}
+
+// projectFull reports whether a job's project runs as many jobs as its
+// parallelism limit, or its reserved slots if more, allow
+func (m *Manager) projectFull(job *models.Job, reserved map[string]int) bool {
+	limit := max(m.getProjectMaxParallel(job.ProjectID), reserved[job.ProjectID])
+	return m.activeJobs[job.ProjectID] >= limit
+}
+
+// hasCapacity reports whether a job may take a worker without eating into
+// slots reserved for other projects. A project may also exceed its usual
+// parallelism limit up to its reserved slots.
+func (m *Manager) hasCapacity(job *models.Job, reserved map[string]int) bool {
+	if m.projectFull(job, reserved) {
+		return false
+	}
+
+	held := 0
+	for projectID, slots := range reserved {
+		if projectID == job.ProjectID {
+			continue
+		}
+		held += max(0, slots-m.activeJobs[projectID])
+	}
+	return m.workers.inUse()+held < m.cfg.MaxParallelJobs
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/hostres"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Host resources that defer dispatching when short
+const (
+	resourceDisk   = "disk"
+	resourceLoad   = "load"
+	resourceMemory = "memory"
+)
+
+// resourceShortage returns the host resource too short for another job, why
+// and what was measured, or "" when the host has room. Resources that cannot
+// be read do not hold dispatching back.
+func (m *Manager) resourceShortage() (resource, reason, measured string) {
+	if limit := m.cfg.MinFreeDiskBytes; limit > 0 {
+		path := m.worktreeManager.BasePath()
+		free, err := hostres.FreeDisk(path)
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to read free disk")
+		} else if free < uint64(limit) {
+			return resourceDisk, fmt.Sprintf("waiting for host resources: less than %d MiB disk free in %s", limit>>20, path),
+				fmt.Sprintf("%d MiB", free>>20)
+		}
+	}
+	if limit := m.cfg.MaxLoadPerCPU; limit > 0 {
+		load, err := hostres.LoadPerCPU()
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to read load average")
+		} else if load > limit {
+			return resourceLoad, fmt.Sprintf("waiting for host resources: load average above %.2f per CPU", limit),
+				fmt.Sprintf("%.2f", load)
+		}
+	}
+	if limit := m.cfg.MinFreeMemoryBytes; limit > 0 {
+		free, err := hostres.FreeMemory()
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to read available memory")
+		} else if free < uint64(limit) {
+			return resourceMemory, fmt.Sprintf("waiting for host resources: less than %d MiB memory available", limit>>20),
+				fmt.Sprintf("%d MiB", free>>20)
+		}
+	}
+	return "", "", ""
+}
+
+// deferForResources holds every pending job back while the host is short of
+// a resource, reporting whether it did. The caller must hold m.mu.
+func (m *Manager) deferForResources(queued []*models.Job) bool {
+	resource, reason, measured := m.resourceShortage()
+	if m.sched.observeDeferral(resource) {
+		if resource != "" {
+			log.Warn().Str("resource", resource).Str("measured", measured).Msg("Deferring dispatch: " + reason)
+		} else {
+			log.Info().Msg("Host resources recovered, resuming dispatch")
+		}
+	}
+	if resource == "" {
+		return false
+	}
+	for _, queuedJob := range queued {
+		if job, ok := m.jobs[queuedJob.ID]; ok && job.Status == models.JobStatusPending {
+			m.block(job, reason)
+		}
+	}
+	return true
+}
+
+// observeDeferral records the resource that held back a dispatch loop pass,
+// or "" when none did, and reports whether that changed since the last pass
+func (s *schedulerMetrics) observeDeferral(resource string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resource != "" {
+		if s.deferrals == nil {
+			s.deferrals = make(map[string]uint64)
+		}
+		s.deferrals[resource]++
+	}
+	changed := resource != s.deferredFor
+	s.deferredFor = resource
+	return changed
+}
@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// resultShardBuffer is how many results each worker can have waiting
+const resultShardBuffer = 32
+
+// resultShard feeds one result worker. Results for jobs at high or critical
+// priority are taken ahead of the rest.
+type resultShard struct {
+	high   chan *models.JobResult
+	normal chan *models.JobResult
+}
+
+// submitResult hands a result to the result workers
+func (m *Manager) submitResult(result *models.JobResult) {
+	// The merge request of a GitLab run stands in for its pull request
+	if result.PRUrl == "" && result.MRUrl != "" {
+		result.PRUrl, result.PRNumber = result.MRUrl, result.MRIID
+	}
+	m.pendingResults.Add(1)
+	m.resultChan <- result
+}
+
+// routeResults spreads incoming results over the result workers. Every
+// result for a job goes to the same worker, so results for one job are
+// handled in order while results for different jobs are handled in parallel
+// and never hold up dispatching.
+func (m *Manager) routeResults(ctx context.Context) {
+	n := max(m.cfg.ResultWorkers, 1)
+	shards := make([]resultShard, n)
+	for i := range shards {
+		shards[i] = resultShard{
+			high:   make(chan *models.JobResult, resultShardBuffer),
+			normal: make(chan *models.JobResult, resultShardBuffer),
+		}
+		go m.resultWorker(ctx, shards[i])
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result := <-m.resultChan:
+			key, priority := m.resultKey(result)
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			shard := shards[h.Sum32()%uint32(n)]
+
+			ch := shard.normal
+			if priority >= models.PriorityHigh {
+				ch = shard.high
+			}
+			select {
+			case ch <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// resultKey identifies the job a result belongs to, and its priority
+func (m *Manager) resultKey(result *models.JobResult) (string, models.JobPriority) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if job := m.findJobForResult(result); job != nil {
+		return job.ID, job.Priority
+	}
+	if result.JobID != "" {
+		return result.JobID, models.PriorityLow
+	}
+	return result.TicketID, models.PriorityLow
+}
+
+func (m *Manager) resultWorker(ctx context.Context, shard resultShard) {
+	for {
+		// Drain high priority results before looking at the rest
+		var result *models.JobResult
+		select {
+		case result = <-shard.high:
+		default:
+			select {
+			case <-ctx.Done():
+				return
+			case result = <-shard.high:
+			case result = <-shard.normal:
+			}
+		}
+
+		m.openPullRequest(result)
+		m.handleResult(result)
+		m.pendingResults.Add(-1)
+	}
+}
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Archiver persists finished jobs evicted from memory
+type Archiver interface {
+	Archive(ctx context.Context, jobs []*models.Job) error
+	// Get returns an archived job, or nil if it is not archived
+	Get(ctx context.Context, jobID string) (*models.Job, error)
+	// Purge deletes archived jobs completed before the cutoff
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// Completed returns the archived jobs completed in [from, to)
+	Completed(ctx context.Context, from, to time.Time) ([]*models.Job, error)
+	// Search returns up to search.Limit archived jobs matching a full-text
+	// search, newest first
+	Search(ctx context.Context, search models.JobSearch) ([]*models.Job, error)
+}
+
+// SetArchiver makes evicted jobs go to the archive instead of being dropped
+func (m *Manager) SetArchiver(archiver Archiver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archiver = archiver
+}
+
+// GetArchivedJob looks up a job evicted from memory. It reports false when no
+// archive is configured or the job is not in it.
+func (m *Manager) GetArchivedJob(ctx context.Context, jobID string, scope Scope) (*models.Job, bool, error) {
+	m.mu.RLock()
+	archiver := m.archiver
+	m.mu.RUnlock()
+	if archiver == nil {
+		return nil, false, nil
+	}
+
+	job, err := archiver.Get(ctx, jobID)
+	if err != nil || job == nil || !inScope(scope, job.ProjectID) {
+		return nil, false, err
+	}
+	return job, true, nil
+}
+
+// runRetention applies the retention policy every RetentionInterval
+func (m *Manager) runRetention(ctx context.Context) {
+	if m.cfg.RetentionInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.cfg.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.applyRetention(ctx)
+		}
+	}
+}
+
+// applyRetention evicts finished jobs past the retention TTL, then the oldest
+// finished jobs while more than the maximum are held
+func (m *Manager) applyRetention(ctx context.Context) {
+	var cutoff time.Time
+	if m.cfg.RetentionTTL > 0 {
+		cutoff = time.Now().Add(-m.cfg.RetentionTTL)
+	}
+	if _, err := m.evict(ctx, cutoff, m.cfg.RetentionMaxJobs); err != nil {
+		log.Error().Err(err).Msg("Failed to archive finished jobs, keeping them in memory")
+	}
+}
+
+// PurgeJobs evicts every finished job completed before the cutoff and
+// deletes archived jobs completed before it
+func (m *Manager) PurgeJobs(ctx context.Context, before time.Time) (*models.PurgeResult, error) {
+	evicted, err := m.evict(ctx, before, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.PurgeResult{Evicted: evicted, Before: before}
+
+	m.mu.RLock()
+	archiver := m.archiver
+	m.mu.RUnlock()
+	if archiver != nil {
+		if result.Purged, err = archiver.Purge(ctx, before); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().
+		Time("before", before).
+		Int("evicted", result.Evicted).
+		Int64("purged", result.Purged).
+		Msg("Purged finished jobs")
+	return result, nil
+}
+
+// evict removes finished jobs completed before cutoff (zero for no cutoff),
+// plus the oldest finished jobs beyond maxJobs (zero for no limit). Jobs are
+// archived first when an archive is configured, and kept if that fails.
+func (m *Manager) evict(ctx context.Context, cutoff time.Time, maxJobs int) (int, error) {
+	m.mu.RLock()
+	candidates := m.evictionCandidates(cutoff, maxJobs)
+	archiver := m.archiver
+	snapshots := make([]*models.Job, len(candidates))
+	for i, job := range candidates {
+		c := *job
+		snapshots[i] = &c
+	}
+	m.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	if archiver != nil {
+		if err := archiver.Archive(ctx, snapshots); err != nil {
+			return 0, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var evicted []string
+	for _, job := range candidates {
+		// A concurrent purge may have evicted it already
+		if _, ok := m.jobs[job.ID]; ok {
+			delete(m.jobs, job.ID)
+			evicted = append(evicted, job.ID)
+		}
+	}
+	m.unpublish(ctx, evicted)
+
+	log.Info().
+		Int("evicted", len(evicted)).
+		Bool("archived", archiver != nil).
+		Int("remaining", len(m.jobs)).
+		Msg("Evicted finished jobs from memory")
+	return len(evicted), nil
+}
+
+// evictionCandidates picks finished jobs to evict. Jobs something still
+// depends on are kept: originals awaited by linked duplicates, parents of
+// unfinished QA re-runs, and members of groups that are still in progress.
+func (m *Manager) evictionCandidates(cutoff time.Time, maxJobs int) []*models.Job {
+	openGroups := make(map[string]bool)
+	for _, job := range m.jobs {
+		if job.GroupID != "" && !job.Status.IsTerminal() {
+			openGroups[groupKey(job.ProjectID, job.GroupID)] = true
+		}
+	}
+
+	var finished []*models.Job
+	for _, job := range m.jobs {
+		if !job.Status.IsTerminal() || job.CompletedAt == nil ||
+			len(m.linked[job.ID]) > 0 || openGroups[groupKey(job.ProjectID, job.GroupID)] {
+			continue
+		}
+		if rerun, ok := m.jobs[job.QARerunJobID]; ok && !rerun.Status.IsTerminal() {
+			continue
+		}
+		if job.QAStatus == models.QAStatusPending {
+			continue
+		}
+		finished = append(finished, job)
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CompletedAt.Before(*finished[j].CompletedAt)
+	})
+
+	excess := 0
+	if maxJobs > 0 && len(m.jobs) > maxJobs {
+		excess = len(m.jobs) - maxJobs
+	}
+
+	var candidates []*models.Job
+	for i, job := range finished {
+		if i < excess || (!cutoff.IsZero() && job.CompletedAt.Before(cutoff)) {
+			candidates = append(candidates, job)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,343 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// rollupCheckInterval is how often finished days are looked for, so each
+// is rolled up within this long of ending
+const rollupCheckInterval = time.Hour
+
+// ErrRollupsDisabled is returned for reports and rollups without a rollup
+// store
+var ErrRollupsDisabled = NewQueueError("job rollups are not enabled")
+
+// RollupStore keeps daily per-project rollups of finished jobs
+type RollupStore interface {
+	// SaveRollups replaces the rollups of a day
+	SaveRollups(ctx context.Context, day time.Time, rollups []models.JobRollup) error
+	// ListRollups returns the rollups of the days in [from, to] of a
+	// project, or of all when projectID is empty
+	ListRollups(ctx context.Context, from, to time.Time, projectID string) ([]models.JobRollup, error)
+	// LastRolledUp returns the latest day with rollups, or nil
+	LastRolledUp(ctx context.Context) (*time.Time, error)
+}
+
+type rollupState struct {
+	mu    sync.Mutex // serializes rollup runs
+	store RollupStore
+	// through is the latest day rolled up, zero until known
+	through time.Time
+}
+
+// SetRollupStore makes finished days roll up into store, and reports read
+// from it
+func (m *Manager) SetRollupStore(store RollupStore) {
+	m.rollups.mu.Lock()
+	defer m.rollups.mu.Unlock()
+	m.rollups.store = store
+}
+
+// runRollups rolls up each day once it has ended
+func (m *Manager) runRollups(ctx context.Context) {
+	if !m.cfg.RollupsEnabled {
+		return
+	}
+	m.rollUpFinishedDays(ctx)
+
+	ticker := time.NewTicker(rollupCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.rollUpFinishedDays(ctx)
+		}
+	}
+}
+
+// rollUpFinishedDays rolls up the days that ended since the last rollup,
+// at most RollupBackfillDays back, then purges archived jobs past their
+// maximum age. Only the leader writes rollups.
+func (m *Manager) rollUpFinishedDays(ctx context.Context) {
+	m.mu.RLock()
+	leader := m.isLeader()
+	m.mu.RUnlock()
+	if !leader {
+		return
+	}
+
+	m.rollups.mu.Lock()
+	defer m.rollups.mu.Unlock()
+	store := m.rollups.store
+	if store == nil {
+		return
+	}
+
+	if m.rollups.through.IsZero() {
+		last, err := store.LastRolledUp(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to look up the last job rollup")
+			return
+		}
+		if last != nil {
+			m.rollups.through = startOfDay(*last)
+		}
+	}
+
+	today := startOfDay(time.Now())
+	from := today.AddDate(0, 0, -m.cfg.RollupBackfillDays)
+	if next := m.rollups.through.AddDate(0, 0, 1); next.After(from) {
+		from = next
+	}
+	if yesterday := today.AddDate(0, 0, -1); !from.After(yesterday) {
+		result, err := m.rollUpDays(ctx, store, from, yesterday)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to roll up finished jobs")
+			return
+		}
+		log.Info().
+			Str("from", from.Format(time.DateOnly)).
+			Str("to", yesterday.Format(time.DateOnly)).
+			Int("rollups", result.Rollups).
+			Msg("Rolled up finished jobs")
+	}
+
+	m.purgeRolledUp(ctx)
+}
+
+// purgeRolledUp deletes archived jobs older than ArchiveMaxAge, keeping
+// those of days not rolled up yet. Caller holds m.rollups.mu.
+func (m *Manager) purgeRolledUp(ctx context.Context) {
+	m.mu.RLock()
+	archiver := m.archiver
+	m.mu.RUnlock()
+	if m.cfg.ArchiveMaxAge <= 0 || archiver == nil || m.rollups.through.IsZero() {
+		return
+	}
+
+	cutoff := time.Now().Add(-m.cfg.ArchiveMaxAge)
+	if rolledUp := m.rollups.through.AddDate(0, 0, 1); cutoff.After(rolledUp) {
+		cutoff = rolledUp
+	}
+	purged, err := archiver.Purge(ctx, cutoff)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to purge rolled-up jobs from the archive")
+		return
+	}
+	if purged > 0 {
+		log.Info().Time("before", cutoff).Int64("purged", purged).Msg("Purged rolled-up jobs from the archive")
+	}
+}
+
+// RollUp recomputes the rollups of the days in [from, to], such as after
+// restoring archived jobs
+func (m *Manager) RollUp(ctx context.Context, from, to time.Time) (*models.RollupResult, error) {
+	m.rollups.mu.Lock()
+	defer m.rollups.mu.Unlock()
+	if m.rollups.store == nil {
+		return nil, ErrRollupsDisabled
+	}
+	result, err := m.rollUpDays(ctx, m.rollups.store, startOfDay(from), startOfDay(to))
+	if err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("from", from.Format(time.DateOnly)).
+		Str("to", to.Format(time.DateOnly)).
+		Int("rollups", result.Rollups).
+		Msg("Rolled up finished jobs on request")
+	return result, nil
+}
+
+// rollUpDays rolls up and saves each day in [from, to]. Caller holds
+// m.rollups.mu.
+func (m *Manager) rollUpDays(ctx context.Context, store RollupStore, from, to time.Time) (*models.RollupResult, error) {
+	result := &models.RollupResult{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		rollups, err := m.rollUpDay(ctx, day)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.SaveRollups(ctx, day, rollups); err != nil {
+			return nil, err
+		}
+		result.Days++
+		result.Rollups += len(rollups)
+		if day.After(m.rollups.through) && day.Before(startOfDay(time.Now())) {
+			m.rollups.through = day
+		}
+	}
+	return result, nil
+}
+
+// rollUpDay aggregates the jobs that finished on day, whether still in
+// memory or evicted to the archive. Jobs evicted without an archive are
+// gone and not counted.
+func (m *Manager) rollUpDay(ctx context.Context, day time.Time) ([]models.JobRollup, error) {
+	next := day.AddDate(0, 0, 1)
+	finished := func(job *models.Job) bool {
+		return job.Status.IsTerminal() && job.CompletedAt != nil &&
+			!job.CompletedAt.Before(day) && job.CompletedAt.Before(next)
+	}
+
+	m.mu.RLock()
+	jobs := make(map[string]*models.Job)
+	for id, job := range m.jobs {
+		if finished(job) {
+			c := *job
+			jobs[id] = &c
+		}
+	}
+	archiver := m.archiver
+	m.mu.RUnlock()
+
+	if archiver != nil {
+		archived, err := archiver.Completed(ctx, day, next)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range archived {
+			if _, ok := jobs[job.ID]; !ok && finished(job) {
+				jobs[job.ID] = job
+			}
+		}
+	}
+
+	byProject := make(map[string]*models.JobRollup)
+	for _, job := range jobs {
+		r, ok := byProject[job.ProjectID]
+		if !ok {
+			r = &models.JobRollup{ProjectID: job.ProjectID, Day: day.Format(time.DateOnly)}
+			byProject[job.ProjectID] = r
+		}
+		addToRollup(r, job)
+	}
+
+	rollups := make([]models.JobRollup, 0, len(byProject))
+	for _, r := range byProject {
+		rollups = append(rollups, *r)
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].ProjectID < rollups[j].ProjectID })
+	return rollups, nil
+}
+
+// addToRollup counts a finished job into its project's rollup
+func addToRollup(r *models.JobRollup, job *models.Job) {
+	r.Total++
+	switch job.Status {
+	case models.JobStatusCompleted:
+		r.Completed++
+	case models.JobStatusFailed:
+		r.Failed++
+	case models.JobStatusCancelled:
+		r.Cancelled++
+	}
+	r.Attempts += len(job.Attempts)
+
+	duration := job.CompletedAt.Sub(job.CreatedAt).Seconds()
+	r.DurationSeconds += duration
+	if duration > r.MaxDurationSeconds {
+		r.MaxDurationSeconds = duration
+	}
+	for _, a := range job.Attempts {
+		if a.StartedAt != nil && a.CompletedAt != nil {
+			r.RunSeconds += a.CompletedAt.Sub(*a.StartedAt).Seconds()
+		}
+	}
+}
+
+// JobReport combines the rollups of the days in [from, to] into buckets of
+// the interval per project, of one project or of every project in scope
+func (m *Manager) JobReport(ctx context.Context, scope Scope, projectID string, from, to time.Time, interval string) (*models.JobReport, error) {
+	m.rollups.mu.Lock()
+	store := m.rollups.store
+	m.rollups.mu.Unlock()
+	if store == nil {
+		return nil, ErrRollupsDisabled
+	}
+
+	rollups, err := store.ListRollups(ctx, startOfDay(from), startOfDay(to), projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ start, projectID string }
+	buckets := make(map[key]*models.JobReportBucket)
+	var order []key
+	for _, r := range rollups {
+		if !inScope(scope, r.ProjectID) {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, r.Day)
+		if err != nil {
+			return nil, err
+		}
+		k := key{bucketStart(day, interval).Format(time.DateOnly), r.ProjectID}
+		b, ok := buckets[k]
+		if !ok {
+			b = &models.JobReportBucket{JobRollup: models.JobRollup{ProjectID: r.ProjectID, Day: k.start}}
+			buckets[k] = b
+			order = append(order, k)
+		}
+		b.Total += r.Total
+		b.Completed += r.Completed
+		b.Failed += r.Failed
+		b.Cancelled += r.Cancelled
+		b.Attempts += r.Attempts
+		b.DurationSeconds += r.DurationSeconds
+		b.MaxDurationSeconds = max(b.MaxDurationSeconds, r.MaxDurationSeconds)
+		b.RunSeconds += r.RunSeconds
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].start != order[j].start {
+			return order[i].start < order[j].start
+		}
+		return order[i].projectID < order[j].projectID
+	})
+	report := &models.JobReport{
+		Interval:  interval,
+		From:      from.Format(time.DateOnly),
+		To:        to.Format(time.DateOnly),
+		ProjectID: projectID,
+		Buckets:   make([]models.JobReportBucket, len(order)),
+	}
+	for i, k := range order {
+		b := buckets[k]
+		if decided := b.Completed + b.Failed; decided > 0 {
+			b.SuccessRate = float64(b.Completed) / float64(decided)
+		}
+		if b.Total > 0 {
+			b.AvgDurationSeconds = b.DurationSeconds / float64(b.Total)
+		}
+		report.Buckets[i] = *b
+	}
+	return report, nil
+}
+
+// bucketStart returns the first day of the interval day falls in; weeks
+// start on Monday
+func bucketStart(day time.Time, interval string) time.Time {
+	switch interval {
+	case models.ReportIntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case models.ReportIntervalMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// startOfDay truncates t to midnight UTC
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Operations whose wait for the queue lock is measured
+const (
+	lockProcessQueue = "process_queue"
+	lockSubmit       = "submit"
+	lockResult       = "handle_result"
+	lockCancel       = "cancel"
+	lockExecute      = "execute"
+	lockDump         = "debug_dump"
+)
+
+// latencyBuckets are the upper bounds of the scheduler histograms, from
+// uncontended lock acquisition up to passes stalled on the backend
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// histogram counts durations into bounds, or latencyBuckets when unset.
+// Each bucket keeps the latest observation made with a trace ID as its
+// exemplar.
+type histogram struct {
+	bounds    []time.Duration
+	counts    []uint64 // per bucket, not cumulative; the last is +Inf
+	exemplars []*models.Exemplar
+	sum       time.Duration
+	count     uint64
+}
+
+func (h *histogram) buckets() []time.Duration {
+	if h.bounds == nil {
+		return latencyBuckets
+	}
+	return h.bounds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.observeTraced(d, "")
+}
+
+// observeTraced records d, keeping it as its bucket's exemplar when traceID
+// is set
+func (h *histogram) observeTraced(d time.Duration, traceID string) {
+	bounds := h.buckets()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+		h.exemplars = make([]*models.Exemplar, len(bounds)+1)
+	}
+	i := 0
+	for i < len(bounds) && d > bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += d
+	h.count++
+	if traceID != "" {
+		h.exemplars[i] = &models.Exemplar{TraceID: traceID, Value: d.Seconds(), Timestamp: time.Now()}
+	}
+}
+
+func (h *histogram) snapshot() models.Histogram {
+	bounds := h.buckets()
+	snap := models.Histogram{
+		Buckets: make([]models.HistogramBucket, len(bounds)),
+		Count:   h.count,
+		Sum:     h.sum.Seconds(),
+	}
+	var cumulative uint64
+	for i, bound := range bounds {
+		snap.Buckets[i] = models.HistogramBucket{UpperBound: bound.Seconds()}
+		if h.counts != nil {
+			cumulative += h.counts[i]
+			snap.Buckets[i].Exemplar = h.exemplars[i]
+		}
+		snap.Buckets[i].Count = cumulative
+	}
+	if h.counts != nil {
+		snap.InfExemplar = h.exemplars[len(bounds)]
+	}
+	return snap
+}
+
+// schedulerMetrics records dispatch loop timings. It has its own lock so
+// recording never contends with the queue lock being measured.
+type schedulerMetrics struct {
+	mu           sync.Mutex
+	ticks        uint64
+	tickDuration histogram
+	lockWait     map[string]*histogram
+	queueLength  int
+	scanLength   int
+	scannedTotal uint64
+	dispatched   uint64
+	// deferrals counts passes held back by each short host resource, and
+	// deferredFor is the one holding back the latest pass
+	deferrals   map[string]uint64
+	deferredFor string
+}
+
+func (s *schedulerMetrics) observeLockWait(op string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockWait == nil {
+		s.lockWait = make(map[string]*histogram)
+	}
+	h, ok := s.lockWait[op]
+	if !ok {
+		h = &histogram{}
+		s.lockWait[op] = h
+	}
+	h.observe(d)
+}
+
+func (s *schedulerMetrics) observeTick(d time.Duration, queueLength, scanned, dispatched int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticks++
+	s.tickDuration.observe(d)
+	s.queueLength = queueLength
+	s.scanLength = scanned
+	s.scannedTotal += uint64(scanned)
+	s.dispatched += uint64(dispatched)
+}
+
+// lock takes the queue lock for writing, recording how long op waited for it
+func (m *Manager) lock(op string) {
+	start := time.Now()
+	m.mu.Lock()
+	m.sched.observeLockWait(op, time.Since(start))
+}
+
+// SchedulerStats returns dispatch loop timings and scan lengths
+func (m *Manager) SchedulerStats() *models.SchedulerStats {
+	s := &m.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &models.SchedulerStats{
+		Ticks:        s.ticks,
+		TickDuration: s.tickDuration.snapshot(),
+		LockWait:     make(map[string]models.Histogram, len(s.lockWait)),
+		QueueLength:  s.queueLength,
+		ScanLength:   s.scanLength,
+		ScannedTotal: s.scannedTotal,
+		Dispatched:   s.dispatched,
+		Deferrals:    make(map[string]uint64, len(s.deferrals)),
+		DeferredFor:  s.deferredFor,
+	}
+	for op, h := range s.lockWait {
+		stats.LockWait[op] = h.snapshot()
+	}
+	for resource, n := range s.deferrals {
+		stats.Deferrals[resource] = n
+	}
+	return stats
+}
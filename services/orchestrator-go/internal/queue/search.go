@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// SearchJobs returns the jobs within the scope matching a search, held in
+// memory or archived, newest first
+func (m *Manager) SearchJobs(ctx context.Context, scope Scope, search models.JobSearch) ([]*models.Job, error) {
+	terms := search.Terms()
+	if scope != nil {
+		// The archive applies the limit, so it must also apply the scope
+		search.ProjectIDs = scope.ScopedProjects()
+	}
+
+	m.mu.RLock()
+	archiver := m.archiver
+	var jobs []*models.Job
+	for _, job := range m.jobs {
+		if inScope(scope, job.ProjectID) && matchesSearch(job, search, terms) {
+			jobs = append(jobs, job)
+		}
+	}
+	m.mu.RUnlock()
+
+	if archiver != nil {
+		archived, err := archiver.Search(ctx, search)
+		if err != nil {
+			return nil, err
+		}
+		held := make(map[string]bool, len(jobs))
+		for _, job := range jobs {
+			held[job.ID] = true
+		}
+		for _, job := range archived {
+			// A job requeued after archiving is also still in memory
+			if !held[job.ID] && inScope(scope, job.ProjectID) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	if search.Limit > 0 && len(jobs) > search.Limit {
+		jobs = jobs[:search.Limit]
+	}
+	return jobs, nil
+}
+
+// matchesSearch reports whether a job passes a search's filters and
+// contains all of its terms, anywhere in its text as the archive matches
+// them
+func matchesSearch(job *models.Job, search models.JobSearch, terms []string) bool {
+	if search.ProjectID != "" && job.ProjectID != search.ProjectID ||
+		search.Status != "" && job.Status != search.Status ||
+		search.From != nil && job.CreatedAt.Before(*search.From) ||
+		search.To != nil && !job.CreatedAt.Before(*search.To) {
+		return false
+	}
+
+	text := []string{job.Prompt, job.TicketTitle, job.TicketDesc, job.ErrorMessage}
+	if job.Result != nil {
+		text = append(text, job.Result.Error)
+	}
+	haystack := strings.ToLower(strings.Join(text, "\n"))
+	for _, term := range terms {
+		if !strings.Contains(haystack, term) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
+	"github.com/rs/zerolog/log"
+)
+
+// dispatchRateWindow is the rolling window dispatch rate rules count over
+const dispatchRateWindow = time.Hour
+
+// Reasons a pending job is held back, shown on the job
+const blockedCapacity = "waiting for capacity: project parallel limit or slots reserved for other projects"
+
+// rateLimited returns why a project may not dispatch another job at now
+// under its dispatch rate rules, or "" when it may. The caller must hold m.mu.
+func (m *Manager) rateLimited(projectID string, now time.Time) string {
+	settings, _ := m.projects.Get(projectID)
+	rule := project.ActiveDispatchRate(settings, now)
+	if rule == nil {
+		return ""
+	}
+	if rule.MaxPerHour == 0 {
+		return fmt.Sprintf("dispatching held from %s to %s", rule.Start, rule.End)
+	}
+
+	recent := m.recentDispatches(projectID, now)
+	if len(recent) < rule.MaxPerHour {
+		return ""
+	}
+	next := recent[len(recent)-rule.MaxPerHour].Add(dispatchRateWindow)
+	return fmt.Sprintf("rate limited to %d dispatches per hour from %s to %s, next slot at %s",
+		rule.MaxPerHour, rule.Start, rule.End, next.UTC().Format(time.RFC3339))
+}
+
+// recentDispatches returns when the project's jobs were dispatched within
+// the rate window, dropping older entries. The caller must hold m.mu.
+func (m *Manager) recentDispatches(projectID string, now time.Time) []time.Time {
+	times := m.dispatches[projectID]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= dispatchRateWindow {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(m.dispatches, projectID)
+		return nil
+	}
+	m.dispatches[projectID] = times
+	return times
+}
+
+// recordDispatch counts a dispatch against the project's rate rules. The
+// caller must hold m.mu.
+func (m *Manager) recordDispatch(projectID string, now time.Time) {
+	m.dispatches[projectID] = append(m.recentDispatches(projectID, now), now)
+}
+
+// block records why the scheduler is holding back a pending job. The caller
+// must hold m.mu.
+func (m *Manager) block(job *models.Job, reason string) {
+	if job.BlockedReason == reason {
+		return
+	}
+	job.BlockedReason = reason
+	m.jobLog(job.ID, logSourceOrchestrator, "Held back: %s", reason)
+	log.Debug().Str("job_id", job.ID).Str("reason", reason).Msg("Job held back")
+}
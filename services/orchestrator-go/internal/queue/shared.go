@@ -0,0 +1,268 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// CancelRequest asks the orchestrator that dispatched a job to cancel it
+type CancelRequest struct {
+	JobID string `json:"job_id"`
+	Actor string `json:"actor"`
+	// Stop asks for a soft cancel, as StopJob makes
+	Stop bool `json:"stop,omitempty"`
+}
+
+// sharedState is what this instance last published of a job, or took from
+// what another instance published
+type sharedState struct {
+	digest uint64
+	status models.JobStatus
+}
+
+func sharedStateOf(job *models.Job) (sharedState, error) {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return sharedState{}, err
+	}
+	h := fnv.New64a()
+	h.Write(payload)
+	return sharedState{digest: h.Sum64(), status: job.Status}, nil
+}
+
+// settled reports whether a job can no longer change since its state was
+// last shared: it had finished by then and has no pull request still open
+func settled(job *models.Job, last sharedState) bool {
+	return last.status.IsTerminal() && last.status == job.Status &&
+		(job.PRNumber == 0 || job.PRResolvedAt != nil)
+}
+
+// syncShared keeps this instance's jobs in step with the other
+// orchestrators sharing the backend, so that any of them serves reads,
+// ticket conflicts and queue limits from current state. Jobs submitted
+// elsewhere are adopted, jobs changed here are published, and jobs changed
+// elsewhere take the state last published. It returns the queue with the
+// jobs held here in place of their queued copies. The caller must hold m.mu.
+func (m *Manager) syncShared(ctx context.Context, queued []*models.Job) []*models.Job {
+	for i, queuedJob := range queued {
+		if job, ok := m.jobs[queuedJob.ID]; ok {
+			queued[i] = job
+			continue
+		}
+		m.jobs[queuedJob.ID] = queuedJob
+		m.adopted[queuedJob.ID] = true
+		if state, err := sharedStateOf(queuedJob); err == nil {
+			m.shared[queuedJob.ID] = state
+		}
+	}
+	for id := range m.shared {
+		if _, ok := m.jobs[id]; !ok {
+			delete(m.shared, id)
+		}
+	}
+	m.applyCancelRequests(ctx)
+
+	// Jobs dispatched here are changed nowhere else. Others changed here
+	// may have moved on elsewhere, so they are published only if what was
+	// published of them is no further along.
+	changed := make(map[string]sharedState)
+	var elsewhere []string
+	for id, job := range m.jobs {
+		last, seen := m.shared[id]
+		if seen && settled(job, last) {
+			continue
+		}
+		state, err := sharedStateOf(job)
+		if err != nil {
+			log.Error().Err(err).Str("job_id", id).Msg("Failed to encode job state")
+			continue
+		}
+		switch {
+		case m.owned[id]:
+			if !seen || state.digest != last.digest {
+				m.publish(ctx, job, state)
+			}
+		case seen && state.digest == last.digest:
+			elsewhere = append(elsewhere, id)
+		default:
+			changed[id] = state
+			elsewhere = append(elsewhere, id)
+		}
+	}
+
+	// Jobs submitted and claimed elsewhere between two passes here were
+	// never seen queued
+	ids, err := m.backend.PublishedIDs(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list published job states")
+	}
+	for _, id := range ids {
+		if _, ok := m.jobs[id]; !ok {
+			elsewhere = append(elsewhere, id)
+		}
+	}
+
+	published := make(map[string]bool)
+	if len(elsewhere) > 0 {
+		jobs, err := m.backend.Published(ctx, elsewhere)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load published job states")
+		}
+		for _, remote := range jobs {
+			published[remote.ID] = true
+			job, ok := m.jobs[remote.ID]
+			if !ok {
+				if state, err := sharedStateOf(remote); err == nil {
+					m.jobs[remote.ID] = remote
+					m.shared[remote.ID] = state
+				}
+				continue
+			}
+			if _, ok := changed[remote.ID]; ok && len(remote.Events) <= len(job.Events) {
+				continue
+			}
+			delete(changed, remote.ID)
+			m.applyShared(job, remote)
+		}
+	}
+	for id, state := range changed {
+		m.publish(ctx, m.jobs[id], state)
+	}
+
+	m.releaseAdopted(queued, published)
+	return queued
+}
+
+// applyShared replaces a job with the state another instance published of
+// it, unless that is the state it already has
+func (m *Manager) applyShared(job, remote *models.Job) {
+	state, err := sharedStateOf(remote)
+	if err != nil || state.digest == m.shared[job.ID].digest {
+		return
+	}
+
+	// Credential tokens are never published
+	if job.Credentials != nil && remote.Credentials != nil {
+		remote.Credentials.RepoToken = job.Credentials.RepoToken
+		remote.Credentials.CallbackToken = job.Credentials.CallbackToken
+	}
+	finished := !job.Status.IsTerminal() && remote.Status.IsTerminal()
+	*job = *remote
+	m.shared[job.ID] = state
+	if finished {
+		m.resolveLinked(job)
+	}
+}
+
+// publish stores a job's state for the other instances
+func (m *Manager) publish(ctx context.Context, job *models.Job, state sharedState) {
+	if err := m.backend.Publish(ctx, job); err != nil {
+		log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to publish job state")
+		return
+	}
+	m.shared[job.ID] = state
+}
+
+// findShared looks a job not held here up in the shared backend, by its
+// published state or else in the queue
+func (m *Manager) findShared(ctx context.Context, jobID string) (*models.Job, bool) {
+	if published, err := m.backend.Published(ctx, []string{jobID}); err == nil && len(published) > 0 {
+		return published[0], true
+	}
+	queued, err := m.backend.List(ctx)
+	if err != nil {
+		return nil, false
+	}
+	for _, job := range queued {
+		if job.ID == jobID {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// unpublish drops the published states of jobs evicted here
+func (m *Manager) unpublish(ctx context.Context, jobIDs []string) {
+	for _, id := range jobIDs {
+		if err := m.backend.Unpublish(ctx, id); err != nil {
+			log.Warn().Err(err).Str("job_id", id).Msg("Failed to unpublish job state")
+		}
+	}
+}
+
+// cancelsElsewhere reports whether only the orchestrator that dispatched a
+// job can cancel it: this instance does not dispatch, and the job has left
+// the queue for a worker, possibly since the last pass here. The caller
+// must hold m.mu.
+func (m *Manager) cancelsElsewhere(ctx context.Context, job *models.Job) bool {
+	if m.isLeader() {
+		return false
+	}
+	switch job.Status {
+	case models.JobStatusDispatched, models.JobStatusRunning:
+		return true
+	case models.JobStatusPending:
+		// Linked duplicates are never queued, and a job still queued is
+		// taken off the queue to be cancelled here
+		if job.DuplicateOf != "" {
+			return false
+		}
+		claimed, err := m.backend.Claim(ctx, job.ID)
+		if err != nil || claimed {
+			return false
+		}
+		published, err := m.backend.Published(ctx, []string{job.ID})
+		return err == nil && len(published) > 0 && started(published[0])
+	}
+	return false
+}
+
+func started(job *models.Job) bool {
+	return job.Status == models.JobStatusDispatched || job.Status == models.JobStatusRunning
+}
+
+// forwardCancel leaves a cancel request for the orchestrator that
+// dispatched a job
+func (m *Manager) forwardCancel(ctx context.Context, job *models.Job, actor string, stop bool) error {
+	if err := m.backend.RequestCancel(ctx, CancelRequest{JobID: job.ID, Actor: actor, Stop: stop}); err != nil {
+		return fmt.Errorf("failed to forward cancel: %w", err)
+	}
+	log.Info().Str("job_id", job.ID).Bool("stop", stop).Msg("Cancel forwarded to the orchestrator running the job")
+	return nil
+}
+
+// applyCancelRequests cancels or stops the jobs dispatched here that
+// other orchestrators were asked to. Finished jobs are no longer owned.
+// The caller must hold m.mu.
+func (m *Manager) applyCancelRequests(ctx context.Context) {
+	ids := make([]string, 0, len(m.owned))
+	for id := range m.owned {
+		if job, ok := m.jobs[id]; !ok || job.Status.IsTerminal() {
+			delete(m.owned, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	reqs, err := m.backend.TakeCancelRequests(ctx, ids)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to take cancel requests")
+		return
+	}
+	for _, req := range reqs {
+		job := m.jobs[req.JobID]
+		if req.Stop {
+			m.stopJob(job, req.Actor)
+		} else {
+			m.cancelJob(job, req.Actor, "cancelled")
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/delivery"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/project"
+)
+
+type follower struct{}
+
+func (follower) IsLeader() bool { return false }
+
+// sharedPair creates a leader and a follower sharing an in-memory queue.
+// The leader has no workers, so tests dispatch its jobs themselves.
+func sharedPair() (leader, follow *Manager, backend *MemoryBackend) {
+	backend = NewMemoryBackend()
+	newManager := func() *Manager {
+		return NewManager(config.QueueConfig{}, backend, nil, nil, delivery.NewDeliverer(config.DeliveryConfig{}), project.NewRegistry())
+	}
+	leader, follow = newManager(), newManager()
+	follow.SetLeader(follower{})
+	return leader, follow, backend
+}
+
+// dispatch claims a queued job for m the way its dispatch loop would and
+// moves it to status
+func dispatch(t *testing.T, m *Manager, jobID string, status models.JobStatus) *models.Job {
+	t.Helper()
+	if claimed, err := m.backend.Claim(context.Background(), jobID); err != nil || !claimed {
+		t.Fatalf("Claim(%s) = %v, %v", jobID, claimed, err)
+	}
+	job := m.jobs[jobID]
+	transition(job, status, actorOrchestrator, "test")
+	return job
+}
+
+func TestFollowerSeesJobsTheLeaderRuns(t *testing.T) {
+	ctx := context.Background()
+	leader, follow, _ := sharedPair()
+
+	job := &models.Job{ID: "job-1", ProjectID: "p", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	addJobs(follow, job)
+	follow.enqueue(job)
+	follow.processQueue(ctx)
+	leader.processQueue(ctx)
+
+	running := dispatch(t, leader, job.ID, models.JobStatusRunning)
+	leader.processQueue(ctx)
+	follow.processQueue(ctx)
+
+	got, ok := follow.GetJob(job.ID, nil)
+	if !ok {
+		t.Fatal("follower lost the job")
+	}
+	if got.Status != models.JobStatusRunning {
+		t.Fatalf("follower has the job as %s, want running", got.Status)
+	}
+	if stats := follow.GetStats(nil); stats.PendingJobs != 0 || stats.RunningJobs != 1 {
+		t.Errorf("follower counts %d pending and %d running jobs, want 0 and 1", stats.PendingJobs, stats.RunningJobs)
+	}
+
+	transition(running, models.JobStatusCompleted, actorOrchestrator, "test")
+	leader.processQueue(ctx)
+	follow.processQueue(ctx)
+	if got, _ := follow.GetJob(job.ID, nil); got.Status != models.JobStatusCompleted {
+		t.Errorf("follower has the finished job as %s", got.Status)
+	}
+}
+
+func TestFollowerFindsJobsDispatchedBeforeItsPass(t *testing.T) {
+	ctx := context.Background()
+	leader, follow, _ := sharedPair()
+
+	job := &models.Job{ID: "job-1", ProjectID: "p", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	addJobs(leader, job)
+	leader.enqueue(job)
+	if got, ok := follow.GetJob(job.ID, nil); !ok || got.Status != models.JobStatusPending {
+		t.Fatalf("follower cannot find the queued job: %v, %v", got, ok)
+	}
+
+	dispatch(t, leader, job.ID, models.JobStatusDispatched)
+	leader.processQueue(ctx)
+	if got, ok := follow.GetJob(job.ID, nil); !ok || got.Status != models.JobStatusDispatched {
+		t.Fatalf("follower cannot find the dispatched job: %v, %v", got, ok)
+	}
+
+	follow.processQueue(ctx)
+	if jobs := follow.ListJobs(nil, models.JobFilter{}); len(jobs) != 1 || jobs[0].Status != models.JobStatusDispatched {
+		t.Errorf("follower lists %v", jobIDs(jobs))
+	}
+}
+
+func TestAdoptedJobsAreNotShared(t *testing.T) {
+	ctx := context.Background()
+	leader, follow, _ := sharedPair()
+
+	job := &models.Job{ID: "job-1", ProjectID: "p", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	addJobs(follow, job)
+	follow.enqueue(job)
+	leader.processQueue(ctx)
+
+	adopted := leader.jobs[job.ID]
+	if adopted == nil || adopted == job {
+		t.Fatalf("leader adopted %p, the follower holds %p", adopted, job)
+	}
+	transition(adopted, models.JobStatusDispatched, actorOrchestrator, "test")
+	if job.Status != models.JobStatusPending {
+		t.Errorf("changing the leader's copy changed the follower's to %s", job.Status)
+	}
+}
+
+func TestFollowerForwardsCancelsToTheLeader(t *testing.T) {
+	ctx := context.Background()
+	leader, follow, _ := sharedPair()
+
+	hard := &models.Job{ID: "job-hard", ProjectID: "p", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	soft := &models.Job{ID: "job-soft", ProjectID: "p", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	addJobs(follow, hard, soft)
+	follow.enqueue(hard)
+	follow.enqueue(soft)
+	leader.processQueue(ctx)
+	for _, job := range []*models.Job{hard, soft} {
+		dispatch(t, leader, job.ID, models.JobStatusDispatched)
+		leader.owned[job.ID] = true
+	}
+	leader.processQueue(ctx)
+
+	// The follower still has the jobs as pending
+	if cancelled, err := follow.CancelJob(hard.ID, nil); err != nil || cancelled {
+		t.Fatalf("CancelJob on the follower = %v, %v, want the cancel forwarded", cancelled, err)
+	}
+	if cancelled, err := follow.StopJob(soft.ID, nil); err != nil || cancelled {
+		t.Fatalf("StopJob on the follower = %v, %v, want the stop forwarded", cancelled, err)
+	}
+	if hard.Status != models.JobStatusPending {
+		t.Errorf("follower changed its copy to %s", hard.Status)
+	}
+
+	leader.processQueue(ctx)
+	follow.processQueue(ctx)
+	if got, _ := follow.GetJob(hard.ID, nil); got.Status != models.JobStatusCancelled {
+		t.Errorf("hard-cancelled job is %s on the follower", got.Status)
+	}
+	if got, _ := follow.GetJob(soft.ID, nil); got.Status != models.JobStatusDispatched || got.StopRequestedAt == nil {
+		t.Errorf("stopped job is %s, stop requested at %v, on the follower", got.Status, got.StopRequestedAt)
+	}
+}
@@ -0,0 +1,44 @@
+package queue
+
+import "sync"
+
+// workerSlots bounds how many jobs run at once. The bound can change while
+// jobs run: lowering it below the slots held only stops new acquisitions
+// until enough jobs finish.
+type workerSlots struct {
+	mu   sync.Mutex
+	held int
+	max  int
+}
+
+// tryAcquire takes a slot, reporting false when none is free
+func (s *workerSlots) tryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held >= s.max {
+		return false
+	}
+	s.held++
+	return true
+}
+
+// release returns a slot taken by tryAcquire
+func (s *workerSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held--
+}
+
+// resize changes how many slots there are
+func (s *workerSlots) resize(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.max = max
+}
+
+// inUse returns the slots held
+func (s *workerSlots) inUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// staleCheckInterval is how often projects are checked for staleness
+const staleCheckInterval = time.Hour
+
+var (
+	// ErrProjectArchived is returned for new jobs of archived projects
+	ErrProjectArchived = NewQueueError("project is archived")
+	// ErrProjectBusy is returned when archiving a project with unfinished jobs
+	ErrProjectBusy = NewQueueError("project has unfinished jobs")
+)
+
+// runStaleProjects periodically evicts the repository caches of stale
+// projects, archiving them when configured to
+func (m *Manager) runStaleProjects(ctx context.Context) {
+	if m.cfg.ProjectStaleAfter <= 0 {
+		return
+	}
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sweepStaleProjects()
+		}
+	}
+}
+
+func (m *Manager) sweepStaleProjects() {
+	for _, p := range m.StaleProjects().Projects {
+		if _, err := m.worktreeManager.EvictProject(p.ProjectID); err != nil {
+			log.Warn().Err(err).Str("project_id", p.ProjectID).Msg("Failed to evict stale project")
+			continue
+		}
+		if m.cfg.ProjectAutoArchive && p.ArchivedAt == nil {
+			m.projects.SetArchived(p.ProjectID, true)
+			log.Info().
+				Str("project_id", p.ProjectID).
+				Int("idle_days", p.IdleDays).
+				Msg("Archived stale project")
+		}
+	}
+}
+
+// StaleProjects lists the projects without new jobs for longer than the
+// stale threshold, oldest first. Projects with unfinished jobs are never
+// stale; projects without jobs since the orchestrator started are idle
+// since then.
+func (m *Manager) StaleProjects() *models.StaleProjectsReport {
+	report := &models.StaleProjectsReport{
+		StaleAfter:  m.cfg.ProjectStaleAfter.String(),
+		AutoArchive: m.cfg.ProjectAutoArchive,
+		Projects:    []models.StaleProject{},
+	}
+	if m.cfg.ProjectStaleAfter <= 0 {
+		return report
+	}
+
+	m.mu.RLock()
+	last := make(map[string]time.Time, len(m.lastJobAt))
+	for projectID, at := range m.lastJobAt {
+		last[projectID] = at
+	}
+	busy := make(map[string]bool)
+	for _, job := range m.jobs {
+		if job.CreatedAt.After(last[job.ProjectID]) {
+			last[job.ProjectID] = job.CreatedAt
+		}
+		if !job.Status.IsTerminal() {
+			busy[job.ProjectID] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	projects := make(map[string]bool, len(last))
+	for projectID := range last {
+		projects[projectID] = true
+	}
+	for _, settings := range m.projects.List() {
+		projects[settings.ProjectID] = true
+	}
+	for _, projectID := range m.worktreeManager.CachedProjects() {
+		projects[projectID] = true
+	}
+
+	now := time.Now()
+	for projectID := range projects {
+		if busy[projectID] {
+			continue
+		}
+		p := models.StaleProject{ProjectID: projectID, IdleSince: m.startedAt}
+		if at, ok := last[projectID]; ok {
+			p.LastJobAt = &at
+			p.IdleSince = at
+		}
+		idle := now.Sub(p.IdleSince)
+		if idle < m.cfg.ProjectStaleAfter {
+			continue
+		}
+		p.IdleDays = int(idle.Hours() / 24)
+		settings, _ := m.projects.Get(projectID)
+		p.ArchivedAt = settings.ArchivedAt
+		report.Projects = append(report.Projects, p)
+	}
+	sort.Slice(report.Projects, func(i, j int) bool {
+		return report.Projects[i].IdleSince.Before(report.Projects[j].IdleSince)
+	})
+	return report
+}
+
+// ArchiveProject archives a project, which then accepts no new jobs, and
+// evicts its repository cache and pooled worktrees
+func (m *Manager) ArchiveProject(projectID string) (models.ProjectSettings, error) {
+	m.mu.RLock()
+	for _, job := range m.jobs {
+		if job.ProjectID == projectID && !job.Status.IsTerminal() {
+			m.mu.RUnlock()
+			return models.ProjectSettings{}, ErrProjectBusy
+		}
+	}
+	m.mu.RUnlock()
+
+	settings := m.projects.SetArchived(projectID, true)
+	if _, err := m.worktreeManager.EvictProject(projectID); err != nil {
+		log.Warn().Err(err).Str("project_id", projectID).Msg("Failed to evict archived project")
+	}
+	log.Info().Str("project_id", projectID).Msg("Archived project")
+	return settings, nil
+}
+
+// UnarchiveProject lets an archived project accept jobs again. Its
+// repository is cloned again by its next job.
+func (m *Manager) UnarchiveProject(projectID string) models.ProjectSettings {
+	log.Info().Str("project_id", projectID).Msg("Unarchived project")
+	return m.projects.SetArchived(projectID, false)
+}
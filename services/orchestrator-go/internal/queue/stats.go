@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// JobStats buckets the jobs of a project, or of every project in scope, that
+// finished or were dispatched within the last span, in buckets of the given
+// length aligned to it. The current, partial bucket is the last. Jobs evicted
+// from memory are counted from the archive when there is one.
+func (m *Manager) JobStats(ctx context.Context, scope Scope, projectID string, span, bucket time.Duration) (*models.JobStats, error) {
+	to := time.Now().UTC().Truncate(bucket).Add(bucket)
+	n := int((span + bucket - 1) / bucket)
+	from := to.Add(-time.Duration(n) * bucket)
+
+	stats := &models.JobStats{
+		From:          from,
+		To:            to,
+		BucketSeconds: bucket.Seconds(),
+		ProjectID:     projectID,
+		Buckets:       make([]models.JobStatsBucket, n),
+	}
+	for i := range stats.Buckets {
+		stats.Buckets[i].Start = from.Add(time.Duration(i) * bucket)
+	}
+	acc := statsAccumulator{
+		stats:     stats,
+		bucket:    bucket,
+		ran:       make([]int, n),
+		durations: make([]time.Duration, n),
+		waits:     make([]time.Duration, n),
+	}
+	counted := func(job *models.Job) bool {
+		return inScope(scope, job.ProjectID) && (projectID == "" || job.ProjectID == projectID)
+	}
+
+	m.mu.RLock()
+	held := make(map[string]bool, len(m.jobs))
+	for id, job := range m.jobs {
+		held[id] = true
+		if counted(job) {
+			acc.add(job)
+		}
+	}
+	archiver := m.archiver
+	m.mu.RUnlock()
+
+	if archiver != nil {
+		archived, err := archiver.Completed(ctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range archived {
+			if !held[job.ID] && counted(job) {
+				acc.add(job)
+			}
+		}
+	}
+
+	acc.finish()
+	return stats, nil
+}
+
+// statsAccumulator counts jobs into the buckets of job stats
+type statsAccumulator struct {
+	stats  *models.JobStats
+	bucket time.Duration
+	// ran, durations and waits are per bucket: the finished jobs that were
+	// dispatched and how long they ran, and how long dispatched jobs waited
+	ran       []int
+	durations []time.Duration
+	waits     []time.Duration
+}
+
+// index returns the bucket of t, or -1 when t is nil or outside the stats
+func (a *statsAccumulator) index(t *time.Time) int {
+	if t == nil || t.Before(a.stats.From) || !t.Before(a.stats.To) {
+		return -1
+	}
+	return int(t.Sub(a.stats.From) / a.bucket)
+}
+
+func (a *statsAccumulator) add(job *models.Job) {
+	if i := a.index(job.DispatchedAt); i >= 0 {
+		a.stats.Buckets[i].Dispatched++
+		a.waits[i] += job.DispatchedAt.Sub(job.CreatedAt)
+	}
+	if i := a.index(job.PRResolvedAt); i >= 0 {
+		switch job.PRState {
+		case models.PRStateMerged:
+			a.stats.Buckets[i].PRsMerged++
+		case models.PRStateClosed:
+			a.stats.Buckets[i].PRsClosed++
+		}
+	}
+	if !job.Status.IsTerminal() {
+		return
+	}
+	i := a.index(job.CompletedAt)
+	if i < 0 {
+		return
+	}
+	b := &a.stats.Buckets[i]
+	b.Finished++
+	switch job.Status {
+	case models.JobStatusCompleted:
+		b.Completed++
+	case models.JobStatusFailed:
+		b.Failed++
+	case models.JobStatusCancelled:
+		b.Cancelled++
+	}
+	if job.PRNumber > 0 {
+		b.PRsOpened++
+	}
+	if job.DispatchedAt != nil {
+		a.ran[i]++
+		a.durations[i] += job.CompletedAt.Sub(*job.DispatchedAt)
+	}
+}
+
+// finish turns the sums into rates and averages
+func (a *statsAccumulator) finish() {
+	for i := range a.stats.Buckets {
+		b := &a.stats.Buckets[i]
+		if b.Finished > 0 {
+			b.FailureRate = float64(b.Failed) / float64(b.Finished)
+		}
+		if a.ran[i] > 0 {
+			b.AvgDurationSeconds = (a.durations[i] / time.Duration(a.ran[i])).Seconds()
+		}
+		if b.Dispatched > 0 {
+			b.AvgWaitSeconds = (a.waits[i] / time.Duration(b.Dispatched)).Seconds()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// stopPollInterval is how often soft-cancelled runs are checked against the
+// stop grace period
+const stopPollInterval = 15 * time.Second
+
+// StopJob soft-cancels a job. A running agent is asked, through the control
+// endpoint its workflow polls, to finish its current step and push what it
+// has; the job ends cancelled once the run reports back. Jobs that have not
+// started are cancelled outright. It reports whether the job was cancelled
+// immediately; the stop of a job another orchestrator runs is left to it.
+func (m *Manager) StopJob(jobID string, scope Scope) (bool, error) {
+	m.lock(lockCancel)
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok || !inScope(scope, job.ProjectID) {
+		return false, ErrJobNotFound
+	}
+	if job.Status.IsTerminal() {
+		return false, ErrJobAlreadyCompleted
+	}
+	if m.cancelsElsewhere(context.Background(), job) {
+		return false, m.forwardCancel(context.Background(), job, actorOf(scope), true)
+	}
+	return m.stopJob(job, actorOf(scope)), nil
+}
+
+// stopJob soft-cancels an unfinished job, reporting whether it was
+// cancelled immediately. The caller must hold m.mu.
+func (m *Manager) stopJob(job *models.Job, actor string) bool {
+	if job.Status != models.JobStatusDispatched && job.Status != models.JobStatusRunning {
+		m.cancelJob(job, actor, "cancelled before dispatch")
+		return true
+	}
+	// Its run has finished already, and its QA checks have no partial work
+	if awaitingChecks(job) {
+		m.cancelJob(job, actor, "cancelled while waiting for QA checks")
+		return true
+	}
+
+	if job.StopRequestedAt == nil {
+		if job.Status == models.JobStatusRunning {
+			m.cancelRun(job, false)
+		}
+		now := time.Now()
+		job.StopRequestedAt = &now
+		transition(job, job.Status, actor, "stop requested, waiting for partial work")
+		m.jobLog(job.ID, logSourceOrchestrator, "Stop requested by %s, the agent will push its partial work", actor)
+		log.Info().Str("job_id", job.ID).Msg("Job stop requested")
+	}
+	return false
+}
+
+// JobControl tells a running job's workflow whether it should stop early
+func (m *Manager) JobControl(jobID string) (*models.JobControl, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &models.JobControl{
+		JobID: job.ID,
+		Stop:  job.StopRequestedAt != nil || job.Status == models.JobStatusCancelled,
+	}, nil
+}
+
+// runStopEscalation hard-cancels soft-cancelled jobs whose runs have not
+// reported back within the grace period
+func (m *Manager) runStopEscalation(ctx context.Context) {
+	ticker := time.NewTicker(stopPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.escalateStops()
+		}
+	}
+}
+
+func (m *Manager) escalateStops() {
+	m.lock(lockCancel)
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.StopRequestedAt == nil || job.Status.IsTerminal() {
+			continue
+		}
+		if time.Since(*job.StopRequestedAt) < m.cfg.StopGracePeriod {
+			continue
+		}
+		m.cancelJob(job, actorOrchestrator, "no partial work pushed within the stop grace period")
+	}
+}
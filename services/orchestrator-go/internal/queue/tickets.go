@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// ErrTicketActive is returned when a ticket is submitted while an earlier
+// implementation of it is unfinished
+var ErrTicketActive = NewQueueError("ticket already has an unfinished job")
+
+// TicketActiveError names the unfinished job a submission collides with
+type TicketActiveError struct {
+	Job *models.Job
+}
+
+func (e *TicketActiveError) Error() string {
+	return ErrTicketActive.Error() + " (" + e.Job.ID + ")"
+}
+
+func (e *TicketActiveError) Unwrap() error {
+	return ErrTicketActive
+}
+
+// activeForTicket returns an unfinished implementation of a project's
+// ticket. Its branch and pull request would collide with a new one's.
+// Callers hold m.mu.
+func (m *Manager) activeForTicket(projectID, ticketID string) *models.Job {
+	for _, job := range m.jobs {
+		if job.ProjectID == projectID && job.TicketID == ticketID &&
+			job.Kind != models.JobKindAnalysis && !job.Status.IsTerminal() {
+			return job
+		}
+	}
+	return nil
+}
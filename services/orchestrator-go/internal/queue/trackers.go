@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// ticketUpdateTimeout bounds each update of an issue
+const ticketUpdateTimeout = 30 * time.Second
+
+// ticketUpdateBacklog is how many updates may wait for their tracker before
+// more are dropped
+const ticketUpdateBacklog = 256
+
+// Tracker updates issues in an issue tracker
+type Tracker interface {
+	// Name is the tracker type projects select in their settings
+	Name() string
+	UpdateIssue(ctx context.Context, update models.TicketUpdate) error
+}
+
+type ticketUpdate struct {
+	tracker Tracker
+	update  models.TicketUpdate
+}
+
+// SetTrackers makes the issues of the tickets of projects that select one
+// of trackers follow their jobs. Updates are made in the background, one at
+// a time so each issue sees them in order.
+func (m *Manager) SetTrackers(trackers ...Tracker) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trackers = make(map[string]Tracker, len(trackers))
+	for _, t := range trackers {
+		m.trackers[t.Name()] = t
+	}
+	if m.ticketUpdates == nil && len(trackers) > 0 {
+		m.ticketUpdates = make(chan ticketUpdate, ticketUpdateBacklog)
+		go runTicketUpdates(m.ticketUpdates)
+	}
+}
+
+// Trackers lists the tracker types projects can select
+func (m *Manager) Trackers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.trackers))
+	for name := range m.trackers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// updateTicket tells a job's ticket's issue what happened to the job, when
+// its project keeps issues up to date. The caller must hold m.mu.
+func (m *Manager) updateTicket(job *models.Job) {
+	if job.Kind == models.JobKindQARerun || job.TicketID == "" {
+		return
+	}
+	settings, _ := m.projects.Get(job.ProjectID)
+	if settings.Tracker == nil {
+		return
+	}
+	tracker, ok := m.trackers[settings.Tracker.Type]
+	if !ok {
+		log.Debug().Str("project_id", job.ProjectID).Str("tracker", settings.Tracker.Type).Msg("Issue tracker not configured, leaving the ticket alone")
+		return
+	}
+
+	var event, key string
+	switch job.Status {
+	case models.JobStatusDispatched:
+		// Retries are not news to the ticket
+		if job.RetryCount > 0 {
+			return
+		}
+		event, key = models.TicketEventDispatched, messages.TicketDispatched
+	case models.JobStatusCompleted:
+		event, key = models.TicketEventNoChanges, messages.TicketNoChanges
+		if job.Result != nil && job.Result.PRUrl != "" {
+			event, key = models.TicketEventPROpened, messages.TicketPROpened
+		}
+	case models.JobStatusFailed:
+		event, key = models.TicketEventFailed, messages.TicketFailed
+	default:
+		return
+	}
+
+	update := ticketUpdate{tracker: tracker, update: models.TicketUpdate{
+		Event:   event,
+		JobID:   job.ID,
+		IssueID: job.TicketID,
+		Comment: m.message(job.ProjectID, key, messages.JobData(job)),
+		Status:  settings.Tracker.Transitions[event],
+	}}
+	select {
+	case m.ticketUpdates <- update:
+	default:
+		log.Warn().Str("job_id", job.ID).Str("event", event).Msg("Too many ticket updates waiting, dropping one")
+	}
+}
+
+// runTicketUpdates makes the updates sent to updates, in order
+func runTicketUpdates(updates <-chan ticketUpdate) {
+	for u := range updates {
+		ctx, cancel := context.WithTimeout(context.Background(), ticketUpdateTimeout)
+		err := u.tracker.UpdateIssue(ctx, u.update)
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).
+				Str("job_id", u.update.JobID).
+				Str("issue", u.update.IssueID).
+				Str("tracker", u.tracker.Name()).
+				Str("event", u.update.Event).
+				Msg("Failed to update ticket")
+			continue
+		}
+		log.Debug().Str("job_id", u.update.JobID).Str("issue", u.update.IssueID).Str("event", u.update.Event).Msg("Updated ticket")
+	}
+}
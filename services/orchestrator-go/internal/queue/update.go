@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/messages"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/prompt"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrJobNotPending is returned when changing a job that has left the queue
+var ErrJobNotPending = NewQueueError("only jobs waiting in the queue can be changed")
+
+// ErrUndefinedVariables is returned when a new prompt uses variables its job
+// does not define
+var ErrUndefinedVariables = NewQueueError("uses undefined variables")
+
+// UpdateJob changes the priority, prompt or base branch of a queued job and
+// re-sorts it. The job is taken out of the backend first, so a dispatcher
+// that claims it concurrently wins and the update is rejected.
+func (m *Manager) UpdateJob(ctx context.Context, jobID string, req *models.UpdateJobRequest, scope Scope) (*models.CreateJobResponse, error) {
+	if req.BaseBranch != nil {
+		// The remote is asked without the lock held
+		m.mu.RLock()
+		var projectID, repo string
+		if job, ok := m.jobs[jobID]; ok {
+			projectID, repo = job.ProjectID, job.RepoFullName
+		}
+		m.mu.RUnlock()
+		if err := m.checkBaseBranch(ctx, projectID, repo, *req.BaseBranch); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok || !inScope(scope, job.ProjectID) {
+		return nil, ErrJobNotFound
+	}
+	if job.Status != models.JobStatusPending {
+		return nil, ErrJobNotPending
+	}
+	if req.Prompt != nil {
+		if missing := prompt.Missing(*req.Prompt, job.Vars); len(missing) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUndefinedVariables, strings.Join(missing, ", "))
+		}
+	}
+
+	claimed, err := m.backend.Claim(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrJobNotPending
+	}
+
+	var warnings []string
+	var changed []string
+	if req.Priority != nil {
+		changed = append(changed, "priority")
+		job.Priority, warnings = m.resolvePriority(&models.CreateJobRequest{
+			ProjectID: job.ProjectID,
+			Priority:  req.Priority,
+		})
+	}
+	if req.Prompt != nil {
+		changed = append(changed, "prompt")
+		job.Prompt = *req.Prompt
+		if m.cfg.DedupWindow > 0 {
+			job.Fingerprint = fingerprintPrompt(job.ProjectID, job.Prompt)
+		}
+	}
+	if req.BaseBranch != nil {
+		changed = append(changed, "base branch")
+		job.BaseBranch = *req.BaseBranch
+	}
+
+	transition(job, job.Status, actorOf(scope), "updated "+strings.Join(changed, ", "))
+
+	// Losing the job here would strand it, so fail it visibly instead
+	m.enqueue(job)
+	if job.Status != models.JobStatusPending {
+		return nil, errors.New(job.ErrorMessage)
+	}
+
+	position := m.getQueuePosition(ctx, job.ID)
+
+	log.Info().
+		Str("job_id", job.ID).
+		Int("priority", int(job.Priority)).
+		Int("position", position).
+		Msg("Job updated")
+
+	return &models.CreateJobResponse{
+		Job:      job,
+		Position: position,
+		Message:  m.message(job.ProjectID, messages.JobUpdated, messages.JobData(job)),
+		Warnings: warnings,
+	}, nil
+}
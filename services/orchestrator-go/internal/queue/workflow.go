@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// HandleWorkflowRun applies a CI run status change reported by webhook. A
+// completed run is fed through the same pipeline as a callback, so jobs
+// finish even if the workflow never calls back.
+func (m *Manager) HandleWorkflowRun(update *models.WorkflowRunUpdate) {
+	m.mu.Lock()
+
+	if m.handleCheckRun(update) {
+		m.mu.Unlock()
+		return
+	}
+
+	job := m.findJobForRun(update)
+	if job == nil {
+		m.mu.Unlock()
+		log.Debug().
+			Str("repo", update.RepoFullName).
+			Str("branch", update.Branch).
+			Msg("Ignoring workflow run for unknown job")
+		return
+	}
+
+	// Runs of earlier attempts are done with, unless one outlived a cancel
+	if isPastRun(job, update.RunID) && job.Status != models.JobStatusCancelled {
+		m.mu.Unlock()
+		return
+	}
+
+	if job.RunID == "" {
+		job.RunID = update.RunID
+	}
+	if update.URL != "" {
+		job.RunURL = update.URL
+	}
+	if !job.Status.IsTerminal() {
+		m.applyRunnerUpdate(job, update)
+	}
+
+	// A run that starts after its job was cancelled is stopped straight away
+	if job.Status == models.JobStatusCancelled && update.Status != "completed" {
+		run := *job
+		run.RepoFullName, run.RunID = update.RepoFullName, update.RunID
+		e, ok := m.executors[runExecutor(update)]
+		m.mu.Unlock()
+		if !ok {
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := e.Cancel(ctx, run, true); err != nil {
+				log.Error().Err(err).Str("job_id", run.ID).Str("run_id", run.RunID).Msg("Failed to cancel workflow run")
+			}
+		}()
+		return
+	}
+	if job.Status.IsTerminal() {
+		m.mu.Unlock()
+		return
+	}
+
+	if update.Status != "completed" {
+		if job.Status == models.JobStatusDispatched {
+			transition(job, models.JobStatusRunning, runSCM(update)+" (webhook)", "workflow run "+update.Status)
+		}
+		if job.StartedAt == nil {
+			now := time.Now()
+			job.StartedAt = &now
+		}
+		m.mu.Unlock()
+		return
+	}
+
+	result := &models.JobResult{
+		JobID:      job.ID,
+		TicketID:   job.TicketID,
+		Status:     "success",
+		RunID:      update.RunID,
+		ReceivedAt: time.Now(),
+		ReportedBy: "webhook",
+	}
+	if update.Conclusion != "success" {
+		result.Status = "failure"
+		result.Error = "Workflow run concluded with " + update.Conclusion
+	}
+	m.mu.Unlock()
+
+	m.submitResult(result)
+}
+
+// RecordRun notes the run an executor started for a job, so its webhooks
+// can be matched to the job by run
+func (m *Manager) RecordRun(jobID, runID, url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[jobID]
+	if !ok || job.RunID != "" {
+		return
+	}
+	job.RunID, job.RunURL = runID, url
+}
+
+// runSCM names the provider that reported a run
+func runSCM(update *models.WorkflowRunUpdate) string {
+	if update.SCM == "" {
+		return models.SCMGitHub
+	}
+	return update.SCM
+}
+
+// runExecutor names the executor whose run an update reports
+func runExecutor(update *models.WorkflowRunUpdate) string {
+	switch runSCM(update) {
+	case models.SCMGitLab:
+		return models.ExecutorGitLabCI
+	case models.SCMBitbucket:
+		return models.ExecutorBitbucketPipelines
+	default:
+		return models.ExecutorGitHubActions
+	}
+}
+
+// findJobForRun matches a workflow run to its job by the job ID in the run
+// name or the run recorded when it was started. Runs naming neither, such
+// as the repository's own CI on a job's branch, belong to no job.
+func (m *Manager) findJobForRun(update *models.WorkflowRunUpdate) *models.Job {
+	if update.JobID != "" {
+		if job, ok := m.jobs[update.JobID]; ok {
+			return job
+		}
+	}
+	if update.RunID != "" {
+		for _, j := range m.jobs {
+			if j.RunID == update.RunID && j.RepoFullName == update.RepoFullName {
+				return j
+			}
+		}
+	}
+	return nil
+}
+
+// findJobForResult matches a result to its job by ID, falling back to the
+// most recent unfinished job for the ticket
+func (m *Manager) findJobForResult(result *models.JobResult) *models.Job {
+	if result.JobID != "" {
+		if job, ok := m.jobs[result.JobID]; ok {
+			return job
+		}
+	}
+
+	var match *models.Job
+	for _, j := range m.jobs {
+		if j.TicketID != result.TicketID || j.Status.IsTerminal() {
+			continue
+		}
+		if match == nil || j.CreatedAt.After(match.CreatedAt) {
+			match = j
+		}
+	}
+	return match
+}
@@ -0,0 +1,22 @@
+package queue
+
+import (
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// releaseWorktree lets go of a finished job's worktree. The worktree of a
+// job that opened a pull request is kept, merging, until the pull request
+// is merged or closed; any other is released right away.
+func (m *Manager) releaseWorktree(jobID, worktreeID, repo string, status models.JobStatus, result *models.JobResult) {
+	if status == models.JobStatusCompleted && result.PRNumber > 0 {
+		err := m.worktreeManager.MarkMerging(worktreeID, repo, result.PRNumber, result.PRUrl)
+		if err == nil {
+			return
+		}
+		log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to keep worktree for its pull request, releasing it")
+	}
+	if err := m.worktreeManager.Delete(worktreeID); err != nil {
+		log.Warn().Err(err).Str("job_id", jobID).Msg("Failed to release worktree")
+	}
+}
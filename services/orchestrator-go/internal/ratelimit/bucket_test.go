@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// near reports whether got is within a moment of want; time passes between
+// calls, so waits come out a little shorter
+func near(got, want time.Duration) bool {
+	return got <= want && got > want-100*time.Millisecond
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l := NewLimiter(60, 3)
+	for i := 0; i < 3; i++ {
+		if ok, wait := l.Allow("caller"); !ok {
+			t.Fatalf("call %d refused with a wait of %s inside the burst", i+1, wait)
+		}
+	}
+	ok, wait := l.Allow("caller")
+	if ok {
+		t.Fatal("call past the burst allowed")
+	}
+	if !near(wait, time.Second) {
+		t.Fatalf("call past the burst waits %s, want about 1s", wait)
+	}
+}
+
+func TestLimiterRefillsAtRate(t *testing.T) {
+	l := NewLimiter(6, 1)
+	l.Allow("caller")
+	if ok, wait := l.Allow("caller"); ok || !near(wait, 10*time.Second) {
+		t.Fatalf("Allow = %t, %s, want refused for about 10s", ok, wait)
+	}
+}
+
+func TestLimiterBurstOfAtLeastOne(t *testing.T) {
+	l := NewLimiter(60, 0)
+	if ok, _ := l.Allow("caller"); !ok {
+		t.Fatal("first call refused with no burst configured")
+	}
+	if ok, _ := l.Allow("caller"); ok {
+		t.Fatal("second call allowed with no burst configured")
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l := NewLimiter(60, 1)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first call for a refused")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("second call for a allowed")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("first call for b refused after a emptied its bucket")
+	}
+}
@@ -0,0 +1,92 @@
+// Package scm abstracts the source code hosts projects' repositories live
+// on. A provider says where a repository is cloned from, how git
+// authenticates to it, and opens the pull or merge request proposing a
+// job's branch, so the worktree manager and local executors do not depend
+// on any one host.
+package scm
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// Provider is a source code host
+type Provider interface {
+	// Name is what projects select the provider by
+	Name() string
+	// Configured reports whether API calls can be made
+	Configured() bool
+	// CloneURL returns the HTTPS URL git clones a repository from
+	CloneURL(repo string) string
+	// SSHCloneURL returns the SSH URL git clones a repository from with a
+	// deploy key
+	SSHCloneURL(repo string) string
+	// GitCredentials authenticates git over HTTPS, or is nil when git
+	// relies on its own credential setup
+	GitCredentials() gitauth.Credentials
+	// OpenChangeRequest proposes merging head into base: a pull request on
+	// GitHub, a merge request on GitLab
+	OpenChangeRequest(ctx context.Context, repo, head, base, title, body string) (*ChangeRequest, error)
+}
+
+// ChangeRequest is an opened pull or merge request
+type ChangeRequest struct {
+	Number int
+	URL    string
+}
+
+// SettingsSource looks up project settings
+type SettingsSource interface {
+	Get(projectID string) (models.ProjectSettings, bool)
+}
+
+// Registry holds the available providers
+type Registry struct {
+	providers map[string]Provider
+	projects  SettingsSource
+}
+
+// NewRegistry creates a registry of providers, which projects select from
+// by name. Projects selecting none use GitHub.
+func NewRegistry(projects SettingsSource, providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider), projects: projects}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get returns a provider by name
+func (r *Registry) Get(name string) (Provider, bool) {
+	if name == "" {
+		name = models.SCMGitHub
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names lists the available providers
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForProject returns the provider hosting a project's repository, or nil
+// when it is not available
+func (r *Registry) ForProject(projectID string) Provider {
+	var name string
+	if r.projects != nil {
+		if settings, ok := r.projects.Get(projectID); ok {
+			name = settings.SCM
+		}
+	}
+	p, _ := r.Get(name)
+	return p
+}
@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/awsauth"
+)
+
+// awsSecrets reads secrets from AWS Secrets Manager. A reference names the
+// secret by name or ARN; a secret stored as a JSON object has its keys as
+// fields, any other secret is a single value.
+type awsSecrets struct {
+	creds    awsauth.Credentials
+	region   string
+	endpoint string
+	client   *http.Client
+}
+
+func newAWS(opts Options) *awsSecrets {
+	return &awsSecrets{
+		creds: awsauth.Credentials{
+			AccessKeyID:     opts.AWSAccessKeyID,
+			SecretAccessKey: opts.AWSSecretAccessKey,
+			SessionToken:    opts.AWSSessionToken,
+		},
+		region:   opts.AWSRegion,
+		endpoint: strings.TrimSuffix(opts.AWSEndpoint, "/"),
+		client:   &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+func (a *awsSecrets) fetch(ctx context.Context, secretID string) (map[string]string, error) {
+	if !a.creds.Valid() {
+		return nil, errors.New("aws secrets require AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	// An ARN names the region its secret is kept in
+	region := a.region
+	if parts := strings.Split(secretID, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	endpoint := a.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsauth.Sign(req, body, a.creds, region, "secretsmanager", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("secrets manager returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(secret.SecretString), &data); err == nil {
+		return stringFields(data), nil
+	}
+	return map[string]string{"": secret.SecretString}, nil
+}
@@ -0,0 +1,157 @@
+// Package secrets reads settings kept in a secrets backend rather than in
+// the environment. A setting refers to a secret as vault:<path>#<field> or
+// awssm:<secret id>#<field>; values are cached for a while so loading the
+// configuration again does not fetch every secret each time.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reference schemes
+const (
+	SchemeVault = "vault"
+	SchemeAWS   = "awssm"
+)
+
+// fetchTimeout bounds each request to a backend
+const fetchTimeout = 10 * time.Second
+
+// Options configure the backends and the cache
+type Options struct {
+	// VaultAddr, VaultToken and VaultNamespace address Vault's HTTP API
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	// AWS Secrets Manager is called in AWSRegion with static credentials,
+	// or at AWSEndpoint when set
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+	AWSRegion          string
+	AWSEndpoint        string
+	// CacheTTL is how long a fetched secret is used before it is fetched
+	// again, which is how rotated secrets are picked up
+	CacheTTL time.Duration
+}
+
+// backend fetches a secret, returning its fields by name. A secret without
+// fields is returned under "".
+type backend interface {
+	fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+type entry struct {
+	fields    map[string]string
+	fetchedAt time.Time
+}
+
+// Resolver replaces secret references with the secrets they name
+type Resolver struct {
+	opts     Options
+	backends map[string]backend
+
+	mu    sync.Mutex
+	cache map[string]entry
+}
+
+// NewResolver creates a resolver for the backends opts configure
+func NewResolver(opts Options) *Resolver {
+	return &Resolver{
+		opts: opts,
+		backends: map[string]backend{
+			SchemeVault: newVault(opts),
+			SchemeAWS:   newAWS(opts),
+		},
+		cache: make(map[string]entry),
+	}
+}
+
+// Options returns what the resolver was created with
+func (r *Resolver) Options() Options {
+	return r.opts
+}
+
+// IsReference reports whether value names a secret instead of holding one
+func IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	return ok && (scheme == SchemeVault || scheme == SchemeAWS)
+}
+
+// Resolve returns the secret value names, or value itself when it is not a
+// reference. A secret that cannot be fetched again once its cache entry
+// expires keeps its last value, so an unreachable backend does not take
+// settings away.
+func (r *Resolver) Resolve(value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	scheme, rest, _ := strings.Cut(value, ":")
+	path, field, _ := strings.Cut(rest, "#")
+	if path == "" {
+		return "", fmt.Errorf("secret reference %q names no secret", value)
+	}
+
+	fields, err := r.fields(scheme, path)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := fields[field]
+	if !ok && field == "" && len(fields) == 1 {
+		for _, only := range fields {
+			secret, ok = only, true
+		}
+	}
+	if !ok {
+		if field == "" {
+			return "", fmt.Errorf("secret %s:%s has several fields, name one with #<field>", scheme, path)
+		}
+		return "", fmt.Errorf("secret %s:%s has no field %q", scheme, path, field)
+	}
+	return secret, nil
+}
+
+// fields returns a secret's fields from the cache, fetching them when they
+// are missing or expired
+func (r *Resolver) fields(scheme, path string) (map[string]string, error) {
+	key := scheme + ":" + path
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached, ok := r.cache[key]
+	if ok && time.Since(cached.fetchedAt) < r.opts.CacheTTL {
+		return cached.fields, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	fields, err := r.backends[scheme].fetch(ctx, path)
+	if err != nil {
+		if ok {
+			log.Warn().Err(err).Str("secret", key).Msg("Failed to refresh secret, keeping the cached value")
+			return cached.fields, nil
+		}
+		return nil, fmt.Errorf("failed to fetch secret %s: %w", key, err)
+	}
+	r.cache[key] = entry{fields: fields, fetchedAt: time.Now()}
+	return fields, nil
+}
+
+// stringFields converts the fields of a JSON secret to strings
+func stringFields(data map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(data))
+	for name, value := range data {
+		if s, ok := value.(string); ok {
+			fields[name] = s
+		} else {
+			fields[name] = fmt.Sprint(value)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// vault reads secrets from a KV secrets engine, version 1 or 2. References
+// use the API path, so a KV v2 secret is vault:secret/data/<name>#<field>.
+type vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func newVault(opts Options) *vault {
+	return &vault{
+		addr:      strings.TrimSuffix(opts.VaultAddr, "/"),
+		token:     opts.VaultToken,
+		namespace: opts.VaultNamespace,
+		client:    &http.Client{Timeout: fetchTimeout},
+	}
+}
+
+func (v *vault) fetch(ctx context.Context, path string) (map[string]string, error) {
+	if v.addr == "" || v.token == "" {
+		return nil, errors.New("vault secrets require VAULT_ADDR and VAULT_TOKEN")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+	// KV v2 nests the secret's fields beside its metadata
+	if inner, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, versioned := secret.Data["metadata"]; versioned {
+			return stringFields(inner), nil
+		}
+	}
+	return stringFields(secret.Data), nil
+}
@@ -0,0 +1,269 @@
+// Package simulate replays recorded job arrivals against a model of the
+// scheduler to predict how long jobs would wait with other worker counts
+// and scheduling strategies
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Scheduling strategies
+const (
+	// StrategyPriority dispatches the highest priority job first, oldest
+	// first within a priority, as the queue manager does
+	StrategyPriority = "priority"
+	// StrategyFIFO dispatches jobs in arrival order
+	StrategyFIFO = "fifo"
+	// StrategyFair dispatches from the project with the fewest running jobs
+	StrategyFair = "fair"
+)
+
+// Strategies lists the strategies Run accepts
+var Strategies = []string{StrategyPriority, StrategyFIFO, StrategyFair}
+
+// Arrival is a job as it arrived, with how long it ran
+type Arrival struct {
+	ProjectID string
+	Priority  int
+	At        time.Time
+	Duration  time.Duration
+}
+
+// record is a line of the arrivals file. Jobs as returned by the API or
+// stored in the archive work as they are; duration_seconds overrides the
+// run time taken from dispatched_at and completed_at.
+type record struct {
+	ProjectID       string     `json:"project_id"`
+	Priority        int        `json:"priority"`
+	CreatedAt       time.Time  `json:"created_at"`
+	DispatchedAt    *time.Time `json:"dispatched_at"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	DurationSeconds *float64   `json:"duration_seconds"`
+}
+
+// Load reads arrivals from NDJSON, one job per line. Jobs that never ran
+// take defaultDuration. Arrivals are returned in arrival order.
+func Load(r io.Reader, defaultDuration time.Duration) ([]Arrival, error) {
+	var arrivals []Arrival
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.CreatedAt.IsZero() {
+			return nil, fmt.Errorf("line %d: created_at is required", line)
+		}
+
+		duration := defaultDuration
+		switch {
+		case rec.DurationSeconds != nil:
+			duration = time.Duration(*rec.DurationSeconds * float64(time.Second))
+		case rec.DispatchedAt != nil && rec.CompletedAt != nil && rec.CompletedAt.After(*rec.DispatchedAt):
+			duration = rec.CompletedAt.Sub(*rec.DispatchedAt)
+		}
+		arrivals = append(arrivals, Arrival{
+			ProjectID: rec.ProjectID,
+			Priority:  rec.Priority,
+			At:        rec.CreatedAt,
+			Duration:  duration,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		return arrivals[i].At.Before(arrivals[j].At)
+	})
+	return arrivals, nil
+}
+
+// Config is the scheduler being simulated
+type Config struct {
+	Workers  int
+	Strategy string
+	// ProjectMaxParallel caps each project's running jobs; zero is unlimited
+	ProjectMaxParallel int
+}
+
+// Result is the predicted wait of jobs from arrival to dispatch
+type Result struct {
+	Config
+	Jobs int
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+	// Utilization is the share of worker time spent running jobs between
+	// the first arrival and the last completion
+	Utilization float64
+}
+
+// run is a job holding a worker until end
+type run struct {
+	projectID string
+	end       time.Time
+}
+
+// Run replays arrivals, which must be in arrival order, against cfg
+func Run(cfg Config, arrivals []Arrival) (*Result, error) {
+	if cfg.Workers < 1 {
+		return nil, fmt.Errorf("at least one worker is required")
+	}
+	pick, ok := strategies[cfg.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", cfg.Strategy)
+	}
+	result := &Result{Config: cfg, Jobs: len(arrivals)}
+	if len(arrivals) == 0 {
+		return result, nil
+	}
+
+	var (
+		queue   []Arrival
+		running []run
+		active  = make(map[string]int)
+		waits   = make([]time.Duration, 0, len(arrivals))
+		busy    time.Duration
+		next    int
+		now     = arrivals[0].At
+		last    = now
+	)
+
+	for next < len(arrivals) || len(queue) > 0 || len(running) > 0 {
+		// Finish runs due by now
+		kept := running[:0]
+		for _, r := range running {
+			if r.end.After(now) {
+				kept = append(kept, r)
+			} else {
+				active[r.projectID]--
+			}
+		}
+		running = kept
+
+		for next < len(arrivals) && !arrivals[next].At.After(now) {
+			queue = append(queue, arrivals[next])
+			next++
+		}
+
+		for len(running) < cfg.Workers {
+			i := pick(queue, active, cfg.ProjectMaxParallel)
+			if i < 0 {
+				break
+			}
+			job := queue[i]
+			queue = append(queue[:i], queue[i+1:]...)
+
+			waits = append(waits, now.Sub(job.At))
+			end := now.Add(job.Duration)
+			running = append(running, run{projectID: job.ProjectID, end: end})
+			active[job.ProjectID]++
+			busy += job.Duration
+			if end.After(last) {
+				last = end
+			}
+		}
+
+		// Advance to the next arrival or completion
+		var upcoming time.Time
+		if next < len(arrivals) {
+			upcoming = arrivals[next].At
+		}
+		for _, r := range running {
+			if upcoming.IsZero() || r.end.Before(upcoming) {
+				upcoming = r.end
+			}
+		}
+		if upcoming.IsZero() {
+			// Nothing is running or left to arrive
+			break
+		}
+		now = upcoming
+	}
+
+	if len(waits) < len(arrivals) {
+		return nil, fmt.Errorf("%d jobs could not be dispatched", len(arrivals)-len(waits))
+	}
+	summarize(result, waits)
+	if span := last.Sub(arrivals[0].At); span > 0 {
+		result.Utilization = float64(busy) / (float64(span) * float64(cfg.Workers))
+	}
+	return result, nil
+}
+
+// strategies pick the index of the queued job to dispatch next, or -1 when
+// none may run
+var strategies = map[string]func(queue []Arrival, active map[string]int, projectMax int) int{
+	StrategyPriority: func(queue []Arrival, active map[string]int, projectMax int) int {
+		best := -1
+		for i, job := range queue {
+			if projectMax > 0 && active[job.ProjectID] >= projectMax {
+				continue
+			}
+			if best < 0 || job.Priority > queue[best].Priority {
+				best = i
+			}
+		}
+		return best
+	},
+	StrategyFIFO: func(queue []Arrival, active map[string]int, projectMax int) int {
+		for i, job := range queue {
+			if projectMax <= 0 || active[job.ProjectID] < projectMax {
+				return i
+			}
+		}
+		return -1
+	},
+	StrategyFair: func(queue []Arrival, active map[string]int, projectMax int) int {
+		best := -1
+		for i, job := range queue {
+			if projectMax > 0 && active[job.ProjectID] >= projectMax {
+				continue
+			}
+			if best < 0 || active[job.ProjectID] < active[queue[best].ProjectID] {
+				best = i
+			}
+		}
+		return best
+	},
+}
+
+// summarize fills in the wait statistics of a result
+func summarize(result *Result, waits []time.Duration) {
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	var total time.Duration
+	for _, w := range waits {
+		total += w
+	}
+	result.Mean = total / time.Duration(len(waits))
+	result.P50 = percentile(waits, 50)
+	result.P90 = percentile(waits, 90)
+	result.P95 = percentile(waits, 95)
+	result.P99 = percentile(waits, 99)
+	result.Max = waits[len(waits)-1]
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,6 @@
+// Package version identifies the running orchestrator build
+package version
+
+// Version is the orchestrator release, overridden at build time with
+// -ldflags "-X github.com/kevinreber/autobuild-orchestrator-go/internal/version.Version=..."
+var Version = "0.1.0"
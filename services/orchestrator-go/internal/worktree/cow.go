@@ -0,0 +1,137 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// templatesDir holds one prepared clone per project, used as the source for
+// copy-on-write worktrees
+const templatesDir = ".templates"
+
+// detectCopyOnWrite reports whether the filesystem under basePath supports
+// reflink copies (Btrfs, XFS, ZFS block cloning, APFS)
+func detectCopyOnWrite(basePath string) bool {
+	probeDir, err := os.MkdirTemp(basePath, ".cow-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(probeDir)
+
+	src := filepath.Join(probeDir, "src")
+	if err := os.WriteFile(src, []byte("probe"), 0644); err != nil {
+		return false
+	}
+
+	return reflinkCopy(src, filepath.Join(probeDir, "dst")) == nil
+}
+
+// reflinkCopy clones src to dst without copying data blocks, failing rather
+// than falling back to a full copy
+func reflinkCopy(src, dst string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("cp", "-a", "-c", src, dst)
+	} else {
+		cmd = exec.Command("cp", "-a", "--reflink=always", src, dst)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("reflink copy failed: %s - %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// createFromTemplate clones the project's template into wtPath and checks out
+// a new branch in it from start, a remote-tracking branch of the cached repo,
+// or start itself when branchName is empty
+func (m *Manager) createFromTemplate(ctx context.Context, projectID, repoPath, start, branchName, wtPath string) error {
+	tplPath, err := m.ensureTemplate(ctx, projectID, repoPath)
+	if err != nil {
+		return err
+	}
+
+	// Bring the template's copy of the start branch up to date with the
+	// freshly fetched repo
+	ref := "refs/remotes/" + start
+	if output, err := runGit(ctx, tplPath, "fetch", "--no-tags", repoPath, "+"+ref+":"+ref); err != nil {
+		return fmt.Errorf("failed to update template: %s - %w", string(output), err)
+	}
+
+	if err := reflinkCopy(tplPath, wtPath); err != nil {
+		return err
+	}
+
+	args := []string{"checkout", "--detach", start}
+	if branchName != "" {
+		args = []string{"checkout", "-b", branchName, start}
+	}
+	if output, err := runGitEnv(ctx, wtPath, noSmudge, args...); err != nil {
+		os.RemoveAll(wtPath)
+		if branchExists(output) {
+			return fmt.Errorf("%w: %s", ErrBranchExists, branchName)
+		}
+		return fmt.Errorf("failed to create branch: %s - %w", string(output), err)
+	}
+
+	return nil
+}
+
+// ensureTemplate prepares the project's template clone on first use: a local
+// clone of the cached repo pointed at the real remote, with the configured
+// prepare command (e.g. dependency install) already run. Callers hold the
+// project's repository lock.
+func (m *Manager) ensureTemplate(ctx context.Context, projectID, repoPath string) (string, error) {
+	m.mu.RLock()
+	path, ok := m.templates[projectID]
+	m.mu.RUnlock()
+	if ok {
+		return path, nil
+	}
+
+	tplPath := filepath.Join(m.cfg.BasePath, templatesDir, projectID)
+	os.RemoveAll(tplPath)
+
+	if output, err := runGitEnv(ctx, "", noSmudge, "clone", "--local", repoPath, tplPath); err != nil {
+		return "", fmt.Errorf("failed to clone template: %s - %w", string(output), err)
+	}
+
+	// Point the template at the upstream remote so pushes from worktrees work
+	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
+	cmd.Dir = repoPath
+	if output, err := cmd.Output(); err == nil {
+		runGit(ctx, tplPath, "remote", "set-url", "origin", strings.TrimSpace(string(output)))
+	}
+
+	if m.cfg.TemplatePrepareCmd != "" {
+		_, span := tracing.Start(ctx, "worktree.prepare_template", attribute.String("project.id", projectID))
+		cmd = exec.CommandContext(ctx, "sh", "-c", m.cfg.TemplatePrepareCmd)
+		cmd.Dir = tplPath
+		output, err := cmd.CombinedOutput()
+		tracing.End(span, err)
+		if err != nil {
+			os.RemoveAll(tplPath)
+			return "", fmt.Errorf("template prepare command failed: %s - %w", string(output), err)
+		}
+	}
+
+	m.mu.Lock()
+	m.templates[projectID] = tplPath
+	m.mu.Unlock()
+
+	log.Info().
+		Str("project_id", projectID).
+		Str("path", tplPath).
+		Msg("Prepared worktree template")
+
+	return tplPath, nil
+}
@@ -0,0 +1,33 @@
+package worktree
+
+import (
+	"sort"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// DebugState returns a copy of the manager's worktrees, repository cache
+// and templates
+func (m *Manager) DebugState() models.WorktreeDebugState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := models.WorktreeDebugState{
+		Worktrees: make([]models.Worktree, 0, len(m.worktrees)),
+		RepoCache: make(map[string]string, len(m.repoCache)),
+		Templates: make(map[string]string, len(m.templates)),
+	}
+	for _, wt := range m.worktrees {
+		state.Worktrees = append(state.Worktrees, *wt)
+	}
+	sort.Slice(state.Worktrees, func(i, j int) bool {
+		return state.Worktrees[i].CreatedAt.Before(state.Worktrees[j].CreatedAt)
+	})
+	for projectID, path := range m.repoCache {
+		state.RepoCache[projectID] = path
+	}
+	for projectID, path := range m.templates {
+		state.Templates[projectID] = path
+	}
+	return state
+}
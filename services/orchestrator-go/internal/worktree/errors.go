@@ -0,0 +1,38 @@
+package worktree
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Errors worktree operations wrap, for callers to tell apart with errors.Is
+var (
+	// ErrCapacityReached is returned while the maximum number of worktrees
+	// is active
+	ErrCapacityReached = errors.New("maximum worktrees reached")
+	// ErrRepoUnavailable is returned when a project's repository cannot be
+	// cloned or fetched
+	ErrRepoUnavailable = errors.New("repository unavailable")
+	// ErrBranchExists is returned when a worktree's branch already exists
+	ErrBranchExists = errors.New("branch already exists")
+	// ErrBaseBranchNotFound is returned when the repository has no branch
+	// named by a job's base branch
+	ErrBaseBranchNotFound = errors.New("base branch not found")
+	// ErrGitTimeout is returned when preparing a worktree takes longer than
+	// the git timeout
+	ErrGitTimeout = errors.New("git timed out")
+	// ErrNotFound is returned for unknown worktrees
+	ErrNotFound = errors.New("worktree not found")
+	// ErrMerging is returned when releasing a worktree kept until its pull
+	// request is resolved
+	ErrMerging = errors.New("worktree is waiting on its pull request")
+	// ErrInvalidTransition is returned for lifecycle changes the worktree's
+	// status does not allow
+	ErrInvalidTransition = errors.New("invalid worktree status transition")
+)
+
+// branchExists reports whether git's output shows it refused to create a
+// branch that already exists
+func branchExists(output []byte) bool {
+	return bytes.Contains(output, []byte("a branch named")) && bytes.Contains(output, []byte("already exists"))
+}
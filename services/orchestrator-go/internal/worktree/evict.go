@@ -0,0 +1,79 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// EvictProject removes a project's pooled worktrees, template and cached
+// repository clone, which its next worktree creates again. It fails while
+// the project has worktrees in use and reports whether anything was removed.
+func (m *Manager) EvictProject(projectID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.creating[projectID] > 0 || m.recycling[projectID] > 0 {
+		return false, fmt.Errorf("project %s has worktrees in use", projectID)
+	}
+	var pooled []*models.Worktree
+	for _, wt := range m.worktrees {
+		if wt.ProjectID != projectID {
+			continue
+		}
+		if wt.Status != models.WorktreeStatusPooled {
+			return false, fmt.Errorf("project %s has worktrees in use", projectID)
+		}
+		pooled = append(pooled, wt)
+	}
+
+	for _, wt := range pooled {
+		if err := m.removeFromDisk(wt); err != nil {
+			os.RemoveAll(wt.Path)
+		}
+		m.drop(wt.ID)
+	}
+	evicted := len(pooled) > 0
+
+	if path, ok := m.templates[projectID]; ok {
+		os.RemoveAll(path)
+		delete(m.templates, projectID)
+		evicted = true
+	}
+
+	// A clone left by an earlier run is on disk without being cached
+	repoPath := filepath.Join(m.cfg.BasePath, reposDir, projectID)
+	if _, ok := m.repoCache[projectID]; ok {
+		delete(m.repoCache, projectID)
+		evicted = true
+	}
+	if _, err := os.Stat(repoPath); err == nil {
+		evicted = true
+	}
+	if err := os.RemoveAll(repoPath); err != nil {
+		return evicted, err
+	}
+
+	if evicted {
+		log.Info().
+			Str("project_id", projectID).
+			Int("pooled_worktrees", len(pooled)).
+			Msg("Evicted project repository cache")
+	}
+	return evicted, nil
+}
+
+// CachedProjects lists the projects with a repository clone on disk
+func (m *Manager) CachedProjects() []string {
+	entries, _ := os.ReadDir(filepath.Join(m.cfg.BasePath, reposDir))
+	projects := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			projects = append(projects, e.Name())
+		}
+	}
+	return projects
+}
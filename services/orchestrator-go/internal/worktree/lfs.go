@@ -0,0 +1,75 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// noSmudge keeps checkouts from downloading LFS objects through a globally
+// installed LFS filter, without credentials; pullLFS fetches them instead
+var noSmudge = []string{"GIT_LFS_SKIP_SMUDGE=1"}
+
+// pullLFS replaces the LFS pointer files of a new worktree with their
+// content. In the default auto mode it does so only when the repository
+// tracks files with LFS and git-lfs is installed.
+func (m *Manager) pullLFS(ctx context.Context, projectID, path string) error {
+	mode := models.LFSModeAuto
+	if m.projects != nil {
+		if settings, _ := m.projects.Get(projectID); settings.LFS != "" {
+			mode = settings.LFS
+		}
+	}
+	switch mode {
+	case models.LFSModeSkip:
+		return nil
+	case models.LFSModeAuto:
+		if !usesLFS(ctx, path) {
+			return nil
+		}
+		if _, err := exec.LookPath("git-lfs"); err != nil {
+			log.Warn().Str("project_id", projectID).Msg("Repository uses Git LFS but git-lfs is not installed, leaving pointer files")
+			return nil
+		}
+	}
+
+	// Installs the filters in the repository so the agent's commits store
+	// LFS files as pointers too
+	if output, err := runGit(ctx, path, "lfs", "install", "--local"); err != nil {
+		return fmt.Errorf("failed to install Git LFS: %s - %w", string(output), err)
+	}
+	output, err := gitauth.Run(ctx, "lfs pull", m.credsFor(projectID), func(env []string) ([]byte, error) {
+		return runGitEnv(ctx, path, env, "lfs", "pull")
+	})
+	if err != nil {
+		if gitauth.IsAuth(err) {
+			return err
+		}
+		return fmt.Errorf("failed to pull LFS objects: %s - %w", string(output), err)
+	}
+	return nil
+}
+
+// usesLFS reports whether a checkout's .gitattributes files route any
+// paths through the LFS filter
+func usesLFS(ctx context.Context, path string) bool {
+	cmd := exec.CommandContext(ctx, "git", "grep", "--quiet", "filter=lfs", "--", ":(glob)**/.gitattributes")
+	cmd.Dir = path
+	return cmd.Run() == nil
+}
+
+// prepareCheckout completes a new worktree's checkout with the sparse
+// paths, submodules and LFS objects its project needs
+func (m *Manager) prepareCheckout(ctx context.Context, projectID, path string) error {
+	if err := m.applySparse(ctx, projectID, path); err != nil {
+		return err
+	}
+	if err := m.initSubmodules(ctx, projectID, path); err != nil {
+		return err
+	}
+	return m.pullLFS(ctx, projectID, path)
+}
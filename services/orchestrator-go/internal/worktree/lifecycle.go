@@ -0,0 +1,137 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// MarkMerging keeps an active worktree, out of the active count, while the
+// pull request opened from its branch is open. Marking a merging worktree
+// again updates its pull request.
+func (m *Manager) MarkMerging(wtID, repo string, prNumber int, prURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wt, ok := m.worktrees[wtID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, wtID)
+	}
+	if wt.Status != models.WorktreeStatusActive && wt.Status != models.WorktreeStatusMerging {
+		return fmt.Errorf("%w: %s worktree cannot wait on a pull request", ErrInvalidTransition, wt.Status)
+	}
+
+	m.unwatch(wtID)
+	now := time.Now()
+	if wt.Status == models.WorktreeStatusActive {
+		wt.MergingAt = &now
+	}
+	wt.Status = models.WorktreeStatusMerging
+	wt.RepoFullName = repo
+	wt.PRNumber = prNumber
+	wt.PRUrl = prURL
+	wt.LastUsedAt = now
+
+	log.Info().
+		Str("worktree_id", wtID).
+		Str("project_id", wt.ProjectID).
+		Int("pr_number", prNumber).
+		Msg("Worktree waiting on its pull request")
+	return nil
+}
+
+// MarkCleanup schedules a worktree for removal once its pull request is
+// resolved, after the cleanup delay. Active worktrees may be marked too.
+func (m *Manager) MarkCleanup(wtID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wt, ok := m.worktrees[wtID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, wtID)
+	}
+	switch wt.Status {
+	case models.WorktreeStatusActive, models.WorktreeStatusMerging:
+	case models.WorktreeStatusCleanup:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s worktree cannot be cleaned up", ErrInvalidTransition, wt.Status)
+	}
+
+	m.unwatch(wtID)
+	cleanupAt := time.Now().Add(m.cfg.CleanupDelay)
+	wt.Status = models.WorktreeStatusCleanup
+	wt.CleanupAt = &cleanupAt
+
+	log.Info().
+		Str("worktree_id", wtID).
+		Str("project_id", wt.ProjectID).
+		Time("cleanup_at", cleanupAt).
+		Msg("Worktree scheduled for cleanup")
+	return nil
+}
+
+// ResolvePullRequest schedules the worktrees waiting on a repository's pull
+// request for cleanup once it is merged or closed, returning their IDs
+func (m *Manager) ResolvePullRequest(repo string, prNumber int) []string {
+	m.mu.RLock()
+	var ids []string
+	for id, wt := range m.worktrees {
+		if wt.Status == models.WorktreeStatusMerging && wt.RepoFullName == repo && wt.PRNumber == prNumber {
+			ids = append(ids, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	resolved := ids[:0]
+	for _, id := range ids {
+		if err := m.MarkCleanup(id); err != nil {
+			log.Warn().Err(err).Str("worktree_id", id).Msg("Failed to schedule worktree cleanup")
+			continue
+		}
+		resolved = append(resolved, id)
+	}
+	return resolved
+}
+
+// sweepLifecycle removes worktrees due for cleanup, and schedules those
+// waiting past the merging maximum age. Callers hold m.mu.
+func (m *Manager) sweepLifecycle(now time.Time) {
+	for id, wt := range m.worktrees {
+		if wt.Status == models.WorktreeStatusMerging && m.cfg.MergingMaxAge > 0 &&
+			wt.MergingAt != nil && now.Sub(*wt.MergingAt) > m.cfg.MergingMaxAge {
+			log.Info().
+				Str("worktree_id", id).
+				Int("pr_number", wt.PRNumber).
+				Msg("Pull request unresolved past the merging maximum age, cleaning up worktree")
+			wt.Status = models.WorktreeStatusCleanup
+			wt.CleanupAt = &now
+		}
+		if wt.Status != models.WorktreeStatusCleanup || wt.CleanupAt == nil || wt.CleanupAt.After(now) {
+			continue
+		}
+
+		if err := m.removeFromDisk(wt); err != nil {
+			os.RemoveAll(wt.Path)
+		}
+		wt.Status = models.WorktreeStatusDeleted
+		m.drop(id)
+		log.Info().
+			Str("worktree_id", id).
+			Msg("Cleaned up worktree")
+	}
+}
+
+// countStatus returns the number of worktrees with a status
+func (m *Manager) countStatus(status models.WorktreeStatus) int {
+	count := 0
+	for _, wt := range m.worktrees {
+		if wt.Status == status {
+			count++
+		}
+	}
+	return count
+}
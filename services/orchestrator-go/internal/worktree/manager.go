@@ -1,25 +1,65 @@
 package worktree
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/google/uuid"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/config"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/joblog"
 	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/tracing"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Manager handles git worktree operations
 type Manager struct {
-	mu         sync.RWMutex
-	cfg        config.WorktreeConfig
-	worktrees  map[string]*models.Worktree
-	repoCache  map[string]string // projectID -> local repo path
+	mu        sync.RWMutex
+	cfg       config.WorktreeConfig
+	worktrees map[string]*models.Worktree
+	repoCache map[string]string // projectID -> local repo path
+	templates map[string]string // projectID -> prepared template path
+	cow       bool              // create worktrees as reflink clones of templates
+	watcher   *fsnotify.Watcher // nil unless activity watching is enabled
+	watched   map[string]string // watched directory -> worktree ID
+
+	gitVersionOnce sync.Once
+	gitVersion     string
+
+	onQuota QuotaHandler
+
+	// providers say where repositories are cloned from and authenticate
+	// clones and fetches
+	providers *scm.Registry
+
+	// repoLocks serialize the git work in each project's clone and
+	// template, which runs without m.mu, and creating counts the worktrees
+	// being checked out meanwhile
+	repoLocks map[string]*sync.Mutex
+	creating  map[string]int
+	// recycling counts the released worktrees being cleaned for each
+	// project's pool, also without m.mu
+	recycling map[string]int
+
+	projects SettingsSource
+
+	// reloaded tells Start that the cleanup interval may have changed
+	reloaded chan struct{}
+
+	// created and removed count worktrees checked out and removed from
+	// disk, for churn rates
+	created uint64
+	removed uint64
 }
 
 // NewManager creates a new worktree manager
@@ -27,62 +67,190 @@ func NewManager(cfg config.WorktreeConfig) *Manager {
 	// Ensure base path exists
 	os.MkdirAll(cfg.BasePath, 0755)
 
-	return &Manager{
+	m := &Manager{
 		cfg:       cfg,
 		worktrees: make(map[string]*models.Worktree),
 		repoCache: make(map[string]string),
+		templates: make(map[string]string),
+		watched:   make(map[string]string),
+		repoLocks: make(map[string]*sync.Mutex),
+		creating:  make(map[string]int),
+		recycling: make(map[string]int),
+		reloaded:  make(chan struct{}, 1),
 	}
+
+	if cfg.WatchActivity {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to start worktree watcher, LastUsedAt will only change on explicit use")
+		} else {
+			m.watcher = watcher
+		}
+	}
+
+	switch cfg.CopyOnWrite {
+	case "always":
+		m.cow = true
+	case "auto":
+		m.cow = detectCopyOnWrite(cfg.BasePath)
+	}
+
+	log.Info().
+		Bool("copy_on_write", m.cow).
+		Bool("watch_activity", m.watcher != nil).
+		Str("base_path", cfg.BasePath).
+		Msg("Worktree manager initialized")
+
+	return m
 }
 
-// Create creates a new git worktree for a job
-func (m *Manager) Create(projectID, ticketID, branchName string) (*models.Worktree, error) {
+// Create creates a new git worktree for a job, on a new branch starting
+// from baseBranch of repo, or its default branch when baseBranch is empty.
+// An empty branchName checks the start point out detached, for jobs that
+// only read it. repo is only needed the first time a project's repository
+// is cloned.
+func (m *Manager) Create(ctx context.Context, projectID, repo, baseBranch, ticketID, branchName string) (*models.Worktree, error) {
+	ctx, span := tracing.Start(ctx, "worktree.create",
+		attribute.String("project.id", projectID),
+		attribute.String("git.repo", repo),
+		attribute.String("git.branch", branchName),
+	)
+	ctx, cancel := m.gitContext(ctx)
+	defer cancel()
+	wt, err := m.create(ctx, projectID, repo, baseBranch, ticketID, branchName)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s: %w", ErrGitTimeout, m.cfg.GitTimeout, err)
+	}
+	tracing.End(span, err)
+	return wt, err
+}
+
+// create reserves a worktree under the lock, checks it out without it, so
+// a slow clone or fetch holds up neither other projects' worktrees nor
+// readers of the manager, and records it under the lock again
+func (m *Manager) create(ctx context.Context, projectID, repo, baseBranch, ticketID, branchName string) (*models.Worktree, error) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	if active := m.countActive() + m.countCreating(); active >= m.cfg.MaxActive {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w (%d)", ErrCapacityReached, m.cfg.MaxActive)
+	}
+	m.creating[projectID]++
+	repoLock := m.repoLock(projectID)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if m.creating[projectID]--; m.creating[projectID] == 0 {
+			delete(m.creating, projectID)
+		}
+		m.mu.Unlock()
+	}()
+
+	repoLock.Lock()
+	wt, reused, err := m.checkout(ctx, projectID, repo, baseBranch, ticketID, branchName)
+	repoLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if we're at capacity
-	activeCount := m.countActive()
-	if activeCount >= m.cfg.MaxActive {
-		return nil, fmt.Errorf("maximum worktrees (%d) reached", m.cfg.MaxActive)
+	if err := m.prepareCheckout(ctx, projectID, wt.Path); err != nil {
+		removeCheckout(wt, m.cachedRepo(projectID))
+		if reused {
+			m.mu.Lock()
+			m.removed++
+			m.mu.Unlock()
+		}
+		return nil, err
 	}
 
+	m.mu.Lock()
+	m.worktrees[wt.ID] = wt
+	if !reused {
+		m.created++
+	}
+	m.watchTree(wt.ID, wt.Path)
+	m.mu.Unlock()
+
+	msg := "Created worktree"
+	if reused {
+		msg = "Reused pooled worktree"
+	}
+	log.Info().
+		Str("worktree_id", wt.ID).
+		Str("project_id", projectID).
+		Str("branch", branchName).
+		Str("path", wt.Path).
+		Msg(msg)
+
+	return wt, nil
+}
+
+// checkout brings the project's clone up to date and checks out a branch
+// for a job in one of its pooled worktrees, or else in a new one, which it
+// reports as not reused. Callers hold the project's repository lock.
+func (m *Manager) checkout(ctx context.Context, projectID, repo, baseBranch, ticketID, branchName string) (*models.Worktree, bool, error) {
 	// Get or clone the repository
-	repoPath, err := m.ensureRepo(projectID)
+	repoPath, err := m.ensureRepo(ctx, projectID, repo)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrRepoUnavailable, err)
+	}
+	start, err := startPoint(ctx, repoPath, baseBranch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ensure repo: %w", err)
+		return nil, false, err
+	}
+
+	if wt := m.takePooled(ctx, projectID, repoPath, start, ticketID, branchName); wt != nil {
+		return wt, true, nil
 	}
 
 	// Create worktree
 	wtID := uuid.New().String()
 	wtPath := filepath.Join(m.cfg.BasePath, wtID)
 
-	// Create the worktree using git
-	cmd := exec.Command("git", "worktree", "add", "-b", branchName, wtPath)
-	cmd.Dir = repoPath
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return nil, fmt.Errorf("failed to create worktree: %s - %w", string(output), err)
+	// Prefer a copy-on-write clone of the project template, falling back to
+	// git worktree add unless copy-on-write is mandatory
+	cow := false
+	if m.cow {
+		err := m.createFromTemplate(ctx, projectID, repoPath, start, branchName, wtPath)
+		switch {
+		case err == nil:
+			cow = true
+		case m.cfg.CopyOnWrite == "always":
+			return nil, false, fmt.Errorf("failed to create copy-on-write worktree: %w", err)
+		default:
+			log.Warn().Err(err).Str("project_id", projectID).Msg("Copy-on-write clone failed, falling back to git worktree")
+		}
 	}
 
-	wt := &models.Worktree{
-		ID:         wtID,
-		ProjectID:  projectID,
-		TicketID:   ticketID,
-		Path:       wtPath,
-		BranchName: branchName,
-		Status:     models.WorktreeStatusActive,
-		CreatedAt:  time.Now(),
-		LastUsedAt: time.Now(),
+	// Create the worktree using git
+	if !cow {
+		args := []string{"worktree", "add", "--detach", wtPath, start}
+		if branchName != "" {
+			args = []string{"worktree", "add", "-b", branchName, wtPath, start}
+		}
+		// Sparse worktrees only check out their paths, once those are set
+		if len(m.sparsePaths(projectID)) > 0 {
+			args = append(args[:2], append([]string{"--no-checkout"}, args[2:]...)...)
+		}
+		if output, err := runGitEnv(ctx, repoPath, noSmudge, args...); err != nil {
+			if branchExists(output) {
+				return nil, false, fmt.Errorf("%w: %s", ErrBranchExists, branchName)
+			}
+			return nil, false, fmt.Errorf("failed to create worktree: %s - %w", string(output), err)
+		}
 	}
 
-	m.worktrees[wtID] = wt
-
-	log.Info().
-		Str("worktree_id", wtID).
-		Str("project_id", projectID).
-		Str("branch", branchName).
-		Str("path", wtPath).
-		Msg("Created worktree")
-
-	return wt, nil
+	now := time.Now()
+	return &models.Worktree{
+		ID:          wtID,
+		ProjectID:   projectID,
+		TicketID:    ticketID,
+		Path:        wtPath,
+		BranchName:  branchName,
+		Status:      models.WorktreeStatusActive,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		CopyOnWrite: cow,
+	}, false, nil
 }
 
 // Get retrieves a worktree by ID
@@ -93,44 +261,152 @@ func (m *Manager) Get(wtID string) (*models.Worktree, bool) {
 	return wt, ok
 }
 
-// Delete removes a worktree
+// Delete releases a worktree, returning it to its project's pool when there
+// is room and removing it otherwise. Worktrees waiting on their pull request
+// are only removed through MarkCleanup. The worktree is forgotten under the
+// lock, and cleaned or removed from disk without it.
 func (m *Manager) Delete(wtID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	wt, ok := m.worktrees[wtID]
 	if !ok {
-		return fmt.Errorf("worktree not found: %s", wtID)
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNotFound, wtID)
+	}
+	if wt.Status == models.WorktreeStatusMerging {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrMerging, wt.PRUrl)
+	}
+	repoPath, ok := m.repoCache[wt.ProjectID]
+	if !ok && !wt.CopyOnWrite {
+		m.mu.Unlock()
+		return fmt.Errorf("repo not found for project: %s", wt.ProjectID)
 	}
 
-	// Get repo path
+	m.unwatch(wtID)
+	delete(m.worktrees, wtID)
+	pooling := m.poolable(wt)
+	if pooling {
+		m.recycling[wt.ProjectID]++
+	}
+	m.mu.Unlock()
+
+	if pooling {
+		cleaned := recycle(wt)
+		m.mu.Lock()
+		if m.recycling[wt.ProjectID]--; m.recycling[wt.ProjectID] == 0 {
+			delete(m.recycling, wt.ProjectID)
+		}
+		if cleaned {
+			m.pool(wt)
+		}
+		m.mu.Unlock()
+		if cleaned {
+			log.Info().
+				Str("worktree_id", wtID).
+				Str("project_id", wt.ProjectID).
+				Msg("Returned worktree to pool")
+			return nil
+		}
+	}
+
+	removeCheckout(wt, repoPath)
+	m.mu.Lock()
+	wt.Status = models.WorktreeStatusDeleted
+	m.removed++
+	m.mu.Unlock()
+
+	log.Info().
+		Str("worktree_id", wtID).
+		Msg("Deleted worktree")
+
+	return nil
+}
+
+// drop forgets a worktree removed from disk. Callers hold m.mu.
+func (m *Manager) drop(wtID string) {
+	delete(m.worktrees, wtID)
+	m.removed++
+}
+
+// removeFromDisk removes a worktree's checkout. Callers hold m.mu.
+func (m *Manager) removeFromDisk(wt *models.Worktree) error {
 	repoPath, ok := m.repoCache[wt.ProjectID]
-	if !ok {
+	if !ok && !wt.CopyOnWrite {
 		return fmt.Errorf("repo not found for project: %s", wt.ProjectID)
 	}
+	return removeCheckout(wt, repoPath)
+}
+
+// removeCheckout removes a worktree's checkout, and its branch, from the
+// clone at repoPath, without the manager's lock. Copy-on-write clones are
+// standalone repositories and are simply deleted.
+func removeCheckout(wt *models.Worktree, repoPath string) error {
+	if wt.CopyOnWrite || repoPath == "" {
+		return os.RemoveAll(wt.Path)
+	}
 
 	// Remove the worktree using git
 	cmd := exec.Command("git", "worktree", "remove", "--force", wt.Path)
 	cmd.Dir = repoPath
 	if output, err := cmd.CombinedOutput(); err != nil {
 		log.Warn().
-			Str("worktree_id", wtID).
+			Str("worktree_id", wt.ID).
 			Str("output", string(output)).
 			Err(err).
 			Msg("Failed to remove worktree via git, attempting manual cleanup")
 
 		// Manual cleanup
 		os.RemoveAll(wt.Path)
+		runGit(context.Background(), repoPath, "worktree", "prune")
 	}
+	deleteBranch(repoPath, wt)
+	return nil
+}
 
-	wt.Status = models.WorktreeStatusDeleted
-	delete(m.worktrees, wtID)
+// deleteBranch deletes a released worktree's branch from the clone at
+// repoPath. The branch was the job's alone, and what it pushed is on the
+// remote; leaving it would make a retry of the job, which checks the same
+// branch out again, fail with ErrBranchExists.
+func deleteBranch(repoPath string, wt *models.Worktree) {
+	if wt.BranchName == "" {
+		return
+	}
+	if output, err := runGit(context.Background(), repoPath, "branch", "-D", wt.BranchName); err != nil {
+		log.Warn().
+			Str("worktree_id", wt.ID).
+			Str("branch", wt.BranchName).
+			Str("output", string(output)).
+			Err(err).
+			Msg("Failed to delete branch of released worktree")
+	}
+}
 
-	log.Info().
-		Str("worktree_id", wtID).
-		Msg("Deleted worktree")
+// cachedRepo returns the path of a project's cached clone, "" before it is
+// cloned
+func (m *Manager) cachedRepo(projectID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.repoCache[projectID]
+}
 
-	return nil
+// repoLock returns the lock serializing git work in a project's clone and
+// template. Callers hold m.mu.
+func (m *Manager) repoLock(projectID string) *sync.Mutex {
+	l, ok := m.repoLocks[projectID]
+	if !ok {
+		l = &sync.Mutex{}
+		m.repoLocks[projectID] = l
+	}
+	return l
+}
+
+// countCreating returns the number of worktrees being checked out
+func (m *Manager) countCreating() int {
+	count := 0
+	for _, n := range m.creating {
+		count += n
+	}
+	return count
 }
 
 // List returns all active worktrees
@@ -145,56 +421,138 @@ func (m *Manager) List() []*models.Worktree {
 	return result
 }
 
+// Snapshot returns copies of all worktrees, safe to read while the manager
+// keeps updating them
+func (m *Manager) Snapshot() []models.Worktree {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]models.Worktree, 0, len(m.worktrees))
+	for _, wt := range m.worktrees {
+		result = append(result, *wt)
+	}
+	return result
+}
+
 // GetStats returns worktree statistics
 func (m *Manager) GetStats() *models.WorktreeStats {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return &models.WorktreeStats{
-		Active:    m.countActive(),
-		MaxActive: m.cfg.MaxActive,
+	stats := &models.WorktreeStats{
+		Active:         m.countActive(),
+		MaxActive:      m.cfg.MaxActive,
+		DiskQuotaBytes: m.cfg.DiskQuotaBytes,
+		Pooled:         m.countPooled(""),
+		Merging:        m.countStatus(models.WorktreeStatusMerging),
+		Cleanup:        m.countStatus(models.WorktreeStatusCleanup),
+		CreatedTotal:   m.created,
+		RemovedTotal:   m.removed,
+	}
+	for _, wt := range m.worktrees {
+		stats.DiskUsageBytes += wt.DiskUsageBytes
+		if m.overQuota(wt) {
+			stats.OverQuota++
+		}
 	}
+	return stats
 }
 
-// Cleanup removes old and unused worktrees
+// Reload applies the runtime-tunable settings of a reloaded configuration:
+// the active worktree limit, the idle age and the cleanup interval
+func (m *Manager) Reload(cfg config.WorktreeConfig) {
+	m.mu.Lock()
+	m.cfg.MaxActive = cfg.MaxActive
+	m.cfg.MaxAge = cfg.MaxAge
+	m.cfg.CleanupInterval = cfg.CleanupInterval
+	m.mu.Unlock()
+
+	select {
+	case m.reloaded <- struct{}{}:
+	default:
+	}
+}
+
+// cleanupInterval returns how often idle worktrees are cleaned up
+func (m *Manager) cleanupInterval() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg.CleanupInterval
+}
+
+// BasePath returns the directory worktrees are created in
+func (m *Manager) BasePath() string {
+	return m.cfg.BasePath
+}
+
+// GitVersion returns the installed git version, e.g. "2.43.0", or "" if git
+// cannot be run
+func (m *Manager) GitVersion() string {
+	m.gitVersionOnce.Do(func() {
+		out, err := exec.Command("git", "--version").Output()
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to determine git version")
+			return
+		}
+		m.gitVersion = strings.TrimPrefix(strings.TrimSpace(string(out)), "git version ")
+	})
+	return m.gitVersion
+}
+
+// Cleanup removes old and unused worktrees, and those whose pull requests
+// were resolved. Worktrees waiting on their pull request are not idle.
 func (m *Manager) Cleanup() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	now := time.Now()
+	m.sweepLifecycle(now)
 	for id, wt := range m.worktrees {
+		if wt.Status == models.WorktreeStatusMerging || wt.Status == models.WorktreeStatusCleanup {
+			continue
+		}
 		if now.Sub(wt.LastUsedAt) > m.cfg.MaxAge {
 			log.Info().
 				Str("worktree_id", id).
 				Time("last_used", wt.LastUsedAt).
 				Msg("Cleaning up stale worktree")
 
-			// Get repo path
-			if repoPath, ok := m.repoCache[wt.ProjectID]; ok {
-				cmd := exec.Command("git", "worktree", "remove", "--force", wt.Path)
-				cmd.Dir = repoPath
-				cmd.Run() // Ignore errors
-			}
+			m.unwatch(id)
 
-			os.RemoveAll(wt.Path)
-			delete(m.worktrees, id)
+			removeCheckout(wt, m.repoCache[wt.ProjectID])
+			m.drop(id)
 		}
 	}
 }
 
-// ensureRepo ensures a repository is cloned locally
-func (m *Manager) ensureRepo(projectID string) (string, error) {
-	if path, ok := m.repoCache[projectID]; ok {
-		return path, nil
+// gitContext bounds the git commands run under ctx by the configured git
+// timeout, so a remote that stops answering fails them rather than holding
+// up the worktree
+func (m *Manager) gitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.cfg.GitTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, m.cfg.GitTimeout)
+}
 
-	// TODO: Clone the repository
-	// This would involve:
-	// 1. Looking up the repo URL from the database
-	// 2. Cloning it to a local path
-	// 3. Caching the path
+// runGit runs a git command in dir, traced as a child span of ctx
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return runGitEnv(ctx, dir, nil, args...)
+}
 
-	return "", fmt.Errorf("repo cloning not yet implemented for project: %s", projectID)
+// runGitEnv runs a git command with env added to its environment. The
+// command is killed once ctx is done.
+func runGitEnv(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	_, span := tracing.Start(ctx, "git "+args[0], attribute.String("git.args", strings.Join(args, " ")))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	tracing.End(span, err)
+	fmt.Fprintf(joblog.Writer(ctx), "$ git %s\n%s", strings.Join(args, " "), output)
+	return output, err
 }
 
 // countActive returns the number of active worktrees
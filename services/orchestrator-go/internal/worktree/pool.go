@@ -0,0 +1,123 @@
+package worktree
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// poolable reports whether a released worktree can go back to its
+// project's pool. Copy-on-write clones are cheap to make again and are
+// never pooled, nor are worktrees over the disk quota. Callers hold m.mu.
+func (m *Manager) poolable(wt *models.Worktree) bool {
+	if m.cfg.PoolSize <= 0 || wt.Status != models.WorktreeStatusActive || wt.CopyOnWrite || m.overQuota(wt) {
+		return false
+	}
+	return m.countPooled(wt.ProjectID)+m.recycling[wt.ProjectID] < m.cfg.PoolSize
+}
+
+// recycle cleans a released worktree's checkout for the pool, reporting
+// false when it should be removed instead. The worktree's branch is
+// deleted, as it is when a worktree is removed. It runs without m.mu, on a
+// worktree no longer recorded.
+func recycle(wt *models.Worktree) bool {
+	ctx := context.Background()
+	steps := [][]string{
+		{"reset", "--hard"},
+		{"clean", "-ffdx"},
+		{"checkout", "--detach"},
+	}
+	if wt.BranchName != "" {
+		steps = append(steps, []string{"branch", "-D", wt.BranchName})
+	}
+	for _, args := range steps {
+		if output, err := runGitEnv(ctx, wt.Path, noSmudge, args...); err != nil {
+			log.Warn().
+				Str("worktree_id", wt.ID).
+				Str("output", string(output)).
+				Err(err).
+				Msg("Failed to clean worktree for the pool, removing it")
+			return false
+		}
+	}
+	return true
+}
+
+// pool records a cleaned worktree as pooled. Callers hold m.mu.
+func (m *Manager) pool(wt *models.Worktree) {
+	wt.Status = models.WorktreeStatusPooled
+	wt.TicketID = ""
+	wt.BranchName = ""
+	wt.DiskUsageBytes = 0
+	wt.DiskCheckedAt = nil
+	wt.LastUsedAt = time.Now()
+	m.worktrees[wt.ID] = wt
+}
+
+// takePooled checks out a new branch from start in one of the project's
+// pooled worktrees, or start itself when branchName is empty. It returns
+// nil when none is pooled. The worktree gets a new ID, so jobs that used it
+// before do not refer to it, and is left for the caller to record. The
+// checkout runs without m.mu; callers hold the project's repository lock.
+func (m *Manager) takePooled(ctx context.Context, projectID, repoPath, start, ticketID, branchName string) *models.Worktree {
+	for {
+		m.mu.Lock()
+		wt := m.unpool(projectID)
+		m.mu.Unlock()
+		if wt == nil {
+			return nil
+		}
+
+		args := []string{"checkout", "--detach", start}
+		if branchName != "" {
+			args = []string{"checkout", "-b", branchName, start}
+		}
+		if output, err := runGitEnv(ctx, wt.Path, noSmudge, args...); err != nil {
+			log.Warn().
+				Str("worktree_id", wt.ID).
+				Str("output", string(output)).
+				Err(err).
+				Msg("Failed to reuse pooled worktree, removing it")
+			removeCheckout(wt, repoPath)
+			m.mu.Lock()
+			m.removed++
+			m.mu.Unlock()
+			continue
+		}
+
+		now := time.Now()
+		wt.ID = uuid.New().String()
+		wt.TicketID = ticketID
+		wt.BranchName = branchName
+		wt.Status = models.WorktreeStatusActive
+		wt.CreatedAt = now
+		wt.LastUsedAt = now
+		return wt
+	}
+}
+
+// unpool takes one of a project's pooled worktrees out of the manager's
+// records, returning nil when none is pooled. Callers hold m.mu.
+func (m *Manager) unpool(projectID string) *models.Worktree {
+	for id, wt := range m.worktrees {
+		if wt.ProjectID == projectID && wt.Status == models.WorktreeStatusPooled {
+			delete(m.worktrees, id)
+			return wt
+		}
+	}
+	return nil
+}
+
+// countPooled returns the number of a project's pooled worktrees
+func (m *Manager) countPooled(projectID string) int {
+	count := 0
+	for _, wt := range m.worktrees {
+		if wt.Status == models.WorktreeStatusPooled && (projectID == "" || wt.ProjectID == projectID) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,124 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/hostres"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// QuotaHandler is told about worktrees measured above the disk quota
+type QuotaHandler func(wt models.Worktree)
+
+// SetQuotaHandler sets what is called for each worktree found over the disk
+// quota. It must be called before Start.
+func (m *Manager) SetQuotaHandler(handler QuotaHandler) {
+	m.onQuota = handler
+}
+
+// measureDisk records the disk usage of every active worktree and reports
+// the ones over the quota. Worktrees are walked without holding the lock,
+// as large ones take a while.
+func (m *Manager) measureDisk() {
+	m.mu.RLock()
+	paths := make(map[string]string, len(m.worktrees))
+	for id, wt := range m.worktrees {
+		if wt.Status == models.WorktreeStatusActive {
+			paths[id] = wt.Path
+		}
+	}
+	m.mu.RUnlock()
+
+	usage := make(map[string]int64, len(paths))
+	for id, path := range paths {
+		size, err := diskUsage(path)
+		if err != nil {
+			log.Warn().Err(err).Str("worktree_id", id).Msg("Failed to measure worktree disk usage")
+			continue
+		}
+		usage[id] = size
+	}
+
+	now := time.Now()
+	var over []models.Worktree
+	m.mu.Lock()
+	for id, size := range usage {
+		wt, ok := m.worktrees[id]
+		if !ok {
+			// Deleted while it was measured
+			continue
+		}
+		wt.DiskUsageBytes = size
+		wt.DiskCheckedAt = &now
+		if m.overQuota(wt) {
+			over = append(over, *wt)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, wt := range over {
+		log.Warn().
+			Str("worktree_id", wt.ID).
+			Int64("disk_usage_bytes", wt.DiskUsageBytes).
+			Int64("disk_quota_bytes", m.cfg.DiskQuotaBytes).
+			Msg("Worktree exceeds its disk quota")
+		if m.onQuota != nil {
+			m.onQuota(wt)
+		}
+	}
+}
+
+// CheckBasePath checks that worktrees can be written to the base path and
+// that its filesystem has at least minFree bytes available
+func (m *Manager) CheckBasePath(minFree int64) error {
+	f, err := os.CreateTemp(m.cfg.BasePath, ".health-*")
+	if err != nil {
+		return fmt.Errorf("base path not writable: %w", err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	free, err := hostres.FreeDisk(m.cfg.BasePath)
+	if err != nil {
+		return err
+	}
+	if minFree > 0 && free < uint64(minFree) {
+		return fmt.Errorf("%d MiB free in %s, below %d MiB", free>>20, m.cfg.BasePath, minFree>>20)
+	}
+	return nil
+}
+
+// overQuota reports whether a worktree was last measured above the quota
+func (m *Manager) overQuota(wt *models.Worktree) bool {
+	return m.cfg.DiskQuotaBytes > 0 && wt.DiskUsageBytes > m.cfg.DiskQuotaBytes
+}
+
+// diskUsage sums the sizes of the files under root. Symlinks count as
+// themselves, not what they point to.
+func diskUsage(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can vanish while the agent works
+			if path != root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
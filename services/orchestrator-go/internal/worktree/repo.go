@@ -0,0 +1,234 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/github"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/scm"
+	"github.com/rs/zerolog/log"
+)
+
+// reposDir holds one clone per project, which worktrees are added to
+const reposDir = ".repos"
+
+// SetProviders sets the SCM providers repositories are cloned from and
+// authenticated with. Without them repositories are cloned from GitHub
+// with git's own credential setup. It must be called before Start.
+func (m *Manager) SetProviders(providers *scm.Registry) {
+	m.providers = providers
+}
+
+// ensureRepo returns the path of the project's clone of repo, cloning it on
+// first use. A cached clone is fetched first, so new worktrees branch from
+// the remote's current state. Callers hold the project's repository lock.
+func (m *Manager) ensureRepo(ctx context.Context, projectID, repo string) (string, error) {
+	m.mu.RLock()
+	path, ok := m.repoCache[projectID]
+	m.mu.RUnlock()
+	if ok {
+		m.syncOrigin(ctx, projectID, repo, path)
+		if err := m.fetch(ctx, projectID, path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	path = filepath.Join(m.cfg.BasePath, reposDir, projectID)
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		// Left by an earlier run; its worktrees are gone
+		runGit(ctx, path, "worktree", "prune")
+		m.syncOrigin(ctx, projectID, repo, path)
+		if err := m.fetch(ctx, projectID, path); err != nil {
+			return "", err
+		}
+	} else {
+		if repo == "" {
+			return "", fmt.Errorf("no repository to clone for project: %s", projectID)
+		}
+		os.RemoveAll(path)
+		if err := m.clone(ctx, projectID, repo, path); err != nil {
+			return "", err
+		}
+	}
+
+	m.mu.Lock()
+	m.repoCache[projectID] = path
+	m.mu.Unlock()
+
+	log.Info().
+		Str("project_id", projectID).
+		Str("path", path).
+		Msg("Cached project repository")
+
+	return path, nil
+}
+
+// credsFor returns the credentials a project's repository is cloned,
+// fetched and pushed with: its deploy key, or its provider's credentials
+func (m *Manager) credsFor(projectID string) gitauth.Credentials {
+	if m.projects != nil {
+		if settings, _ := m.projects.Get(projectID); settings.DeployKey != "" {
+			return gitauth.DeployKey(settings.DeployKey)
+		}
+	}
+	if p := m.provider(projectID); p != nil {
+		return p.GitCredentials()
+	}
+	return nil
+}
+
+// provider returns the SCM provider hosting a project's repository, or nil
+// for GitHub without credentials
+func (m *Manager) provider(projectID string) scm.Provider {
+	if m.providers == nil {
+		return nil
+	}
+	return m.providers.ForProject(projectID)
+}
+
+// cloneURL returns the URL of a project's repository on its provider: SSH
+// for projects with a deploy key, HTTPS otherwise
+func (m *Manager) cloneURL(projectID, repo string) string {
+	deployKey := false
+	if m.projects != nil {
+		settings, _ := m.projects.Get(projectID)
+		deployKey = settings.DeployKey != ""
+	}
+	p := m.provider(projectID)
+	switch {
+	case p != nil && deployKey:
+		return p.SSHCloneURL(repo)
+	case p != nil:
+		return p.CloneURL(repo)
+	case deployKey:
+		return github.SSHCloneURL(repo)
+	default:
+		return github.CloneURL(repo)
+	}
+}
+
+// syncOrigin points a cached clone, and the project's template, at the URL
+// matching its credentials, as after a deploy key was added or removed
+func (m *Manager) syncOrigin(ctx context.Context, projectID, repo, path string) {
+	if repo == "" {
+		return
+	}
+	url := m.cloneURL(projectID, repo)
+	m.mu.RLock()
+	tplPath := m.templates[projectID]
+	m.mu.RUnlock()
+	for _, dir := range []string{path, tplPath} {
+		if dir == "" {
+			continue
+		}
+		if output, err := runGit(ctx, dir, "remote", "get-url", "origin"); err == nil && strings.TrimSpace(string(output)) != url {
+			runGit(ctx, dir, "remote", "set-url", "origin", url)
+		}
+	}
+}
+
+// clone clones repo into path without checking out files, which only
+// worktrees need
+func (m *Manager) clone(ctx context.Context, projectID, repo, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	output, err := gitauth.Run(ctx, "clone", m.credsFor(projectID), func(env []string) ([]byte, error) {
+		return runGitEnv(ctx, "", env, "clone", "--no-checkout", m.cloneURL(projectID, repo), path)
+	})
+	if err != nil {
+		os.RemoveAll(path)
+		if gitauth.IsAuth(err) {
+			return err
+		}
+		return fmt.Errorf("failed to clone %s: %s - %w", repo, string(output), err)
+	}
+	return nil
+}
+
+// fetch updates a cached clone's remote-tracking branches. Callers hold the
+// project's repository lock, as git fails to lock refs another fetch is
+// updating.
+func (m *Manager) fetch(ctx context.Context, projectID, path string) error {
+	output, err := gitauth.Run(ctx, "fetch", m.credsFor(projectID), func(env []string) ([]byte, error) {
+		return runGitEnv(ctx, path, env, "fetch", "--prune", "origin")
+	})
+	if err != nil {
+		if gitauth.IsAuth(err) {
+			return err
+		}
+		return fmt.Errorf("failed to fetch: %s - %w", string(output), err)
+	}
+	return nil
+}
+
+// RemoteBranchExists asks a project's remote whether it has branch, without
+// cloning or fetching the repository
+func (m *Manager) RemoteBranchExists(ctx context.Context, projectID, repo, branch string) (bool, error) {
+	ctx, cancel := m.gitContext(ctx)
+	defer cancel()
+	output, err := gitauth.Run(ctx, "ls-remote", m.credsFor(projectID), func(env []string) ([]byte, error) {
+		return runGitEnv(ctx, "", env, "ls-remote", "--heads", m.cloneURL(projectID, repo), "refs/heads/"+branch)
+	})
+	if err != nil {
+		if gitauth.IsAuth(err) {
+			return false, err
+		}
+		return false, fmt.Errorf("%w: %s - %w", ErrRepoUnavailable, strings.TrimSpace(string(output)), err)
+	}
+	return len(strings.TrimSpace(string(output))) > 0, nil
+}
+
+// refreshRepos fetches every cached clone. Fetches run without the manager
+// lock, so worktrees can be created meanwhile, and each is bounded by the
+// git timeout, as a hung one holds its project's repository lock.
+func (m *Manager) refreshRepos(ctx context.Context) {
+	m.mu.Lock()
+	paths := make(map[string]string, len(m.repoCache))
+	locks := make(map[string]*sync.Mutex, len(m.repoCache))
+	for projectID, path := range m.repoCache {
+		paths[projectID] = path
+		locks[projectID] = m.repoLock(projectID)
+	}
+	m.mu.Unlock()
+
+	for projectID, path := range paths {
+		fetchCtx, cancel := m.gitContext(ctx)
+		locks[projectID].Lock()
+		err := m.fetch(fetchCtx, projectID, path)
+		locks[projectID].Unlock()
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Str("project_id", projectID).Msg("Failed to refresh repository")
+		}
+	}
+}
+
+// startPoint returns the remote-tracking branch new branches start from:
+// the base branch, or the remote's default branch when there is none
+func startPoint(ctx context.Context, repoPath, baseBranch string) (string, error) {
+	if baseBranch != "" {
+		// Checked here, as git's own error for a missing start point
+		// ("invalid reference") does not say which branch is missing
+		cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+baseBranch)
+		cmd.Dir = repoPath
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrBaseBranchNotFound, baseBranch)
+		}
+		return "origin/" + baseBranch, nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the default branch: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
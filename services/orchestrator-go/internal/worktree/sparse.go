@@ -0,0 +1,53 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ValidateSparsePaths checks that sparse checkout paths are directories
+// relative to the repository root
+func ValidateSparsePaths(paths []string) error {
+	for _, p := range paths {
+		clean := path.Clean(p)
+		if p == "" || clean == "." || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "-") ||
+			clean == ".." || strings.HasPrefix(clean, "../") || strings.ContainsAny(p, "*?[\\") {
+			return fmt.Errorf("invalid sparse path %q: must be a directory relative to the repository root", p)
+		}
+	}
+	return nil
+}
+
+// sparsePaths returns the directories a project's worktrees check out, or
+// nil when they check out everything
+func (m *Manager) sparsePaths(projectID string) []string {
+	if m.projects == nil {
+		return nil
+	}
+	settings, _ := m.projects.Get(projectID)
+	return settings.SparsePaths
+}
+
+// applySparse limits a worktree's checkout to its project's sparse paths
+// and the files at the repository root. A worktree reused from the pool
+// after the project stopped using sparse paths gets a full checkout again.
+func (m *Manager) applySparse(ctx context.Context, projectID, path string) error {
+	paths := m.sparsePaths(projectID)
+	args := append([]string{"sparse-checkout", "set", "--cone"}, paths...)
+	if len(paths) == 0 {
+		if output, _ := runGit(ctx, path, "config", "--get", "core.sparseCheckout"); strings.TrimSpace(string(output)) != "true" {
+			return nil
+		}
+		args = []string{"sparse-checkout", "disable"}
+	}
+	if output, err := runGitEnv(ctx, path, noSmudge, args...); err != nil {
+		return fmt.Errorf("failed to set sparse checkout: %s - %w", string(output), err)
+	}
+	// Worktrees added without a checkout get their files now
+	if output, err := runGitEnv(ctx, path, noSmudge, "checkout"); err != nil {
+		return fmt.Errorf("failed to check out sparse paths: %s - %w", string(output), err)
+	}
+	return nil
+}
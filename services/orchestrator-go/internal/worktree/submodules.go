@@ -0,0 +1,58 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/gitauth"
+	"github.com/kevinreber/autobuild-orchestrator-go/internal/models"
+)
+
+// SettingsSource looks up project settings
+type SettingsSource interface {
+	Get(projectID string) (models.ProjectSettings, bool)
+}
+
+// SetProjects makes worktrees follow their project's checkout settings,
+// such as initializing submodules. It must be called before Start.
+func (m *Manager) SetProjects(projects SettingsSource) {
+	m.projects = projects
+}
+
+// sshToHTTPS rewrites GitHub SSH submodule URLs to HTTPS, so private
+// submodules authenticate with the same credentials as the repository
+var sshToHTTPS = []string{
+	"-c", "url.https://github.com/.insteadOf=git@github.com:",
+	"-c", "url.https://github.com/.insteadOf=ssh://git@github.com/",
+}
+
+// initSubmodules checks out the submodules of a new worktree, recursively,
+// when its project asks for them
+func (m *Manager) initSubmodules(ctx context.Context, projectID, path string) error {
+	if m.projects == nil {
+		return nil
+	}
+	if settings, _ := m.projects.Get(projectID); !settings.Submodules {
+		return nil
+	}
+
+	args := append(append([]string{}, sshToHTTPS...), "submodule", "update", "--init", "--recursive")
+	// Submodules are fetched from GitHub over HTTPS, whatever hosts the
+	// project itself
+	var creds gitauth.Credentials
+	if m.providers != nil {
+		if p, ok := m.providers.Get(models.SCMGitHub); ok {
+			creds = p.GitCredentials()
+		}
+	}
+	output, err := gitauth.Run(ctx, "submodule update", creds, func(env []string) ([]byte, error) {
+		return runGitEnv(ctx, path, env, args...)
+	})
+	if err != nil {
+		if gitauth.IsAuth(err) {
+			return err
+		}
+		return fmt.Errorf("failed to initialize submodules: %s - %w", string(output), err)
+	}
+	return nil
+}
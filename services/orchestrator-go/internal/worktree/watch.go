@@ -0,0 +1,159 @@
+package worktree
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// touchResolution limits how often file activity rewrites LastUsedAt, so a
+// burst of writes (a dependency install, a build) takes the lock only once
+const touchResolution = 5 * time.Second
+
+// skipWatchDirs are never watched: they are large, churn on their own, or
+// both, and would exhaust the inotify watch limit without saying anything
+// about whether someone is working in the worktree
+var skipWatchDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Start runs periodic cleanup and disk usage checks and, when activity
+// watching is enabled, applies file events to LastUsedAt until ctx is
+// cancelled
+func (m *Manager) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.cleanupInterval())
+	defer ticker.Stop()
+
+	var disk <-chan time.Time
+	if m.cfg.DiskCheckInterval > 0 {
+		diskTicker := time.NewTicker(m.cfg.DiskCheckInterval)
+		defer diskTicker.Stop()
+		disk = diskTicker.C
+	}
+
+	var fetch <-chan time.Time
+	if m.cfg.FetchInterval > 0 {
+		fetchTicker := time.NewTicker(m.cfg.FetchInterval)
+		defer fetchTicker.Stop()
+		fetch = fetchTicker.C
+	}
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if m.watcher != nil {
+		events, errs = m.watcher.Events, m.watcher.Errors
+		defer m.watcher.Close()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Cleanup()
+		case <-m.reloaded:
+			ticker.Reset(m.cleanupInterval())
+		case <-disk:
+			m.measureDisk()
+		case <-fetch:
+			m.refreshRepos(ctx)
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			m.handleEvent(event)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Warn().Err(err).Msg("Worktree watcher error")
+		}
+	}
+}
+
+// Touch marks a worktree as in use now
+func (m *Manager) Touch(wtID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if wt, ok := m.worktrees[wtID]; ok {
+		wt.LastUsedAt = time.Now()
+	}
+}
+
+// handleEvent refreshes the owning worktree's LastUsedAt and starts watching
+// directories created inside it, or forgets ones removed from it
+func (m *Manager) handleEvent(event fsnotify.Event) {
+	m.mu.RLock()
+	wtID, ok := m.watched[filepath.Dir(event.Name)]
+	wt := m.worktrees[wtID]
+	stale := ok && wt != nil && time.Since(wt.LastUsedAt) >= touchResolution
+	m.mu.RUnlock()
+	if !ok || wt == nil {
+		return
+	}
+
+	switch {
+	case event.Has(fsnotify.Create) && !skipWatchDirs[filepath.Base(event.Name)]:
+		m.mu.Lock()
+		m.watchTree(wtID, event.Name)
+		m.mu.Unlock()
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		// The kernel drops watches on removed directories by itself
+		m.mu.Lock()
+		delete(m.watched, event.Name)
+		m.mu.Unlock()
+	}
+
+	if stale {
+		m.Touch(wtID)
+	}
+}
+
+// watchTree adds watches for root and every directory beneath it. Callers
+// hold m.mu.
+func (m *Manager) watchTree(wtID, root string) {
+	if m.watcher == nil {
+		return
+	}
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root && skipWatchDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if _, ok := m.watched[path]; ok {
+			return nil
+		}
+		if err := m.watcher.Add(path); err != nil {
+			log.Warn().Err(err).Str("worktree_id", wtID).Str("path", path).Msg("Failed to watch worktree directory")
+			return filepath.SkipDir
+		}
+		m.watched[path] = wtID
+		return nil
+	})
+}
+
+// unwatch drops the watches held for a worktree. Callers hold m.mu.
+func (m *Manager) unwatch(wtID string) {
+	if m.watcher == nil {
+		return
+	}
+
+	for path, id := range m.watched {
+		if id == wtID {
+			m.watcher.Remove(path)
+			delete(m.watched, path)
+		}
+	}
+}